@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AdaptiveConcurrency defines adaptive limit of concurrent outgoing
+// requests, see WithAdaptiveConcurrency.
+type AdaptiveConcurrency struct {
+	// Min and Max bound the limit. It starts at Max.
+	Min int
+	Max int
+	// Latency is time after which fetch is considered slow.
+	// Zero means latency does not affect the limit.
+	Latency time.Duration
+}
+
+// adaptiveLimit adjusts number of scheduler's slots in AIMD manner:
+// the limit is halved once fetch signals congestion or is slow, and is
+// increased by one once number of successful fetches reaches the limit.
+type adaptiveLimit struct {
+	settings  AdaptiveConcurrency
+	scheduler *scheduler
+
+	mu    sync.Mutex
+	limit int
+	// successes is number of successful fetches since the limit changed.
+	successes int
+	// decreased is time the limit has been decreased at. Failures of
+	// fetches started before it do not decrease the limit again,
+	// so burst of failures halves it once.
+	decreased time.Time
+}
+
+// newAdaptiveLimit creates adaptiveLimit. Its scheduler
+// must be set before limit is adjusted.
+func newAdaptiveLimit(settings AdaptiveConcurrency) *adaptiveLimit {
+	if settings.Min < 1 {
+		settings.Min = 1
+	}
+	if settings.Max < settings.Min {
+		settings.Max = settings.Min
+	}
+
+	return &adaptiveLimit{
+		settings: settings,
+		limit:    settings.Max,
+	}
+}
+
+// current returns the current limit.
+func (a *adaptiveLimit) current() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.limit
+}
+
+// record adjusts the limit according to outcome of fetch started at start.
+func (a *adaptiveLimit) record(start, now time.Time, result *Result) {
+	congested := isCongestion(result)
+	if !congested && a.settings.Latency > 0 && now.Sub(start) > a.settings.Latency {
+		congested = true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	limit := a.limit
+
+	switch {
+	case congested:
+		if start.Before(a.decreased) {
+			return
+		}
+
+		a.decreased = now
+		limit /= 2
+		if limit < a.settings.Min {
+			limit = a.settings.Min
+		}
+	case limit < a.settings.Max:
+		a.successes++
+		if a.successes < limit {
+			return
+		}
+
+		limit++
+	}
+
+	a.successes = 0
+	if delta := limit - a.limit; delta != 0 {
+		a.limit = limit
+		a.scheduler.resize(delta)
+	}
+}
+
+// isCongestion reports whether result of fetch signals that upstream
+// is overloaded: fetch timed out or failed due to connection error,
+// or response status is 429 Too Many Requests or 5xx. Other failures,
+// e.g. of DNS, TLS or invalid URLs, and fetches canceled or skipped
+// by handler do not depend on load.
+func isCongestion(result *Result) bool {
+	if err := result.err; err != nil {
+		switch classifyError(err) {
+		case ErrorKindTimeout, ErrorKindConnection:
+			return true
+		}
+
+		return false
+	}
+
+	return result.Status == http.StatusTooManyRequests || result.Status >= http.StatusInternalServerError
+}
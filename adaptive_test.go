@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimit(t *testing.T) {
+	s := newScheduler(8)
+	a := newAdaptiveLimit(AdaptiveConcurrency{Min: 2, Max: 8, Latency: time.Second})
+	a.scheduler = s
+
+	start := time.Now()
+	failed := &Result{}
+	failed.setError(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+
+	a.record(start, start.Add(time.Millisecond), failed)
+	if limit := a.current(); limit != 4 {
+		t.Fatalf("expected limit halved to 4, got %d", limit)
+	}
+
+	// failures of fetches started before decrease are ignored
+	a.record(start, start.Add(2*time.Millisecond), &Result{Status: http.StatusServiceUnavailable})
+	if limit := a.current(); limit != 4 {
+		t.Fatalf("expected limit 4, got %d", limit)
+	}
+
+	// slow fetch decreases limit, but not below minimum
+	later := start.Add(time.Second)
+	a.record(later, later.Add(2*time.Second), &Result{Status: http.StatusOK})
+	later = later.Add(3 * time.Second)
+	a.record(later, later.Add(time.Millisecond), failed)
+	if limit := a.current(); limit != 2 {
+		t.Fatalf("expected limit 2, got %d", limit)
+	}
+
+	for i := 0; i < 2; i++ {
+		a.record(later, later.Add(time.Millisecond), &Result{Status: http.StatusOK})
+	}
+	if limit := a.current(); limit != 3 {
+		t.Errorf("expected limit increased to 3, got %d", limit)
+	}
+
+	if s.free != 3 {
+		t.Errorf("expected 3 free slots, got %d", s.free)
+	}
+}
+
+func TestIsCongestion(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		status    int
+		congested bool
+	}{
+		{"ok", nil, http.StatusOK, false},
+		{"not found", nil, http.StatusNotFound, false},
+		{"too many requests", nil, http.StatusTooManyRequests, true},
+		{"unavailable", nil, http.StatusServiceUnavailable, true},
+		{"timeout", context.DeadlineExceeded, 0, true},
+		{"connection", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, 0, true},
+		{"dns", &net.DNSError{Err: "no such host", Name: "example.invalid"}, 0, false},
+		{"tls", x509.UnknownAuthorityError{}, 0, false},
+		{"invalid URL", &url.Error{Op: "parse", URL: "http://[::1", Err: errors.New("missing ']' in host")}, 0, false},
+		{"canceled", context.Canceled, 0, false},
+		{"budget", errBudgetExceeded, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := &Result{Status: test.status}
+			if test.err != nil {
+				result.setError(test.err)
+			}
+
+			if congested := isCongestion(result); congested != test.congested {
+				t.Errorf("expected congestion %t, got %t", test.congested, congested)
+			}
+		})
+	}
+}
+
+func TestSchedulerResize(t *testing.T) {
+	s := newScheduler(1)
+
+	if err := s.acquire(context.Background(), priorityNormal, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- s.acquire(context.Background(), priorityNormal, "")
+	}()
+
+	// waiter gets added slot
+	time.Sleep(10 * time.Millisecond)
+	s.resize(1)
+
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+
+	// released slots are dropped until shrunk limit is reached
+	s.resize(-1)
+	s.release()
+	if s.free != 0 {
+		t.Errorf("expected no free slots, got %d", s.free)
+	}
+
+	s.release()
+	if s.free != 1 {
+		t.Errorf("expected 1 free slot, got %d", s.free)
+	}
+}
+
+func TestHandlerAdaptiveConcurrency(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	h := NewHandler(
+		WithAdaptiveConcurrency(AdaptiveConcurrency{Min: 1, Max: 16}),
+		WithSynchronousFetching(),
+	)
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	urls := strings.Repeat(upstream.URL+"\n", 3)
+	if results := fetchResults(t, s.URL, strings.NewReader(urls)); len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+
+	// each failed fetch started after previous decrease
+	if limit := h.LoadStats().MaxFetches; limit != 2 {
+		t.Errorf("expected limit 2, got %d", limit)
+	}
+}
@@ -0,0 +1,472 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchInfo describes running batch listed by admin endpoint.
+type BatchInfo struct {
+	ID     uint64    `json:"id"`
+	Client string    `json:"client"`
+	Tenant string    `json:"tenant,omitempty"`
+	Start  time.Time `json:"start"`
+	// Done is number of URLs fetched so far.
+	Done int64 `json:"done"`
+	// Total is number of URLs in batch. For chunked input,
+	// it is number of URLs read so far.
+	Total int64 `json:"total"`
+}
+
+// batchRegistry keeps running batches, so they can be listed and canceled.
+type batchRegistry struct {
+	mu      sync.Mutex
+	lastID  uint64
+	batches map[uint64]*batch
+}
+
+// newBatchRegistry creates new batchRegistry.
+func newBatchRegistry() *batchRegistry {
+	return &batchRegistry{
+		batches: make(map[uint64]*batch),
+	}
+}
+
+// add registers running batch and assigns ID to it.
+func (r *batchRegistry) add(b *batch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	b.id = r.lastID
+	r.batches[b.id] = b
+}
+
+// remove unregisters completed batch.
+func (r *batchRegistry) remove(b *batch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.batches, b.id)
+}
+
+// list returns running batches ordered by ID.
+func (r *batchRegistry) list() []BatchInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	infos := make([]BatchInfo, 0, len(r.batches))
+	for _, b := range r.batches {
+		infos = append(infos, BatchInfo{
+			ID:     b.id,
+			Client: b.client,
+			Tenant: b.tenant,
+			Start:  b.start,
+			Done:   atomic.LoadInt64(&b.done),
+			Total:  atomic.LoadInt64(&b.total),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+
+	return infos
+}
+
+// cancel cancels remaining fetches of batch
+// and reports whether batch is found.
+func (r *batchRegistry) cancel(id uint64) bool {
+	r.mu.Lock()
+	b, ok := r.batches[id]
+	r.mu.Unlock()
+
+	if ok {
+		b.logger.Printf("batch %d is canceled by operator", id)
+		b.stop()
+	}
+
+	return ok
+}
+
+// serveAdmin serves admin endpoint mounted by WithAdmin option:
+//
+//	GET <prefix>/batches              lists running batches
+//	DELETE <prefix>/batches/<id>      cancels remaining fetches of batch
+//	GET <prefix>/schedules            lists scheduled batches
+//	POST <prefix>/schedules           schedules batch, see scheduleRequest
+//	GET <prefix>/schedules/<name>     returns the latest run of scheduled batch
+//	DELETE <prefix>/schedules/<name>  unschedules batch
+//	GET <prefix>/schedules/<name>/results
+//	                                  returns page of results of the current run
+//	GET <prefix>/schedules/<name>/runs
+//	                                  lists IDs of stored runs of scheduled batch
+//	GET <prefix>/runs/<id>            returns stored run, see JobStore
+//	POST <prefix>/prefetch            prefetches URLs, see prefetchRequest
+//
+// Requests are authenticated by admin authenticator, see WithAdmin.
+func (h *Handler) serveAdmin(writer http.ResponseWriter, request *http.Request) {
+	if err := h.adminAuth.Authenticate(request); err != nil {
+		h.logger.Printf("%s: admin authentication failed: %s", h.clientIP(request), err)
+
+		writer.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	path := strings.TrimPrefix(request.URL.Path, h.adminPrefix)
+
+	switch {
+	case path == "/batches":
+		if request.Method != http.MethodGet {
+			writer.Header().Set("Allow", http.MethodGet)
+			http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(writer).Encode(h.running.list()); err != nil {
+			h.logger.Println(err)
+		}
+	case strings.HasPrefix(path, "/batches/"):
+		if request.Method != http.MethodDelete {
+			writer.Header().Set("Allow", http.MethodDelete)
+			http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		id, err := strconv.ParseUint(strings.TrimPrefix(path, "/batches/"), 10, 64)
+		if err != nil || !h.running.cancel(id) {
+			http.NotFound(writer, request)
+
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	case path == "/schedules":
+		h.serveSchedules(writer, request)
+	case strings.HasPrefix(path, "/schedules/") && strings.HasSuffix(path, "/runs"):
+		h.serveRuns(writer, request, strings.TrimSuffix(strings.TrimPrefix(path, "/schedules/"), "/runs"))
+	case strings.HasPrefix(path, "/runs/"):
+		h.serveRun(writer, request, strings.TrimPrefix(path, "/runs/"))
+	case strings.HasPrefix(path, "/schedules/") && strings.HasSuffix(path, "/results"):
+		h.serveScheduleResults(writer, request, strings.TrimSuffix(strings.TrimPrefix(path, "/schedules/"), "/results"))
+	case strings.HasPrefix(path, "/schedules/"):
+		h.serveSchedule(writer, request, strings.TrimPrefix(path, "/schedules/"))
+	case path == "/prefetch":
+		h.servePrefetch(writer, request)
+	default:
+		http.NotFound(writer, request)
+	}
+}
+
+// scheduleRequest is JSON body of request scheduling batch.
+type scheduleRequest struct {
+	Name string   `json:"name"`
+	URLs []string `json:"urls"`
+	// Interval is duration, e.g. "5m".
+	Interval string `json:"interval"`
+}
+
+// serveSchedules lists scheduled batches or schedules new one.
+func (h *Handler) serveSchedules(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		writer.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(writer).Encode(h.schedules.list()); err != nil {
+			h.logger.Println(err)
+		}
+	case http.MethodPost:
+		var body scheduleRequest
+		if err := json.NewDecoder(io.LimitReader(request.Body, h.maxBodySize)).Decode(&body); err != nil {
+			http.Error(writer, fmt.Sprintf("invalid JSON body: %s", err), http.StatusBadRequest)
+
+			return
+		}
+
+		interval, err := time.ParseDuration(body.Interval)
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("invalid interval: %s", err), http.StatusBadRequest)
+
+			return
+		}
+
+		if len(body.URLs) > maxAdminScheduleURLs {
+			http.Error(writer, errScheduleTooLarge.Error(), http.StatusRequestEntityTooLarge)
+
+			return
+		}
+
+		switch err := h.schedule(Schedule{Name: body.Name, URLs: body.URLs, Interval: interval}, maxAdminSchedules); err {
+		case nil:
+		case ErrHandlerClosed:
+			http.Error(writer, err.Error(), http.StatusServiceUnavailable)
+
+			return
+		case errTooManySchedules:
+			http.Error(writer, err.Error(), http.StatusConflict)
+
+			return
+		default:
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		writer.WriteHeader(http.StatusCreated)
+	default:
+		writer.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// serveSchedule returns the latest run of scheduled batch, or unschedules it.
+// If batch has not completed any run yet, 204 No Content is returned.
+func (h *Handler) serveSchedule(writer http.ResponseWriter, request *http.Request, name string) {
+	switch request.Method {
+	case http.MethodGet:
+		if _, ok := h.schedules.get(name); !ok {
+			http.NotFound(writer, request)
+
+			return
+		}
+
+		run, ok := h.LatestRun(name)
+		if !ok {
+			writer.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(writer).Encode(run); err != nil {
+			h.logger.Println(err)
+		}
+	case http.MethodDelete:
+		if !h.Unschedule(name) {
+			http.NotFound(writer, request)
+
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		writer.Header().Set("Allow", http.MethodGet+", "+http.MethodDelete)
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// serveRuns lists IDs of stored runs of scheduled batch,
+// from the newest to the oldest.
+func (h *Handler) serveRuns(writer http.ResponseWriter, request *http.Request, name string) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	ids, err := h.jobStore.Runs(request.Context(), name)
+	if err != nil {
+		h.logger.Printf("schedule %s: listing runs: %s", name, err)
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(ids); err != nil {
+		h.logger.Println(err)
+	}
+}
+
+// serveRun returns stored run of scheduled batch.
+func (h *Handler) serveRun(writer http.ResponseWriter, request *http.Request, id string) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	run, err := h.jobStore.Run(request.Context(), id)
+	switch {
+	case errors.Is(err, ErrRunNotFound):
+		http.NotFound(writer, request)
+
+		return
+	case err != nil:
+		h.logger.Printf("run %s: %s", id, err)
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(run); err != nil {
+		h.logger.Println(err)
+	}
+}
+
+// Parameters of pages of scheduled batches' results.
+const (
+	// defaultResultPageLimit is number of results
+	// of page unless limit parameter is provided.
+	defaultResultPageLimit = 100
+	// maxResultPageLimit is maximum number of results of page.
+	maxResultPageLimit = 10000
+	// defaultLongPollTimeout is time request waits for results
+	// unless timeout parameter is provided.
+	defaultLongPollTimeout = 30 * time.Second
+	// maxLongPollTimeout is maximum time request waits for results.
+	maxLongPollTimeout = 5 * time.Minute
+)
+
+// serveScheduleResults returns page of results of the running run of
+// scheduled batch, or of the latest completed one, see ResultPage.
+// Query parameters are offset of page, its limit, and wait, which makes
+// request wait until at least wait results following offset are available,
+// run is completed, or timeout parameter expires. If batch has not run yet,
+// 204 No Content is returned.
+func (h *Handler) serveScheduleResults(writer http.ResponseWriter, request *http.Request, name string) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	e, ok := h.schedules.get(name)
+	if !ok {
+		http.NotFound(writer, request)
+
+		return
+	}
+
+	query := request.URL.Query()
+
+	var (
+		params  = []int{0, defaultResultPageLimit, 0}
+		timeout = defaultLongPollTimeout
+	)
+	for i, key := range []string{"offset", "limit", "wait"} {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || key == "limit" && n > maxResultPageLimit {
+			http.Error(writer, fmt.Sprintf("invalid %s parameter", key), http.StatusBadRequest)
+
+			return
+		}
+		params[i] = n
+	}
+	if value := query.Get("timeout"); value != "" {
+		t, err := parseTimeout(value)
+		if err != nil || t < 0 {
+			http.Error(writer, "invalid timeout parameter", http.StatusBadRequest)
+
+			return
+		}
+		timeout = t
+	}
+	if timeout > maxLongPollTimeout {
+		timeout = maxLongPollTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), timeout)
+	defer cancel()
+
+	page, ok := e.page(ctx, params[0], params[1], params[2])
+	if !ok {
+		writer.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(page); err != nil {
+		h.logger.Println(err)
+	}
+}
+
+// prefetchRequest is JSON body of request prefetching URLs.
+type prefetchRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// servePrefetch prefetches URLs and responds with 204 No Content
+// once they are fetched. Number of failed URLs is reported
+// in X-Failed-Count header. Prefetch is admitted by Limiter and
+// weighted admission, if any, as incoming requests are.
+func (h *Handler) servePrefetch(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var body prefetchRequest
+	if err := json.NewDecoder(io.LimitReader(request.Body, h.maxBodySize)).Decode(&body); err != nil {
+		http.Error(writer, fmt.Sprintf("invalid JSON body: %s", err), http.StatusBadRequest)
+
+		return
+	}
+
+	if len(body.URLs) > maxAdminPrefetchURLs {
+		http.Error(writer, errPrefetchTooLarge.Error(), http.StatusRequestEntityTooLarge)
+
+		return
+	}
+
+	if err := h.limiter.Acquire(request.Context()); err != nil {
+		http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+		return
+	}
+	atomic.AddInt64(&h.inFlight, 1)
+	defer h.release()
+
+	if h.weighted != nil {
+		var cost batchCost
+
+		if err := h.weighted.take(&cost, len(body.URLs)); err != nil {
+			admissionError(writer, h.logger, err)
+
+			return
+		}
+		defer h.weighted.put(&cost)
+	}
+
+	failed, err := h.Prefetch(request.Context(), body.URLs)
+	if err != nil {
+		h.logger.Printf("%s: prefetch: %s", h.clientIP(request), err)
+
+		return
+	}
+
+	writer.Header().Set(failedCountHeader, strconv.Itoa(failed))
+	writer.WriteHeader(http.StatusNoContent)
+}
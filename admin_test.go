@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// allowAdmin authenticates every admin request.
+var allowAdmin = AuthenticatorFunc(func(request *http.Request) error {
+	return nil
+})
+
+func listBatches(t *testing.T, url string) []BatchInfo {
+	resp, err := http.Get(url + "/admin/batches")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var batches []BatchInfo
+	if err := json.NewDecoder(resp.Body).Decode(&batches); err != nil {
+		t.Fatal(err)
+	}
+
+	return batches
+}
+
+func cancelBatch(t *testing.T, url string, id string) int {
+	req, err := http.NewRequest(http.MethodDelete, url+"/admin/batches/"+id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestHandlerAdmin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithAdmin("/admin/", allowAdmin)))
+	defer s.Close()
+
+	if batches := listBatches(t, s.URL); len(batches) != 0 {
+		t.Fatalf("expected no batches, got %+v", batches)
+	}
+
+	done := make(chan []Result)
+	go func() {
+		done <- fetchResults(t, s.URL, strings.NewReader(server.URL+"/fast\n"+server.URL+"/slow"))
+	}()
+
+	var batches []BatchInfo
+
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		batches = listBatches(t, s.URL)
+		if len(batches) == 1 && batches[0].Done == 1 {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if len(batches) != 1 {
+		t.Fatalf("expected 1 batch, got %+v", batches)
+	}
+	if b := batches[0]; b.ID != 1 || b.Client != "127.0.0.1" || b.Done != 1 || b.Total != 2 || b.Start.IsZero() {
+		t.Errorf("unexpected batch %+v", b)
+	}
+
+	if status := cancelBatch(t, s.URL, "2"); status != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown batch, got %d", status)
+	}
+	if status := cancelBatch(t, s.URL, "1"); status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+
+	select {
+	case results := <-done:
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results, got %d", len(results))
+		}
+
+		failed := 0
+		for _, r := range results {
+			if r.Error != "" {
+				failed++
+			}
+		}
+		if failed != 1 {
+			t.Errorf("expected 1 failed result, got %+v", results)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("batch is not canceled")
+	}
+
+	if batches := listBatches(t, s.URL); len(batches) != 0 {
+		t.Errorf("expected no batches, got %+v", batches)
+	}
+}
+
+func TestHandlerAdminAuth(t *testing.T) {
+	h := NewHandler(
+		WithAuth(BearerTokens("client")),
+		WithAdmin("/admin", BearerTokens("admin")),
+	)
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	for token, status := range map[string]int{
+		"":       http.StatusUnauthorized,
+		"client": http.StatusUnauthorized,
+		"admin":  http.StatusOK,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, s.URL+"/admin/batches", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Errorf("token %q: expected status %d, got %d", token, status, resp.StatusCode)
+		}
+	}
+
+	for _, opt := range []Option{WithAdmin("/", allowAdmin), WithAdmin("/admin", nil)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic of invalid admin endpoint")
+				}
+			}()
+
+			NewHandler(opt)
+		}()
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// Analyzer analyzes fetched documents. Its output is serialized
+// into detailed results under the name analyzer is registered with.
+// Analyze is called concurrently for different documents and
+// receives body while it is being read, so it must not retain it.
+type Analyzer interface {
+	Analyze(url string, header http.Header, body io.Reader) (interface{}, error)
+}
+
+// AnalyzerFunc is an adapter to allow the use of
+// ordinary functions as Analyzer.
+type AnalyzerFunc func(url string, header http.Header, body io.Reader) (interface{}, error)
+
+// Analyze calls f(url, header, body).
+func (f AnalyzerFunc) Analyze(url string, header http.Header, body io.Reader) (interface{}, error) {
+	return f(url, header, body)
+}
+
+// namedAnalyzer binds Analyzer to its name.
+type namedAnalyzer struct {
+	name     string
+	analyzer Analyzer
+}
+
+// Analyses maps analyzers' names to their output.
+type Analyses map[string]interface{}
+
+// MarshalXML encodes analyses as elements with name attribute
+// containing JSON encoded output of analyzer:
+//
+//	<analysis name="title">"Example Domain"</analysis>
+func (a Analyses) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := json.Marshal(a[name])
+		if err != nil {
+			return err
+		}
+
+		el := xml.StartElement{
+			Name: start.Name,
+			Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}},
+		}
+		if err := e.EncodeElement(string(data), el); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// analysis runs analyzer on document written to it.
+type analysis struct {
+	*streamConsumer
+
+	name   string
+	output interface{}
+	err    error
+}
+
+// newAnalysis starts analyzer on document fetched from url.
+// Analyzer's panic is converted to error by recovered.
+func newAnalysis(a namedAnalyzer, url string, header http.Header, recovered func(value interface{}) error) *analysis {
+	an := &analysis{
+		name: a.name,
+	}
+
+	an.streamConsumer = newStreamConsumer(func(r io.Reader) {
+		defer func() {
+			if value := recover(); value != nil {
+				an.output, an.err = nil, recovered(value)
+			}
+		}()
+
+		an.output, an.err = a.analyzer.Analyze(url, header, r)
+	})
+
+	return an
+}
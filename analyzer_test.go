@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerAnalyzer(t *testing.T) {
+	server := createServer(0)
+
+	spaces := AnalyzerFunc(func(url string, header http.Header, body io.Reader) (interface{}, error) {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.Count(data, []byte{' '}), nil
+	})
+	failing := AnalyzerFunc(func(url string, header http.Header, body io.Reader) (interface{}, error) {
+		return nil, errors.New("analysis failed")
+	})
+
+	s := httptest.NewServer(NewHandler(WithAnalyzer("spaces", spaces), WithAnalyzer("failing", failing)))
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, getRequestBodyBuffer(getUrl(server.URL, 100000, 0)))
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %+v", results)
+	}
+
+	r := results[0]
+	if r.Length != 100000 || r.Analysis["spaces"] != float64(100000) {
+		t.Errorf("unexpected analysis: %+v", r)
+	}
+	if r.AnalysisErrors["failing"] != "analysis failed" {
+		t.Errorf("unexpected analysis errors: %+v", r.AnalysisErrors)
+	}
+}
+
+func TestAnalysesMarshalXML(t *testing.T) {
+	data, err := xml.Marshal(struct {
+		XMLName  xml.Name `xml:"result"`
+		Analysis Analyses `xml:"analysis"`
+	}{
+		Analysis: Analyses{"title": "Example", "count": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<result><analysis name="count">2</analysis><analysis name="title">&#34;Example&#34;</analysis></result>`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
@@ -0,0 +1,296 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// archiveHeader is request header which makes fetched documents
+// streamed back as archive of provided format, see WithArchive.
+const archiveHeader = "X-Archive"
+
+// Supported archive formats.
+const (
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+)
+
+// archiveManifest is name of archive's entry describing its documents.
+const archiveManifest = "index.json"
+
+// archiveMemoryDocuments is number of documents of maximum size which may
+// be held in memory by archive request until they are written to archive.
+const archiveMemoryDocuments = 8
+
+// Errors of archive requests.
+var (
+	// errArchiveDisabled is returned for archive requests
+	// unless WithArchive option is provided.
+	errArchiveDisabled = errors.New("archive is not enabled")
+	// errArchiveLimit is error of documents exceeding archive limit.
+	errArchiveLimit = errors.New("document exceeds archive limit")
+	// errArchiveMemory is error of documents which can not be held
+	// since documents waiting to be written take all memory of request.
+	errArchiveMemory = errors.New("documents exceed archive memory limit")
+)
+
+// setArchive sets archive format of batch if header is set.
+func (b *batch) setArchive(h *Handler, header http.Header) error {
+	format := strings.ToLower(header.Get(archiveHeader))
+
+	switch format {
+	case "":
+		return nil
+	case archiveZip, archiveTarGz, "tgz":
+	default:
+		return fmt.Errorf("unknown archive format %q", format)
+	}
+
+	if h.archiveLimit <= 0 {
+		return errArchiveDisabled
+	}
+
+	if format == "tgz" {
+		format = archiveTarGz
+	}
+	b.archive = format
+	b.archiveLeft = int64(h.archiveLimit) * archiveMemoryDocuments
+
+	return nil
+}
+
+// archiveBuffer holds document until it is written to archive. Held bytes
+// are taken from archive memory of batch, so documents fetched, or kept
+// in order, faster than they are written take limited memory together.
+// Document exceeding archive limit or memory is not held.
+type archiveBuffer struct {
+	b     *batch
+	limit int
+	buf   []byte
+	// err is reason document is not held, if any.
+	err  error
+	once sync.Once
+}
+
+// newArchiveBuffer creates new archiveBuffer holding up to limit bytes.
+func newArchiveBuffer(b *batch, limit int) *archiveBuffer {
+	return &archiveBuffer{
+		b:     b,
+		limit: limit,
+	}
+}
+
+// Write implements io.Writer interface.
+func (w *archiveBuffer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return len(p), nil
+	}
+
+	switch {
+	case len(w.buf)+len(p) > w.limit:
+		w.err = errArchiveLimit
+	case atomic.AddInt64(&w.b.archiveLeft, -int64(len(p))) < 0:
+		atomic.AddInt64(&w.b.archiveLeft, int64(len(p)))
+		w.err = errArchiveMemory
+	default:
+		w.buf = append(w.buf, p...)
+
+		return len(p), nil
+	}
+
+	w.release()
+
+	return len(p), nil
+}
+
+// release returns held bytes to archive memory of batch. Results fanned
+// out share buffer, so bytes are returned only once.
+func (w *archiveBuffer) release() {
+	if w == nil {
+		return
+	}
+
+	w.once.Do(func() {
+		atomic.AddInt64(&w.b.archiveLeft, int64(len(w.buf)))
+		w.buf = nil
+	})
+}
+
+// ArchiveEntry describes single document in manifest of archive.
+type ArchiveEntry struct {
+	URL         string `json:"url"`
+	File        string `json:"file,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	Length      int    `json:"length"`
+	ContentType string `json:"content_type,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// archiveWriter writes entries of archive.
+type archiveWriter interface {
+	add(name string, body []byte, modified time.Time) error
+	Close() error
+}
+
+// zipWriter writes ZIP archive.
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func (a *zipWriter) add(name string, body []byte, modified time.Time) error {
+	w, err := a.w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(body)
+
+	return err
+}
+
+func (a *zipWriter) Close() error {
+	return a.w.Close()
+}
+
+// tarGzWriter writes gzipped tar archive.
+type tarGzWriter struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarGzWriter) add(name string, body []byte, modified time.Time) error {
+	if err := a.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(body)),
+		ModTime: modified,
+	}); err != nil {
+		return err
+	}
+
+	_, err := a.tw.Write(body)
+
+	return err
+}
+
+func (a *tarGzWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+
+	return a.gw.Close()
+}
+
+// newArchiveWriter creates archiveWriter of format writing to w.
+func newArchiveWriter(format string, w io.Writer) archiveWriter {
+	if format == archiveTarGz {
+		gw := gzip.NewWriter(w)
+
+		return &tarGzWriter{
+			gw: gw,
+			tw: tar.NewWriter(gw),
+		}
+	}
+
+	return &zipWriter{
+		w: zip.NewWriter(w),
+	}
+}
+
+// archiveName returns name of archive's entry of document at URL.
+func archiveName(url string) string {
+	sum := sha256.Sum256([]byte(url))
+
+	return hex.EncodeToString(sum[:16])
+}
+
+// serveArchive streams documents of batch's URLs as archive. Documents
+// are named by hashes of their URLs, and manifest listing them along
+// with failed URLs is written at the end of archive. Documents exceeding
+// archive limit, or archive memory of batch, are listed in manifest
+// but not included.
+func (h *Handler) serveArchive(writer http.ResponseWriter, b *batch, results <-chan *Result) {
+	contentType, filename := "application/zip", "documents.zip"
+	if b.archive == archiveTarGz {
+		contentType, filename = "application/gzip", "documents.tar.gz"
+	}
+
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	writer.WriteHeader(http.StatusOK)
+
+	a := newArchiveWriter(b.archive, writer)
+
+	var (
+		manifest = []ArchiveEntry{}
+		added    = make(map[string]bool)
+	)
+
+	for result := range results {
+		// chunked input sends nil after each chunk
+		if result == nil {
+			continue
+		}
+
+		entry := ArchiveEntry{
+			URL:         result.URL,
+			Status:      result.Status,
+			Length:      result.Length,
+			ContentType: result.ContentType,
+			Error:       result.Error,
+		}
+
+		var body []byte
+		if result.body != nil {
+			body = result.body.buf
+		}
+
+		switch {
+		case result.err != nil:
+		case result.body != nil && result.body.err != nil:
+			entry.Error = result.body.err.Error()
+		default:
+			entry.File = archiveName(result.URL)
+			if added[entry.File] {
+				break
+			}
+			added[entry.File] = true
+
+			if err := a.add(entry.File, body, h.now()); err != nil {
+				b.logger.Printf("%s: writing archive: %s", b.client, err)
+
+				return
+			}
+		}
+
+		result.body.release()
+		manifest = append(manifest, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		err = a.add(archiveManifest, data, h.now())
+	}
+	if err == nil {
+		err = a.Close()
+	}
+	if err != nil {
+		b.logger.Printf("%s: writing archive: %s", b.client, err)
+	}
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readArchive returns entries of archive of format.
+func readArchive(t *testing.T, format string, data []byte) map[string][]byte {
+	entries := make(map[string][]byte)
+
+	if format == archiveZip {
+		r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, f := range r.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries[f.Name], _ = ioutil.ReadAll(rc)
+			rc.Close()
+		}
+
+		return entries
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries[hdr.Name], _ = ioutil.ReadAll(tr)
+	}
+}
+
+func TestHandlerArchive(t *testing.T) {
+	target := createServer(0)
+	defer target.Close()
+
+	s := httptest.NewServer(NewHandler(WithArchive(100)))
+	defer s.Close()
+
+	small := getUrl(target.URL, 10, 0)
+	large := getUrl(target.URL, 200, 0)
+	unreachable := "http://127.0.0.1:1"
+
+	for _, format := range []string{archiveZip, archiveTarGz} {
+		t.Run(format, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(strings.Join([]string{small, large, unreachable}, "\n")))
+			req.Header.Set(archiveHeader, format)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			data, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, data)
+			}
+
+			entries := readArchive(t, format, data)
+
+			var manifest []ArchiveEntry
+			if err := json.Unmarshal(entries[archiveManifest], &manifest); err != nil {
+				t.Fatal(err)
+			}
+			if len(manifest) != 3 {
+				t.Fatalf("expected 3 entries in manifest, got %+v", manifest)
+			}
+
+			for _, entry := range manifest {
+				switch entry.URL {
+				case small:
+					if body, ok := entries[entry.File]; !ok || len(body) != 10 {
+						t.Errorf("document of %+v is not archived", entry)
+					}
+				case large, unreachable:
+					if entry.File != "" || entry.Error == "" {
+						t.Errorf("expected failed entry, got %+v", entry)
+					}
+				}
+			}
+
+			if len(entries) != 2 {
+				t.Errorf("expected document and manifest archived, got %d entries", len(entries))
+			}
+		})
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(small))
+	req.Header.Set(archiveHeader, "rar")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerArchiveChunkedInput(t *testing.T) {
+	target := createServer(0)
+	defer target.Close()
+
+	s := httptest.NewServer(NewHandler(WithChunkedInput(2), WithArchive(1000)))
+	defer s.Close()
+
+	urls := []string{getUrl(target.URL, 10, 0), getUrl(target.URL, 20, 0), getUrl(target.URL, 30, 0)}
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+	req.Header.Set(archiveHeader, archiveZip)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, data)
+	}
+
+	entries := readArchive(t, archiveZip, data)
+
+	var manifest []ArchiveEntry
+	if err := json.Unmarshal(entries[archiveManifest], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != 3 || len(entries) != 4 {
+		t.Errorf("expected 3 documents and manifest, got %d entries and manifest %+v", len(entries), manifest)
+	}
+}
+
+func TestArchiveBufferMemory(t *testing.T) {
+	b := &batch{archiveLeft: 100}
+
+	first := newArchiveBuffer(b, 80)
+	first.Write([]byte(strings.Repeat("x", 60)))
+
+	second := newArchiveBuffer(b, 80)
+	second.Write([]byte(strings.Repeat("x", 30)))
+	second.Write([]byte(strings.Repeat("x", 30)))
+
+	if first.err != nil || len(first.buf) != 60 {
+		t.Errorf("expected the first document held, got %d bytes and error %v", len(first.buf), first.err)
+	}
+	if second.err != errArchiveMemory || second.buf != nil {
+		t.Errorf("expected the second document not held, got %d bytes and error %v", len(second.buf), second.err)
+	}
+	if b.archiveLeft != 40 {
+		t.Errorf("expected 40 bytes left, got %d", b.archiveLeft)
+	}
+
+	// fanned out results share buffer
+	first.release()
+	first.release()
+
+	third := newArchiveBuffer(b, 80)
+	third.Write([]byte(strings.Repeat("x", 90)))
+
+	if third.err != errArchiveLimit {
+		t.Errorf("expected error of archive limit, got %v", third.err)
+	}
+	if b.archiveLeft != 100 {
+		t.Errorf("expected 100 bytes left, got %d", b.archiveLeft)
+	}
+}
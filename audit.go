@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes single outgoing fetch.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Client is IP address of client made incoming request.
+	Client string `json:"client"`
+	// Tenant is name of client's tenant, see WithTenants.
+	Tenant string `json:"tenant,omitempty"`
+	URL    string `json:"url"`
+	Method string `json:"method,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Bytes  int    `json:"bytes"`
+	Error  string `json:"error,omitempty"`
+	// ErrorKind is class of failure, or ErrorKindStatus
+	// for non-2xx responses.
+	ErrorKind ErrorKind `json:"error_kind,omitempty"`
+}
+
+// AuditSink records outgoing fetches. Record is called
+// concurrently, once for every fetched URL.
+type AuditSink interface {
+	Record(record AuditRecord) error
+}
+
+// AuditSinkFunc is function implementing AuditSink interface.
+type AuditSinkFunc func(record AuditRecord) error
+
+// Record implements AuditSink interface.
+func (f AuditSinkFunc) Record(record AuditRecord) error {
+	return f(record)
+}
+
+// jsonAuditSink writes records to writer as JSON lines.
+type jsonAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// JSONAuditSink returns AuditSink writing records to w as JSON lines,
+// e.g. to os.Stdout.
+func JSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{
+		w: w,
+	}
+}
+
+// FileAuditSink returns AuditSink appending records to file as JSON lines.
+// File is created if it does not exist. Returned sink implements io.Closer
+// interface, which closes file.
+func FileAuditSink(path string) (AuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonAuditSink{
+		w: f,
+	}, nil
+}
+
+// Record implements AuditSink interface.
+func (s *jsonAuditSink) Record(record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(data, '\n'))
+
+	return err
+}
+
+// Close closes underlying writer if it implements io.Closer interface.
+func (s *jsonAuditSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// Parameters of HTTP audit sink.
+const (
+	// auditQueueSize is number of records queued to be posted.
+	auditQueueSize = 1024
+	// auditTimeout limits time of posting single record.
+	auditTimeout = time.Second * 10
+)
+
+// Errors of HTTP audit sink.
+var (
+	// errAuditQueueFull is returned if record is dropped,
+	// since endpoint does not keep up with fetches.
+	errAuditQueueFull = errors.New("audit queue is full, record is dropped")
+	// errAuditSinkClosed is returned for records made after sink is closed.
+	errAuditSinkClosed = errors.New("audit sink is closed")
+)
+
+// httpAuditSink posts records to HTTP endpoint
+// from queue, so fetches do not wait for it.
+type httpAuditSink struct {
+	url    string
+	client *http.Client
+
+	mu sync.RWMutex
+	// logger logs failures of posting records, it is set by NewHandler.
+	logger *log.Logger
+	closed bool
+	queue  chan AuditRecord
+	done   chan struct{}
+}
+
+// HTTPAuditSink returns AuditSink posting every record to url as JSON
+// object. Records are queued and posted one by one in background, so
+// fetches are not slowed down by endpoint; if it does not keep up,
+// records exceeding queue of 1024 ones are dropped with error. Failures
+// of posting records are logged. If client is nil, client with
+// 10 seconds timeout is used. Returned sink implements io.Closer
+// interface, which waits for queued records to be posted.
+func HTTPAuditSink(url string, client *http.Client) AuditSink {
+	if client == nil {
+		client = &http.Client{
+			Timeout: auditTimeout,
+		}
+	}
+
+	s := &httpAuditSink{
+		url:    url,
+		client: client,
+		logger: defaultLogger,
+		queue:  make(chan AuditRecord, auditQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Record implements AuditSink interface.
+func (s *httpAuditSink) Record(record AuditRecord) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return errAuditSinkClosed
+	}
+
+	select {
+	case s.queue <- record:
+		return nil
+	default:
+		return errAuditQueueFull
+	}
+}
+
+// Close stops accepting records and waits for queued ones to be posted.
+func (s *httpAuditSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+
+	return nil
+}
+
+// run posts queued records until sink is closed.
+func (s *httpAuditSink) run() {
+	defer close(s.done)
+
+	for record := range s.queue {
+		if err := s.post(record); err != nil {
+			s.mu.RLock()
+			s.logger.Printf("%s: audit: %s", record.URL, err)
+			s.mu.RUnlock()
+		}
+	}
+}
+
+// setLogger sets logger of failures of posting records.
+func (s *httpAuditSink) setLogger(logger *log.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logger = logger
+}
+
+// post posts single record.
+func (s *httpAuditSink) post(record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit sink responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// audit records fetch of result started at start.
+func (h *Handler) audit(b *batch, start time.Time, result *Result) {
+	if h.auditSink == nil {
+		return
+	}
+
+	record := AuditRecord{
+		Time:      start,
+		Client:    b.client,
+		Tenant:    b.tenant,
+		URL:       result.URL,
+		Method:    result.Method,
+		Status:    result.Status,
+		Bytes:     result.Length,
+		Error:     result.Error,
+		ErrorKind: result.ErrorKind,
+	}
+
+	if err := h.auditSink.Record(record); err != nil {
+		b.logger.Printf("%s: audit: %s", result.URL, err)
+	}
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandlerAudit(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	var buf bytes.Buffer
+
+	s := httptest.NewServer(NewHandler(
+		WithAudit(JSONAuditSink(&buf)),
+		WithTenants(map[string]Tenant{"key": {Name: "team"}}),
+	))
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(getUrl(server.URL, 10, 0), "http://127.0.0.1:0"))
+	req.Header.Set(apiKeyHeader, "key")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	resp.Body.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", buf.String())
+	}
+
+	for _, line := range lines {
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+
+		if record.Client != "127.0.0.1" || record.Tenant != "team" || record.Time.IsZero() {
+			t.Errorf("unexpected record: %+v", record)
+		}
+		if record.Error == "" && (record.Status != http.StatusOK || record.Bytes != 10) {
+			t.Errorf("unexpected record: %+v", record)
+		}
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := FileAuditSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Record(AuditRecord{URL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	sink.(io.Closer).Close()
+
+	data, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(data), `"url":"https://example.com"`) {
+		t.Errorf("unexpected file content: %s", data)
+	}
+}
+
+func TestHTTPAuditSink(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		records []AuditRecord
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var record AuditRecord
+		json.NewDecoder(request.Body).Decode(&record)
+
+		mu.Lock()
+		records = append(records, record)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	sink := HTTPAuditSink(server.URL, nil)
+	if err := sink.Record(AuditRecord{URL: "https://example.com", Status: 200}); err != nil {
+		t.Fatal(err)
+	}
+
+	// queued records are posted before sink is closed
+	sink.(io.Closer).Close()
+
+	if len(records) != 1 || records[0].URL != "https://example.com" || records[0].Status != 200 {
+		t.Errorf("unexpected records: %+v", records)
+	}
+
+	if err := sink.Record(AuditRecord{}); err != errAuditSinkClosed {
+		t.Errorf("expected error of closed sink, got %v", err)
+	}
+}
+
+func TestHTTPAuditSinkQueue(t *testing.T) {
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	sink := HTTPAuditSink(server.URL, nil)
+	defer sink.(io.Closer).Close()
+	defer close(release)
+
+	// records do not wait for endpoint, and ones
+	// exceeding queue are dropped
+	start := time.Now()
+
+	var err error
+	for i := 0; i <= auditQueueSize+1 && err == nil; i++ {
+		err = sink.Record(AuditRecord{URL: "https://example.com"})
+	}
+
+	if err != errAuditQueueFull {
+		t.Errorf("expected error of full queue, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected records not to wait for endpoint, took %s", elapsed)
+	}
+}
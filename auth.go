@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var errUnauthenticated = errors.New("missing or invalid bearer token")
+
+// Authenticator authenticates incoming requests.
+// Authenticate returns non-nil error if request
+// is not authenticated, e.g. JWT is invalid.
+type Authenticator interface {
+	Authenticate(request *http.Request) error
+}
+
+// AuthenticatorFunc is function implementing Authenticator interface.
+type AuthenticatorFunc func(request *http.Request) error
+
+// Authenticate implements Authenticator interface.
+func (f AuthenticatorFunc) Authenticate(request *http.Request) error {
+	return f(request)
+}
+
+// bearerTokens authenticates requests with static bearer tokens.
+type bearerTokens [][]byte
+
+// BearerTokens returns Authenticator accepting requests whose
+// Authorization header contains any of tokens as bearer token.
+func BearerTokens(tokens ...string) Authenticator {
+	bt := make(bearerTokens, len(tokens))
+	for i, token := range tokens {
+		bt[i] = []byte(token)
+	}
+
+	return bt
+}
+
+// Authenticate implements Authenticator interface.
+func (bt bearerTokens) Authenticate(request *http.Request) error {
+	token, ok := bearerToken(request)
+	if !ok {
+		return errUnauthenticated
+	}
+
+	for _, t := range bt {
+		if subtle.ConstantTimeCompare(t, []byte(token)) == 1 {
+			return nil
+		}
+	}
+
+	return errUnauthenticated
+}
+
+// bearerToken returns bearer token from request's Authorization header.
+func bearerToken(request *http.Request) (string, bool) {
+	const prefix = "bearer "
+
+	auth := request.Header.Get("Authorization")
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(auth[len(prefix):]), true
+}
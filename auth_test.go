@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerAuth(t *testing.T) {
+	cases := []struct {
+		auth   Authenticator
+		header string
+		status int
+	}{
+		{BearerTokens("secret"), "", http.StatusUnauthorized},
+		{BearerTokens("secret"), "Bearer wrong", http.StatusUnauthorized},
+		{BearerTokens("secret"), "Basic secret", http.StatusUnauthorized},
+		{BearerTokens("other", "secret"), "bearer secret", http.StatusOK},
+		{AuthenticatorFunc(func(*http.Request) error { return errors.New("expired") }), "Bearer secret", http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		h := NewHandler(WithAuth(c.auth))
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("%q: expected status %d, got %d", c.header, c.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// newBandwidthLimiter creates rateLimiter limiting bandwidth to rate
+// bytes per second. Its buckets hold one second worth of bytes.
+func newBandwidthLimiter(rate int64) *rateLimiter {
+	return newRateLimiter(float64(rate), int(rate))
+}
+
+// bandwidthLimit is bandwidth limiter along with key of its bucket.
+type bandwidthLimit struct {
+	limiter *rateLimiter
+	key     string
+}
+
+// throttledBody delays reading of response body exceeding bandwidth
+// limits. Bytes read are taken from buckets of limits, and once any
+// of them runs into debt, reading waits until debt is repaid.
+type throttledBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	limits []bandwidthLimit
+}
+
+// Read implements io.Reader interface.
+func (b *throttledBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n == 0 {
+		return n, err
+	}
+
+	var delay time.Duration
+	for _, l := range b.limits {
+		if d := l.limiter.reserve(l.key, float64(n)); d > delay {
+			delay = d
+		}
+	}
+
+	if delay <= 0 {
+		return n, err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return n, err
+	case <-b.ctx.Done():
+		return n, b.ctx.Err()
+	}
+}
+
+// throttleBody wraps body of response to host
+// if any of bandwidth limits applies to it.
+func (t *throttleTransport) throttleBody(req *http.Request, resp *http.Response, host *hostThrottle) {
+	var limits []bandwidthLimit
+
+	if host != nil && host.bandwidth != nil {
+		limits = append(limits, bandwidthLimit{
+			limiter: host.bandwidth,
+			key:     req.URL.Hostname(),
+		})
+	}
+	if t.bandwidth != nil {
+		limits = append(limits, bandwidthLimit{
+			limiter: t.bandwidth,
+		})
+	}
+
+	if len(limits) == 0 || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+
+	resp.Body = &throttledBody{
+		ReadCloser: resp.Body,
+		ctx:        req.Context(),
+		limits:     limits,
+	}
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Now()
+
+	l := newBandwidthLimiter(1000)
+	l.now = func() time.Time {
+		return now
+	}
+
+	if delay := l.reserve("", 1000); delay != 0 {
+		t.Errorf("expected no delay within burst, got %s", delay)
+	}
+	if delay := l.reserve("", 500); delay != 500*time.Millisecond {
+		t.Errorf("expected delay 500ms, got %s", delay)
+	}
+
+	now = now.Add(time.Second)
+
+	if delay := l.reserve("", 500); delay != 0 {
+		t.Errorf("expected no delay after debt is repaid, got %s", delay)
+	}
+}
+
+func TestHandlerBandwidthLimit(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithBandwidthLimit(10000)))
+	defer s.Close()
+
+	urls := []string{
+		getUrl(server.URL, 8000, 0),
+		getUrl(server.URL, 8000, 0),
+	}
+
+	start := time.Now()
+
+	results := fetchResults(t, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+	if len(results) != len(urls) {
+		t.Fatalf("expected %d results, got %+v", len(urls), results)
+	}
+	for _, result := range results {
+		if result.Length != 8000 {
+			t.Errorf("expected length 8000, got %+v", result)
+		}
+	}
+
+	// burst covers the first 10000 bytes, and the rest 6000 take 600ms
+	if elapsed := time.Since(start); elapsed < time.Millisecond*500 {
+		t.Errorf("bandwidth limit is not enforced, batch took %s", elapsed)
+	}
+}
+
+func TestHandlerHostBandwidthLimit(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(
+		WithHostLimit("*", HostLimit{Bandwidth: 10000}),
+	))
+	defer s.Close()
+
+	start := time.Now()
+
+	results := fetchResults(t, s.URL, strings.NewReader(getUrl(server.URL, 15000, 0)))
+	if len(results) != 1 || results[0].Length != 15000 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Millisecond*400 {
+		t.Errorf("host bandwidth limit is not enforced, batch took %s", elapsed)
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+)
+
+// Changes of results compared to baseline.
+const (
+	changeNew       = "new"
+	changeChanged   = "changed"
+	changeUnchanged = "unchanged"
+	changeRemoved   = "removed"
+)
+
+// Delta describes change of result compared to result
+// of the same URL in baseline, see "baseline" field of JSON body.
+type Delta struct {
+	// Change is either "new", "changed", "unchanged" or "removed".
+	Change         string `json:"change" xml:"change"`
+	PreviousLength int    `json:"previous_length,omitempty" xml:"previous_length,omitempty"`
+	PreviousStatus int    `json:"previous_status,omitempty" xml:"previous_status,omitempty"`
+	LengthDelta    int    `json:"length_delta,omitempty" xml:"length_delta,omitempty"`
+}
+
+// baseline contains previous results batch's results are compared to.
+type baseline struct {
+	results []Result
+	// index maps URLs to positions of their results.
+	index map[string]int
+	// seen marks results whose URLs are fetched again.
+	seen []bool
+}
+
+// newBaseline creates baseline of previous results. If URL
+// occurs several times, its last result is used.
+func newBaseline(results []Result) *baseline {
+	bl := &baseline{
+		results: results,
+		index:   make(map[string]int, len(results)),
+		seen:    make([]bool, len(results)),
+	}
+
+	for i, r := range results {
+		bl.index[r.URL] = i
+	}
+
+	return bl
+}
+
+// loadBaseline loads results of stored run referenced by batch, if any,
+// as its baseline. If there is no such run, ErrRunNotFound is returned.
+func (h *Handler) loadBaseline(ctx context.Context, b *batch) error {
+	if b.baselineRun == "" {
+		return nil
+	}
+
+	run, err := h.jobStore.Run(ctx, b.baselineRun)
+	if err != nil {
+		return fmt.Errorf("baseline run %s: %w", b.baselineRun, err)
+	}
+	b.baseline = newBaseline(run.Results)
+
+	return nil
+}
+
+// compare records change of result compared to baseline.
+func (bl *baseline) compare(result *Result) {
+	i, ok := bl.index[result.URL]
+	if !ok {
+		result.Delta = &Delta{Change: changeNew}
+
+		return
+	}
+	bl.seen[i] = true
+
+	prev := bl.results[i]
+	result.Delta = &Delta{
+		Change:         changeUnchanged,
+		PreviousLength: prev.Length,
+		PreviousStatus: prev.Status,
+		LengthDelta:    result.Length - prev.Length,
+	}
+
+	if result.Length != prev.Length || result.Status != prev.Status || (result.Error == "") != (prev.Error == "") {
+		result.Delta.Change = changeChanged
+	}
+}
+
+// removed returns results of baseline's URLs which are not fetched again.
+func (bl *baseline) removed() []*Result {
+	var removed []*Result
+
+	for i, r := range bl.results {
+		if bl.seen[i] || bl.index[r.URL] != i {
+			continue
+		}
+
+		removed = append(removed, &Result{
+			URL: r.URL,
+			Delta: &Delta{
+				Change:         changeRemoved,
+				PreviousLength: r.Length,
+				PreviousStatus: r.Status,
+			},
+		})
+	}
+
+	return removed
+}
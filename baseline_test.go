@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerBaseline(t *testing.T) {
+	target := createServer(0)
+	defer target.Close()
+
+	same := getUrl(target.URL, 10, 0)
+	grown := getUrl(target.URL, 20, 0)
+	added := getUrl(target.URL, 30, 0)
+	removed := getUrl(target.URL, 40, 0)
+
+	store := NewMemoryJobStore(1)
+	store.SaveRun(context.Background(), &ScheduledRun{
+		ID:       "previous",
+		Schedule: "monitor",
+		Results: []Result{
+			{URL: same, Length: 10, Status: 200},
+			{URL: grown, Length: 15, Status: 200},
+			{URL: removed, Length: 40, Status: 200},
+		},
+	})
+
+	s := httptest.NewServer(NewHandler(WithJobStore(store)))
+	defer s.Close()
+
+	resp, err := http.Post(s.URL, "application/json", strings.NewReader(`{"urls": ["`+same+`"], "baseline": "missing"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unknown run, got %d", resp.StatusCode)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"urls":     []string{same, grown, added},
+		"format":   "json",
+		"ordered":  true,
+		"baseline": "previous",
+	})
+
+	resp, err = http.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var results []Result
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		url   string
+		delta Delta
+	}{
+		{same, Delta{Change: changeUnchanged, PreviousLength: 10, PreviousStatus: 200}},
+		{grown, Delta{Change: changeChanged, PreviousLength: 15, PreviousStatus: 200, LengthDelta: 5}},
+		{added, Delta{Change: changeNew}},
+		{removed, Delta{Change: changeRemoved, PreviousLength: 40, PreviousStatus: 200}},
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %+v", len(expected), results)
+	}
+	for i, e := range expected {
+		if results[i].URL != e.url || results[i].Delta == nil || *results[i].Delta != e.delta {
+			t.Errorf("expected %s with %+v, got %+v", e.url, e.delta, results[i])
+		}
+	}
+}
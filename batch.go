@@ -0,0 +1,357 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchModeHeader is request header which overrides
+// the way documents' lengths are determined.
+// Supported values are "head" and "body".
+const fetchModeHeader = "X-Fetch-Mode"
+
+// fetchMethodHeader is request header which sets
+// HTTP method of outgoing requests.
+const fetchMethodHeader = "X-Fetch-Method"
+
+// Request headers bounding total time spent on batch. Deadline header
+// contains RFC 3339 time, timeout header contains duration, e.g. "1.5s",
+// or number of seconds.
+const (
+	deadlineHeader = "X-Request-Deadline"
+	timeoutHeader  = "X-Timeout"
+)
+
+// defaultAllowedMethods contains outgoing methods allowed
+// unless WithAllowedMethods option is provided.
+var defaultAllowedMethods = []string{http.MethodGet, http.MethodHead}
+
+// batch holds parameters of single incoming request.
+type batch struct {
+	// queueWait is total time in nanoseconds batch's fetches waited
+	// for outgoing slots. It is accessed atomically, so it is
+	// the first field to be 64-bit aligned.
+	queueWait int64
+	// done and total are numbers of fetched URLs and all URLs read
+	// so far, reported by admin endpoint. They are accessed atomically.
+	done  int64
+	total int64
+	// previewLeft is number of bytes left for previews of documents,
+	// see WithBodyPreview. It is accessed atomically.
+	previewLeft int64
+	// budgetLeft is number of bytes left to be downloaded,
+	// see WithByteBudget. It is accessed atomically.
+	budgetLeft int64
+	// archiveLeft is number of bytes documents held until they are
+	// written to archive may take, see WithArchive. It is accessed
+	// atomically.
+	archiveLeft int64
+
+	// id identifies batch in admin endpoint.
+	id uint64
+	// start is time batch is started at.
+	start time.Time
+
+	ctx    context.Context
+	logger *log.Logger
+	// client is IP address of client made request.
+	client string
+	// tenant is name of client's tenant, if any.
+	tenant  string
+	targets []target
+	// head makes lengths determined by Content-Length
+	// header of HEAD responses when possible.
+	head bool
+	// method is HTTP method of outgoing requests.
+	method string
+	// header contains incoming request's headers
+	// forwarded to outgoing requests.
+	header http.Header
+	// timeout limits time of fetching single URL.
+	timeout time.Duration
+	// deadline limits time of fetching whole batch.
+	deadline time.Time
+	// priority defines order batch's fetches get slots in.
+	priority priority
+	// flow is key of scheduler's flow batch's fetches belong to.
+	flow string
+	// format is name of output format. If empty,
+	// it is negotiated by request's Accept header.
+	format string
+	// ordered makes results written in order of URLs in request.
+	ordered bool
+	// sort is order results are sorted by documents' lengths in.
+	// It takes precedence over ordered.
+	sort SortOrder
+	// checksum is algorithm of documents' checksums.
+	// If empty, checksums are not computed.
+	checksum ChecksumAlgorithm
+	// links defines whether links are extracted from HTML documents.
+	links LinkMode
+	// sameHostLinks makes links to other hosts skipped.
+	sameHostLinks bool
+	// textStats makes words and lines of documents counted.
+	textStats bool
+	// dedupe makes identical targets fetched once.
+	dedupe bool
+	// fanOut makes result of deduplicated target
+	// reported for its every occurrence.
+	fanOut bool
+	// normalize makes URLs normalized before deduplication and fetching.
+	normalize bool
+	// removeTracking makes tracking query parameters removed during normalization.
+	removeTracking bool
+	// strict makes the first failure cancel remaining fetches
+	// and the whole request fail.
+	strict bool
+	// failure is the first failed result of strict batch.
+	failure     *Result
+	failureOnce sync.Once
+	// cancel cancels batch's fetches.
+	cancel context.CancelFunc
+	// stop cancels fetches of all batch's chunks.
+	stop context.CancelFunc
+	// abandoned is closed once results are not consumed anymore.
+	abandoned chan struct{}
+	// input is the rest of chunked input, if any.
+	input *chunkedInput
+	// cost is cost of batch taken from weighted semaphore, if any.
+	cost batchCost
+	// duplex reports whether request body can be
+	// read after response is started.
+	duplex bool
+	// inputMode is the way batch's URLs are interpreted.
+	inputMode string
+	// depth is number of handlers incoming request has passed through.
+	depth int
+	// passthrough makes document of the only URL streamed back.
+	passthrough bool
+	// archive is format of archive documents are streamed back in, if any.
+	archive string
+	// concurrency limits number of URLs fetched simultaneously, if set.
+	concurrency int
+	// filter selects results written to response.
+	filter resultFilter
+	// duplicates makes URLs with identical content grouped.
+	duplicates bool
+	// baselineRun is ID of stored run baseline is loaded from.
+	baselineRun string
+	// baseline contains previous results, results are compared to.
+	baseline *baseline
+	// budgeted makes total size of downloaded documents limited.
+	budgeted bool
+	// spool holds buffered results, if they may be spilled to disk.
+	spool *resultSpool
+	// jar is ephemeral cookie jar of batch, see WithBatchCookies.
+	jar http.CookieJar
+}
+
+// newBatch creates batch with parameters taken
+// from Handler's options and request's headers.
+func (h *Handler) newBatch(request *http.Request) (*batch, error) {
+	b := &batch{
+		logger:         h.logger,
+		client:         h.clientIP(request),
+		head:           h.preferHead,
+		method:         http.MethodGet,
+		checksum:       h.checksum,
+		links:          h.links,
+		sameHostLinks:  h.sameHostLinks,
+		textStats:      h.textStats,
+		dedupe:         h.dedupe,
+		normalize:      h.normalize,
+		removeTracking: h.removeTracking,
+		sort:           h.sort,
+		abandoned:      make(chan struct{}),
+		start:          h.now(),
+		ordered:        h.ordered,
+		duplicates:     h.duplicates,
+	}
+	b.ctx, b.stop = context.WithCancel(request.Context())
+
+	if h.preview != nil {
+		b.previewLeft = h.preview.total
+	}
+	if h.byteBudget > 0 {
+		b.budgeted, b.budgetLeft = true, h.byteBudget
+	}
+	if h.spillLimit > 0 {
+		b.spool = newResultSpool(h.spillLimit, h.spillDir, h.logger)
+	}
+	if h.batchCookies {
+		b.jar = newBatchJar()
+	}
+
+	switch strings.ToLower(request.Header.Get(fetchModeHeader)) {
+	case "head":
+		b.head = true
+	case "body":
+		b.head = false
+	}
+
+	for _, key := range h.forwardedHeaders {
+		if values, ok := request.Header[key]; ok {
+			if b.header == nil {
+				b.header = make(http.Header)
+			}
+			b.header[key] = append([]string(nil), values...)
+		}
+	}
+
+	// deadline bounds context, which is driven by real clock,
+	// so it is computed by real clock rather than Handler's one
+	if err := b.setDeadline(request.Header, time.Now()); err != nil {
+		return nil, err
+	}
+
+	p, err := parsePriority(request.Header.Get(priorityHeader))
+	if err != nil {
+		return nil, err
+	}
+	b.priority = p
+
+	if h.fairScheduling {
+		b.flow = h.flowKey(request)
+	}
+
+	if err := b.setDepth(request.Header); err != nil {
+		return nil, err
+	}
+
+	if err := b.setInputMode(h, request.Header.Get(inputModeHeader)); err != nil {
+		return nil, err
+	}
+
+	if err := b.setFilter(request.Header.Get(resultFilterHeader)); err != nil {
+		return nil, err
+	}
+
+	if h.overrides != nil {
+		if err := b.setOverrides(h.overrides, request.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.setPassthrough(h, request.Header); err != nil {
+		return nil, err
+	}
+
+	if err := b.setArchive(h, request.Header); err != nil {
+		return nil, err
+	}
+
+	if method := request.Header.Get(fetchMethodHeader); method != "" {
+		if err := b.setMethod(h.allowedMethods, method); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// setMethod sets method of outgoing requests
+// if it is contained in allowed list.
+func (b *batch) setMethod(allowed []string, method string) error {
+	method = strings.ToUpper(method)
+
+	for _, m := range allowed {
+		if m == method {
+			b.method = method
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("method %s is not allowed", method)
+}
+
+// setDeadline sets batch's deadline from request's deadline and timeout
+// headers, the latter counted from now. If both are present, the earliest is used.
+func (b *batch) setDeadline(header http.Header, now time.Time) error {
+	if value := header.Get(deadlineHeader); value != "" {
+		deadline, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s header: %s", deadlineHeader, err)
+		}
+
+		b.deadline = deadline
+	}
+
+	if value := header.Get(timeoutHeader); value != "" {
+		timeout, err := parseTimeout(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s header: %s", timeoutHeader, err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("%s must be positive", timeoutHeader)
+		}
+
+		if deadline := now.Add(timeout); b.deadline.IsZero() || deadline.Before(b.deadline) {
+			b.deadline = deadline
+		}
+	}
+
+	return nil
+}
+
+// parseTimeout parses timeout given either as duration,
+// e.g. "1.5s", or as number of seconds.
+func parseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, serr := strconv.ParseFloat(value, 64)
+		if serr != nil {
+			return 0, err
+		}
+
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	return timeout, nil
+}
+
+// fail records the first failed result of batch
+// and cancels remaining fetches.
+func (b *batch) fail(result *Result) {
+	b.failureOnce.Do(func() {
+		b.failure = result
+		b.cancel()
+	})
+}
+
+// send sends result to ch and reports whether it is sent,
+// i.e. batch has not been abandoned.
+func (b *batch) send(ch chan<- *Result, result *Result) bool {
+	select {
+	case ch <- result:
+		return true
+	case <-b.abandoned:
+		return false
+	}
+}
+
+// abandon cancels remaining fetches and makes their results discarded,
+// so fetches do not wait for consumer which has gone.
+func (b *batch) abandon() {
+	close(b.abandoned)
+	b.stop()
+}
+
+// buffered reports whether results of batch are written after all
+// documents are fetched: if they are sorted, response status depends
+// on them, batch is strict or duplicates are grouped.
+func (b *batch) buffered(h *Handler) bool {
+	return b.sort != SortNone || h.statusPolicy() || b.strict || b.duplicates
+}
+
+// needsBody reports whether documents' bodies must be read
+// to compute requested results, so HEAD requests can not be used.
+func (b *batch) needsBody(h *Handler) bool {
+	return b.checksum != "" || b.links != LinksNone || b.textStats || len(h.analyzers) != 0 || h.preview != nil || b.archive != "" || b.duplicates
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxBodySize is maximum size of decompressed
+// request body unless LimitBodySize option is provided.
+const defaultMaxBodySize = 32 << 20
+
+// defaultMaxLineLength is maximum length of plain text body's
+// line unless LimitLineLength option is provided.
+const defaultMaxLineLength = 16 << 10
+
+var (
+	errBodyTooLarge        = errors.New("request body is too large")
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+// bodyReader reads decompressed request body. Reading fails
+// with errBodyTooLarge once more than limit bytes are read.
+type bodyReader struct {
+	r      io.Reader
+	closer io.Closer
+	left   int64
+}
+
+// Read implements io.Reader interface.
+func (r *bodyReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		var probe [1]byte
+
+		n, err := r.r.Read(probe[:])
+		if n > 0 {
+			return 0, errBodyTooLarge
+		}
+
+		return 0, err
+	}
+
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+
+	n, err := r.r.Read(p)
+	r.left -= int64(n)
+
+	return n, err
+}
+
+// Close releases decompressor, if any.
+func (r *bodyReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+
+	return r.closer.Close()
+}
+
+// openBody returns reader of request body, decompressing it according
+// to Content-Encoding header. Reading fails with errBodyTooLarge
+// if decompressed body exceeds Handler's limit.
+func (h *Handler) openBody(request *http.Request) (io.ReadCloser, error) {
+	r := &bodyReader{
+		r:    request.Body,
+		left: h.maxBodySize,
+	}
+
+	switch encoding := strings.ToLower(request.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(request.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %s", err)
+		}
+
+		r.r, r.closer = gz, gz
+	case "deflate":
+		zr, err := zlib.NewReader(request.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deflate body: %s", err)
+		}
+
+		r.r, r.closer = zr, zr
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedEncoding, encoding)
+	}
+
+	return r, nil
+}
+
+// bodyErrorStatus returns response status code for error
+// occurred while reading request body.
+func bodyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
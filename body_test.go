@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerCompressedBody(t *testing.T) {
+	server := createServer(0)
+
+	s := httptest.NewServer(NewHandler(LimitBodySize(1024)))
+	defer s.Close()
+
+	compress := func(data string) *bytes.Buffer {
+		var buf bytes.Buffer
+
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(data))
+		w.Close()
+
+		return &buf
+	}
+
+	tests := map[string]struct {
+		body     *bytes.Buffer
+		encoding string
+		status   int
+	}{
+		"gzip": {
+			body:     compress(getUrl(server.URL, 100, 0)),
+			encoding: "gzip",
+			status:   http.StatusOK,
+		},
+		"too large": {
+			body:     compress(strings.Repeat(getUrl(server.URL, 100, 0)+"\n", 100)),
+			encoding: "gzip",
+			status:   http.StatusRequestEntityTooLarge,
+		},
+		"unsupported": {
+			body:     bytes.NewBufferString(getUrl(server.URL, 100, 0)),
+			encoding: "br",
+			status:   http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, s.URL, test.body)
+			req.Header.Set("Content-Encoding", test.encoding)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("failed to make request: %s", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, resp.StatusCode)
+			}
+
+			if test.status == http.StatusOK {
+				if err := checkResponse(resp, []int{100}); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
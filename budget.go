@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// errBudgetExceeded is error of fetches interrupted or skipped
+// once byte budget of batch is exceeded, see WithByteBudget.
+var errBudgetExceeded = errors.New("byte budget of request is exceeded")
+
+// budgetReader reads response body, taking bytes read from batch's
+// byte budget. Reading fails with errBudgetExceeded once it is exceeded.
+type budgetReader struct {
+	r io.Reader
+	b *batch
+}
+
+// Read implements io.Reader interface.
+func (r *budgetReader) Read(p []byte) (int, error) {
+	if r.b.overBudget() {
+		return 0, errBudgetExceeded
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 && !r.b.spend(n) {
+		return n, errBudgetExceeded
+	}
+
+	return n, err
+}
+
+// spend takes n bytes from batch's byte budget and reports whether
+// budget is not exceeded. Once it is, remaining fetches are canceled.
+func (b *batch) spend(n int) bool {
+	if atomic.AddInt64(&b.budgetLeft, -int64(n)) >= 0 {
+		return true
+	}
+
+	b.cancel()
+
+	return false
+}
+
+// overBudget reports whether byte budget of batch is exceeded.
+func (b *batch) overBudget() bool {
+	return b.budgeted && atomic.LoadInt64(&b.budgetLeft) < 0
+}
+
+// checkBudget records fetch canceled due to exceeded
+// byte budget of batch as skipped over budget.
+func (b *batch) checkBudget(result *Result) {
+	if result.err != nil && errors.Is(result.err, context.Canceled) && b.overBudget() {
+		result.setError(errBudgetExceeded)
+	}
+}
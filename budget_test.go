@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerByteBudget(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(
+		WithByteBudget(1500),
+		WithSynchronousFetching(),
+	))
+	defer s.Close()
+
+	urls := []string{
+		getUrl(server.URL, 1000, 0),
+		getUrl(server.URL, 1000, 0),
+		getUrl(server.URL, 1000, 0),
+	}
+
+	results := fetchResults(t, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+	if len(results) != len(urls) {
+		t.Fatalf("expected %d results, got %+v", len(urls), results)
+	}
+
+	if results[0].Length != 1000 || results[0].Error != "" {
+		t.Errorf("expected the first document fetched, got %+v", results[0])
+	}
+
+	// the second document exceeds budget while it is read,
+	// and the third one is skipped
+	for _, result := range results[1:] {
+		if result.ErrorKind != ErrorKindBudget {
+			t.Errorf("expected result over budget, got %+v", result)
+		}
+	}
+	if results[2].Length != 0 {
+		t.Errorf("expected the third document skipped, got %+v", results[2])
+	}
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"bytes"
+	"sync"
+)
+
+// copyBufferSize is size of buffers documents are read with.
+const copyBufferSize = 32 << 10
+
+// maxPooledBufferSize is capacity of encoding buffers above which they
+// are not returned to pool, so rare huge results do not pin memory.
+const maxPooledBufferSize = 64 << 10
+
+// copyBuffers pools buffers documents are read with.
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, copyBufferSize)
+
+		return &buf
+	},
+}
+
+// encodeBuffers pools buffers results are encoded into.
+var encodeBuffers = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getEncodeBuffer returns empty buffer from pool.
+func getEncodeBuffer() *bytes.Buffer {
+	buf := encodeBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	return buf
+}
+
+// putEncodeBuffer returns buffer to pool.
+func putEncodeBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+
+	encodeBuffers.Put(buf)
+}
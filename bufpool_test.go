@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func benchmarkResults() []*Result {
+	results := make([]*Result, 100)
+	for i := range results {
+		results[i] = &Result{
+			URL:         "https://example.com/page?id=" + string(rune('a'+i%26)),
+			Length:      1256 * i,
+			Status:      http.StatusOK,
+			ContentType: "text/html",
+			Charset:     "utf-8",
+			Checksum:    "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		}
+	}
+
+	return results
+}
+
+func benchmarkEncoder(b *testing.B, newEncoder func() encoder) {
+	results := benchmarkResults()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		enc := newEncoder()
+		enc.begin(ioutil.Discard)
+		for _, r := range results {
+			enc.encode(ioutil.Discard, r)
+		}
+		enc.end(ioutil.Discard)
+	}
+}
+
+func BenchmarkJSONEncoder(b *testing.B) {
+	benchmarkEncoder(b, func() encoder { return &jsonEncoder{} })
+}
+
+func BenchmarkXMLEncoder(b *testing.B) {
+	benchmarkEncoder(b, func() encoder { return &xmlEncoder{} })
+}
+
+func BenchmarkConsume(b *testing.B) {
+	h := NewHandler(WithLogger(log.New(ioutil.Discard, "", 0)))
+	batch := &batch{
+		logger:   h.logger,
+		checksum: ChecksumSHA256,
+	}
+
+	body := bytes.Repeat([]byte("<p>hello</p>\n"), 20<<10)
+	u, _ := url.Parse("https://example.com")
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		resp := &http.Response{
+			Header: http.Header{"Content-Type": {"text/html"}},
+			// unlike bytes.Reader, response bodies do not implement io.WriterTo
+			Body:    ioutil.NopCloser(struct{ io.Reader }{bytes.NewReader(body)}),
+			Request: &http.Request{URL: u},
+		}
+
+		if err := h.consume(batch, resp, &Result{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// hostSlots limits number of simultaneous requests to single host.
+type hostSlots struct {
+	ch chan struct{}
+	// users is number of requests holding or waiting for slots,
+	// so slots of idle hosts can be dropped.
+	users int
+}
+
+// bulkhead limits number of simultaneous requests per host,
+// so single host can not take all outgoing connections.
+type bulkhead struct {
+	limit int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+// newBulkhead creates new bulkhead allowing limit simultaneous requests per host.
+func newBulkhead(limit int) *bulkhead {
+	return &bulkhead{
+		limit: limit,
+		hosts: make(map[string]*hostSlots),
+	}
+}
+
+// acquire waits for slot of host until ctx is done.
+func (b *bulkhead) acquire(ctx context.Context, host string) error {
+	b.mu.Lock()
+	slots, ok := b.hosts[host]
+	if !ok {
+		slots = &hostSlots{
+			ch: make(chan struct{}, b.limit),
+		}
+		b.hosts[host] = slots
+	}
+	slots.users++
+	b.mu.Unlock()
+
+	select {
+	case slots.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		b.leave(host, slots)
+
+		return ctx.Err()
+	}
+}
+
+// release releases slot of host.
+func (b *bulkhead) release(host string) {
+	b.mu.Lock()
+	slots := b.hosts[host]
+	b.mu.Unlock()
+
+	<-slots.ch
+	b.leave(host, slots)
+}
+
+// leave drops slots of host if they are not used anymore.
+func (b *bulkhead) leave(host string, slots *hostSlots) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slots.users--
+	if slots.users == 0 {
+		delete(b.hosts, host)
+	}
+}
+
+// bulkheadTransport makes requests within per host limit.
+// Slot is held until response body is closed.
+type bulkheadTransport struct {
+	bulkhead *bulkhead
+	next     http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *bulkheadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	if err := t.bulkhead.acquire(req.Context(), host); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.bulkhead.release(host)
+
+		return nil, err
+	}
+
+	resp.Body = &releaseBody{
+		ReadCloser: resp.Body,
+		release: func() {
+			t.bulkhead.release(host)
+		},
+	}
+
+	return resp, nil
+}
+
+// releaseBody is response body which releases
+// resources held by request once closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+// Close closes body and releases resources.
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+
+	return err
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerPerHostConcurrency(t *testing.T) {
+	var running, max int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for m := atomic.LoadInt32(&max); n > m && !atomic.CompareAndSwapInt32(&max, m, n); m = atomic.LoadInt32(&max) {
+		}
+
+		time.Sleep(time.Millisecond * 20)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	h := NewHandler(WithPerHostConcurrency(2))
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	urls := make([]string, 10)
+	for i := range urls {
+		urls[i] = getUrl(server.URL, i, 0)
+	}
+
+	results := fetchResults(t, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+	if len(results) != len(urls) {
+		t.Fatalf("expected %d results, got %+v", len(urls), results)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			t.Errorf("unexpected error: %+v", r)
+		}
+	}
+
+	if max != 2 {
+		t.Errorf("expected at most 2 simultaneous requests, got %d", max)
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	b := newBulkhead(1)
+
+	if err := b.acquire(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.acquire(context.Background(), "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	if err := b.acquire(ctx, "a"); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	b.release("a")
+	b.release("b")
+
+	if len(b.hosts) != 0 {
+		t.Errorf("slots of idle hosts are kept: %v", b.hosts)
+	}
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// CassetteMode defines whether outgoing requests are recorded or replayed.
+type CassetteMode string
+
+// Modes of cassette.
+const (
+	// CassetteRecord makes outgoing requests made as usual,
+	// and their responses recorded to cassette file.
+	CassetteRecord CassetteMode = "record"
+	// CassetteReplay makes responses replayed from cassette
+	// file, so no requests are sent to network.
+	CassetteReplay CassetteMode = "replay"
+)
+
+// interaction is outgoing request and its outcome recorded in cassette.
+type interaction struct {
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	Status        int         `json:"status,omitempty"`
+	Proto         string      `json:"proto,omitempty"`
+	Header        http.Header `json:"header,omitempty"`
+	ContentLength int64       `json:"content_length,omitempty"`
+	Body          []byte      `json:"body,omitempty"`
+	Error         string      `json:"error,omitempty"`
+}
+
+// interactionKey returns key interactions of request are looked up by.
+func interactionKey(method, url string) string {
+	return method + " " + url
+}
+
+// cassette records outgoing requests to file, one JSON object per line,
+// or replays them. URLs and headers are redacted before being recorded.
+type cassette struct {
+	mode     CassetteMode
+	redactor *redactor
+
+	mu   sync.Mutex
+	file *os.File
+	// interactions are replayed interactions by their keys,
+	// and played are numbers of their replayed ones.
+	interactions map[string][]*interaction
+	played       map[string]int
+}
+
+// openCassette opens cassette file at path for mode.
+// In record mode, existing file is truncated.
+func openCassette(path string, mode CassetteMode, r *redactor) (*cassette, error) {
+	c := &cassette{
+		mode:     mode,
+		redactor: r,
+	}
+
+	switch mode {
+	case CassetteRecord:
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+
+		c.file = f
+	case CassetteReplay:
+		if err := c.load(path); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %q", mode)
+	}
+
+	return c, nil
+}
+
+// load reads interactions to replay from file at path.
+func (c *cassette) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.interactions = make(map[string][]*interaction)
+	c.played = make(map[string]int)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<30)
+
+	for line := 1; scanner.Scan(); line++ {
+		in := &interaction{}
+		if err := json.Unmarshal(scanner.Bytes(), in); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		key := interactionKey(in.Method, in.URL)
+		c.interactions[key] = append(c.interactions[key], in)
+	}
+
+	return scanner.Err()
+}
+
+// record appends interaction to cassette file.
+func (c *cassette) record(in *interaction) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err = c.file.Write(append(data, '\n'))
+
+	return err
+}
+
+// replay returns the next recorded interaction of request. Once all
+// of them are replayed, the last one is returned for subsequent requests.
+func (c *cassette) replay(method, url string) (*interaction, bool) {
+	key := interactionKey(method, url)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	recorded := c.interactions[key]
+	if len(recorded) == 0 {
+		return nil, false
+	}
+
+	i := c.played[key]
+	if i < len(recorded)-1 {
+		c.played[key]++
+	}
+
+	return recorded[i], true
+}
+
+// close closes cassette file.
+func (c *cassette) close() error {
+	if c.file == nil {
+		return nil
+	}
+
+	return c.file.Close()
+}
+
+// cassetteTransport records or replays outgoing requests.
+type cassetteTransport struct {
+	cassette *cassette
+	next     http.RoundTripper
+	// err is returned for all requests if set,
+	// since cassette to replay can not be loaded.
+	err error
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	url := t.cassette.redactor.url(req.URL.String())
+
+	if t.cassette.mode == CassetteReplay {
+		in, ok := t.cassette.replay(req.Method, url)
+		if !ok {
+			return nil, fmt.Errorf("%s %s: interaction is not recorded", req.Method, url)
+		}
+
+		return in.response(req)
+	}
+
+	in := &interaction{
+		Method: req.Method,
+		URL:    url,
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		in.Body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// response is not returned along with error
+		if err != nil {
+			resp = nil
+		} else {
+			resp.Body = ioutil.NopCloser(bytes.NewReader(in.Body))
+		}
+	}
+	if err != nil {
+		in.Body = nil
+		in.Error = err.Error()
+	} else {
+		in.Status = resp.StatusCode
+		in.Proto = resp.Proto
+		in.Header = t.cassette.redactor.header(resp.Header)
+		in.ContentLength = resp.ContentLength
+	}
+
+	if rerr := t.cassette.record(in); rerr != nil {
+		return nil, fmt.Errorf("recording cassette: %w", rerr)
+	}
+
+	return resp, err
+}
+
+// response returns replayed response to req, or recorded error.
+func (in *interaction) response(req *http.Request) (*http.Response, error) {
+	if in.Error != "" {
+		return nil, fmt.Errorf("%s (replayed)", in.Error)
+	}
+
+	major, minor, ok := http.ParseHTTPVersion(in.Proto)
+	if !ok {
+		major, minor = 1, 1
+	}
+
+	header := in.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(in.Status) + " " + http.StatusText(in.Status),
+		StatusCode:    in.Status,
+		Proto:         in.Proto,
+		ProtoMajor:    major,
+		ProtoMinor:    minor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(in.Body)),
+		ContentLength: in.ContentLength,
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHandlerCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	server := createServer(0)
+	urls := []string{getUrl(server.URL, 10, 0), getUrl(server.URL, 20, 0)}
+
+	h := NewHandler(WithCassette(path, CassetteRecord))
+	s := httptest.NewServer(h)
+
+	recorded := fetchResults(t, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+
+	s.Close()
+	server.Close()
+
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = httptest.NewServer(NewHandler(WithCassette(path, CassetteReplay)))
+	defer s.Close()
+
+	replayed := fetchResults(t, s.URL, strings.NewReader(strings.Join(append(urls, server.URL+"/missing"), "\n")))
+	if len(replayed) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(replayed))
+	}
+
+	lengths := make(map[string]int)
+	for _, r := range recorded {
+		if r.Error != "" {
+			t.Errorf("unexpected recorded result %+v", r)
+		}
+		lengths[r.URL] = r.Length
+	}
+
+	for _, r := range replayed {
+		if r.URL == server.URL+"/missing" {
+			if !strings.Contains(r.Error, "interaction is not recorded") {
+				t.Errorf("expected not recorded interaction to fail, got %+v", r)
+			}
+
+			continue
+		}
+
+		if r.Error != "" || r.Length != lengths[r.URL] || r.Status != 200 {
+			t.Errorf("unexpected replayed result %+v", r)
+		}
+	}
+}
+
+func TestHandlerCassetteReplayMissing(t *testing.T) {
+	var hits int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithCassette(filepath.Join(t.TempDir(), "missing.jsonl"), CassetteReplay)))
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, strings.NewReader(server.URL))
+	if len(results) != 1 || !strings.Contains(results[0].Error, "can not be loaded") {
+		t.Errorf("expected failed result, got %+v", results)
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 0 {
+		t.Errorf("expected no requests to network, got %d", n)
+	}
+}
+
+func TestCassetteTransportReadError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// body is shorter than declared, so reading it fails
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("short"))
+	}))
+	defer server.Close()
+
+	c, err := openCassette(filepath.Join(t.TempDir(), "cassette.jsonl"), CassetteRecord, defaultRedactor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	tr := &cassetteTransport{cassette: c, next: http.DefaultTransport}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+
+	resp, err := tr.RoundTrip(req)
+	if err == nil || resp != nil {
+		t.Errorf("expected error without response, got %v and %v", resp, err)
+	}
+}
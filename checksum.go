@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+)
+
+// ChecksumAlgorithm is name of hash function
+// used to compute documents' checksums.
+type ChecksumAlgorithm string
+
+// Supported checksum algorithms.
+const (
+	ChecksumMD5    ChecksumAlgorithm = "md5"
+	ChecksumSHA1   ChecksumAlgorithm = "sha1"
+	ChecksumSHA256 ChecksumAlgorithm = "sha256"
+	ChecksumSHA512 ChecksumAlgorithm = "sha512"
+)
+
+// checksums maps supported algorithms to hash constructors.
+var checksums = map[ChecksumAlgorithm]func() hash.Hash{
+	ChecksumMD5:    md5.New,
+	ChecksumSHA1:   sha1.New,
+	ChecksumSHA256: sha256.New,
+	ChecksumSHA512: sha512.New,
+}
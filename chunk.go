@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sync/atomic"
+)
+
+// inputErrorHeader is response trailer containing error occurred while
+// reading chunked input after results started being written.
+const inputErrorHeader = "X-Input-Error"
+
+// errQuotaExceeded is returned when tenant's URL quota
+// is exceeded by chunk of input.
+var errQuotaExceeded = errors.New("URL quota exceeded")
+
+// chunkedInput is the rest of plain text body
+// which is read chunk by chunk while batch is fetched.
+type chunkedInput struct {
+	lines *lineReader
+	body  io.Closer
+	// err is error occurred while reading input, if any.
+	err error
+}
+
+// Close closes request body.
+func (in *chunkedInput) Close() error {
+	return in.body.Close()
+}
+
+// fullDuplexer is implemented by HTTP/1 response writers
+// of Go 1.21 and later, see http.ResponseController.
+type fullDuplexer interface {
+	EnableFullDuplex() error
+}
+
+// duplex reports whether request body can be read after response is
+// started, enabling it if needed. HTTP/1 server closes request body once
+// response is started, unless full duplex mode is enabled.
+func duplex(writer http.ResponseWriter, request *http.Request) bool {
+	if request.ProtoMajor >= 2 {
+		return true
+	}
+
+	fd, ok := writer.(fullDuplexer)
+
+	return ok && fd.EnableFullDuplex() == nil
+}
+
+// chunkable reports whether body of content type can be read chunk by chunk.
+// Only plain text bodies are chunked, only if they can be read while
+// response is written, and only if results are not buffered, so they do
+// not have to be kept until all URLs are fetched. Only URLs fetched
+// as is are chunked, not sitemaps or crawl seeds.
+func (h *Handler) chunkable(b *batch, contentType string) bool {
+	switch mediaType, _, _ := mime.ParseMediaType(contentType); mediaType {
+	case "application/json", "multipart/form-data":
+		return false
+	}
+
+	return b.duplex && !b.buffered(h) && b.inputMode == inputURLs
+}
+
+// fetchChunks fetches batch with chunked input chunk by chunk: the next
+// chunk is read once all results of the previous one are sent, so
+// memory usage does not depend on number of URLs. After results of
+// each chunk, nil is sent, so they can be flushed. Cost of each chunk is
+// taken by weighted admission, if any, and if tenant is set, each chunk
+// is taken from its URL quota. If input can not be read, or capacity
+// or quota is exceeded, the rest of input is skipped.
+func (h *Handler) fetchChunks(b *batch, tn *tenant) <-chan *Result {
+	out := make(chan *Result)
+	parent := b.ctx
+
+	go func() {
+		defer close(out)
+
+		for len(b.targets) != 0 {
+			results := h.fetch(b)
+			if b.ordered {
+				results = inOrder(b, results)
+			}
+
+			for result := range results {
+				b.send(out, result)
+			}
+
+			if !b.send(out, nil) {
+				return
+			}
+
+			// batch is canceled, e.g. by operator
+			if err := parent.Err(); err != nil {
+				b.input.err = err
+
+				return
+			}
+
+			targets, err := b.input.lines.next(h.chunkSize)
+			if err == nil && len(targets) != 0 {
+				err = h.admitChunk(b, len(targets))
+			}
+			if err == nil && tn != nil && len(targets) != 0 {
+				if ok, _ := tn.take(len(targets)); !ok {
+					err = errQuotaExceeded
+				}
+			}
+			if err != nil {
+				b.logger.Printf("chunked input: %s", err)
+				b.input.err = err
+
+				return
+			}
+
+			b.ctx = parent
+			b.targets = targets
+			atomic.AddInt64(&b.total, int64(len(targets)))
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerChunkedInput(t *testing.T) {
+	var running, max int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for m := atomic.LoadInt32(&max); n > m && !atomic.CompareAndSwapInt32(&max, m, n); m = atomic.LoadInt32(&max) {
+		}
+
+		time.Sleep(time.Millisecond * 5)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithChunkedInput(10), LimitLineLength(200)))
+	defer s.Close()
+
+	lines := make([]string, 35)
+	for i := range lines {
+		lines[i] = getUrl(server.URL, i, 0)
+	}
+
+	cases := []struct {
+		name    string
+		lines   []string
+		results int
+		err     string
+	}{
+		{"complete", lines, 35, ""},
+		{"invalid", append(lines[:25:25], strings.Repeat("x", 300)), 20, "line 26: line is longer than 200 bytes"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			atomic.StoreInt32(&max, 0)
+
+			resp, err := http.Post(s.URL, "text/plain", strings.NewReader(strings.Join(c.lines, "\n")))
+			if err != nil {
+				t.Fatalf("failed to make request: %s", err)
+			}
+			defer resp.Body.Close()
+
+			data, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read response: %s", err)
+			}
+
+			if n := strings.Count(string(data), "5\n"); n != c.results {
+				t.Errorf("expected %d results, got %d", c.results, n)
+			}
+			if got := resp.Trailer.Get(inputErrorHeader); got != c.err {
+				t.Errorf("expected input error %q, got %q", c.err, got)
+			}
+			if max > 10 {
+				t.Errorf("expected at most 10 simultaneous fetches, got %d", max)
+			}
+		})
+	}
+}
+
+func TestHandlerChunkedInputBuffered(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithChunkedInput(2), WithDuplicateDetection()))
+	defer s.Close()
+
+	body := strings.Join([]string{getUrl(server.URL, 10, 0), getUrl(server.URL, 10, 0), getUrl(server.URL, 20, 0)}, "\n")
+
+	resp, err := http.Post(s.URL, "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(duplicateGroupsHeader) != "1" {
+		t.Errorf("expected duplicates grouped, got status %d, %s header %q, body %q", resp.StatusCode, duplicateGroupsHeader, resp.Header.Get(duplicateGroupsHeader), data)
+	}
+}
+
+func TestHandlerChunkedInputFirstChunk(t *testing.T) {
+	s := httptest.NewServer(NewHandler(WithChunkedInput(10), LimitLineLength(200)))
+	defer s.Close()
+
+	// errors in the first chunk are reported before results are written
+	resp, err := http.Post(s.URL, "text/plain", strings.NewReader(strings.Repeat("x", 300)))
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parseNetworks parses IP addresses and CIDR networks.
+// Invalid entries are logged and skipped.
+func (h *Handler) parseNetworks(specs []string) []*net.IPNet {
+	var networks []*net.IPNet
+
+	for _, spec := range specs {
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				h.logger.Printf("invalid IP address %q is ignored", spec)
+
+				continue
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			spec += "/" + strconv.Itoa(bits)
+		}
+
+		_, network, err := net.ParseCIDR(spec)
+		if err != nil {
+			h.logger.Printf("invalid network %q is ignored", spec)
+
+			continue
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// containsIP reports whether ip belongs to any of networks.
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientAllowed reports whether request's client
+// belongs to networks set by WithAllowedClients option.
+func (h *Handler) clientAllowed(request *http.Request) bool {
+	ip := net.ParseIP(h.clientIP(request))
+
+	return ip != nil && containsIP(h.allowedClients, ip)
+}
+
+// clientIP returns IP address of client made request. If request
+// is received from trusted proxy, the rightmost address of
+// X-Forwarded-For header not belonging to trusted proxies is used.
+func (h *Handler) clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+
+	if len(h.trustedProxies) == 0 {
+		return host
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(h.trustedProxies, ip) {
+		return host
+	}
+
+	var forwarded []string
+	for _, value := range request.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(value, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			break
+		}
+		if !containsIP(h.trustedProxies, ip) {
+			return ip.String()
+		}
+	}
+
+	return host
+}
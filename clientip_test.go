@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerAllowedClients(t *testing.T) {
+	h := NewHandler(WithAllowedClients("198.51.100.0/24", "2001:db8::1"), WithTrustedProxies("192.0.2.1"))
+
+	cases := []struct {
+		remote    string
+		forwarded string
+		status    int
+	}{
+		{"198.51.100.7", "", http.StatusOK},
+		{"[2001:db8::1]", "", http.StatusOK},
+		{"203.0.113.1", "", http.StatusForbidden},
+		{"203.0.113.1", "198.51.100.7", http.StatusForbidden},
+		{"192.0.2.1", "198.51.100.7", http.StatusOK},
+		{"192.0.2.1", "203.0.113.1", http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = c.remote + ":1234"
+		if c.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("%s (%s): expected status %d, got %d", c.remote, c.forwarded, c.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultCompressionThreshold is minimal response size compressed
+// unless WithCompressionThreshold option is provided.
+const defaultCompressionThreshold = 1024
+
+// gzipWriter compresses response if its size reaches threshold.
+// Until then, written data is buffered, so small responses
+// are written uncompressed.
+type gzipWriter struct {
+	writer    http.ResponseWriter
+	threshold int
+	buf       []byte
+	gz        *gzip.Writer
+	plain     bool
+	// status is response status written along with headers.
+	status int
+}
+
+// newGzipWriter creates new gzipWriter.
+func newGzipWriter(writer http.ResponseWriter, threshold int) *gzipWriter {
+	return &gzipWriter{
+		writer:    writer,
+		threshold: threshold,
+	}
+}
+
+// Write implements io.Writer interface.
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(p)
+	case w.plain:
+		return w.writer.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+
+	if len(w.buf) >= w.threshold {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// WriteHeader records response status. Since compression is
+// decided later, status is written once the first data is written.
+func (w *gzipWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+// writeHeader writes recorded response status, if any.
+func (w *gzipWriter) writeHeader() {
+	if w.status != 0 {
+		w.writer.WriteHeader(w.status)
+	}
+}
+
+// Flush writes buffered data to client. If compression
+// has not been started yet, it is started regardless of threshold.
+func (w *gzipWriter) Flush() {
+	if w.gz == nil && !w.plain {
+		if err := w.start(); err != nil {
+			return
+		}
+	}
+
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+
+	if f, ok := w.writer.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes remaining data. Response is written
+// uncompressed if threshold has not been reached.
+func (w *gzipWriter) Close() error {
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+
+	if w.plain {
+		return nil
+	}
+
+	w.plain = true
+	w.writeHeader()
+
+	_, err := w.writer.Write(w.buf)
+
+	return err
+}
+
+// start starts compression and writes buffered data.
+func (w *gzipWriter) start() error {
+	w.writer.Header().Del("Content-Length")
+	w.writer.Header().Set("Content-Encoding", "gzip")
+	w.writeHeader()
+
+	w.gz = gzip.NewWriter(w.writer)
+
+	_, err := w.gz.Write(w.buf)
+	w.buf = nil
+
+	return err
+}
+
+// acceptsGzip reports whether client accepts gzip encoded responses.
+func acceptsGzip(request *http.Request) bool {
+	for _, accept := range request.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(accept, ",") {
+			params := strings.Split(part, ";")
+			if strings.ToLower(strings.TrimSpace(params[0])) != "gzip" {
+				continue
+			}
+
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+						return false
+					}
+				}
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
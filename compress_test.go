@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerCompression(t *testing.T) {
+	server := createServer(0)
+
+	s := httptest.NewServer(NewHandler(WithCompressionThreshold(256)))
+	defer s.Close()
+
+	tests := map[string]struct {
+		urls       int
+		compressed bool
+	}{
+		"small": {
+			urls: 1,
+		},
+		"large": {
+			urls:       10,
+			compressed: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(strings.Repeat(getUrl(server.URL, 100, 0)+"\n", test.urls-1)+getUrl(server.URL, 100, 0)))
+			req.Header.Set("Accept", "application/json")
+			req.Header.Set("Accept-Encoding", "gzip")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("failed to make request: %s", err)
+			}
+			defer resp.Body.Close()
+
+			compressed := resp.Header.Get("Content-Encoding") == "gzip"
+			if compressed != test.compressed {
+				t.Fatalf("expected compressed to be %t, got %t", test.compressed, compressed)
+			}
+
+			var body io.Reader = resp.Body
+			if compressed {
+				if body, err = gzip.NewReader(resp.Body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var results []Result
+			if err := json.NewDecoder(body).Decode(&results); err != nil {
+				t.Fatalf("failed to decode response: %s", err)
+			}
+
+			if len(results) != test.urls {
+				t.Errorf("expected %d results, got %d", test.urls, len(results))
+			}
+		})
+	}
+}
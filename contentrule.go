@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// errDocumentTooLarge is error of documents exceeding
+// size limit of their content type, see ContentRule.
+var errDocumentTooLarge = errors.New("document exceeds size limit of its content type")
+
+// ContentRule defines handling of documents of content type,
+// see WithContentRules.
+type ContentRule struct {
+	// ContentType is media type, e.g. "text/html", wildcard of its
+	// subtypes, e.g. "video/*", or "*" matching any type. It is
+	// matched against Content-Type header of response.
+	ContentType string
+	// Analyzers are names of analyzers run on documents. Nil means
+	// all analyzers, and empty slice means none of them.
+	Analyzers []string
+	// MaxSize is maximum size of document. Reading of larger
+	// documents fails. Zero means no limit.
+	MaxSize int64
+	// SkipBody makes documents not read, so their lengths are taken
+	// from Content-Length header, if any, and other results which
+	// require body, e.g. checksums, are not computed.
+	SkipBody bool
+}
+
+// matches reports whether rule applies to media type.
+func (r *ContentRule) matches(mediaType string) bool {
+	pattern := strings.ToLower(r.ContentType)
+	if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+		return strings.HasPrefix(mediaType, prefix)
+	}
+
+	return mediaType == pattern
+}
+
+// runs reports whether analyzer of name is run on documents rule applies to.
+func (r *ContentRule) runs(name string) bool {
+	if r == nil || r.Analyzers == nil {
+		return true
+	}
+
+	for _, a := range r.Analyzers {
+		if a == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contentRule returns the first rule applying to
+// content type of response, or nil if there is none.
+func (h *Handler) contentRule(header http.Header) *ContentRule {
+	if len(h.contentRules) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+
+	for i := range h.contentRules {
+		if h.contentRules[i].matches(mediaType) {
+			return &h.contentRules[i]
+		}
+	}
+
+	return nil
+}
+
+// sizeLimitReader reads document, failing with
+// errDocumentTooLarge once more than left bytes are read.
+type sizeLimitReader struct {
+	r    io.Reader
+	left int64
+}
+
+// Read implements io.Reader interface.
+func (r *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.left -= int64(n); r.left < 0 {
+		return n, errDocumentTooLarge
+	}
+
+	return n, err
+}
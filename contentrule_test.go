@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerContentRules(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html></html>"))
+		case "/video":
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Write(make([]byte, 2000))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Content-Length", "100000")
+			w.Write(make([]byte, 100000))
+		}
+	}))
+	defer server.Close()
+
+	size := AnalyzerFunc(func(url string, header http.Header, body io.Reader) (interface{}, error) {
+		n, err := io.Copy(ioutil.Discard, body)
+
+		return n, err
+	})
+
+	s := httptest.NewServer(NewHandler(
+		WithAnalyzer("size", size),
+		WithAnalyzer("other", size),
+		WithContentRules(
+			ContentRule{ContentType: "text/html", Analyzers: []string{"size"}},
+			ContentRule{ContentType: "video/*", MaxSize: 1000},
+			ContentRule{ContentType: "image/*", SkipBody: true},
+		),
+		WithOrderedResults(),
+	))
+	defer s.Close()
+
+	body := strings.Join([]string{server.URL + "/page", server.URL + "/video", server.URL + "/image"}, "\n")
+
+	results := fetchResults(t, s.URL, strings.NewReader(body))
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+
+	page := results[0]
+	if _, ok := page.Analysis["size"]; !ok || len(page.Analysis) != 1 {
+		t.Errorf("expected only size analyzer run on page, got %+v", page)
+	}
+
+	video := results[1]
+	if video.Error != errDocumentTooLarge.Error() || len(video.Analysis) != 0 {
+		t.Errorf("expected video exceeding size limit, got %+v", video)
+	}
+
+	image := results[2]
+	if image.Length != 100000 || image.ContentType != "image/png" || image.Error != "" || len(image.Analysis) != 0 {
+		t.Errorf("expected image length taken from header, got %+v", image)
+	}
+}
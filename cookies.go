@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// newBatchJar creates ephemeral cookie jar of single batch.
+func newBatchJar() http.CookieJar {
+	// cookiejar.New never fails
+	jar, _ := cookiejar.New(nil)
+
+	return jar
+}
+
+// withJar returns client used for requests of batch. If batch has
+// cookie jar of its own, or Handler has shared one, client's copy
+// using the jar is returned.
+func (h *Handler) withJar(b *batch, client *http.Client) *http.Client {
+	jar := b.jar
+	if jar == nil {
+		jar = h.cookieJar
+	}
+	if jar == nil {
+		return client
+	}
+
+	c := *client
+	c.Jar = jar
+
+	return &c
+}
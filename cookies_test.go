@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerCookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+		case "/check":
+			if c, err := r.Cookie("session"); err == nil && c.Value == "abc" {
+				w.Write([]byte("ok"))
+			}
+		}
+	}))
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+
+	tests := []struct {
+		name string
+		opt  Option
+		// shared is length of document of the second request,
+		// which reports whether cookie is shared between requests
+		shared int
+	}{
+		{"batch", WithBatchCookies(), 0},
+		{"shared", WithCookieJar(jar), 2},
+	}
+
+	for _, test := range tests {
+		s := httptest.NewServer(NewHandler(test.opt, WithSynchronousFetching(), WithOrderedResults()))
+
+		results := fetchResults(t, s.URL, strings.NewReader(server.URL+"/login\n"+server.URL+"/check"))
+		if len(results) != 2 || results[1].Length != 2 {
+			t.Errorf("%s: expected cookie sent by the second fetch, got %+v", test.name, results)
+		}
+
+		results = fetchResults(t, s.URL, strings.NewReader(server.URL+"/check"))
+		if len(results) != 1 || results[0].Length != test.shared {
+			t.Errorf("%s: unexpected result of the second request %+v", test.name, results)
+		}
+
+		s.Close()
+	}
+}
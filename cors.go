@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy defines which browser origins are allowed
+// to make cross-origin requests.
+type corsPolicy struct {
+	origins []string
+	headers []string
+	maxAge  time.Duration
+}
+
+// allowedOrigin returns value of Access-Control-Allow-Origin header
+// for origin, or empty string if origin is not allowed.
+func (p *corsPolicy) allowedOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+
+	for _, o := range p.origins {
+		if o == "*" {
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+
+	return ""
+}
+
+// setHeaders sets CORS headers of actual response.
+func (p *corsPolicy) setHeaders(writer http.ResponseWriter, request *http.Request) {
+	header := writer.Header()
+	header.Add("Vary", "Origin")
+
+	origin := p.allowedOrigin(request.Header.Get("Origin"))
+	if origin == "" {
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Set("Access-Control-Expose-Headers", strings.Join(summaryHeaders, ", "))
+}
+
+// preflight responds to CORS preflight request allowing
+// given methods. It reports
+// whether request is preflight one and has been responded.
+func (p *corsPolicy) preflight(writer http.ResponseWriter, request *http.Request, methods []string) bool {
+	if request.Method != http.MethodOptions || request.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+
+	header := writer.Header()
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := p.allowedOrigin(request.Header.Get("Origin"))
+	if origin == "" {
+		writer.WriteHeader(http.StatusForbidden)
+
+		return true
+	}
+
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(p.headers) != 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(p.headers, ", "))
+	}
+	if p.maxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+
+	return true
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerCORS(t *testing.T) {
+	h := NewHandler(
+		WithCORS([]string{"https://app.example.com"}, []string{"Content-Type"}, time.Hour),
+		WithAuth(BearerTokens("secret")),
+	)
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	header := w.Header()
+	if header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		header.Get("Access-Control-Allow-Methods") != http.MethodPost ||
+		header.Get("Access-Control-Allow-Headers") != "Content-Type" ||
+		header.Get("Access-Control-Max-Age") != "3600" {
+		t.Errorf("unexpected preflight headers: %v", header)
+	}
+
+	req = httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight of disallowed origin is accepted")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Authorization", "Bearer secret")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("unexpected response: %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+// textCounter counts words and lines of text written to it.
+// Words are sequences of non-whitespace characters.
+type textCounter struct {
+	words  int
+	lines  int
+	inWord bool
+	last   byte
+	empty  bool
+}
+
+// newTextCounter creates new textCounter.
+func newTextCounter() *textCounter {
+	return &textCounter{
+		empty: true,
+	}
+}
+
+// Write implements io.Writer interface.
+func (c *textCounter) Write(p []byte) (int, error) {
+	for _, ch := range p {
+		switch ch {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+			c.inWord = false
+		default:
+			if !c.inWord {
+				c.words++
+				c.inWord = true
+			}
+		}
+
+		if ch == '\n' {
+			c.lines++
+		}
+	}
+
+	if len(p) > 0 {
+		c.last = p[len(p)-1]
+		c.empty = false
+	}
+
+	return len(p), nil
+}
+
+// count returns number of words and lines.
+// Last line is counted even if it is not terminated.
+func (c *textCounter) count() (words, lines int) {
+	lines = c.lines
+	if !c.empty && c.last != '\n' {
+		lines++
+	}
+
+	return c.words, lines
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"testing"
+)
+
+func TestTextCounter(t *testing.T) {
+	tests := map[string]struct {
+		chunks []string
+		words  int
+		lines  int
+	}{
+		"empty": {},
+		"single line": {
+			chunks: []string{"hello  world"},
+			words:  2,
+			lines:  1,
+		},
+		"terminated lines": {
+			chunks: []string{"one two\n", "three\n"},
+			words:  3,
+			lines:  2,
+		},
+		"word split across chunks": {
+			chunks: []string{"hel", "lo wo", "rld\r\nbye"},
+			words:  3,
+			lines:  2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := newTextCounter()
+			for _, chunk := range test.chunks {
+				c.Write([]byte(chunk))
+			}
+
+			if words, lines := c.count(); words != test.words || lines != test.lines {
+				t.Errorf("expected %d words and %d lines, got %d and %d", test.words, test.lines, words, lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// errCrawlDisabled is returned for requests in crawl mode
+// unless WithCrawl option is provided.
+var errCrawlDisabled = errors.New("crawl is not enabled")
+
+// crawl fetches batch's URLs and follows links to the same hosts found
+// in HTML documents, level by level, up to depth and number of pages set
+// by WithCrawl option. Pages found on one level are fetched once all
+// results of the previous one are sent, and each page is fetched once.
+// If tenant is set, each level is taken from its URL quota.
+func (h *Handler) crawl(b *batch, tn *tenant) <-chan *Result {
+	out := make(chan *Result)
+	parent := b.ctx
+
+	// links are extracted to be followed, but reported only if requested
+	links := b.links
+	b.links = LinksList
+
+	visited := make(map[string]bool, len(b.targets))
+	for _, t := range b.targets {
+		visited[t.URL] = true
+	}
+	pages := len(b.targets)
+
+	go func() {
+		defer close(out)
+
+		for depth := 0; len(b.targets) != 0; depth++ {
+			results := h.fetch(b)
+			if b.ordered {
+				results = inOrder(b, results)
+			}
+
+			var next []target
+			for result := range results {
+				if depth < h.crawlDepth {
+					for _, link := range sameHostLinks(result) {
+						if pages < h.crawlPages && !visited[link] {
+							visited[link] = true
+							next = append(next, target{URL: link})
+							pages++
+						}
+					}
+				}
+
+				result.Depth = depth
+				if links != LinksList {
+					result.Links = nil
+				}
+				if links == LinksNone {
+					result.LinkCount = 0
+				}
+
+				if !b.send(out, result) {
+					return
+				}
+			}
+
+			// strict batch is failed, or batch is canceled
+			if b.failure != nil || parent.Err() != nil || len(next) == 0 {
+				return
+			}
+
+			if tn != nil {
+				if ok, _ := tn.take(len(next)); !ok {
+					b.logger.Printf("crawl: %s", errQuotaExceeded)
+
+					return
+				}
+			}
+
+			b.ctx = parent
+			b.targets = next
+			atomic.AddInt64(&b.total, int64(len(next)))
+		}
+	}()
+
+	return out
+}
+
+// sameHostLinks returns links of result pointing to the same
+// host as document, after redirects if any.
+func sameHostLinks(result *Result) []string {
+	page := result.FinalURL
+	if page == "" {
+		page = result.URL
+	}
+
+	base, err := url.Parse(page)
+	if err != nil {
+		return nil
+	}
+
+	var found []string
+	for _, link := range result.Links {
+		u, err := url.Parse(link)
+		if err == nil && strings.EqualFold(u.Host, base.Host) {
+			found = append(found, link)
+		}
+	}
+
+	return found
+}
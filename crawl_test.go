@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newCrawlServer(t *testing.T, requests map[string]int, mu *sync.Mutex) *httptest.Server {
+	pages := map[string]string{
+		"/":  `<a href="/a">a</a><a href="/b">b</a><a href="https://other.example/">other</a>`,
+		"/a": `<a href="/">home</a><a href="/c">c</a>`,
+		"/b": `<a href="/c">c</a><a href="/d">d</a>`,
+		"/c": `<a href="/e">e</a>`,
+		"/d": `no links`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, page)
+	}))
+}
+
+func crawlResults(t *testing.T, url, body string) []Result {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(inputModeHeader, "crawl")
+
+	return doFetchResults(t, req)
+}
+
+func TestHandlerCrawl(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+
+	server := newCrawlServer(t, requests, &mu)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithCrawl(2, 100)))
+	defer s.Close()
+
+	results := crawlResults(t, s.URL, server.URL+"/")
+
+	var pages []string
+	for _, r := range results {
+		if r.Error != "" || r.Links != nil || r.LinkCount != 0 {
+			t.Errorf("unexpected result %+v", r)
+		}
+
+		pages = append(pages, fmt.Sprintf("%s:%d", strings.TrimPrefix(r.URL, server.URL), r.Depth))
+	}
+	sort.Strings(pages)
+
+	if expected := "/:0 /a:1 /b:1 /c:2 /d:2"; strings.Join(pages, " ") != expected {
+		t.Errorf("expected pages %s, got %s", expected, pages)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for path, n := range requests {
+		if n != 1 {
+			t.Errorf("expected %s fetched once, got %d", path, n)
+		}
+	}
+}
+
+func TestHandlerCrawlPages(t *testing.T) {
+	var mu sync.Mutex
+
+	server := newCrawlServer(t, make(map[string]int), &mu)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithCrawl(5, 3)))
+	defer s.Close()
+
+	if results := crawlResults(t, s.URL, server.URL+"/"); len(results) != 3 {
+		t.Errorf("expected 3 pages, got %+v", results)
+	}
+}
+
+func TestHandlerCrawlDisabled(t *testing.T) {
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, strings.NewReader("http://127.0.0.1/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(inputModeHeader, "crawl")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Credentials are attached to outgoing requests.
+type Credentials struct {
+	// Header contains headers added to request.
+	Header http.Header
+	// Username and Password are used for basic authentication
+	// if Username is not empty.
+	Username string
+	Password string
+	// BearerToken is passed in Authorization header if not empty.
+	BearerToken string
+}
+
+// apply attaches credentials to req.
+func (c *Credentials) apply(req *http.Request) {
+	for key, values := range c.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	}
+}
+
+// CredentialProvider provides credentials of target hosts, so different
+// hosts can use different credentials managed outside of request body.
+// Credentials returns nil if there are no credentials for host.
+type CredentialProvider interface {
+	Credentials(ctx context.Context, host string) (*Credentials, error)
+}
+
+// CredentialProviderFunc is function implementing CredentialProvider interface.
+type CredentialProviderFunc func(ctx context.Context, host string) (*Credentials, error)
+
+// Credentials implements CredentialProvider interface.
+func (f CredentialProviderFunc) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	return f(ctx, host)
+}
+
+// staticCredentials provides credentials of fixed host patterns.
+type staticCredentials struct {
+	patterns []string
+	creds    map[string]Credentials
+}
+
+// StaticCredentials returns CredentialProvider of credentials keyed by host
+// patterns, which may contain shell-like wildcards, e.g. "*.example.com".
+// Exact host matches take precedence, then longer patterns are preferred.
+func StaticCredentials(creds map[string]Credentials) CredentialProvider {
+	sc := &staticCredentials{
+		creds: creds,
+	}
+
+	for pattern := range creds {
+		sc.patterns = append(sc.patterns, pattern)
+	}
+	sort.Slice(sc.patterns, func(i, j int) bool {
+		if len(sc.patterns[i]) != len(sc.patterns[j]) {
+			return len(sc.patterns[i]) > len(sc.patterns[j])
+		}
+
+		return sc.patterns[i] < sc.patterns[j]
+	})
+
+	return sc
+}
+
+// Credentials implements CredentialProvider interface.
+func (sc *staticCredentials) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	if c, ok := sc.creds[host]; ok {
+		return &c, nil
+	}
+
+	for _, pattern := range sc.patterns {
+		if matchHost(pattern, host) {
+			c := sc.creds[pattern]
+
+			return &c, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// attachCredentials attaches credentials provided for request's host
+// and returns names of their custom headers, e.g. API keys.
+func (h *Handler) attachCredentials(req *http.Request) ([]string, error) {
+	if h.credentials == nil {
+		return nil, nil
+	}
+
+	creds, err := h.credentials.Credentials(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("%s: credentials: %w", h.redactor.url(req.URL.String()), err)
+	}
+	if creds == nil {
+		return nil, nil
+	}
+	creds.apply(req)
+
+	var headers []string
+	for key := range creds.Header {
+		headers = append(headers, key)
+	}
+
+	return headers, nil
+}
+
+// credentialHeadersKey is context key of names of
+// headers attached to request by credentials.
+type credentialHeadersKey struct{}
+
+// withCredentialHeaders returns context carrying names
+// of headers attached to request by credentials.
+func withCredentialHeaders(ctx context.Context, headers []string) context.Context {
+	return context.WithValue(ctx, credentialHeadersKey{}, headers)
+}
+
+// credentialRedirects returns copy of client whose redirect policy removes
+// headers attached by credentials from requests redirected to hosts other
+// than the original one, since http.Client forwards custom headers, and
+// then applies redirect policy of client.
+func credentialRedirects(client *http.Client) *http.Client {
+	next := client.CheckRedirect
+
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if headers, ok := req.Context().Value(credentialHeadersKey{}).([]string); ok && req.URL.Hostname() != via[0].URL.Hostname() {
+			for _, key := range headers {
+				req.Header.Del(key)
+			}
+		}
+
+		if next != nil {
+			return next(req, via)
+		}
+		// default policy of http.Client
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+
+		return nil
+	}
+
+	return &c
+}
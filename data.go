@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// dataFetcher decodes data: URLs (RFC 2397) locally.
+var dataFetcher = SchemeFetcherFunc(func(ctx context.Context, method string, u *url.URL) (*Document, error) {
+	i := strings.IndexByte(u.Opaque, ',')
+	if i < 0 {
+		return nil, errors.New("invalid data URL: no comma")
+	}
+
+	meta, payload := u.Opaque[:i], u.Opaque[i+1:]
+
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	content := []byte(data)
+
+	if strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		meta = meta[:len(meta)-len(";base64")]
+
+		content, err = base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if meta == "" || strings.HasPrefix(meta, ";") {
+		meta = "text/plain" + meta
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", meta)
+	header.Set("Content-Length", strconv.Itoa(len(content)))
+
+	return &Document{
+		Header: header,
+		Body:   ioutil.NopCloser(bytes.NewReader(content)),
+	}, nil
+})
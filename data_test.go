@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerDataURL(t *testing.T) {
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	tests := map[string]struct {
+		length      int
+		contentType string
+		failed      bool
+	}{
+		"data:,Hello%2C%20World%21": {
+			length:      13,
+			contentType: "text/plain",
+		},
+		"data:text/html;base64,PGh0bWw+PC9odG1sPg==": {
+			length:      13,
+			contentType: "text/html",
+		},
+		"data:;charset=utf-8,abc": {
+			length:      3,
+			contentType: "text/plain",
+		},
+		"data:text/plain;base64,***": {
+			failed: true,
+		},
+	}
+
+	for url, test := range tests {
+		t.Run(url, func(t *testing.T) {
+			results := fetchResults(t, s.URL, getRequestBodyBuffer(url))
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %+v", results)
+			}
+
+			r := results[0]
+			if test.failed {
+				if r.Error == "" {
+					t.Errorf("expected error, got %+v", r)
+				}
+
+				return
+			}
+
+			if r.Length != test.length || r.ContentType != test.contentType {
+				t.Errorf("unexpected result: %+v", r)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"expvar"
+	"net/http"
+	"sync/atomic"
+)
+
+// Mux returns http.Handler which serves Handler at "/" along with
+// operational endpoints, so they do not need separate wiring:
+//
+//	/healthz      always responds with 200 while process is alive
+//	/readyz       responds with 503 once Handler is closed,
+//	              limit of in-flight requests is reached, unless
+//	              custom Limiter is used, or ShedPolicy would
+//	              reject the probe
+//
+// If WithDebugEndpoints option is provided, /debug/pprof/ and
+// /debug/vars are served as well.
+func (h *Handler) Mux() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/", h)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", h.serveReady)
+
+	if h.debugEndpoints {
+		mux.HandleFunc(pprofPrefix, servePprofIndex)
+		mux.HandleFunc(pprofPrefix+"cmdline", servePprofCmdline)
+		mux.HandleFunc(pprofPrefix+"profile", servePprofCPU)
+		mux.HandleFunc(pprofPrefix+"trace", servePprofTrace)
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
+
+	return mux
+}
+
+// serveReady reports whether Handler is ready to serve requests.
+func (h *Handler) serveReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	switch {
+	case atomic.LoadInt32(&h.closed) != 0:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("closed\n"))
+	case h.maxRequests > 0 && h.InFlightRequests() >= h.maxRequests, !h.ready(r):
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("overloaded\n"))
+	default:
+		w.Write([]byte("ok\n"))
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func getStatus(t *testing.T, url string) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestHandlerMux(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	h := NewHandler(LimitRequests(1))
+
+	s := httptest.NewServer(h.Mux())
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, strings.NewReader(getUrl(server.URL, 10, 0)))
+	if len(results) != 1 || results[0].Length != 10 {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	// debug endpoints are not mounted, so requests reach Handler
+	tests := map[string]int{
+		"/healthz":      http.StatusOK,
+		"/readyz":       http.StatusOK,
+		"/debug/vars":   http.StatusMethodNotAllowed,
+		"/debug/pprof/": http.StatusMethodNotAllowed,
+	}
+	for path, status := range tests {
+		if got := getStatus(t, s.URL+path); got != status {
+			t.Errorf("%s: expected status %d, got %d", path, status, got)
+		}
+	}
+
+	h.limiter.Acquire(context.Background())
+	atomic.AddInt64(&h.inFlight, 1)
+	if got := getStatus(t, s.URL+"/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("expected overloaded handler not ready, got %d", got)
+	}
+	h.release()
+
+	h.Close()
+	if got := getStatus(t, s.URL+"/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("expected closed handler not ready, got %d", got)
+	}
+	if got := getStatus(t, s.URL+"/healthz"); got != http.StatusOK {
+		t.Errorf("expected closed handler alive, got %d", got)
+	}
+}
+
+func TestHandlerMuxDebugEndpoints(t *testing.T) {
+	s := httptest.NewServer(NewHandler(WithDebugEndpoints()).Mux())
+	defer s.Close()
+
+	for _, path := range []string{"/debug/vars", "/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/heap", "/debug/pprof/goroutine?debug=1", "/debug/pprof/profile?seconds=0.1", "/debug/pprof/trace?seconds=0.1"} {
+		if got := getStatus(t, s.URL+path); got != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", path, got)
+		}
+	}
+}
+
+func TestPprofNotRegisteredGlobally(t *testing.T) {
+	NewHandler(WithDebugEndpoints()).Mux()
+
+	if _, pattern := http.DefaultServeMux.Handler(httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)); pattern == "/debug/pprof/" {
+		t.Error("profiling endpoints are registered on http.DefaultServeMux")
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"sort"
+	"strings"
+)
+
+// key returns string identifying target. Targets with
+// equal keys produce equal outgoing requests.
+func (t target) key() string {
+	if len(t.Headers) == 0 {
+		return t.fetchURL()
+	}
+
+	keys := make([]string, 0, len(t.Headers))
+	for key := range t.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+
+	sb.WriteString(t.fetchURL())
+	for _, key := range keys {
+		sb.WriteString("\n" + key + ": " + t.Headers[key])
+	}
+
+	return sb.String()
+}
+
+// dedupe groups indexes of batch's targets by their keys.
+// Returned slices are ordered by first occurrence of target.
+func dedupe(targets []target) [][]int {
+	var groups [][]int
+
+	seen := make(map[string]int)
+
+	for i, t := range targets {
+		key := t.key()
+
+		if g, ok := seen[key]; ok {
+			groups[g] = append(groups[g], i)
+
+			continue
+		}
+
+		seen[key] = len(groups)
+		groups = append(groups, []int{i})
+	}
+
+	return groups
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHandlerDeduplication(t *testing.T) {
+	var hits int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		writer.Write([]byte(request.URL.Path))
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithDeduplication()))
+	defer s.Close()
+
+	body := func() *bytes.Buffer {
+		return bytes.NewBufferString(strings.Join([]string{server.URL + "/a", server.URL + "/bb", server.URL + "/a", server.URL + "/a"}, "\n"))
+	}
+
+	resp, err := http.Post(s.URL, "text/plain", body())
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+
+	lengths := strings.Fields(string(data))
+	sort.Strings(lengths)
+
+	if strings.Join(lengths, " ") != "2 3" {
+		t.Errorf("unexpected response: %q", data)
+	}
+
+	if n := atomic.SwapInt64(&hits, 0); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+
+	results := fetchResults(t, s.URL, body())
+	if len(results) != 4 {
+		t.Errorf("expected 4 results, got %+v", results)
+	}
+
+	if n := atomic.LoadInt64(&hits); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
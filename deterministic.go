@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedSource is rand.Source safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+// newRand creates rand.Rand safe for concurrent use seeded with seed.
+func newRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{
+		src: rand.NewSource(seed),
+	})
+}
+
+// Int63 implements rand.Source interface.
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.src.Int63()
+}
+
+// Seed implements rand.Source interface.
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.src.Seed(seed)
+}
+
+// since returns time elapsed since t by Handler's clock.
+func (h *Handler) since(t time.Time) time.Duration {
+	return h.now().Sub(t)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerDeterministicMode(t *testing.T) {
+	var active, maxActive int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+				break
+			}
+		}
+
+		length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+		time.Sleep(time.Millisecond * time.Duration(50-length))
+		w.Write([]byte(strings.Repeat("a", length)))
+	}))
+	defer server.Close()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := httptest.NewServer(NewHandler(WithDeterministicMode(func() time.Time { return now }, 1)))
+	defer s.Close()
+
+	var urls []string
+	for i := 1; i <= 5; i++ {
+		urls = append(urls, server.URL+"/?length="+strconv.Itoa(i*5))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "5\n10\n15\n20\n25\n"; string(body) != expected {
+		t.Errorf("expected %q, got %q", expected, body)
+	}
+	if d := resp.Trailer.Get(totalDurationHeader); d != "0s" {
+		t.Errorf("expected total duration 0s, got %q", d)
+	}
+	if n := atomic.LoadInt32(&maxActive); n != 1 {
+		t.Errorf("expected URLs fetched one by one, got %d concurrent fetches", n)
+	}
+}
+
+func TestHandlerRandomSeed(t *testing.T) {
+	h1 := NewHandler(WithRandomSeed(42))
+	h2 := NewHandler(WithRandomSeed(42))
+
+	for i := 0; i < 10; i++ {
+		if a, b := h1.rand.Int63(), h2.rand.Int63(); a != b {
+			t.Fatalf("expected equal random sequences, got %d and %d", a, b)
+		}
+	}
+}
+
+func TestHandlerClockTimeout(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := httptest.NewServer(NewHandler(WithClock(func() time.Time { return now })))
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(getUrl(server.URL, 10, 0)))
+	req.Header.Set(timeoutHeader, "30s")
+
+	results := doFetchResults(t, req)
+	if len(results) != 1 || results[0].Error != "" || results[0].Length != 10 {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
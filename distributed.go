@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// releaseTimeout limits time of releasing slot of distributed limiter.
+const releaseTimeout = time.Second * 5
+
+// LimiterBackend stores counters shared by replicas of Handler,
+// so they enforce global limits together, e.g. behind load balancer.
+type LimiterBackend interface {
+	// Increment atomically adds delta to counter stored at key, sets its
+	// expiration to ttl and returns new value. Missing counter is zero.
+	Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+}
+
+// LeaseBackend stores leases of slots shared by replicas of Handler, so
+// they limit concurrency together. Every lease belongs to its holder and
+// expires unless it is released earlier, so slots of terminated replicas,
+// or ones whose release failed, are eventually freed.
+type LeaseBackend interface {
+	// AcquireLease atomically removes expired leases stored at key and
+	// adds lease of holder expiring after ttl, unless there are limit
+	// leases already. It reports whether lease is added.
+	AcquireLease(ctx context.Context, key, holder string, limit int64, ttl time.Duration) (bool, error)
+	// ReleaseLease removes lease of holder, if any.
+	ReleaseLease(ctx context.Context, key, holder string) error
+}
+
+// distributedLimiter limits number of requests served concurrently
+// by all replicas sharing backend's leases.
+type distributedLimiter struct {
+	backend LeaseBackend
+	key     string
+	limit   int64
+	ttl     time.Duration
+	// replica makes holders of leases unique among replicas.
+	replica string
+	seq     uint64
+	logger  *log.Logger
+
+	mu sync.Mutex
+	// held contains holders of acquired leases. Requests are not
+	// distinguished by Release, so any of them is released.
+	held []string
+}
+
+// NewDistributedLimiter creates new Limiter which admits up to limit
+// concurrent requests served by all replicas sharing leases stored at
+// key of backend. Every admitted request holds its own lease, which
+// expires ttl after it is acquired, so slots of replicas terminated
+// while serving requests are eventually released; ttl should exceed
+// time of serving the longest request. Requests are rejected if backend
+// fails, and failed releases are logged by Handler's logger.
+func NewDistributedLimiter(backend LeaseBackend, key string, limit int64, ttl time.Duration) Limiter {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &distributedLimiter{
+		backend: backend,
+		key:     key,
+		limit:   limit,
+		ttl:     ttl,
+		replica: hex.EncodeToString(id),
+		logger:  defaultLogger,
+	}
+}
+
+// Acquire implements Limiter interface.
+func (l *distributedLimiter) Acquire(ctx context.Context) error {
+	holder := l.replica + ":" + strconv.FormatUint(atomic.AddUint64(&l.seq, 1), 10)
+
+	ok, err := l.backend.AcquireLease(ctx, l.key, holder, l.limit, l.ttl)
+	if err != nil {
+		// lease may be acquired even if reply is not received
+		go l.release(holder)
+
+		return fmt.Errorf("acquiring slot: %w", err)
+	}
+	if !ok {
+		return ErrLimitExceeded
+	}
+
+	l.mu.Lock()
+	l.held = append(l.held, holder)
+	l.mu.Unlock()
+
+	return nil
+}
+
+// Release implements Limiter interface.
+func (l *distributedLimiter) Release() {
+	l.mu.Lock()
+	if len(l.held) == 0 {
+		l.mu.Unlock()
+
+		return
+	}
+	holder := l.held[len(l.held)-1]
+	l.held = l.held[:len(l.held)-1]
+	l.mu.Unlock()
+
+	l.release(holder)
+}
+
+// release releases lease of holder, logging failure.
+func (l *distributedLimiter) release(holder string) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if err := l.backend.ReleaseLease(ctx, l.key, holder); err != nil {
+		l.logger.Printf("releasing slot of distributed limiter: %s", err)
+	}
+}
+
+// distributedRate limits rate of outgoing requests made by all replicas
+// with counters of one-second windows shared through backend.
+type distributedRate struct {
+	backend LimiterBackend
+	key     string
+	rate    int64
+	// now is real clock rather than Handler's one, since windows
+	// are shared by replicas and waited for with timers.
+	now func() time.Time
+}
+
+// wait waits until request is allowed by limit, or ctx is done.
+func (r *distributedRate) wait(ctx context.Context) error {
+	for {
+		now := r.now()
+		window := now.Truncate(time.Second)
+
+		n, err := r.backend.Increment(ctx, r.key+":"+strconv.FormatInt(window.Unix(), 10), 1, time.Second*2)
+		if err != nil {
+			return fmt.Errorf("distributed rate limit: %w", err)
+		}
+		if n <= r.rate {
+			return nil
+		}
+
+		timer := time.NewTimer(window.Add(time.Second).Sub(now))
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		}
+	}
+}
+
+// distributedRateTransport delays requests exceeding distributed rate limit.
+type distributedRateTransport struct {
+	rate *distributedRate
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *distributedRateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.rate.wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	return t.next.RoundTrip(req)
+}
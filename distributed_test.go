@@ -0,0 +1,361 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lo00l/http-handler/internal/resp"
+)
+
+// fakeRedis serves subset of Redis protocol used by RedisBackend.
+type fakeRedis struct {
+	l        net.Listener
+	password string
+
+	mu       sync.Mutex
+	counters map[string]int64
+	ttls     map[string]string
+	leases   map[string]map[string]bool
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &fakeRedis{
+		l:        l,
+		password: password,
+		counters: make(map[string]int64),
+		ttls:     make(map[string]string),
+		leases:   make(map[string]map[string]bool),
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go r.serve(conn)
+		}
+	}()
+
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	authorized := r.password == ""
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			header, _ := reader.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+
+			arg := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, arg); err != nil {
+				return
+			}
+			args[i] = string(arg[:size])
+		}
+
+		switch {
+		case args[0] == "AUTH":
+			authorized = args[len(args)-1] == r.password
+			if !authorized {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+
+				continue
+			}
+			fmt.Fprint(conn, "+OK\r\n")
+		case !authorized:
+			fmt.Fprint(conn, "-NOAUTH Authentication required\r\n")
+		case args[0] == "EVAL" && args[1] == redisLeaseScript:
+			limit, _ := strconv.Atoi(args[5])
+
+			r.mu.Lock()
+			leases := r.leases[args[3]]
+			if leases == nil {
+				leases = make(map[string]bool)
+				r.leases[args[3]] = leases
+			}
+			acquired := len(leases) < limit
+			if acquired {
+				leases[args[4]] = true
+				r.ttls[args[3]] = args[6]
+			}
+			r.mu.Unlock()
+
+			if acquired {
+				fmt.Fprint(conn, ":1\r\n")
+			} else {
+				fmt.Fprint(conn, ":0\r\n")
+			}
+		case args[0] == "ZREM":
+			r.mu.Lock()
+			n := 0
+			if r.leases[args[1]][args[2]] {
+				delete(r.leases[args[1]], args[2])
+				n = 1
+			}
+			r.mu.Unlock()
+
+			fmt.Fprintf(conn, ":%d\r\n", n)
+		case args[0] == "EVAL":
+			delta, _ := strconv.ParseInt(args[4], 10, 64)
+
+			r.mu.Lock()
+			r.counters[args[3]] += delta
+			r.ttls[args[3]] = args[5]
+			value := r.counters[args[3]]
+			r.mu.Unlock()
+
+			fmt.Fprintf(conn, ":%d\r\n", value)
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func TestRedisBackend(t *testing.T) {
+	r := newFakeRedis(t, "secret")
+	defer r.l.Close()
+
+	b, err := NewRedisBackend("redis://:secret@" + r.l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := b.Increment(context.Background(), "requests", 1, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != i {
+			t.Errorf("expected %d, got %d", i, n)
+		}
+	}
+
+	if ttl := r.ttls["requests"]; ttl != "60000" {
+		t.Errorf("expected ttl 60000, got %s", ttl)
+	}
+
+	for i, expected := range []bool{true, true, false} {
+		ok, err := b.AcquireLease(context.Background(), "slots", strconv.Itoa(i), 2, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != expected {
+			t.Errorf("lease %d: expected %t, got %t", i, expected, ok)
+		}
+	}
+
+	if err := b.ReleaseLease(context.Background(), "slots", "0"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := b.AcquireLease(context.Background(), "slots", "3", 2, time.Minute); err != nil || !ok {
+		t.Errorf("expected lease acquired after release, got %t, %v", ok, err)
+	}
+
+	b, err = NewRedisBackend("redis://:wrong@" + r.l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	var rerr resp.Error
+	if _, err := b.Increment(context.Background(), "requests", 1, time.Minute); !errors.As(err, &rerr) {
+		t.Errorf("expected redis error, got %v", err)
+	}
+
+	if _, err := NewRedisBackend("http://localhost"); err == nil {
+		t.Error("expected error of unsupported scheme")
+	}
+}
+
+// memoryBackend is LimiterBackend and LeaseBackend
+// storing counters and leases in memory.
+type memoryBackend struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	// leases contains expiration times of leases by holders.
+	leases map[string]time.Time
+	// releaseErr is returned by ReleaseLease if set.
+	releaseErr error
+}
+
+func (b *memoryBackend) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.counters == nil {
+		b.counters = make(map[string]int64)
+	}
+	b.counters[key] += delta
+
+	return b.counters[key], nil
+}
+
+func (b *memoryBackend) AcquireLease(ctx context.Context, key, holder string, limit int64, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.leases == nil {
+		b.leases = make(map[string]time.Time)
+	}
+
+	now := time.Now()
+	for h, expires := range b.leases {
+		if !expires.After(now) {
+			delete(b.leases, h)
+		}
+	}
+
+	if int64(len(b.leases)) >= limit {
+		return false, nil
+	}
+	b.leases[holder] = now.Add(ttl)
+
+	return true, nil
+}
+
+func (b *memoryBackend) ReleaseLease(ctx context.Context, key, holder string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.releaseErr != nil {
+		return b.releaseErr
+	}
+	delete(b.leases, holder)
+
+	return nil
+}
+
+func TestDistributedLimiter(t *testing.T) {
+	backend := &memoryBackend{}
+
+	// limiters of two replicas
+	l1 := NewDistributedLimiter(backend, "requests", 2, time.Minute)
+	l2 := NewDistributedLimiter(backend, "requests", 2, time.Minute)
+
+	if err := l1.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.Acquire(context.Background()); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+
+	l2.Release()
+
+	if err := l1.Acquire(context.Background()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if n := len(backend.leases); n != 2 {
+		t.Errorf("expected 2 leases, got %d", n)
+	}
+
+	// releases without acquired slots do not free slots of others
+	l2.Release()
+	l2.Release()
+
+	if n := len(backend.leases); n != 2 {
+		t.Errorf("expected 2 leases, got %d", n)
+	}
+}
+
+func TestDistributedLimiterExpiration(t *testing.T) {
+	backend := &memoryBackend{
+		releaseErr: errors.New("connection refused"),
+	}
+
+	var logs bytes.Buffer
+
+	l := NewDistributedLimiter(backend, "requests", 1, time.Millisecond*50)
+	l.(*distributedLimiter).logger = log.New(&logs, "", 0)
+
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Release()
+
+	if !strings.Contains(logs.String(), "connection refused") {
+		t.Errorf("expected failed release logged, got %q", logs.String())
+	}
+
+	// slot is not released, but its lease expires
+	if err := l.Acquire(context.Background()); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Errorf("expected expired lease freed, got %v", err)
+	}
+}
+
+func TestHandlerDistributedRateLimit(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	backend := &memoryBackend{}
+	now := time.Now().Truncate(time.Second)
+
+	h := NewHandler(WithDistributedRateLimit(backend, "fetches", 2))
+	h.distributedRate.now = func() time.Time {
+		return now
+	}
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	urls := strings.Repeat(getUrl(server.URL, 10, 0)+"\n", 2)
+	if results := fetchResults(t, s.URL, strings.NewReader(urls)); len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+
+	key := "fetches:" + strconv.FormatInt(now.Unix(), 10)
+	if n := backend.counters[key]; n != 2 {
+		t.Errorf("expected 2 requests counted, got %d", n)
+	}
+
+	// the third request waits for the next window, which never comes
+	// with stopped clock, so it is bounded by request's timeout
+	req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(getUrl(server.URL, 10, 0)))
+	req.Header.Set(timeoutHeader, "100ms")
+
+	results := doFetchResults(t, req)
+	if len(results) != 1 || results[0].Error == "" {
+		t.Errorf("expected failed result, got %+v", results)
+	}
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DNSCacheStats contains DNS cache usage statistics.
+type DNSCacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// HitRate returns ratio of lookups served from cache.
+func (s DNSCacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(total)
+}
+
+// dnsEntry is cached result of host lookup.
+type dnsEntry struct {
+	addrs      []string
+	expires    time.Time
+	refreshing bool
+}
+
+// dnsCache caches resolved host addresses for ttl.
+// Expired entries are still served while they are refreshed
+// in background, so lookups never wait for stale hosts.
+type dnsCache struct {
+	ttl    time.Duration
+	lookup func(ctx context.Context, host string) ([]string, error)
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+
+	hits   uint64
+	misses uint64
+}
+
+// newDNSCache creates new DNS cache using default resolver.
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		lookup:  net.DefaultResolver.LookupHost,
+		entries: make(map[string]*dnsEntry),
+	}
+}
+
+// resolve returns addresses of host.
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	if ok {
+		if time.Now().After(entry.expires) && !entry.refreshing {
+			entry.refreshing = true
+
+			go c.refresh(host)
+		}
+		addrs := entry.addrs
+		c.mu.Unlock()
+
+		atomic.AddUint64(&c.hits, 1)
+
+		return addrs, nil
+	}
+	c.mu.Unlock()
+
+	atomic.AddUint64(&c.misses, 1)
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(host, addrs)
+
+	return addrs, nil
+}
+
+// refresh looks up host again and updates its entry.
+// If lookup fails, stale entry is kept until next attempt.
+func (c *dnsCache) refresh(host string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		c.mu.Lock()
+		c.entries[host].refreshing = false
+		c.mu.Unlock()
+
+		return
+	}
+
+	c.store(host, addrs)
+}
+
+// store saves addrs of host.
+func (c *dnsCache) store(host string, addrs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[host] = &dnsEntry{
+		addrs:   addrs,
+		expires: time.Now().Add(c.ttl),
+	}
+}
+
+// stats returns cache usage statistics.
+func (c *dnsCache) stats() DNSCacheStats {
+	return DNSCacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+}
+
+// dialContext wraps dial so that host names are resolved using cache.
+// Resolved addresses are tried in order until connection is established.
+func (c *dnsCache) dialContext(dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		addrs, err := c.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range addrs {
+			var conn net.Conn
+
+			conn, err = dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDNSCache(t *testing.T) {
+	var lookups uint64
+
+	c := newDNSCache(time.Millisecond * 50)
+	c.lookup = func(ctx context.Context, host string) ([]string, error) {
+		n := atomic.AddUint64(&lookups, 1)
+		if n == 1 {
+			return []string{"127.0.0.1"}, nil
+		}
+
+		return []string{"127.0.0.2"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		addrs, err := c.resolve(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addrs[0] != "127.0.0.1" {
+			t.Fatalf("unexpected addresses: %v", addrs)
+		}
+	}
+
+	if stats := c.stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	time.Sleep(time.Millisecond * 60)
+
+	// stale entry is served while it is refreshed
+	addrs, _ := c.resolve(context.Background(), "example.com")
+	if addrs[0] != "127.0.0.1" {
+		t.Fatalf("expected stale address, got %v", addrs)
+	}
+
+	time.Sleep(time.Millisecond * 10)
+
+	addrs, _ = c.resolve(context.Background(), "example.com")
+	if addrs[0] != "127.0.0.2" {
+		t.Fatalf("expected refreshed address, got %v", addrs)
+	}
+
+	if n := atomic.LoadUint64(&lookups); n != 2 {
+		t.Fatalf("expected 2 lookups, got %d", n)
+	}
+}
@@ -0,0 +1,32 @@
+package handler
+
+// duplicateGroupsHeader is response header containing number
+// of groups of URLs with identical content, see WithDuplicateDetection.
+const duplicateGroupsHeader = "X-Duplicate-Groups"
+
+// assignDuplicateGroups groups successfully fetched results by hashes of
+// their content and numbers groups of two or more results in order of their
+// first results, starting from 1. It returns number of such groups.
+func assignDuplicateGroups(results []*Result) int {
+	members := make(map[string][]*Result)
+	for _, r := range results {
+		if r.err == nil && r.contentHash != "" {
+			members[r.contentHash] = append(members[r.contentHash], r)
+		}
+	}
+
+	groups := 0
+	for _, r := range results {
+		group := members[r.contentHash]
+		if r.DuplicateGroup != 0 || len(group) < 2 || r.err != nil {
+			continue
+		}
+
+		groups++
+		for _, member := range group {
+			member.DuplicateGroup = groups
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerDuplicateDetection(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a", "/mirror/a":
+			w.Write([]byte("document a"))
+		case "/b", "/mirror/b", "/copy/b":
+			w.Write([]byte("document b"))
+		default:
+			w.Write([]byte("unique " + r.URL.Path))
+		}
+	}))
+	defer target.Close()
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"urls": []string{
+			target.URL + "/b", target.URL + "/a", target.URL + "/c",
+			target.URL + "/mirror/a", target.URL + "/mirror/b", target.URL + "/copy/b",
+		},
+		"duplicates": true,
+		"ordered":    true,
+		"format":     "json",
+	})
+
+	resp, err := http.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var results []Result
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{1, 2, 0, 2, 1, 1}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %+v", len(expected), results)
+	}
+	for i, r := range results {
+		if r.DuplicateGroup != expected[i] {
+			t.Errorf("%s: expected group %d, got %d", r.URL, expected[i], r.DuplicateGroup)
+		}
+	}
+
+	if groups := resp.Header.Get(duplicateGroupsHeader); groups != "2" {
+		t.Errorf("expected 2 groups, got %q", groups)
+	}
+}
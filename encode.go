@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// encoder writes fetch results to response.
+type encoder interface {
+	// contentType returns value of Content-Type response header.
+	contentType() string
+	// begin is called once before any result is encoded.
+	begin(w io.Writer) error
+	// encode writes single result.
+	encode(w io.Writer, r *Result) error
+	// end is called once after all results are encoded.
+	end(w io.Writer) error
+}
+
+// TextFormat defines layout of plain text output, see WithTextFormat.
+type TextFormat struct {
+	// FieldSeparator makes records contain URL followed by separator
+	// and length of document. Empty means records contain lengths only.
+	FieldSeparator string
+	// RecordTerminator terminates every record, e.g. "\x00" for
+	// NUL-delimited output. Empty means new line.
+	RecordTerminator string
+}
+
+// terminator returns record terminator of format.
+func (f TextFormat) terminator() string {
+	if f.RecordTerminator == "" {
+		return "\n"
+	}
+
+	return f.RecordTerminator
+}
+
+// textEncoder writes lengths of successfully fetched documents, optionally
+// preceded by their URLs, as records laid out by format. Failed results
+// are omitted.
+type textEncoder struct {
+	format TextFormat
+}
+
+func (e *textEncoder) contentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+func (e *textEncoder) begin(w io.Writer) error {
+	return nil
+}
+
+func (e *textEncoder) encode(w io.Writer, r *Result) error {
+	if r.err != nil {
+		return nil
+	}
+
+	if e.format.FieldSeparator == "" {
+		_, err := fmt.Fprint(w, r.Length, e.format.terminator())
+
+		return err
+	}
+
+	_, err := fmt.Fprint(w, r.URL, e.format.FieldSeparator, r.Length, e.format.terminator())
+
+	return err
+}
+
+func (e *textEncoder) end(w io.Writer) error {
+	return nil
+}
+
+// jsonEncoder writes all results, including failed ones,
+// as JSON array of objects.
+type jsonEncoder struct {
+	count int
+}
+
+func (e *jsonEncoder) contentType() string {
+	return "application/json"
+}
+
+func (e *jsonEncoder) begin(w io.Writer) error {
+	_, err := io.WriteString(w, "[")
+
+	return err
+}
+
+func (e *jsonEncoder) encode(w io.Writer, r *Result) error {
+	if e.count > 0 {
+		if _, err := io.WriteString(w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+
+	buf := getEncodeBuffer()
+	defer putEncodeBuffer(buf)
+
+	if err := json.NewEncoder(buf).Encode(r); err != nil {
+		return err
+	}
+
+	// Encode terminates value with new line, which is not needed inside array
+	_, err := w.Write(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}))
+
+	return err
+}
+
+func (e *jsonEncoder) end(w io.Writer) error {
+	_, err := io.WriteString(w, "]\n")
+
+	return err
+}
+
+// xmlEncoder writes all results, including failed ones, as XML document:
+//
+//	<results>
+//	  <result>
+//	    <url>https://example.com</url>
+//	    <length>1256</length>
+//	    <status>200</status>
+//	  </result>
+//	</results>
+//
+// Each result element contains child elements named as fields
+// of JSON result objects. Empty optional elements are omitted.
+type xmlEncoder struct {
+	// enc is reused for all results, since it allocates
+	// buffer of its own. It is flushed after every result.
+	enc *xml.Encoder
+}
+
+func (e *xmlEncoder) contentType() string {
+	return "application/xml"
+}
+
+func (e *xmlEncoder) begin(w io.Writer) error {
+	e.enc = xml.NewEncoder(w)
+
+	_, err := io.WriteString(w, xml.Header+"<results>")
+
+	return err
+}
+
+func (e *xmlEncoder) encode(w io.Writer, r *Result) error {
+	return e.enc.EncodeElement(r, xml.StartElement{Name: xml.Name{Local: "result"}})
+}
+
+func (e *xmlEncoder) end(w io.Writer) error {
+	_, err := io.WriteString(w, "</results>\n")
+
+	return err
+}
+
+// msgpackEncoder writes all results, including failed ones,
+// as MessagePack array of maps with the same keys as JSON objects.
+// Since array length must precede its items, results are buffered
+// until all of them are received.
+type msgpackEncoder struct {
+	buf   bytes.Buffer
+	enc   *msgpack.Encoder
+	count int
+}
+
+func (e *msgpackEncoder) contentType() string {
+	return "application/msgpack"
+}
+
+func (e *msgpackEncoder) begin(w io.Writer) error {
+	e.enc = msgpack.NewEncoder(&e.buf).UseJSONTag(true)
+
+	return nil
+}
+
+func (e *msgpackEncoder) encode(w io.Writer, r *Result) error {
+	e.count++
+
+	return e.enc.Encode(r)
+}
+
+func (e *msgpackEncoder) end(w io.Writer) error {
+	if err := msgpack.NewEncoder(w).EncodeArrayLen(e.count); err != nil {
+		return err
+	}
+
+	_, err := e.buf.WriteTo(w)
+
+	return err
+}
+
+// encoders maps supported media types to encoder constructors.
+var encoders = map[string]func() encoder{
+	"text/plain":            func() encoder { return &textEncoder{} },
+	"application/json":      func() encoder { return &jsonEncoder{} },
+	"application/xml":       func() encoder { return &xmlEncoder{} },
+	"text/xml":              func() encoder { return &xmlEncoder{} },
+	"application/msgpack":   func() encoder { return &msgpackEncoder{} },
+	"application/x-msgpack": func() encoder { return &msgpackEncoder{} },
+}
+
+// formats maps names of output formats to media types.
+var formats = map[string]string{
+	"text":    "text/plain",
+	"json":    "application/json",
+	"xml":     "application/xml",
+	"msgpack": "application/msgpack",
+}
+
+// newEncoder creates encoder for format. If format
+// is empty, encoder is negotiated by request's Accept header.
+func newEncoder(format string, request *http.Request) encoder {
+	if mediaType, ok := formats[format]; ok {
+		return encoders[mediaType]()
+	}
+
+	return negotiateEncoder(request)
+}
+
+// negotiateEncoder selects encoder based on request's Accept header.
+// Media types are tried in order of appearance; plain text encoder
+// is used if none of them is supported.
+func negotiateEncoder(request *http.Request) encoder {
+	for _, accept := range request.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			if newEncoder, ok := encoders[mediaType]; ok {
+				return newEncoder()
+			}
+		}
+	}
+
+	return &textEncoder{}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestHandlerXML(t *testing.T) {
+	server := createServer(0)
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(getUrl(server.URL, 100, 0), getUrl(server.URL, 200, 0)))
+	req.Header.Set("Accept", "text/html, application/xml;q=0.9")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/xml" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	var doc struct {
+		Results []Result `xml:"result"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+
+	if len(doc.Results) != 2 || doc.Results[0].Length+doc.Results[1].Length != 300 {
+		t.Errorf("unexpected results: %+v", doc.Results)
+	}
+}
+
+func TestHandlerMessagePack(t *testing.T) {
+	server := createServer(0)
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(getUrl(server.URL, 100, 0), "invalid"))
+	req.Header.Set("Accept", "application/msgpack")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var results []Result
+	if err := msgpack.NewDecoder(resp.Body).UseJSONTag(true).Decode(&results); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+
+	if len(results) != 2 || results[0].Length+results[1].Length != 100 || results[0].Error+results[1].Error == "" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+func TestHandlerTextFormat(t *testing.T) {
+	server := createServer(0)
+
+	s := httptest.NewServer(NewHandler(
+		WithOrderedResults(),
+		WithTextFormat(TextFormat{FieldSeparator: "\t", RecordTerminator: "\x00"}),
+	))
+	defer s.Close()
+
+	first, second := getUrl(server.URL, 100, 0), getUrl(server.URL, 200, 0)
+
+	resp, err := http.Post(s.URL, "text/plain", getRequestBodyBuffer(first, second, "invalid"))
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %s", err)
+	}
+
+	if expected := first + "\t100\x00" + second + "\t200\x00"; string(body) != expected {
+		t.Errorf("expected %q, got %q", expected, body)
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// errInjectedFault is error of outgoing requests failed by fault injection.
+var errInjectedFault = errors.New("injected fault")
+
+// FaultInjection configures faults injected into outgoing requests and
+// admission of incoming ones, so consumers of Handler can be tested
+// against slow or failing fetches. Rates are probabilities from 0 to 1.
+type FaultInjection struct {
+	// FetchDelay is delay added to outgoing requests with probability FetchDelayRate.
+	FetchDelay     time.Duration
+	FetchDelayRate float64
+	// FetchErrorRate is probability outgoing request fails with injected fault.
+	FetchErrorRate float64
+	// RequestDelay is delay added to admission of incoming requests
+	// with probability RequestDelayRate.
+	RequestDelay     time.Duration
+	RequestDelayRate float64
+	// RequestErrorRate is probability incoming request
+	// is rejected with 503 Service Unavailable.
+	RequestErrorRate float64
+}
+
+// inject reports whether fault of rate is injected.
+func inject(r *rand.Rand, rate float64) bool {
+	return rate > 0 && r.Float64() < rate
+}
+
+// faultTransport injects delays and failures into outgoing requests.
+type faultTransport struct {
+	faults *FaultInjection
+	rand   *rand.Rand
+	next   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if inject(t.rand, t.faults.FetchDelayRate) {
+		timer := time.NewTimer(t.faults.FetchDelay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+
+			return nil, req.Context().Err()
+		}
+	}
+
+	if inject(t.rand, t.faults.FetchErrorRate) {
+		return nil, errInjectedFault
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// admitFaulty delays admission of incoming request or rejects it
+// as configured by fault injection. It reports whether request is admitted.
+func (h *Handler) admitFaulty(writer http.ResponseWriter, request *http.Request) bool {
+	if inject(h.rand, h.faults.RequestDelayRate) {
+		timer := time.NewTimer(h.faults.RequestDelay)
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			timer.Stop()
+
+			return false
+		}
+	}
+
+	if inject(h.rand, h.faults.RequestErrorRate) {
+		h.logger.Printf("%s: request is rejected by fault injection", h.clientIP(request))
+		http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+		return false
+	}
+
+	return true
+}
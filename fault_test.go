@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerFaultInjectionFetches(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithFaultInjection(FaultInjection{
+		FetchDelay:     time.Millisecond * 100,
+		FetchDelayRate: 1,
+		FetchErrorRate: 1,
+	})))
+	defer s.Close()
+
+	start := time.Now()
+	results := fetchResults(t, s.URL, strings.NewReader(getUrl(server.URL, 10, 0)))
+
+	if elapsed := time.Since(start); elapsed < time.Millisecond*100 {
+		t.Errorf("expected fetch delayed, took %s", elapsed)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Error, "injected fault") {
+		t.Errorf("expected injected fault, got %+v", results)
+	}
+}
+
+func TestHandlerFaultInjectionRequests(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithFaultInjection(FaultInjection{
+		RequestErrorRate: 1,
+	})))
+	defer s.Close()
+
+	resp, err := http.Post(s.URL, "text/plain", strings.NewReader(getUrl(server.URL, 10, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerFaultInjectionDisabled(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithFaultInjection(FaultInjection{})))
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, strings.NewReader(getUrl(server.URL, 10, 0)))
+	if len(results) != 1 || results[0].Error != "" || results[0].Length != 10 {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
@@ -0,0 +1,592 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// normalizeTargets normalizes URLs of batch's targets.
+func (b *batch) normalizeTargets() {
+	for i := range b.targets {
+		b.targets[i].normalized = normalizeURL(b.targets[i].URL, b.removeTracking)
+	}
+}
+
+// fetch concurrently fetches batch's URLs.
+// It returns channel results are sent to.
+// After all documents are fetched, then channel is closed.
+// If batch is deduplicated, each unique target is fetched once,
+// and its result is sent either once, or for every occurrence
+// of target if batch's results are fanned out. If batch is strict,
+// the first failure cancels remaining fetches. Fetches
+// not completed by batch's deadline fail with timeout. If fetching is
+// synchronous, targets are fetched one by one in order. If Handler has
+// worker pool, fetches are run on its workers, which are returned once
+// documents are fetched, so results are queued and sent by single
+// goroutine of batch; otherwise each target is fetched in its own goroutine.
+func (h *Handler) fetch(b *batch) <-chan *Result {
+	ch := make(chan *Result)
+
+	if b.normalize {
+		b.normalizeTargets()
+	}
+
+	groups := make([][]int, len(b.targets))
+	if b.dedupe {
+		groups = dedupe(b.targets)
+	} else {
+		for i := range b.targets {
+			groups[i] = []int{i}
+		}
+	}
+
+	if b.deadline.IsZero() {
+		b.ctx, b.cancel = context.WithCancel(b.ctx)
+	} else {
+		b.ctx, b.cancel = context.WithDeadline(b.ctx, b.deadline)
+	}
+
+	// queue holds results fetched by workers until they are sent
+	var queue chan queuedResult
+
+	run := func(group []int, done func()) {
+		go func() {
+			defer done()
+
+			h.fetchGroup(b, group, ch)
+		}()
+	}
+	switch {
+	case h.synchronous:
+		run = func(group []int, done func()) {
+			defer done()
+
+			h.fetchGroup(b, group, ch)
+		}
+	case h.workers != nil:
+		// worker must not wait for consumer of results, which may be
+		// slow or gone, so it is shared fairly; queue has room for
+		// result of every group, so putting result never blocks
+		queue = make(chan queuedResult, len(groups))
+		go func() {
+			for q := range queue {
+				b.sendGroup(q.group, q.result, ch)
+				q.done()
+			}
+		}()
+
+		run = func(group []int, done func()) {
+			h.workers.submit(func() {
+				queue <- queuedResult{
+					group:  group,
+					result: h.fetchTarget(b, group),
+					done:   done,
+				}
+			})
+		}
+	}
+
+	// slots limit number of groups fetched simultaneously, if needed
+	var slots chan struct{}
+	if b.concurrency > 0 {
+		slots = make(chan struct{}, b.concurrency)
+	}
+
+	go func() {
+		var wg sync.WaitGroup
+
+		for _, group := range groups {
+			group := group
+
+			if slots != nil {
+				slots <- struct{}{}
+			}
+
+			wg.Add(1)
+			run(group, func() {
+				if slots != nil {
+					<-slots
+				}
+
+				wg.Done()
+			})
+		}
+
+		wg.Wait()
+		b.cancel()
+
+		if queue != nil {
+			close(queue)
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// queuedResult is result of group of batch's targets
+// fetched by worker and waiting to be sent.
+type queuedResult struct {
+	group  []int
+	result *Result
+	// done is called once result is sent.
+	done func()
+}
+
+// fetchGroup fetches target shared by group of batch's targets
+// and sends its result to ch. Results are not sent once batch
+// is abandoned.
+func (h *Handler) fetchGroup(b *batch, group []int, ch chan<- *Result) {
+	b.sendGroup(group, h.fetchTarget(b, group), ch)
+}
+
+// fetchTarget fetches target shared by group of batch's targets
+// and returns its result.
+func (h *Handler) fetchTarget(b *batch, group []int) *Result {
+	start := h.now()
+	result := h.fetchSafely(b, b.targets[group[0]])
+	result.index = group[0]
+	result.duration = h.since(start)
+	b.checkBudget(result)
+	result.classify()
+
+	h.audit(b, start, result)
+	atomic.AddInt64(&b.done, int64(len(group)))
+
+	if b.strict && result.err != nil {
+		b.fail(result)
+	}
+
+	return result
+}
+
+// sendGroup sends result of group of batch's targets to ch, once or for
+// every target of group. Results are not sent once batch is abandoned.
+func (b *batch) sendGroup(group []int, result *Result, ch chan<- *Result) {
+	if !b.send(ch, result) || !b.fanOut {
+		return
+	}
+
+	for _, i := range group[1:] {
+		r := *result
+		r.index = i
+
+		if !b.send(ch, &r) {
+			return
+		}
+	}
+}
+
+// inOrder returns channel results received from ch are sent to
+// in order of their URLs in request. Each result is sent as soon as
+// all preceding ones are received, until batch is abandoned.
+// Pending results are held by batch's spool, if any.
+func inOrder(b *batch, ch <-chan *Result) <-chan *Result {
+	out := make(chan *Result)
+
+	go func() {
+		pending := make(map[int]*Result)
+		next := 0
+
+		for result := range ch {
+			pending[result.index] = b.spool.put(result)
+
+			for r, ok := pending[next]; ok; r, ok = pending[next] {
+				delete(pending, next)
+				next++
+
+				if !b.send(out, b.spool.get(r)) {
+					break
+				}
+			}
+		}
+
+		close(out)
+	}()
+
+	return out
+}
+
+// clientFor returns HTTP client registered for host,
+// or default client if there is no such one.
+func (h *Handler) clientFor(host string) *http.Client {
+	for _, hc := range h.hostClients {
+		if matchHost(hc.pattern, host) {
+			return hc.client
+		}
+	}
+
+	return h.client
+}
+
+// fetchOne fetches single URL. Errors are logged
+// and recorded in returned result.
+func (h *Handler) fetchOne(b *batch, t target) *Result {
+	result := &Result{
+		URL:           h.redactor.url(t.URL),
+		NormalizedURL: h.redactor.url(t.normalized),
+	}
+
+	ctx, done, ok := h.startFetch(b, t, result)
+	if !ok {
+		return result
+	}
+	defer done()
+
+	if h.slowFetchThreshold > 0 || h.phaseTiming {
+		timing := newFetchTiming()
+		ctx = httptrace.WithClientTrace(ctx, timing.trace())
+
+		defer h.finishTiming(b, result, timing)
+	}
+
+	if b.head && b.method == http.MethodGet && !b.needsBody(h) {
+		resp, err := h.do(ctx, b, http.MethodHead, t, result)
+		if err != nil {
+			h.fail(b, result, err)
+
+			return result
+		}
+		resp.Body.Close()
+
+		// fall back to GET if length is unknown or HEAD is not supported
+		if resp.ContentLength >= 0 && resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			result.Length = int(resp.ContentLength)
+			detectContentType(resp.Header, nil, result)
+
+			return result
+		}
+	}
+
+	resp, err := h.do(ctx, b, b.method, t, result)
+	if err != nil {
+		h.fail(b, result, err)
+
+		return result
+	}
+	defer resp.Body.Close()
+
+	if b.method == http.MethodHead && resp.ContentLength >= 0 {
+		result.Length = int(resp.ContentLength)
+		detectContentType(resp.Header, nil, result)
+
+		return result
+	}
+
+	if rule := h.contentRule(resp.Header); rule != nil && rule.SkipBody {
+		if resp.ContentLength >= 0 {
+			result.Length = int(resp.ContentLength)
+		}
+		detectContentType(resp.Header, nil, result)
+
+		return result
+	}
+
+	if err := h.consume(b, resp, result); err != nil {
+		h.fail(b, result, err)
+	}
+
+	return result
+}
+
+// startFetch checks that target may be fetched and waits for fetch slot,
+// if fetches are limited. It returns context of fetch and func which must
+// be called once fetch is done. If target can not be fetched, failure is
+// recorded in result and false is returned.
+func (h *Handler) startFetch(b *batch, t target, result *Result) (context.Context, func(), bool) {
+	if h.robots != nil && !h.checkRobots(b, t, result) {
+		return nil, nil, false
+	}
+
+	if b.overBudget() {
+		result.setError(errBudgetExceeded)
+
+		return nil, nil, false
+	}
+
+	if h.scheduler != nil {
+		atomic.AddInt64(&h.queuedFetches, 1)
+
+		start := h.now()
+		err := h.scheduler.acquire(b.ctx, b.priority, b.flow)
+		b.waited(h.since(start))
+
+		atomic.AddInt64(&h.queuedFetches, -1)
+
+		if err != nil {
+			h.fail(b, result, err)
+
+			return nil, nil, false
+		}
+	}
+
+	atomic.AddInt64(&h.activeFetches, 1)
+
+	ctx, cancel := b.ctx, context.CancelFunc(func() {})
+	if b.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+	}
+
+	start := h.now()
+
+	return ctx, func() {
+		cancel()
+		atomic.AddInt64(&h.activeFetches, -1)
+
+		// fetches canceled along with batch say nothing about upstream
+		if h.adaptive != nil && b.ctx.Err() == nil {
+			h.adaptive.record(start, h.now(), result)
+		}
+
+		if h.scheduler != nil {
+			h.scheduler.release()
+		}
+	}, true
+}
+
+// consume reads document's body, recording its length,
+// content type and requested checksum in result.
+// Content rule of document, if any, is applied.
+func (h *Handler) consume(b *batch, resp *http.Response, result *Result) error {
+	rule := h.contentRule(resp.Header)
+
+	var (
+		prefix = &prefixWriter{limit: sniffLen}
+		w      = []io.Writer{prefix}
+		sum    hash.Hash
+	)
+
+	if b.checksum != "" {
+		sum = checksums[b.checksum]()
+		w = append(w, sum)
+	}
+
+	var previewPrefix *prefixWriter
+	if h.preview != nil {
+		previewPrefix = &prefixWriter{limit: h.preview.size}
+		w = append(w, previewPrefix)
+	}
+
+	var content hash.Hash
+	if b.duplicates {
+		content = sha256.New()
+		w = append(w, content)
+	}
+
+	var body *archiveBuffer
+	if b.archive != "" {
+		body = newArchiveBuffer(b, h.archiveLimit)
+		w = append(w, body)
+	}
+
+	var counter *textCounter
+	if b.textStats {
+		counter = newTextCounter()
+		w = append(w, counter)
+	}
+
+	var links *linkExtractor
+	if b.links != LinksNone {
+		links = newLinkExtractor(resp.Request.URL, b.sameHostLinks)
+		w = append(w, links)
+	}
+
+	analyses := make([]*analysis, 0, len(h.analyzers))
+	for _, a := range h.analyzers {
+		if !rule.runs(a.name) {
+			continue
+		}
+
+		name := a.name
+		an := newAnalysis(a, result.URL, resp.Header, func(value interface{}) error {
+			return h.recovered(b.logger, value, result.URL+": analyzer "+name)
+		})
+		analyses = append(analyses, an)
+		w = append(w, an)
+	}
+
+	var r io.Reader = resp.Body
+	if b.budgeted {
+		r = &budgetReader{
+			r: r,
+			b: b,
+		}
+	}
+	if rule != nil && rule.MaxSize > 0 {
+		r = &sizeLimitReader{
+			r:    r,
+			left: rule.MaxSize,
+		}
+	}
+
+	buf := copyBuffers.Get().(*[]byte)
+	n, err := io.CopyBuffer(io.MultiWriter(w...), r, *buf)
+	copyBuffers.Put(buf)
+	result.Length = int(n)
+
+	for _, an := range analyses {
+		an.finish()
+
+		if err != nil {
+			continue
+		}
+
+		if an.err != nil {
+			b.logger.Printf("%s: analyzer %s: %s", result.URL, an.name, an.err)
+
+			if result.AnalysisErrors == nil {
+				result.AnalysisErrors = make(Analyses)
+			}
+			result.AnalysisErrors[an.name] = an.err.Error()
+
+			continue
+		}
+
+		if result.Analysis == nil {
+			result.Analysis = make(Analyses)
+		}
+		result.Analysis[an.name] = an.output
+	}
+
+	detectContentType(resp.Header, prefix.buf, result)
+
+	if links != nil {
+		found := links.result()
+
+		if err == nil && isHTML(result.ContentType) {
+			result.LinkCount = len(found)
+
+			if b.links == LinksList {
+				result.Links = found
+			}
+		}
+	}
+
+	if err != nil {
+		body.release()
+
+		return err
+	}
+
+	if body != nil {
+		result.body = body
+	}
+
+	if content != nil {
+		result.contentHash = string(content.Sum(nil))
+	}
+
+	if previewPrefix != nil {
+		h.setPreview(b, previewPrefix.buf, result)
+	}
+
+	if counter != nil {
+		result.Words, result.Lines = counter.count()
+	}
+
+	if sum != nil {
+		result.Checksum = string(b.checksum) + ":" + hex.EncodeToString(sum.Sum(nil))
+	}
+
+	return nil
+}
+
+// do makes outgoing request and records response's metadata in result.
+func (h *Handler) do(ctx context.Context, b *batch, method string, t target, result *Result) (*http.Response, error) {
+	if h.httpCache != nil {
+		ctx = withCacheStatus(ctx, &result.Cache)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, t.fetchURL(), nil)
+	if err != nil {
+		return nil, h.redactor.error(err)
+	}
+
+	for key, values := range h.outboundHeaders {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	if h.cacheControl != "" {
+		req.Header.Set("Cache-Control", h.cacheControl)
+	}
+	for key, values := range b.header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	headers, err := h.attachCredentials(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) != 0 {
+		req = req.WithContext(withCredentialHeaders(req.Context(), headers))
+	}
+	private := len(headers) != 0
+	for key, value := range t.Headers {
+		req.Header.Set(key, value)
+	}
+	if h.maxFetchDepth > 0 {
+		req.Header.Set(fetchDepthHeader, strconv.Itoa(b.depth+1))
+	}
+
+	if signer := h.signerFor(req.URL.Hostname()); signer != nil {
+		if err := signer.Sign(req); err != nil {
+			return nil, fmt.Errorf("%s: signing request: %w", result.URL, err)
+		}
+		private = true
+	}
+
+	// responses to requests with credentials
+	// other than Authorization header are not shared
+	if private && h.httpCache != nil {
+		req = req.WithContext(withPrivateRequest(req.Context()))
+	}
+
+	f, custom := h.fetchers[req.URL.Scheme]
+
+	var resp *http.Response
+	if custom {
+		resp, err = fetchScheme(f, req)
+	} else {
+		resp, err = h.withJar(b, h.clientFor(req.URL.Hostname())).Do(req)
+	}
+	if err != nil {
+		return nil, h.redactor.error(err)
+	}
+
+	result.Method = method
+	result.Status = resp.StatusCode
+	result.Protocol = resp.Proto
+	result.FinalURL = h.redactor.url(resp.Request.URL.String())
+	result.Redirects = redirectsCount(resp)
+
+	if len(h.responseHeaders) != 0 {
+		result.Headers = h.captureHeaders(resp.Header)
+	}
+
+	// response served by local cache was stored
+	// along with status of upstream cache
+	if h.forwardCache && result.Cache != cacheHit {
+		setUpstreamCache(resp.Header, result)
+	}
+
+	if h.http2 == http2Force && !custom && resp.ProtoMajor != 2 {
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("%s: protocol %s is used instead of HTTP/2", result.URL, resp.Proto)
+	}
+
+	return resp, nil
+}
+
+// fail records err in result and logs it along with its kind.
+func (h *Handler) fail(b *batch, result *Result, err error) {
+	result.setError(err)
+	b.logger.Printf("%s (%s)", err, result.ErrorKind)
+}
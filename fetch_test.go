@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandlerHeadMode(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		methods []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mu.Lock()
+		methods = append(methods, request.Method+" "+request.URL.Path)
+		mu.Unlock()
+
+		if request.URL.Path == "/unknown" && request.Method == http.MethodHead {
+			// flushing before writing body prevents server from setting Content-Length
+			writer.(http.Flusher).Flush()
+
+			return
+		}
+
+		writer.Header().Set("Content-Length", "10")
+		writer.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	for _, path := range []string{"/known", "/unknown"} {
+		methods = nil
+
+		req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(server.URL+path))
+		req.Header.Set(fetchModeHeader, "head")
+
+		results := doFetchResults(t, req)
+		if len(results) != 1 || results[0].Length != 10 {
+			t.Fatalf("unexpected results: %+v", results)
+		}
+
+		expected := []string{"HEAD " + path}
+		if path == "/unknown" {
+			expected = append(expected, "GET "+path)
+		}
+
+		if len(methods) != len(expected) || methods[0] != expected[0] || methods[len(methods)-1] != expected[len(expected)-1] {
+			t.Errorf("expected requests %v, got %v", expected, methods)
+		}
+	}
+}
+
+func TestHandlerFetchMethod(t *testing.T) {
+	var method string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		method = request.Method
+	}))
+	defer server.Close()
+
+	tests := map[string]struct {
+		opts   []Option
+		status int
+	}{
+		"not allowed": {
+			status: http.StatusBadRequest,
+		},
+		"allowed": {
+			opts:   []Option{WithAllowedMethods("get", "options")},
+			status: http.StatusOK,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			method = ""
+
+			s := httptest.NewServer(NewHandler(test.opts...))
+			defer s.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(server.URL))
+			req.Header.Set(fetchMethodHeader, "OPTIONS")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("failed to make request: %s", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, resp.StatusCode)
+			}
+
+			if test.status == http.StatusOK && method != http.MethodOptions {
+				t.Errorf("expected OPTIONS request, got %q", method)
+			}
+		})
+	}
+}
+
+func TestHandlerOutboundHeaders(t *testing.T) {
+	var header http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		header = request.Header
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithOutboundHeaders(http.Header{
+		"User-Agent": {"test-agent"},
+		"X-Token":    {"secret"},
+	})))
+	defer s.Close()
+
+	fetchResults(t, s.URL, getRequestBodyBuffer(server.URL))
+
+	if header.Get("User-Agent") != "test-agent" || header.Get("X-Token") != "secret" {
+		t.Errorf("unexpected outbound headers: %v", header)
+	}
+}
+
+func TestHandlerForwardedHeaders(t *testing.T) {
+	var header http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		header = request.Header
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithForwardedHeaders("x-request-id")))
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(server.URL))
+	req.Header.Set("X-Request-ID", "42")
+	req.Header.Set("Cookie", "session=secret")
+
+	doFetchResults(t, req)
+
+	if header.Get("X-Request-ID") != "42" {
+		t.Errorf("expected X-Request-ID to be forwarded, got %v", header)
+	}
+	if header.Get("Cookie") != "" {
+		t.Errorf("expected Cookie not to be forwarded, got %v", header)
+	}
+}
+
+func TestHandlerChecksum(t *testing.T) {
+	server := createServer(0)
+
+	s := httptest.NewServer(NewHandler(WithChecksum(ChecksumSHA256)))
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, getRequestBodyBuffer(getUrl(server.URL, 3, 0)))
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %+v", results)
+	}
+
+	sum := sha256.Sum256([]byte("   "))
+	if expected := "sha256:" + hex.EncodeToString(sum[:]); results[0].Checksum != expected {
+		t.Errorf("expected checksum %s, got %s", expected, results[0].Checksum)
+	}
+}
+
+func TestHandlerStrict(t *testing.T) {
+	server := createServer(5 * time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	body := `{"urls": ["` + getUrl(server.URL, 10, 1500*time.Millisecond) + `", "http://127.0.0.1:0"], "strict": true}`
+
+	start := time.Now()
+
+	resp, err := http.Post(s.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if time.Since(start) > time.Second {
+		t.Errorf("remaining fetches are not canceled")
+	}
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected status %d, got %d", http.StatusBadGateway, resp.StatusCode)
+	}
+
+	message, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(message), "http://127.0.0.1:0") {
+		t.Errorf("expected failed URL in error, got %q", message)
+	}
+}
+
+func TestHandlerDeadline(t *testing.T) {
+	server := createServer(5 * time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(getUrl(server.URL, 10, 0), getUrl(server.URL, 20, time.Second)))
+	req.Header.Set(timeoutHeader, "200ms")
+
+	start := time.Now()
+	results := doFetchResults(t, req)
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("deadline is not honored")
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+
+	for _, r := range results {
+		switch r.Length {
+		case 10:
+			if r.Error != "" {
+				t.Errorf("unexpected error: %s", r.Error)
+			}
+		default:
+			if r.ErrorKind != ErrorKindTimeout {
+				t.Errorf("expected timeout, got %+v", r)
+			}
+		}
+	}
+}
+
+func TestBatchDeadlineHeaders(t *testing.T) {
+	deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	cases := []struct {
+		deadline string
+		timeout  string
+		valid    bool
+	}{
+		{deadline.Format(time.RFC3339), "", true},
+		{"", "1.5", true},
+		{deadline.Format(time.RFC3339), "2h", true},
+		{"tomorrow", "", false},
+		{"", "soon", false},
+		{"", "0", false},
+		{"", "-1s", false},
+	}
+
+	for _, c := range cases {
+		header := make(http.Header)
+		if c.deadline != "" {
+			header.Set(deadlineHeader, c.deadline)
+		}
+		if c.timeout != "" {
+			header.Set(timeoutHeader, c.timeout)
+		}
+
+		b := &batch{}
+		err := b.setDeadline(header, time.Now())
+		if (err == nil) != c.valid {
+			t.Errorf("%q %q: unexpected error: %v", c.deadline, c.timeout, err)
+		}
+
+		if c.deadline != "" && c.valid && !b.deadline.Equal(deadline) {
+			t.Errorf("%q %q: unexpected deadline %s", c.deadline, c.timeout, b.deadline)
+		}
+	}
+}
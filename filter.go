@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// resultFilterHeader is request header which makes only results
+// matching filter written, e.g. "length<1000" or "failed".
+const resultFilterHeader = "X-Result-Filter"
+
+// filterOperators contains operators of filter conditions.
+// Longer operators precede their prefixes.
+var filterOperators = []string{">=", "<=", "!=", ">", "<", "="}
+
+// filterCondition is single condition of result filter, e.g. "length>1000".
+type filterCondition struct {
+	field string
+	op    string
+	value int
+}
+
+// resultFilter selects results written to response. Results match
+// filter if they match all of its conditions. Nil filter matches
+// all results.
+type resultFilter []filterCondition
+
+// parseFilter parses comma-separated conditions of filter. Condition is
+// either comparison of result's length or status with number, e.g.
+// "length>1000" or "status>=400", or "failed", or "ok", which match
+// failed and successfully fetched URLs respectively, or "changed",
+// which matches results differing from baseline.
+func parseFilter(s string) (resultFilter, error) {
+	var f resultFilter
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		switch part {
+		case "":
+			continue
+		case "failed", "ok", "changed":
+			f = append(f, filterCondition{field: part})
+
+			continue
+		}
+
+		c, err := parseCondition(part)
+		if err != nil {
+			return nil, err
+		}
+
+		f = append(f, c)
+	}
+
+	return f, nil
+}
+
+// parseCondition parses comparison condition of filter.
+func parseCondition(s string) (filterCondition, error) {
+	for _, op := range filterOperators {
+		i := strings.Index(s, op)
+		if i < 0 {
+			continue
+		}
+
+		c := filterCondition{
+			field: strings.TrimSpace(s[:i]),
+			op:    op,
+		}
+		if c.field != "length" && c.field != "status" {
+			return c, fmt.Errorf("unknown filter field %q", c.field)
+		}
+
+		value, err := strconv.Atoi(strings.TrimSpace(s[i+len(op):]))
+		if err != nil {
+			return c, fmt.Errorf("invalid filter condition %q", s)
+		}
+		c.value = value
+
+		return c, nil
+	}
+
+	return filterCondition{}, fmt.Errorf("invalid filter condition %q", s)
+}
+
+// match reports whether result matches all conditions of filter.
+func (f resultFilter) match(r *Result) bool {
+	for _, c := range f {
+		if !c.match(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// match reports whether result matches condition.
+func (c filterCondition) match(r *Result) bool {
+	var value int
+
+	switch c.field {
+	case "failed":
+		return r.err != nil
+	case "ok":
+		return r.err == nil
+	case "changed":
+		return r.Delta != nil && r.Delta.Change != changeUnchanged
+	case "length":
+		value = r.Length
+	case "status":
+		value = r.Status
+	}
+
+	switch c.op {
+	case ">=":
+		return value >= c.value
+	case "<=":
+		return value <= c.value
+	case "!=":
+		return value != c.value
+	case ">":
+		return value > c.value
+	case "<":
+		return value < c.value
+	}
+
+	return value == c.value
+}
+
+// setFilter sets filter of batch's results.
+func (b *batch) setFilter(s string) error {
+	f, err := parseFilter(s)
+	if err != nil {
+		return err
+	}
+
+	b.filter = f
+
+	return nil
+}
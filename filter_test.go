@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResultFilter(t *testing.T) {
+	ok := &Result{Length: 100, Status: 200}
+	small := &Result{Length: 10, Status: 200}
+	missing := &Result{Length: 50, Status: 404}
+	failed := &Result{err: errors.New("failed")}
+
+	tests := []struct {
+		filter   string
+		expected []*Result
+	}{
+		{"", []*Result{ok, small, missing, failed}},
+		{"length>50", []*Result{ok}},
+		{"length <= 50, ok", []*Result{small, missing}},
+		{"status>=400", []*Result{missing}},
+		{"status!=200,ok", []*Result{missing}},
+		{"failed", []*Result{failed}},
+	}
+
+	for _, test := range tests {
+		f, err := parseFilter(test.filter)
+		if err != nil {
+			t.Fatalf("%q: %s", test.filter, err)
+		}
+
+		var matched []*Result
+		for _, r := range []*Result{ok, small, missing, failed} {
+			if f.match(r) {
+				matched = append(matched, r)
+			}
+		}
+
+		if len(matched) != len(test.expected) {
+			t.Errorf("%q: expected %d results, got %d", test.filter, len(test.expected), len(matched))
+
+			continue
+		}
+		for i := range matched {
+			if matched[i] != test.expected[i] {
+				t.Errorf("%q: unexpected result %+v", test.filter, matched[i])
+			}
+		}
+	}
+
+	for _, s := range []string{"size>10", "length>ten", "broken"} {
+		if _, err := parseFilter(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestHandlerResultFilter(t *testing.T) {
+	target := createServer(0)
+	defer target.Close()
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	urls := strings.Join([]string{getUrl(target.URL, 10, 0), getUrl(target.URL, 200, 0), "http://127.0.0.1:1"}, "\n")
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(urls))
+	req.Header.Set(resultFilterHeader, "length<100")
+
+	results := doFetchResults(t, req)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Length >= 100 {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Upstream cache statuses of results, see WithForwardCache.
+const (
+	// upstreamCacheHit marks results served by upstream cache.
+	upstreamCacheHit = "hit"
+	// upstreamCacheMiss marks results fetched by upstream cache from origin.
+	upstreamCacheMiss = "miss"
+)
+
+// cfCacheHits contains values of CF-Cache-Status header
+// meaning that response is served from Cloudflare's cache.
+var cfCacheHits = map[string]bool{
+	"HIT":         true,
+	"STALE":       true,
+	"UPDATING":    true,
+	"REVALIDATED": true,
+}
+
+// setUpstreamCache records status of upstream cache and age of
+// response in result, as reported by response headers. X-Cache
+// header, set by Squid, Varnish and most CDNs, takes precedence,
+// then CF-Cache-Status, and then Age, whose positive value means
+// that response is served from cache.
+func setUpstreamCache(header http.Header, result *Result) {
+	age, err := strconv.Atoi(strings.TrimSpace(header.Get("Age")))
+	if err == nil && age > 0 {
+		result.UpstreamAge = age
+	}
+
+	if status := xCacheStatus(header); status != "" {
+		result.UpstreamCache = status
+
+		return
+	}
+
+	if value := strings.ToUpper(strings.TrimSpace(header.Get("CF-Cache-Status"))); value != "" {
+		if cfCacheHits[value] {
+			result.UpstreamCache = upstreamCacheHit
+		} else {
+			result.UpstreamCache = upstreamCacheMiss
+		}
+
+		return
+	}
+
+	if result.UpstreamAge > 0 {
+		result.UpstreamCache = upstreamCacheHit
+	}
+}
+
+// xCacheStatus returns cache status reported by X-Cache header, e.g.
+// "HIT from proxy", "TCP_MISS" or "MISS, HIT", or empty string if it
+// is absent or unknown. Every cache on the way appends its status, so
+// the last one, reported by cache closest to handler, is used.
+func xCacheStatus(header http.Header) string {
+	values := header.Values("X-Cache")
+	if len(values) == 0 {
+		return ""
+	}
+
+	parts := strings.Split(values[len(values)-1], ",")
+	last := strings.ToUpper(parts[len(parts)-1])
+
+	switch {
+	case strings.Contains(last, "HIT"):
+		return upstreamCacheHit
+	case strings.Contains(last, "MISS"):
+		return upstreamCacheMiss
+	}
+
+	return ""
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetUpstreamCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		status string
+		age    int
+	}{
+		{
+			name:   "squid hit",
+			header: http.Header{"X-Cache": {"HIT from proxy.example.com"}},
+			status: upstreamCacheHit,
+		},
+		{
+			name:   "squid miss",
+			header: http.Header{"X-Cache": {"TCP_MISS"}},
+			status: upstreamCacheMiss,
+		},
+		{
+			name:   "closest cache",
+			header: http.Header{"X-Cache": {"HIT, MISS"}},
+			status: upstreamCacheMiss,
+		},
+		{
+			name:   "x-cache precedence",
+			header: http.Header{"X-Cache": {"MISS"}, "Cf-Cache-Status": {"HIT"}, "Age": {"10"}},
+			status: upstreamCacheMiss,
+			age:    10,
+		},
+		{
+			name:   "cloudflare",
+			header: http.Header{"Cf-Cache-Status": {"REVALIDATED"}},
+			status: upstreamCacheHit,
+		},
+		{
+			name:   "cloudflare dynamic",
+			header: http.Header{"Cf-Cache-Status": {"DYNAMIC"}},
+			status: upstreamCacheMiss,
+		},
+		{
+			name:   "age",
+			header: http.Header{"Age": {"120"}},
+			status: upstreamCacheHit,
+			age:    120,
+		},
+		{
+			name:   "no cache",
+			header: http.Header{"Age": {"0"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := &Result{}
+			setUpstreamCache(test.header, result)
+
+			if result.UpstreamCache != test.status || result.UpstreamAge != test.age {
+				t.Errorf("expected %q and age %d, got %q and age %d", test.status, test.age, result.UpstreamCache, result.UpstreamAge)
+			}
+		})
+	}
+}
+
+func TestHandlerForwardCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cache-Control") == "max-age=60" {
+			w.Header().Set("X-Cache", "HIT from proxy")
+			w.Header().Set("Age", "30")
+		} else {
+			w.Header().Set("X-Cache", "MISS from proxy")
+		}
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithForwardCache("max-age=60")))
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(server.URL))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var results []Result
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+
+	if len(results) != 1 || results[0].UpstreamCache != upstreamCacheHit || results[0].UpstreamAge != 30 {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
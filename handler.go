@@ -4,61 +4,207 @@
 // Request body should contain list of URL, each URL on separate line.
 // Once POST request is received, Handler reads its content, splits it into lines, and fetches URLs.
 // Response consists of fetched documents' lengths, separated by new line. Result set is not guaranteed to be sorted.
+// Detailed results, including failed URLs, are returned as JSON if request's Accept header contains application/json.
 // All errors (non 2XX response codes, timeouts, etc) are logged.
 
 // While creating Handler, additional options can be provided to change its default behaviour.
-// See: WithClient, WithLogger.
+// See: WithClient, WithLogger, WithTLSConfig.
 
 package handler
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 )
 
 const defaultMaxIncomingRequests = 100
 
-var defaultLogger = log.Default()
-var defaultClient = http.DefaultClient
-
-// semaphore is used to limit number
-// of concurrent incoming requests.
-type semaphore struct {
-	ch chan struct{}
-}
+// defaultIncomingMethods contains methods of incoming requests
+// served unless WithIncomingMethods option is provided.
+var defaultIncomingMethods = []string{http.MethodPost}
 
-// newSemaphore creates new semaphore.
-func newSemaphore(cap int) *semaphore {
-	return &semaphore{
-		ch: make(chan struct{}, cap),
-	}
-}
-
-// semaphore tries to increase semaphore counter
-// and returns true on success, and false otherwise.
-func (s *semaphore) acquire() bool {
-	select {
-	case s.ch <- struct{}{}:
-		return true
-	default:
-		return false
-	}
-}
+var defaultLogger = log.Default()
 
-// release decreases semaphore counter.
-func (s *semaphore) release() {
-	<-s.ch
+// defaultClient is used unless WithClient option is provided.
+// Unlike http.DefaultClient, it uses transport tuned for batch fetching.
+var defaultClient = &http.Client{
+	Transport: newDefaultTransport(),
 }
 
 type Handler struct {
-	sem         *semaphore
+	// Counters below are accessed atomically, so they are
+	// the first fields to be 64-bit aligned on 32-bit platforms.
+
+	// batches is counter of incoming requests used as flow keys.
+	batches uint64
+	// inFlight is number of admitted incoming requests, activeFetches
+	// and queuedFetches are numbers of URLs being fetched and waiting
+	// for slots, see LoadStats.
+	inFlight      int64
+	activeFetches int64
+	queuedFetches int64
+
+	limiter     Limiter
+	weighted    *weightedSemaphore
 	logger      *log.Logger
 	client      *http.Client
 	maxRequests int
+	clientCert  *tls.Certificate
+	rootCAs     *x509.CertPool
+	hostCerts   []hostCertificate
+	tlsConfig   *tls.Config
+	hostClients []hostClient
+	http2       http2Mode
+	// roundTripper replaces transport of default client, see WithRoundTripper.
+	roundTripper http.RoundTripper
+	dnsTTL       time.Duration
+	dnsCache     *dnsCache
+	dial         DialFunc
+
+	checkRedirect func(req *http.Request, via []*http.Request) error
+	preferHead    bool
+
+	allowedMethods  []string
+	outboundHeaders http.Header
+
+	forwardedHeaders []string
+	maxBodySize      int64
+	maxLineLength    int
+
+	compressionThreshold int
+	checksum             ChecksumAlgorithm
+	links                LinkMode
+	sameHostLinks        bool
+	textStats            bool
+	analyzers            []namedAnalyzer
+	fetchers             map[string]SchemeFetcher
+	dedupe               bool
+	normalize            bool
+	removeTracking       bool
+	sort                 SortOrder
+	// partialStatus and failureStatus are response statuses used
+	// if some or all URLs failed. If zero, 200 is used.
+	partialStatus int
+	failureStatus int
+
+	clientRate     float64
+	clientBurst    int
+	rateLimiter    *rateLimiter
+	proxies        []string
+	trustedProxies []*net.IPNet
+	clients        []string
+	allowedClients []*net.IPNet
+
+	tenantOpts map[string]Tenant
+	tenants    map[string]*tenant
+	auth       Authenticator
+	cors       *corsPolicy
+
+	idempotencyRetention time.Duration
+	idempotency          *idempotencyCache
+
+	maxFetches     int
+	scheduler      *scheduler
+	fairScheduling bool
+	// adaptive adjusts number of scheduler's slots, if set.
+	adaptive         *adaptiveLimit
+	adaptiveSettings *AdaptiveConcurrency
+	// closed is set once Handler is closed, so it is reported not ready.
+	closed int32
+
+	middleware []func(http.Handler) http.Handler
+	chain      http.Handler
+
+	propagatePanics bool
+	signers         []hostSigner
+	credentials     CredentialProvider
+	redactor        *redactor
+	auditSink       AuditSink
+
+	phaseTiming        bool
+	preview            *preview
+	passthrough        bool
+	passthroughHeaders []string
+	archiveLimit       int
+	byteBudget         int64
+	contentRules       []ContentRule
+	spillLimit         int64
+	spillDir           string
+	cookieJar          http.CookieJar
+	batchCookies       bool
+	textFormat         TextFormat
+	shedPolicy         ShedPolicy
+	shedTimeout        time.Duration
+	// shedQueue wakes up requests queued by shedPolicy.
+	shedQueue          *shedQueue
+	forwardCache       bool
+	cacheControl       string
+	progressInterval   time.Duration
+	overrides          *FetchOverrides
+	duplicates         bool
+	schedules          *scheduleRegistry
+	jobStore           JobStore
+	outputTemplate     *template.Template
+	slowFetchThreshold time.Duration
+	responseHeaders    []string
+	httpCacheSize      int64
+	httpCache          *httpCache
+	hedgeDelay         time.Duration
+	retries            int
+	retryBackoff       time.Duration
+	retryBudget        *RetryBudget
+	perHostConcurrency int
+	workerPoolSize     int
+	workers            *workerPool
+	chunkSize          int
+	admin              bool
+	adminPrefix        string
+	adminAuth          Authenticator
+	running            *batchRegistry
+	debugEndpoints     bool
+	faults             *FaultInjection
+	cassettePath       string
+	cassetteMode       CassetteMode
+	cassette           *cassette
+	// now is Handler's clock.
+	now func() time.Time
+	// rand is source of jitter and injected faults.
+	rand        *rand.Rand
+	seed        int64
+	seeded      bool
+	synchronous bool
+	ordered     bool
+	robotsAgent string
+	robots      *robotsCache
+	// sitemapLimit is maximum number of URLs sitemaps are expanded into.
+	sitemapLimit int
+	crawlDepth   int
+	crawlPages   int
+	// maxFetchDepth is maximum fetch depth of incoming requests, see WithLoopProtection.
+	maxFetchDepth     int
+	outboundRate      float64
+	outboundBurst     int
+	bandwidth         int64
+	hostLimits        []hostLimit
+	distributedRate   *distributedRate
+	transportSettings *TransportSettings
+	// incomingMethods are HTTP methods of incoming requests served by Handler.
+	incomingMethods []string
+	// getMode makes URLs of GET requests taken from query.
+	getMode bool
 }
 
 // NewHandler created Handler and applies provided options.
@@ -69,7 +215,10 @@ func NewHandler(opts ...Option) *Handler {
 		opt.apply(h)
 	}
 
-	if h.maxRequests == 0 {
+	if h.limiter != nil {
+		// limit is unknown
+		h.maxRequests = 0
+	} else if h.maxRequests == 0 {
 		h.maxRequests = defaultMaxIncomingRequests
 	}
 	if h.client == nil {
@@ -78,79 +227,756 @@ func NewHandler(opts ...Option) *Handler {
 	if h.logger == nil {
 		h.logger = defaultLogger
 	}
+	if h.now == nil {
+		h.now = time.Now
+	}
+	if !h.seeded {
+		h.seed = time.Now().UnixNano()
+	}
+	h.rand = newRand(h.seed)
+
+	if h.dnsTTL > 0 {
+		h.dnsCache = newDNSCache(h.dnsTTL)
+	}
+
+	if h.tenantOpts != nil {
+		h.tenants = make(map[string]*tenant, len(h.tenantOpts))
+		for key, t := range h.tenantOpts {
+			h.tenants[key] = newTenant(t, h.logger)
+		}
+	}
+
+	if h.adaptiveSettings != nil {
+		h.adaptive = newAdaptiveLimit(*h.adaptiveSettings)
+		h.maxFetches = h.adaptive.settings.Max
+		h.scheduler = newScheduler(h.maxFetches)
+		h.adaptive.scheduler = h.scheduler
+	} else if h.maxFetches > 0 {
+		h.scheduler = newScheduler(h.maxFetches)
+	}
+
+	h.schedules = newScheduleRegistry()
+	if h.jobStore == nil {
+		h.jobStore = NewMemoryJobStore(defaultRunHistory)
+	}
+	if h.workerPoolSize > 0 {
+		h.workers = newWorkerPool(h.workerPoolSize)
+	}
+	if h.admin {
+		h.adminPrefix = strings.TrimRight(h.adminPrefix, "/")
+		if h.adminPrefix == "" {
+			panic("handler: admin endpoint can not be mounted at root")
+		}
+		if h.adminAuth == nil {
+			panic("handler: admin endpoint requires authenticator")
+		}
+
+		h.running = newBatchRegistry()
+	}
+
+	if h.idempotencyRetention > 0 {
+		h.idempotency = newIdempotencyCache(h.idempotencyRetention)
+	}
+
+	if h.clientRate > 0 {
+		h.rateLimiter = newRateLimiter(h.clientRate, h.clientBurst)
+	}
+	h.trustedProxies = h.parseNetworks(h.proxies)
+	h.allowedClients = h.parseNetworks(h.clients)
+
+	if h.redactor == nil {
+		h.redactor = defaultRedactor
+	}
+
+	if h.maxBodySize == 0 {
+		h.maxBodySize = defaultMaxBodySize
+	}
+	if h.maxLineLength == 0 {
+		h.maxLineLength = defaultMaxLineLength
+	}
+	if h.compressionThreshold == 0 {
+		h.compressionThreshold = defaultCompressionThreshold
+	}
+	if h.allowedMethods == nil {
+		h.allowedMethods = defaultAllowedMethods
+	}
+	if h.incomingMethods == nil {
+		h.incomingMethods = defaultIncomingMethods
+	}
+	if h.getMode && !h.acceptsMethod(http.MethodGet) {
+		h.incomingMethods = append(append([]string(nil), h.incomingMethods...), http.MethodGet)
+	}
+
+	if h.sort != SortNone && h.sort != SortAscending && h.sort != SortDescending {
+		h.logger.Printf("unknown sort order %q is ignored", h.sort)
+		h.sort = SortNone
+	}
+
+	if _, ok := checksums[h.checksum]; h.checksum != "" && !ok {
+		h.logger.Printf("unknown checksum algorithm %q is ignored", h.checksum)
+		h.checksum = ""
+	}
+
+	if h.preview != nil && h.preview.encoding != PreviewText && h.preview.encoding != PreviewBase64 {
+		h.logger.Printf("unknown preview encoding %q is ignored", h.preview.encoding)
+		h.preview = nil
+	}
+
+	if h.fetchers == nil {
+		h.fetchers = make(map[string]SchemeFetcher)
+	}
+	if _, ok := h.fetchers["data"]; !ok {
+		h.fetchers["data"] = dataFetcher
+	}
+
+	// round tripper makes connections on its own, so it can not
+	// follow transport options, including loop protection
+	if h.roundTripper != nil && h.customTransport() {
+		h.logger.Printf("round tripper %T is ignored, since transport options are provided", h.roundTripper)
+		h.roundTripper = nil
+	}
+
+	h.client = h.configureClient(h.client)
 
-	h.sem = newSemaphore(h.maxRequests)
+	if h.credentials != nil {
+		h.client = credentialRedirects(h.client)
+		for i := range h.hostClients {
+			h.hostClients[i].client = credentialRedirects(h.hostClients[i].client)
+		}
+	}
+
+	if h.cassettePath != "" {
+		c, err := openCassette(h.cassettePath, h.cassetteMode, h.redactor)
+		switch {
+		case err != nil && h.cassetteMode == CassetteReplay:
+			// replayed fetches must never reach network
+			h.logger.Printf("cassette %s can not be loaded, so fetches fail: %s", h.cassettePath, err)
+
+			err = fmt.Errorf("cassette %s can not be loaded: %w", h.cassettePath, err)
+			h.wrapClients(func(next http.RoundTripper) http.RoundTripper {
+				return &cassetteTransport{
+					err: err,
+				}
+			})
+		case err != nil:
+			h.logger.Printf("cassette %s is ignored: %s", h.cassettePath, err)
+		default:
+			h.cassette = c
+
+			h.wrapClients(func(next http.RoundTripper) http.RoundTripper {
+				return &cassetteTransport{
+					cassette: c,
+					next:     next,
+				}
+			})
+		}
+	}
+
+	// faults are injected closest to network,
+	// so retries and hedging can handle them
+	if h.faults != nil && (h.faults.FetchDelayRate > 0 || h.faults.FetchErrorRate > 0) {
+		h.wrapClients(func(next http.RoundTripper) http.RoundTripper {
+			return &faultTransport{
+				faults: h.faults,
+				rand:   h.rand,
+				next:   next,
+			}
+		})
+	}
+
+	if h.outboundRate > 0 || len(h.hostLimits) != 0 || h.bandwidth > 0 {
+		var (
+			global    *rateLimiter
+			bandwidth *rateLimiter
+			hosts     = make([]*hostThrottle, len(h.hostLimits))
+		)
+
+		if h.outboundRate > 0 {
+			global = newRateLimiter(h.outboundRate, h.outboundBurst)
+		}
+		if h.bandwidth > 0 {
+			bandwidth = newBandwidthLimiter(h.bandwidth)
+		}
+		for i, hl := range h.hostLimits {
+			hosts[i] = newHostThrottle(hl.pattern, hl.limit)
+		}
+
+		h.wrapClients(func(next http.RoundTripper) http.RoundTripper {
+			return &throttleTransport{
+				hosts:     hosts,
+				global:    global,
+				bandwidth: bandwidth,
+				next:      next,
+			}
+		})
+	}
+
+	for _, hs := range h.signers {
+		if s, ok := hs.signer.(*oauth2Signer); ok {
+			s.now = h.now
+		}
+	}
+
+	if l, ok := h.limiter.(*distributedLimiter); ok {
+		l.logger = h.logger
+	}
+	if s, ok := h.auditSink.(*httpAuditSink); ok {
+		s.setLogger(h.logger)
+	}
+
+	if h.distributedRate != nil {
+		h.wrapClients(func(next http.RoundTripper) http.RoundTripper {
+			return &distributedRateTransport{
+				rate: h.distributedRate,
+				next: next,
+			}
+		})
+	}
+
+	if h.perHostConcurrency > 0 {
+		bh := newBulkhead(h.perHostConcurrency)
+
+		h.wrapClients(func(next http.RoundTripper) http.RoundTripper {
+			return &bulkheadTransport{
+				bulkhead: bh,
+				next:     next,
+			}
+		})
+	}
+
+	if h.hedgeDelay > 0 {
+		h.wrapClients(func(next http.RoundTripper) http.RoundTripper {
+			return &hedgeTransport{
+				delay: h.hedgeDelay,
+				next:  next,
+			}
+		})
+	}
+
+	if h.retries > 0 || h.overrides != nil && h.overrides.MaxRetries > 0 {
+		if h.retries == 0 && h.retryBackoff <= 0 {
+			h.retryBackoff = defaultRetryBackoff
+		}
+		if h.retryBudget == nil {
+			h.retryBudget = DefaultRetryBudget
+		}
+
+		h.wrapClients(func(next http.RoundTripper) http.RoundTripper {
+			return &retryTransport{
+				retries: h.retries,
+				backoff: h.retryBackoff,
+				budget:  h.retryBudget,
+				rand:    h.rand,
+				next:    next,
+			}
+		})
+	}
+
+	if h.httpCacheSize > 0 {
+		h.httpCache = newHTTPCache(h.httpCacheSize)
+
+		h.wrapClients(func(next http.RoundTripper) http.RoundTripper {
+			return &cacheTransport{
+				cache: h.httpCache,
+				next:  next,
+			}
+		})
+	}
+
+	if h.robotsAgent != "" {
+		h.robots = newRobotsCache(h.robotsAgent, h.clientFor, h.now)
+	}
+
+	if h.limiter == nil {
+		h.limiter = newSemaphore(h.maxRequests)
+	}
+
+	if h.shedPolicy != nil {
+		h.shedQueue = newShedQueue()
+	}
+
+	if len(h.middleware) != 0 {
+		h.Use()
+	}
 
 	return h
 }
 
+// acceptsMethod reports whether incoming requests of method are served.
+func (h *Handler) acceptsMethod(method string) bool {
+	for _, m := range h.incomingMethods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allow returns value of Allow header listing methods supported by Handler.
+func (h *Handler) allow() string {
+	return strings.Join(append(append([]string(nil), h.incomingMethods...), http.MethodOptions), ", ")
+}
+
+// DNSCacheStats returns statistics of DNS cache
+// enabled by WithDNSCache option.
+func (h *Handler) DNSCacheStats() DNSCacheStats {
+	if h.dnsCache == nil {
+		return DNSCacheStats{}
+	}
+
+	return h.dnsCache.stats()
+}
+
+// ServeHTTP implements http.Handler interface.
 func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	if request.Method != "POST" {
+	if h.chain != nil {
+		h.chain.ServeHTTP(writer, request)
+
+		return
+	}
+
+	h.serve(writer, request)
+}
+
+// results starts fetching batch's URLs according to its input
+// and returns channel results are sent to.
+func (h *Handler) results(b *batch, tn *tenant) <-chan *Result {
+	switch {
+	case b.input != nil:
+		return h.fetchChunks(b, tn)
+	case b.inputMode == inputCrawl:
+		return h.crawl(b, tn)
+	case b.ordered && b.sort == SortNone:
+		return inOrder(b, h.fetch(b))
+	}
+
+	return h.fetch(b)
+}
+
+// serve handles incoming request.
+func (h *Handler) serve(writer http.ResponseWriter, request *http.Request) {
+	defer h.recoverRequest(writer, request)
+
+	if h.clients != nil && !h.clientAllowed(request) {
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+		return
+	}
+
+	if h.running != nil && strings.HasPrefix(request.URL.Path, h.adminPrefix+"/") {
+		h.serveAdmin(writer, request)
+
+		return
+	}
+
+	if h.cors != nil {
+		if h.cors.preflight(writer, request, h.incomingMethods) {
+			return
+		}
+
+		h.cors.setHeaders(writer, request)
+	}
+
+	if request.Method == http.MethodOptions {
+		writer.Header().Set("Allow", h.allow())
+		writer.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	if !h.acceptsMethod(request.Method) {
+		writer.Header().Set("Allow", h.allow())
 		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 
 		return
 	}
 
-	if !h.sem.acquire() {
+	if h.rateLimiter != nil {
+		if ok, wait := h.rateLimiter.allow(h.clientIP(request)); !ok {
+			writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(writer, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+
+			return
+		}
+	}
+
+	if h.auth != nil {
+		if err := h.auth.Authenticate(request); err != nil {
+			h.logger.Printf("%s: authentication failed: %s", h.clientIP(request), err)
+
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+	}
+
+	if key := request.Header.Get(idempotencyKeyHeader); key != "" && h.idempotency != nil {
+		// keys of different tenants never clash
+		key = request.Header.Get(apiKeyHeader) + "\x00" + key
+
+		rec, finish, served := h.serveIdempotent(writer, request, key)
+		if served {
+			return
+		}
+		defer finish()
+
+		writer = rec
+	}
+
+	var tn *tenant
+	if h.tenants != nil {
+		tn = h.tenants[request.Header.Get(apiKeyHeader)]
+		if tn == nil {
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+
+		if !tn.acquire() {
+			http.Error(writer, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+
+			return
+		}
+		defer tn.release()
+	}
+
+	if h.faults != nil && !h.admitFaulty(writer, request) {
+		return
+	}
+
+	decision := ShedAccept
+	if h.shedPolicy != nil {
+		if decision = h.shed(request); decision == ShedReject {
+			http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+			return
+		}
+	}
+
+	if err := h.limiter.Acquire(request.Context()); err != nil {
 		http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 
 		return
 	}
-	defer h.sem.release()
+	atomic.AddInt64(&h.inFlight, 1)
+	defer h.release()
 
-	data, err := ioutil.ReadAll(request.Body)
+	b, err := h.newBatch(request)
 	if err != nil {
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		http.Error(writer, err.Error(), http.StatusBadRequest)
 
 		return
 	}
 
-	urls := strings.Split(string(data), "\n")
+	if h.maxFetchDepth > 0 && b.depth >= h.maxFetchDepth {
+		h.logger.Printf("%s: fetch depth %d exceeds limit", b.client, b.depth)
+		http.Error(writer, http.StatusText(http.StatusLoopDetected), http.StatusLoopDetected)
 
-	writer.Header().Add("Content-Type", "text/plain")
+		return
+	}
 
-	for size := range h.fetch(urls) {
-		fmt.Fprintln(writer, size)
+	if h.chunkSize > 0 {
+		b.duplex = duplex(writer, request)
 	}
-}
 
-// fetch concurrently fetches provided URLs.
-// It returns channel received documents' lengths is sent to.
-// After all documents are fetched, then channel is cloed.
-func (h *Handler) fetch(urls []string) <-chan int {
-	ch := make(chan int)
+	var timing serverTiming
+
+	start := h.now()
+	if err := h.parseRequest(b, request); err != nil {
+		status := bodyErrorStatus(err)
+		if status == http.StatusBadRequest {
+			http.Error(writer, err.Error(), status)
+		} else {
+			http.Error(writer, http.StatusText(status), status)
+		}
+
+		return
+	}
+
+	if err := h.loadBaseline(request.Context(), b); err != nil {
+		if errors.Is(err, ErrRunNotFound) {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+		} else {
+			b.logger.Println(err)
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if b.inputMode == inputSitemap {
+		truncated, err := h.expandSitemaps(b)
+		if err != nil {
+			b.logger.Println(err)
+			http.Error(writer, err.Error(), http.StatusBadGateway)
+
+			return
+		}
+
+		if truncated {
+			writer.Header().Set(sitemapTruncatedHeader, "true")
+		}
+	}
+	timing.parse = h.since(start)
+
+	if b.passthrough {
+		if err := b.checkPassthrough(); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	// batch is degraded once it is parsed,
+	// since its body may set method as well
+	if decision == ShedDegrade {
+		if !b.degradable(h) {
+			http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+			return
+		}
+
+		b.method = http.MethodHead
+		writer.Header().Set(degradedHeader, "head")
+	}
+
+	release, ok := h.admitBatch(writer, b)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if b.input != nil {
+		defer b.input.Close()
+	}
+
+	if tn != nil {
+		if ok, wait := tn.take(len(b.targets)); !ok {
+			writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(writer, "URL quota exceeded", http.StatusTooManyRequests)
+
+			return
+		}
+
+		b.logger = tn.logger
+		b.tenant = tn.Name
+	}
 
-	go func() {
-		var wg sync.WaitGroup
+	atomic.AddInt64(&b.total, int64(len(b.targets)))
+
+	if h.running != nil {
+		h.running.add(b)
+		defer h.running.remove(b)
+	}
+
+	if b.passthrough {
+		h.servePassthrough(writer, b)
+
+		return
+	}
+
+	if b.archive != "" {
+		results := h.results(b, tn)
+		defer b.abandon()
+
+		h.serveArchive(writer, b, results)
+
+		return
+	}
+
+	enc := newEncoder(b.format, request)
+	if te, ok := enc.(*textEncoder); ok {
+		te.format = h.textFormat
+		if h.outputTemplate != nil {
+			enc = &templateEncoder{tmpl: h.outputTemplate, terminator: h.textFormat.terminator()}
+		}
+	}
+
+	// plain text output contains lengths only, so duplicates are
+	// meaningful only if results are ordered, sorted or detailed
+	_, plain := enc.(*textEncoder)
+	b.fanOut = b.ordered || b.sort != SortNone || !plain
+
+	// Content-Type may be already set, e.g. by middleware
+	writer.Header().Set("Content-Type", enc.contentType())
+
+	var (
+		w           io.Writer = writer
+		writeHeader           = writer.WriteHeader
+	)
+
+	if h.compressionThreshold >= 0 {
+		writer.Header().Add("Vary", "Accept-Encoding")
+
+		if acceptsGzip(request) {
+			gw := newGzipWriter(writer, h.compressionThreshold)
+			defer gw.Close()
+
+			w = gw
+			writeHeader = gw.WriteHeader
+		}
+	}
+
+	stats := newSummary(h.now)
+	start = h.now()
+
+	results := h.results(b, tn)
+	defer b.abandon()
+	defer b.spool.close()
+
+	// buffered results are written after all documents are fetched, so
+	// summary and timing are sent in headers, otherwise in trailer
+	buffered := b.buffered(h)
+
+	var collected []*Result
+	if buffered {
+		for result := range results {
+			if b.baseline != nil {
+				b.baseline.compare(result)
+			}
+
+			stats.add(result)
+			collected = append(collected, b.spool.put(result))
+		}
+		if b.sort != SortNone {
+			sortResults(collected, b.sort)
+		}
+		if b.duplicates {
+			writer.Header().Set(duplicateGroupsHeader, strconv.Itoa(assignDuplicateGroups(collected)))
+		}
 
-		for _, url := range urls {
-			wg.Add(1)
+		timing.fetch = h.since(start)
+		timing.queue = b.queued()
 
-			go func(url string) {
-				defer wg.Done()
+		stats.write(writer.Header())
+		timing.write(writer.Header(), false)
 
-				resp, err := h.client.Get(url)
-				if err != nil {
-					h.logger.Println(err)
+		if b.failure != nil {
+			http.Error(writer, fmt.Sprintf("strict mode: %s: %s", b.failure.URL, b.failure.Error), http.StatusBadGateway)
 
-					return
+			return
+		}
+
+		if status := h.status(stats); status != http.StatusOK {
+			writeHeader(status)
+		}
+	} else {
+		trailer := strings.Join(summaryHeaders, ", ") + ", " + serverTimingHeader
+		if b.input != nil {
+			trailer += ", " + inputErrorHeader
+		}
+
+		writer.Header().Set("Trailer", trailer)
+	}
+
+	var encoding time.Duration
+
+	encodeStart := h.now()
+	if err := enc.begin(w); err != nil {
+		b.logger.Println(err)
+
+		return
+	}
+
+	encoding += h.since(encodeStart)
+
+	if buffered {
+		for _, result := range collected {
+			if !b.filter.match(result) {
+				continue
+			}
+
+			if err := enc.encode(w, b.spool.get(result)); err != nil {
+				b.logger.Println(err)
+			}
+		}
+	} else {
+		var progress <-chan time.Time
+		if h.progressInterval > 0 {
+			ticker := time.NewTicker(h.progressInterval)
+			defer ticker.Stop()
+
+			progress = ticker.C
+		}
+
+		for {
+			var (
+				result *Result
+				ok     bool
+			)
+
+			select {
+			case result, ok = <-results:
+			case <-progress:
+				if err := writeProgress(w, enc, b); err != nil {
+					b.logger.Println(err)
 				}
 
-				content, err := ioutil.ReadAll(resp.Body)
-				if err != nil {
-					h.logger.Println(err)
+				continue
+			}
 
-					return
+			if !ok {
+				break
+			}
+
+			// chunked input sends nil after each chunk
+			if result == nil {
+				if f, ok := w.(http.Flusher); ok {
+					f.Flush()
 				}
 
-				ch <- len(content)
-			}(url)
+				continue
+			}
+
+			stats.add(result)
+
+			if b.baseline != nil {
+				b.baseline.compare(result)
+			}
+
+			if !b.filter.match(result) {
+				continue
+			}
+
+			encodeStart = h.now()
+			if err := enc.encode(w, result); err != nil {
+				b.logger.Println(err)
+			}
+			encoding += h.since(encodeStart)
+		}
+
+		timing.fetch = h.since(start)
+	}
+
+	encodeStart = h.now()
+	// removed URLs are reported by detailed output only
+	if b.baseline != nil && !plain {
+		for _, result := range b.baseline.removed() {
+			if !b.filter.match(result) {
+				continue
+			}
+
+			if err := enc.encode(w, result); err != nil {
+				b.logger.Println(err)
+			}
 		}
+	}
 
-		wg.Wait()
+	if err := enc.end(w); err != nil {
+		b.logger.Println(err)
+	}
+
+	if !buffered {
+		timing.queue = b.queued()
+		timing.encode = encoding + h.since(encodeStart)
 
-		close(ch)
-	}()
+		stats.write(writer.Header())
+		timing.write(writer.Header(), true)
 
-	return ch
+		if b.input != nil && b.input.err != nil {
+			writer.Header().Set(inputErrorHeader, b.input.err.Error())
+		}
+	}
 }
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/r3labs/diff/v2"
 	"io"
@@ -258,3 +259,84 @@ func checkResponse(resp *http.Response, expectedData []int) error {
 
 	return nil
 }
+
+// fetchResults posts body to handler requesting detailed results.
+func fetchResults(t *testing.T, url string, body io.Reader) []Result {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doFetchResults(t, req)
+}
+
+// doFetchResults makes request to handler requesting detailed results.
+func doFetchResults(t *testing.T, req *http.Request) []Result {
+	t.Helper()
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var results []Result
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+
+	return results
+}
+
+func TestHandlerClientFor(t *testing.T) {
+	server := createServer(0)
+
+	s := httptest.NewServer(NewHandler(
+		WithClient(&http.Client{Timeout: time.Millisecond * 10}),
+		WithClientFor("127.0.0.*", &http.Client{Timeout: time.Second}),
+	))
+	defer s.Close()
+
+	resp, err := s.Client().Post(s.URL, "text/plain", getRequestBodyBuffer(getUrl(server.URL, 100, time.Millisecond*50)))
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, []int{100}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandlerMethods(t *testing.T) {
+	cases := []struct {
+		opts   []Option
+		method string
+		status int
+		allow  string
+	}{
+		{nil, http.MethodGet, http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{nil, http.MethodOptions, http.StatusNoContent, "POST, OPTIONS"},
+		{nil, http.MethodPost, http.StatusOK, ""},
+		{[]Option{WithIncomingMethods("post", "put")}, http.MethodPut, http.StatusOK, ""},
+		{[]Option{WithIncomingMethods("post", "put")}, http.MethodDelete, http.StatusMethodNotAllowed, "POST, PUT, OPTIONS"},
+	}
+
+	for _, c := range cases {
+		h := NewHandler(c.opts...)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(c.method, "/", nil))
+
+		if w.Code != c.status {
+			t.Errorf("%s: expected status %d, got %d", c.method, c.status, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != c.allow {
+			t.Errorf("%s: expected Allow %q, got %q", c.method, c.allow, allow)
+		}
+	}
+}
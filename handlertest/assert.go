@@ -0,0 +1,87 @@
+package handlertest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	handler "github.com/lo00l/http-handler"
+)
+
+// Fetch makes request to h fetching urls and returns detailed results.
+// Request is served in-process, so no listener is needed.
+func Fetch(t testing.TB, h http.Handler, urls ...string) []handler.Result {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Join(urls, "\n")))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Accept", "application/json")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code >= http.StatusBadRequest {
+		t.Fatalf("request failed with status %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+
+	var results []handler.Result
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+
+	return results
+}
+
+// Find returns result of url, or nil if there is no such one.
+func Find(results []handler.Result, url string) *handler.Result {
+	for i := range results {
+		if results[i].URL == url {
+			return &results[i]
+		}
+	}
+
+	return nil
+}
+
+// AssertLength checks that url is fetched successfully and its length is expected.
+func AssertLength(t testing.TB, results []handler.Result, url string, expected int) {
+	t.Helper()
+
+	r := Find(results, url)
+
+	switch {
+	case r == nil:
+		t.Errorf("%s: no result", url)
+	case r.Error != "":
+		t.Errorf("%s: expected length %d, got error %q", url, expected, r.Error)
+	case r.Length != expected:
+		t.Errorf("%s: expected length %d, got %d", url, expected, r.Length)
+	}
+}
+
+// AssertFailed checks that fetching url failed.
+func AssertFailed(t testing.TB, results []handler.Result, url string) {
+	t.Helper()
+
+	r := Find(results, url)
+
+	switch {
+	case r == nil:
+		t.Errorf("%s: no result", url)
+	case r.Error == "":
+		t.Errorf("%s: expected error, got length %d", url, r.Length)
+	}
+}
+
+// AssertNoErrors checks that all URLs are fetched successfully.
+func AssertNoErrors(t testing.TB, results []handler.Result) {
+	t.Helper()
+
+	for _, r := range results {
+		if r.Error != "" {
+			t.Errorf("%s: unexpected error %q", r.URL, r.Error)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package handlertest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	handler "github.com/lo00l/http-handler"
+)
+
+// Fetcher is fake handler.SchemeFetcher serving documents
+// configured by Set method and failures configured by Fail method.
+// Fetching other URLs fails. Fetcher records URLs it is called for.
+type Fetcher struct {
+	mu    sync.Mutex
+	docs  map[string]Response
+	errs  map[string]error
+	calls []string
+}
+
+// NewFetcher creates new Fetcher.
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		docs: make(map[string]Response),
+		errs: make(map[string]error),
+	}
+}
+
+// Set makes resp served for rawURL. Its status is ignored.
+func (f *Fetcher) Set(rawURL string, resp Response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.docs[rawURL] = resp
+	delete(f.errs, rawURL)
+}
+
+// Fail makes fetching rawURL fail with err.
+func (f *Fetcher) Fail(rawURL string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errs[rawURL] = err
+	delete(f.docs, rawURL)
+}
+
+// Calls returns URLs Fetcher is called for, in order of calls.
+func (f *Fetcher) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.calls...)
+}
+
+// Fetch implements handler.SchemeFetcher interface.
+func (f *Fetcher) Fetch(ctx context.Context, method string, u *url.URL) (*handler.Document, error) {
+	rawURL := u.String()
+
+	f.mu.Lock()
+	f.calls = append(f.calls, rawURL)
+	resp, ok := f.docs[rawURL]
+	err := f.errs[rawURL]
+	f.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("document %s is not found", rawURL)
+	}
+
+	if resp.Delay > 0 {
+		timer := time.NewTimer(resp.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	body := resp.body()
+
+	header := make(http.Header)
+	for key, values := range resp.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	if method == http.MethodHead {
+		body = nil
+	}
+
+	return &handler.Document{
+		Header: header,
+		Body:   ioutil.NopCloser(bytes.NewReader(body)),
+	}, nil
+}
@@ -0,0 +1,66 @@
+package handlertest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	handler "github.com/lo00l/http-handler"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Handle("/page", Response{
+		Header: http.Header{"Content-Type": {"text/html"}},
+		Body:   []byte("<p>hello</p>"),
+	})
+
+	h := handler.NewHandler(handler.WithClient(&http.Client{Timeout: time.Millisecond * 200}))
+
+	var (
+		page    = s.Server.URL + "/page"
+		sized   = s.URL(Response{Length: 10})
+		missing = s.URL(Response{Status: http.StatusNotFound})
+		slow    = s.URL(Response{Length: 10, Delay: time.Second})
+	)
+
+	results := Fetch(t, h, page, sized, missing, slow)
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+
+	AssertLength(t, results, page, 12)
+	AssertLength(t, results, sized, 10)
+	AssertFailed(t, results, slow)
+
+	if r := Find(results, missing); r == nil || r.Status != http.StatusNotFound {
+		t.Errorf("expected status 404, got %+v", r)
+	}
+	if r := Find(results, page); r == nil || r.ContentType != "text/html" {
+		t.Errorf("expected text/html content type, got %+v", r)
+	}
+	if n := s.Requests("/page"); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestFetcher(t *testing.T) {
+	f := NewFetcher()
+	f.Set("mock://host/a", Response{Length: 5})
+	f.Fail("mock://host/b", errors.New("broken"))
+
+	h := handler.NewHandler(handler.WithSchemeFetcher("mock", f))
+
+	results := Fetch(t, h, "mock://host/a", "mock://host/b", "mock://host/c")
+
+	AssertLength(t, results, "mock://host/a", 5)
+	AssertFailed(t, results, "mock://host/b")
+	AssertFailed(t, results, "mock://host/c")
+
+	if calls := f.Calls(); len(calls) != 3 {
+		t.Errorf("expected 3 calls, got %v", calls)
+	}
+}
@@ -0,0 +1,148 @@
+// Package handlertest provides utilities for testing code
+// which uses handler package: fake target server, fake scheme
+// fetcher and helpers making requests and checking results.
+package handlertest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Response describes response served by Server or Fetcher.
+type Response struct {
+	// Status is response status. If zero, 200 is used.
+	// Fetcher ignores it.
+	Status int
+	// Length is length of generated body. It is ignored if Body is set.
+	Length int
+	// Delay is time to wait before response is sent.
+	Delay time.Duration
+	// Header contains response headers.
+	Header http.Header
+	// Body is response body.
+	Body []byte
+}
+
+// body returns response body.
+func (r Response) body() []byte {
+	if r.Body != nil {
+		return r.Body
+	}
+
+	return bytes.Repeat([]byte{'a'}, r.Length)
+}
+
+// Server is fake target server. Responses are configured per path
+// by Handle method. Responses of other paths are described by query
+// parameters: length, delay and status, see URL method.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	routes   map[string]Response
+	requests map[string]int
+}
+
+// NewServer starts and returns new Server.
+// Caller should call Close when finished.
+func NewServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewServer(s)
+
+	return s
+}
+
+// NewTLSServer starts and returns new Server using TLS.
+// Caller should call Close when finished.
+func NewTLSServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewTLSServer(s)
+
+	return s
+}
+
+func newServer() *Server {
+	return &Server{
+		routes:   make(map[string]Response),
+		requests: make(map[string]int),
+	}
+}
+
+// Handle makes resp served for requests of path.
+func (s *Server) Handle(path string, resp Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.routes[path] = resp
+}
+
+// URL returns URL of document described by resp. Only its length,
+// delay and status are encoded in URL; use Handle for other fields.
+func (s *Server) URL(resp Response) string {
+	q := make(url.Values, 3)
+	q.Set("length", strconv.Itoa(len(resp.body())))
+
+	if resp.Delay != 0 {
+		q.Set("delay", resp.Delay.String())
+	}
+	if resp.Status != 0 {
+		q.Set("status", strconv.Itoa(resp.Status))
+	}
+
+	return s.Server.URL + "/?" + q.Encode()
+}
+
+// Requests returns number of requests made to path.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+// ServeHTTP implements http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	resp, ok := s.routes[r.URL.Path]
+	s.mu.Unlock()
+
+	if !ok {
+		q := r.URL.Query()
+
+		resp.Length, _ = strconv.Atoi(q.Get("length"))
+		resp.Delay, _ = time.ParseDuration(q.Get("delay"))
+		resp.Status, _ = strconv.Atoi(q.Get("status"))
+	}
+
+	if resp.Delay > 0 {
+		timer := time.NewTimer(resp.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+
+	body := resp.body()
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+
+	if resp.Status != 0 {
+		w.WriteHeader(resp.Status)
+	}
+
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ResponseHeaders maps names of captured response headers to their values.
+// Multiple values of the same header are joined with comma.
+type ResponseHeaders map[string]string
+
+// MarshalXML encodes headers as elements with name attribute:
+//
+//	<header name="Etag">"33a64df5"</header>
+func (rh ResponseHeaders) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	names := make([]string, 0, len(rh))
+	for name := range rh {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		el := xml.StartElement{
+			Name: start.Name,
+			Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}},
+		}
+		if err := e.EncodeElement(rh[name], el); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// captureHeaders returns response headers contained in
+// allowlist set by WithResponseHeaders option, or nil
+// if there are no such ones. Sensitive headers are redacted.
+func (h *Handler) captureHeaders(header http.Header) ResponseHeaders {
+	captured := make(http.Header)
+	for _, key := range h.responseHeaders {
+		if values, ok := header[key]; ok {
+			captured[key] = values
+		}
+	}
+
+	if len(captured) == 0 {
+		return nil
+	}
+
+	rh := make(ResponseHeaders, len(captured))
+	for key, values := range h.redactor.header(captured) {
+		rh[key] = strings.Join(values, ", ")
+	}
+
+	return rh
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerResponseHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Add("Cache-Control", "public")
+		w.Header().Add("Cache-Control", "max-age=60")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Server", "test")
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(
+		WithResponseHeaders("etag", "cache-control", "set-cookie", "last-modified"),
+		WithRedaction(RedactionRules{Headers: []string{"Set-Cookie"}}),
+	))
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, strings.NewReader(server.URL))
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %+v", results)
+	}
+
+	expected := ResponseHeaders{
+		"Etag":          `"abc"`,
+		"Cache-Control": "public, max-age=60",
+		"Set-Cookie":    redactedValue,
+	}
+
+	got := results[0].Headers
+	if len(got) != len(expected) {
+		t.Fatalf("expected headers %v, got %v", expected, got)
+	}
+	for key, value := range expected {
+		if got[key] != value {
+			t.Errorf("expected %s header %q, got %q", key, value, got[key])
+		}
+	}
+}
+
+func TestResponseHeadersMarshalXML(t *testing.T) {
+	v := struct {
+		XMLName xml.Name        `xml:"result"`
+		Headers ResponseHeaders `xml:"header"`
+	}{
+		Headers: ResponseHeaders{"Etag": `"abc"`, "Cache-Control": "public"},
+	}
+
+	data, err := xml.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<result><header name="Cache-Control">public</header><header name="Etag">&#34;abc&#34;</header></result>`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
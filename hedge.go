@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// hedgeAttempt is outcome of single attempt of hedged request.
+type hedgeAttempt struct {
+	resp *http.Response
+	err  error
+	// index is position of attempt's cancel func.
+	index int
+}
+
+// hedgeTransport makes the second attempt of request if the first one
+// is not responded within delay. Response received first is used,
+// and the other attempt is canceled. Only GET and HEAD requests
+// without body are hedged, since they are safe to repeat.
+type hedgeTransport struct {
+	delay time.Duration
+	next  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *hedgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead || req.Body != nil && req.Body != http.NoBody {
+		return t.next.RoundTrip(req)
+	}
+
+	ch := make(chan hedgeAttempt, 2)
+	// cancels contain cancel funcs of launched attempts
+	var cancels []context.CancelFunc
+	launch := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+
+		go func() {
+			resp, err := t.next.RoundTrip(req.Clone(ctx))
+			ch <- hedgeAttempt{resp, err, index}
+		}()
+	}
+
+	launch()
+	pending, hedged := 1, false
+
+	timer := time.NewTimer(t.delay)
+	defer timer.Stop()
+
+	var failed hedgeAttempt
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if !hedged {
+				launch()
+				pending, hedged = pending+1, true
+			}
+		case a := <-ch:
+			pending--
+
+			if a.err != nil {
+				cancels[a.index]()
+				failed = a
+
+				continue
+			}
+
+			// the other attempt, if any, is canceled right away,
+			// and its response is discarded once it returns
+			for i, cancel := range cancels {
+				if i != a.index {
+					cancel()
+				}
+			}
+			go discardAttempts(ch, pending)
+
+			a.resp.Request = req
+			a.resp.Body = &releaseBody{
+				ReadCloser: a.resp.Body,
+				release:    cancels[a.index],
+			}
+
+			return a.resp, nil
+		}
+	}
+
+	return nil, failed.err
+}
+
+// discardAttempts receives n canceled attempts
+// from ch and closes their responses' bodies.
+func discardAttempts(ch <-chan hedgeAttempt, n int) {
+	for ; n > 0; n-- {
+		a := <-ch
+
+		if a.err == nil {
+			a.resp.Body.Close()
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerHedging(t *testing.T) {
+	var requests, canceled int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first attempt stalls, while the second one is fast
+		if atomic.AddInt32(&requests, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&canceled, 1)
+			case <-time.After(time.Second * 5):
+			}
+
+			return
+		}
+
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithHedging(time.Millisecond * 50)))
+	defer s.Close()
+
+	start := time.Now()
+
+	results := fetchResults(t, s.URL, strings.NewReader(server.URL))
+	if len(results) != 1 || results[0].Length != 5 || results[0].Error != "" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hedged request took %s", elapsed)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&canceled) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if canceled != 1 {
+		t.Error("slow attempt is not canceled")
+	}
+}
+
+func TestHedgeTransportFastResponse(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &hedgeTransport{
+			delay: time.Second,
+			next:  http.DefaultTransport,
+		},
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		req, _ := http.NewRequest(method, server.URL, nil)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(data) != "hello" {
+			t.Errorf("%s: unexpected body %q", method, data)
+		}
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestHedgeTransportCancelsLoser(t *testing.T) {
+	var requests int32
+	canceled := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				close(canceled)
+			case <-time.After(time.Second * 5):
+			}
+
+			return
+		}
+
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &hedgeTransport{
+			delay: time.Millisecond * 50,
+			next:  http.DefaultTransport,
+		},
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// winner is still being read, and request's context is not
+	// canceled, so loser must be canceled by transport itself
+	defer resp.Body.Close()
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("losing attempt is not canceled")
+	}
+}
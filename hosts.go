@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// matchHost reports whether host matches pattern.
+// Pattern may contain shell-like wildcards, e.g. "*.example.com".
+// Comparison is case-insensitive.
+func matchHost(pattern, host string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(host))
+
+	return ok
+}
+
+// hostClient binds HTTP client to host pattern.
+type hostClient struct {
+	pattern string
+	client  *http.Client
+}
+
+// hostLimit binds outgoing limits to host pattern.
+type hostLimit struct {
+	pattern string
+	limit   HostLimit
+}
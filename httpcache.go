@@ -0,0 +1,568 @@
+package handler
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache statuses of results.
+const (
+	// cacheHit marks results served from cache without outgoing request.
+	cacheHit = "hit"
+	// cacheRevalidated marks results served from cache
+	// after conditional request was answered with 304.
+	cacheRevalidated = "revalidated"
+	// cacheMiss marks results fetched from origin.
+	cacheMiss = "miss"
+)
+
+// httpCacheEntryShare is share of cache size a single response may take,
+// so responses are not buffered beyond it in order to be stored.
+const httpCacheEntryShare = 8
+
+// cacheableStatuses contains statuses of responses
+// which can be stored, see RFC 7231, section 6.1.
+var cacheableStatuses = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// HTTPCacheStats contains HTTP cache usage statistics.
+type HTTPCacheStats struct {
+	Hits          uint64
+	Revalidations uint64
+	Misses        uint64
+}
+
+// HitRate returns ratio of requests served from cache,
+// including revalidated ones.
+func (s HTTPCacheStats) HitRate() float64 {
+	total := s.Hits + s.Revalidations + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits+s.Revalidations) / float64(total)
+}
+
+// cacheEntry is stored response. Entries are never modified,
+// revalidated response replaces its entry.
+type cacheEntry struct {
+	key    string
+	status string
+	code   int
+	proto  string
+	major  int
+	minor  int
+	header http.Header
+	body   []byte
+	// vary contains request's values of headers listed in Vary header.
+	vary http.Header
+	// requestTime and responseTime are times request was sent and
+	// response was received, see RFC 7234, section 4.2.3.
+	requestTime  time.Time
+	responseTime time.Time
+}
+
+// date returns value of response's Date header,
+// or time response was received if it is missing.
+func (e *cacheEntry) date() time.Time {
+	if date, err := http.ParseTime(e.header.Get("Date")); err == nil {
+		return date
+	}
+
+	return e.responseTime
+}
+
+// lifetime returns freshness lifetime of response,
+// see RFC 7234, section 4.2.1.
+func (e *cacheEntry) lifetime() time.Duration {
+	cc := parseCacheControl(e.header)
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, ok := cc[directive]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				return 0
+			}
+
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	date := e.date()
+
+	if value := e.header.Get("Expires"); value != "" {
+		// invalid Expires value means response is already expired
+		expires, err := http.ParseTime(value)
+		if err != nil {
+			return 0
+		}
+
+		return expires.Sub(date)
+	}
+
+	// heuristic freshness, see RFC 7234, section 4.2.2
+	if modified, err := http.ParseTime(e.header.Get("Last-Modified")); err == nil && modified.Before(date) {
+		return date.Sub(modified) / 10
+	}
+
+	return 0
+}
+
+// age returns current age of response, see RFC 7234, section 4.2.3.
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparent := e.responseTime.Sub(e.date())
+	if apparent < 0 {
+		apparent = 0
+	}
+
+	seconds, _ := strconv.Atoi(e.header.Get("Age"))
+	corrected := time.Duration(seconds)*time.Second + e.responseTime.Sub(e.requestTime)
+
+	if corrected < apparent {
+		corrected = apparent
+	}
+
+	return corrected + now.Sub(e.responseTime)
+}
+
+// fresh reports whether response can be served without revalidation.
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return e.lifetime() > e.age(now)
+}
+
+// matches reports whether response can be served for request,
+// i.e. request's headers listed in Vary header match stored ones.
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for key, values := range e.vary {
+		if strings.Join(req.Header[key], ", ") != strings.Join(values, ", ") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// response returns stored response to request.
+func (e *cacheEntry) response(req *http.Request, now time.Time) *http.Response {
+	header := e.header.Clone()
+	header.Set("Age", strconv.Itoa(int(e.age(now).Seconds())))
+
+	return &http.Response{
+		Status:        e.status,
+		StatusCode:    e.code,
+		Proto:         e.proto,
+		ProtoMajor:    e.major,
+		ProtoMinor:    e.minor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// parseCacheControl returns directives of Cache-Control header.
+// Names of directives are lowercased.
+func parseCacheControl(header http.Header) map[string]string {
+	cc := make(map[string]string)
+
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+
+			name, arg := directive, ""
+			if i := strings.IndexByte(directive, '='); i >= 0 {
+				name, arg = directive[:i], strings.Trim(directive[i+1:], `"`)
+			}
+
+			cc[strings.ToLower(strings.TrimSpace(name))] = arg
+		}
+	}
+
+	return cc
+}
+
+// httpCache stores responses of outgoing requests according to RFC 7234.
+// Since results are served to different clients, it behaves like shared
+// cache: private responses are never stored, and responses to requests
+// with credentials are stored only if they are explicitly allowed to.
+// Least recently used responses are evicted when total size of stored
+// bodies exceeds the limit.
+type httpCache struct {
+	// hits, revalidations and misses are accessed atomically,
+	// so they are the first fields to be 64-bit aligned.
+	hits          uint64
+	revalidations uint64
+	misses        uint64
+
+	maxBytes int64
+	// maxEntryBytes is maximum size of stored body.
+	maxEntryBytes int64
+	now           func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+}
+
+// newHTTPCache creates new HTTP cache storing up to maxBytes of bodies.
+func newHTTPCache(maxBytes int64) *httpCache {
+	return &httpCache{
+		maxBytes:      maxBytes,
+		maxEntryBytes: maxBytes / httpCacheEntryShare,
+		now:           time.Now,
+		entries:       make(map[string]*list.Element),
+		lru:           list.New(),
+	}
+}
+
+// get returns stored response to request, if any.
+func (c *httpCache) get(key string, req *http.Request) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if !entry.matches(req) {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+
+	return entry
+}
+
+// put stores entry replacing previous response, if any.
+func (c *httpCache) put(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeLocked(entry.key)
+
+	if int64(len(entry.body)) > c.maxBytes {
+		return
+	}
+
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += int64(len(entry.body))
+
+	for c.size > c.maxBytes {
+		c.removeLocked(c.lru.Back().Value.(*cacheEntry).key)
+	}
+}
+
+// remove removes stored response, if any.
+func (c *httpCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeLocked(key)
+}
+
+// removeLocked removes stored response, if any. It must be called with mu held.
+func (c *httpCache) removeLocked(key string) {
+	el, ok := c.entries[key]
+	if !ok {
+		return
+	}
+
+	delete(c.entries, key)
+	c.lru.Remove(el)
+	c.size -= int64(len(el.Value.(*cacheEntry).body))
+}
+
+// stats returns cache usage statistics.
+func (c *httpCache) stats() HTTPCacheStats {
+	return HTTPCacheStats{
+		Hits:          atomic.LoadUint64(&c.hits),
+		Revalidations: atomic.LoadUint64(&c.revalidations),
+		Misses:        atomic.LoadUint64(&c.misses),
+	}
+}
+
+// cacheableRequest reports whether response to request
+// can be served from cache and stored. Since cache is keyed
+// by URL, requests with cookies or credentials other than
+// Authorization header are never cached, as their responses
+// may differ per client.
+func cacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return false
+	}
+
+	if req.Header.Get("Cookie") != "" || privateRequest(req) {
+		return false
+	}
+
+	// conditional requests made by clients are passed as is
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+
+	_, noStore := parseCacheControl(req.Header)["no-store"]
+
+	return !noStore
+}
+
+// storable reports whether response to request can be stored,
+// see RFC 7234, section 3.
+func storable(req *http.Request, resp *http.Response) bool {
+	if !cacheableStatuses[resp.StatusCode] || resp.Header.Get("Vary") == "*" {
+		return false
+	}
+
+	cc := parseCacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if _, ok := cc["private"]; ok {
+		return false
+	}
+
+	if req.Header.Get("Authorization") != "" {
+		_, public := cc["public"]
+		_, mustRevalidate := cc["must-revalidate"]
+		_, sMaxAge := cc["s-maxage"]
+
+		if !public && !mustRevalidate && !sMaxAge {
+			return false
+		}
+	}
+
+	// responses which can not be fresh nor revalidated are useless
+	_, maxAge := cc["max-age"]
+	_, sMaxAge := cc["s-maxage"]
+
+	return maxAge || sMaxAge ||
+		resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" ||
+		resp.Header.Get("Last-Modified") != ""
+}
+
+// privateRequestKey is context key marking requests
+// whose responses can not be served from cache nor stored.
+type privateRequestKey struct{}
+
+// withPrivateRequest returns context marking requests as private.
+func withPrivateRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, privateRequestKey{}, true)
+}
+
+// privateRequest reports whether request is marked as private.
+func privateRequest(req *http.Request) bool {
+	private, _ := req.Context().Value(privateRequestKey{}).(bool)
+
+	return private
+}
+
+// cacheStatusKey is context key of pointer cache status of request is stored to.
+type cacheStatusKey struct{}
+
+// withCacheStatus returns context making cache status of request stored to status.
+func withCacheStatus(ctx context.Context, status *string) context.Context {
+	return context.WithValue(ctx, cacheStatusKey{}, status)
+}
+
+// setCacheStatus stores cache status of request, if it is requested.
+func setCacheStatus(req *http.Request, status string) {
+	if p, ok := req.Context().Value(cacheStatusKey{}).(*string); ok {
+		*p = status
+	}
+}
+
+// cacheTransport serves requests from cache when possible,
+// revalidates stale responses by conditional requests
+// and stores responses of next round tripper.
+type cacheTransport struct {
+	cache *httpCache
+	next  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp, err := t.next.RoundTrip(req)
+
+		// successful unsafe requests invalidate stored responses,
+		// see RFC 7234, section 4.4
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			t.cache.remove(key)
+		}
+
+		return resp, err
+	}
+
+	if !cacheableRequest(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	_, noCache := parseCacheControl(req.Header)["no-cache"]
+
+	entry := t.cache.get(key, req)
+	if entry != nil && !noCache && entry.fresh(t.cache.now()) {
+		atomic.AddUint64(&t.cache.hits, 1)
+		setCacheStatus(req, cacheHit)
+
+		return entry.response(req, t.cache.now()), nil
+	}
+
+	outgoing := req
+	if entry != nil {
+		etag, modified := entry.header.Get("ETag"), entry.header.Get("Last-Modified")
+
+		if etag != "" || modified != "" {
+			outgoing = req.Clone(req.Context())
+
+			if etag != "" {
+				outgoing.Header.Set("If-None-Match", etag)
+			}
+			if modified != "" {
+				outgoing.Header.Set("If-Modified-Since", modified)
+			}
+		}
+	}
+
+	requestTime := t.cache.now()
+
+	resp, err := t.next.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+
+	responseTime := t.cache.now()
+
+	if outgoing != req && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+
+		revalidated := *entry
+		revalidated.header = entry.header.Clone()
+		revalidated.requestTime = requestTime
+		revalidated.responseTime = responseTime
+
+		// stored headers are updated by ones of 304 response,
+		// see RFC 7234, section 4.3.4
+		for key, values := range resp.Header {
+			if key != "Content-Length" {
+				revalidated.header[key] = values
+			}
+		}
+
+		t.cache.put(&revalidated)
+
+		atomic.AddUint64(&t.cache.revalidations, 1)
+		setCacheStatus(req, cacheRevalidated)
+
+		return revalidated.response(req, t.cache.now()), nil
+	}
+
+	atomic.AddUint64(&t.cache.misses, 1)
+	setCacheStatus(req, cacheMiss)
+
+	if !storable(req, resp) {
+		t.cache.remove(key)
+
+		return resp, nil
+	}
+
+	return t.store(key, req, resp, requestTime, responseTime), nil
+}
+
+// store reads response's body and stores response. If body is larger
+// than entry may be or can not be read, response is returned unstored
+// with already read part of body prepended to the rest of it.
+func (t *cacheTransport) store(key string, req *http.Request, resp *http.Response, requestTime, responseTime time.Time) *http.Response {
+	if resp.ContentLength > t.cache.maxEntryBytes {
+		return resp
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, t.cache.maxEntryBytes+1))
+	if err != nil || int64(len(body)) > t.cache.maxEntryBytes {
+		resp.Body = &prefixedBody{
+			Reader: io.MultiReader(bytes.NewReader(body), resp.Body),
+			Closer: resp.Body,
+		}
+
+		return resp
+	}
+	resp.Body.Close()
+
+	entry := &cacheEntry{
+		key:          key,
+		status:       resp.Status,
+		code:         resp.StatusCode,
+		proto:        resp.Proto,
+		major:        resp.ProtoMajor,
+		minor:        resp.ProtoMinor,
+		header:       resp.Header.Clone(),
+		body:         body,
+		requestTime:  requestTime,
+		responseTime: responseTime,
+	}
+
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+
+			if entry.vary == nil {
+				entry.vary = make(http.Header)
+			}
+			entry.vary[name] = req.Header[name]
+		}
+	}
+
+	t.cache.put(entry)
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+
+	return resp
+}
+
+// prefixedBody is response body with already read part prepended.
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// HTTPCacheStats returns statistics of HTTP cache
+// enabled by WithHTTPCache option.
+func (h *Handler) HTTPCacheStats() HTTPCacheStats {
+	if h.httpCache == nil {
+		return HTTPCacheStats{}
+	}
+
+	return h.httpCache.stats()
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerHTTPCache(t *testing.T) {
+	var requests, conditional int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/revalidated":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&conditional, 1)
+				w.WriteHeader(http.StatusNotModified)
+
+				return
+			}
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		}
+
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	h := NewHandler(WithHTTPCache(1 << 20))
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	body := strings.Join([]string{server.URL + "/fresh", server.URL + "/revalidated", server.URL + "/private"}, "\n")
+
+	for i, expected := range [][]string{{cacheMiss, cacheMiss, cacheMiss}, {cacheHit, cacheRevalidated, cacheMiss}} {
+		results := fetchResults(t, s.URL, strings.NewReader(body))
+		if len(results) != 3 {
+			t.Fatalf("expected 3 results, got %+v", results)
+		}
+
+		byURL := make(map[string]Result)
+		for _, r := range results {
+			byURL[r.URL] = r
+		}
+
+		for j, path := range []string{"/fresh", "/revalidated", "/private"} {
+			r := byURL[server.URL+path]
+			if r.Cache != expected[j] || r.Length != 5 || r.Status != http.StatusOK {
+				t.Errorf("batch %d: unexpected result of %s: %+v", i, path, r)
+			}
+		}
+	}
+
+	if requests != 5 || conditional != 1 {
+		t.Errorf("expected 5 requests including 1 conditional, got %d and %d", requests, conditional)
+	}
+
+	stats := h.HTTPCacheStats()
+	if stats.Hits != 1 || stats.Revalidations != 1 || stats.Misses != 4 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheTransportExpiration(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+	defer server.Close()
+
+	now := time.Now()
+
+	cache := newHTTPCache(1 << 20)
+	cache.now = func() time.Time {
+		return now
+	}
+
+	client := &http.Client{
+		Transport: &cacheTransport{
+			cache: cache,
+			next:  http.DefaultTransport,
+		},
+	}
+
+	get := func(lang string) string {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Accept-Language", lang)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		data, _ := ioutil.ReadAll(resp.Body)
+
+		return string(data)
+	}
+
+	steps := []struct {
+		advance  time.Duration
+		lang     string
+		requests int32
+	}{
+		{0, "en", 1},
+		{time.Second * 5, "en", 1},
+		{0, "de", 2},
+		{0, "de", 2},
+		{time.Second * 11, "de", 3},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.advance)
+
+		if got := get(step.lang); got != step.lang {
+			t.Errorf("step %d: expected body %q, got %q", i, step.lang, got)
+		}
+		if got := atomic.LoadInt32(&requests); got != step.requests {
+			t.Errorf("step %d: expected %d requests, got %d", i, step.requests, got)
+		}
+	}
+}
+
+func TestHTTPCacheEviction(t *testing.T) {
+	cache := newHTTPCache(10)
+
+	for _, key := range []string{"a", "b", "c"} {
+		cache.put(&cacheEntry{key: key, body: []byte("12345")})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	if cache.get("a", req) != nil {
+		t.Error("least recently used entry is not evicted")
+	}
+	if cache.get("b", req) == nil || cache.get("c", req) == nil {
+		t.Error("recent entries are evicted")
+	}
+	if cache.size != 10 {
+		t.Errorf("expected size 10, got %d", cache.size)
+	}
+}
+
+func TestHandlerHTTPCachePrivate(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("X-Api-Key")))
+	}))
+	defer server.Close()
+
+	h := NewHandler(WithHTTPCache(1<<20), WithCredentialProvider(StaticCredentials(map[string]Credentials{
+		"127.0.0.1": {Header: http.Header{"X-Api-Key": {"secret"}}},
+	})))
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	for i := 0; i < 2; i++ {
+		results := fetchResults(t, s.URL, strings.NewReader(server.URL))
+		if len(results) != 1 || results[0].Cache != "" || results[0].Length != 6 {
+			t.Errorf("unexpected results: %+v", results)
+		}
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestCacheTransportNotStored(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(strings.Repeat("x", 200)))
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &cacheTransport{
+			cache: newHTTPCache(1000),
+			next:  http.DefaultTransport,
+		},
+	}
+
+	get := func(url, cookie string) {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if data, _ := ioutil.ReadAll(resp.Body); len(data) != 200 {
+			t.Errorf("expected 200 bytes, got %d", len(data))
+		}
+	}
+
+	// response takes more than 1/8 of cache
+	get(server.URL+"/large", "")
+	get(server.URL+"/large", "")
+
+	if requests != 2 {
+		t.Errorf("expected large response not stored, got %d requests", requests)
+	}
+
+	client.Transport.(*cacheTransport).cache = newHTTPCache(1 << 20)
+
+	get(server.URL+"/cookie", "session=a")
+	get(server.URL+"/cookie", "session=b")
+
+	if requests != 4 {
+		t.Errorf("expected response to request with cookies not stored, got %d requests", requests)
+	}
+}
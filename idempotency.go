@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyKeyHeader is request header containing idempotency key.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	// idempotencyMaxResponses is maximum number of kept responses.
+	idempotencyMaxResponses = 10000
+	// idempotencyMaxBytes is maximum total size of bodies of kept responses.
+	idempotencyMaxBytes = 64 << 20
+)
+
+// idempotentResponse is response of request with idempotency key.
+type idempotentResponse struct {
+	// done is closed once response is recorded.
+	done    chan struct{}
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+	// complete is set if response is written completely, i.e. request
+	// is not canceled and writing does not fail. Incomplete responses
+	// are not replayed.
+	complete bool
+	// requestHash is hash of body of request response is recorded for.
+	requestHash []byte
+
+	key string
+	// el is element of response in list of kept responses, if it is kept.
+	el *list.Element
+}
+
+// replay writes recorded response.
+func (r *idempotentResponse) replay(writer http.ResponseWriter) {
+	header := writer.Header()
+	for key, values := range r.header {
+		header[key] = values
+	}
+	// trailer values are known already, so they are sent as headers
+	header.Del("Trailer")
+	header.Set("Idempotent-Replayed", "true")
+
+	writer.WriteHeader(r.status)
+	writer.Write(r.body)
+}
+
+// idempotencyCache keeps responses of requests with idempotency keys,
+// so repeated requests reuse them instead of fetching batch again.
+// The oldest responses are evicted once number of kept responses
+// or total size of their bodies exceeds the limit.
+type idempotencyCache struct {
+	retention    time.Duration
+	maxResponses int
+	maxBytes     int64
+
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+	// kept lists kept responses from the oldest to the newest,
+	// which is also order of their expiration.
+	kept *list.List
+	size int64
+}
+
+// newIdempotencyCache creates new idempotencyCache.
+func newIdempotencyCache(retention time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		retention:    retention,
+		maxResponses: idempotencyMaxResponses,
+		maxBytes:     idempotencyMaxBytes,
+		responses:    make(map[string]*idempotentResponse),
+		kept:         list.New(),
+	}
+}
+
+// start returns response of key. If there is no such one, new response
+// is created and true is returned, so caller must record it and call finish.
+func (c *idempotencyCache) start(key string) (*idempotentResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	for el := c.kept.Front(); el != nil && now.After(el.Value.(*idempotentResponse).expires); el = c.kept.Front() {
+		c.removeLocked(el.Value.(*idempotentResponse))
+	}
+
+	if r, ok := c.responses[key]; ok {
+		return r, false
+	}
+
+	r := &idempotentResponse{
+		done: make(chan struct{}),
+		key:  key,
+	}
+	c.responses[key] = r
+
+	return r, true
+}
+
+// finish stores response recorded by rec for request whose body hash is
+// requestHash, and wakes up waiting requests. Responses caused by temporary
+// failures are not kept, so request can be retried, and incomplete ones
+// are neither kept nor replayed.
+func (c *idempotencyCache) finish(key string, r *idempotentResponse, rec *responseRecorder, complete bool, requestHash []byte) {
+	r.status = rec.status
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.header = rec.ResponseWriter.Header().Clone()
+	r.body = rec.buf.Bytes()
+	r.complete = complete && !rec.failed
+	r.requestHash = requestHash
+
+	c.mu.Lock()
+	if !r.complete || r.status >= http.StatusInternalServerError || r.status == http.StatusTooManyRequests || int64(len(r.body)) > c.maxBytes {
+		delete(c.responses, key)
+	} else {
+		r.expires = time.Now().Add(c.retention)
+		r.el = c.kept.PushBack(r)
+		c.size += int64(len(r.body))
+
+		for c.kept.Len() > c.maxResponses || c.size > c.maxBytes {
+			c.removeLocked(c.kept.Front().Value.(*idempotentResponse))
+		}
+	}
+	c.mu.Unlock()
+
+	close(r.done)
+}
+
+// abort drops response of request which has panicked,
+// and wakes up waiting requests, so they are served again.
+func (c *idempotencyCache) abort(key string, r *idempotentResponse) {
+	c.mu.Lock()
+	delete(c.responses, key)
+	c.mu.Unlock()
+
+	close(r.done)
+}
+
+// removeLocked removes kept response. It must be called with mu held.
+func (c *idempotencyCache) removeLocked(r *idempotentResponse) {
+	delete(c.responses, r.key)
+	c.kept.Remove(r.el)
+	c.size -= int64(len(r.body))
+}
+
+// hashingBody computes hash of request body as it is read.
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	// n is number of bytes read.
+	n int64
+}
+
+// Read implements io.Reader interface.
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	b.n += int64(n)
+
+	return n, err
+}
+
+// sum reads the rest of body, up to limit bytes in total,
+// and returns hash of body.
+func (b *hashingBody) sum(limit int64) []byte {
+	if left := limit - b.n; left > 0 {
+		io.Copy(ioutil.Discard, io.LimitReader(b, left))
+	}
+
+	return b.hash.Sum(nil)
+}
+
+// serveIdempotent serves request with idempotency key. If response of key
+// is recorded, it is replayed, waiting until recording is finished, and true
+// is returned. Repeated request with different body is rejected with 422
+// Unprocessable Entity. Otherwise, returned writer records response, and
+// returned func must be deferred by caller, so it is called once request
+// is served or has panicked.
+func (h *Handler) serveIdempotent(writer http.ResponseWriter, request *http.Request, key string) (http.ResponseWriter, func(), bool) {
+	// compressed responses are recorded as they are sent,
+	// so they are replayed to clients accepting compression only
+	if h.compressionThreshold >= 0 && acceptsGzip(request) {
+		key += "\x00gzip"
+	}
+
+	// bodies are compared up to limit, since larger ones are rejected
+	limit := h.maxBodySize + 1
+
+	var requestHash []byte
+	for {
+		r, owner := h.idempotency.start(key)
+		if owner {
+			body := &hashingBody{
+				ReadCloser: request.Body,
+				hash:       sha256.New(),
+			}
+			request.Body = body
+
+			rec := &responseRecorder{ResponseWriter: writer}
+			// finish is deferred, so it recovers panic of request
+			// to drop its response and then panics again
+			finish := func() {
+				if value := recover(); value != nil {
+					h.idempotency.abort(key, r)
+					panic(value)
+				}
+
+				h.idempotency.finish(key, r, rec, request.Context().Err() == nil, body.sum(limit))
+			}
+
+			return rec, finish, false
+		}
+
+		if requestHash == nil {
+			// body is kept, since request records response
+			// if recording of another one is not completed
+			data, err := ioutil.ReadAll(io.LimitReader(request.Body, limit))
+			if err != nil {
+				http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+				return nil, nil, true
+			}
+			request.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+			sum := sha256.Sum256(data)
+			requestHash = sum[:]
+		}
+
+		select {
+		case <-r.done:
+		case <-request.Context().Done():
+			return nil, nil, true
+		}
+
+		if !r.complete {
+			continue
+		}
+
+		if !bytes.Equal(r.requestHash, requestHash) {
+			http.Error(writer, "idempotency key is reused with different body", http.StatusUnprocessableEntity)
+
+			return nil, nil, true
+		}
+
+		r.replay(writer)
+
+		return nil, nil, true
+	}
+}
+
+// responseRecorder writes response to underlying writer
+// and records its status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+	// failed is set once writing to underlying writer fails.
+	failed bool
+}
+
+// WriteHeader implements http.ResponseWriter interface.
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements io.Writer interface.
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.buf.Write(p)
+
+	n, err := r.ResponseWriter.Write(p)
+	if err != nil {
+		r.failed = true
+	}
+
+	return n, err
+}
+
+// Flush implements http.Flusher interface.
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerIdempotency(t *testing.T) {
+	var fetches int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt64(&fetches, 1)
+		time.Sleep(50 * time.Millisecond)
+		writer.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithIdempotency(time.Minute)))
+	defer s.Close()
+
+	post := func(key string) (string, http.Header) {
+		req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(server.URL))
+		req.Header.Set(idempotencyKeyHeader, key)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("failed to make request: %s", err)
+
+			return "", nil
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		return string(body), resp.Header
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if body, _ := post("a"); body != "5\n" {
+				t.Errorf("unexpected body: %q", body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	body, header := post("a")
+	if body != "5\n" || header.Get("Idempotent-Replayed") != "true" || header.Get(fetchedCountHeader) != "1" {
+		t.Errorf("unexpected replayed response: %q %v", body, header)
+	}
+
+	if n := atomic.LoadInt64(&fetches); n != 1 {
+		t.Errorf("expected 1 fetch, got %d", n)
+	}
+
+	post("b")
+
+	if n := atomic.LoadInt64(&fetches); n != 2 {
+		t.Errorf("expected 2 fetches, got %d", n)
+	}
+}
+
+func TestHandlerIdempotencyRequest(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithIdempotency(time.Minute), WithCompressionThreshold(1)))
+	defer s.Close()
+
+	// transport must not request compression on its own
+	transport := &http.Transport{DisableCompression: true}
+	defer transport.CloseIdleConnections()
+
+	post := func(url string, gzip bool) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(url))
+		req.Header.Set(idempotencyKeyHeader, "a")
+		if gzip {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	url := getUrl(server.URL, 10, 0)
+
+	if resp := post(url, true); resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected compressed response, got %v", resp.Header)
+	}
+
+	// compressed response is not replayed to client not accepting it
+	if resp := post(url, false); resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected uncompressed response, got %v", resp.Header)
+	}
+	if resp := post(url, false); resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected replayed response, got %v", resp.Header)
+	}
+
+	if resp := post(getUrl(server.URL, 20, 0), false); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 for different body, got %d", resp.StatusCode)
+	}
+}
+
+func TestIdempotencyCacheIncomplete(t *testing.T) {
+	c := newIdempotencyCache(time.Minute)
+
+	r, owner := c.start("a")
+	if !owner {
+		t.Fatal("expected owner")
+	}
+
+	rec := &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+	rec.Write([]byte("partial"))
+	c.finish("a", r, rec, false, nil)
+
+	if r.complete {
+		t.Error("expected incomplete response")
+	}
+	if _, owner := c.start("a"); !owner {
+		t.Error("expected incomplete response not kept")
+	}
+}
+
+func TestIdempotencyCacheEviction(t *testing.T) {
+	c := newIdempotencyCache(time.Minute)
+	c.maxResponses = 2
+	c.maxBytes = 10
+
+	keep := func(key, body string) {
+		r, owner := c.start(key)
+		if !owner {
+			t.Fatalf("expected owner of %s", key)
+		}
+
+		rec := &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+		rec.Write([]byte(body))
+		c.finish(key, r, rec, true, nil)
+	}
+
+	keep("a", "aaa")
+	keep("b", "bbb")
+	keep("c", "ccc")
+	keep("d", "dddddddd")
+	keep("e", strings.Repeat("e", 11))
+
+	for key, kept := range map[string]bool{"a": false, "b": false, "c": false, "d": true, "e": false} {
+		if _, ok := c.responses[key]; ok != kept {
+			t.Errorf("%s: expected kept %t", key, kept)
+		}
+	}
+	if c.kept.Len() != 1 || c.size != 8 {
+		t.Errorf("expected 1 response of 8 bytes, got %d of %d bytes", c.kept.Len(), c.size)
+	}
+}
+
+func TestHandlerIdempotencyPanic(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	var calls int32
+
+	policy := ShedPolicyFunc(func(r *http.Request, stats LoadStats) ShedDecision {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("policy failed")
+		}
+
+		return ShedAccept
+	})
+
+	s := httptest.NewServer(NewHandler(WithIdempotency(time.Minute), WithShedPolicy(policy, 0), WithLogger(log.New(ioutil.Discard, "", 0))))
+	defer s.Close()
+
+	post := func() *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(getUrl(server.URL, 10, 0)))
+		req.Header.Set(idempotencyKeyHeader, "a")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err)
+		}
+		resp.Body.Close()
+
+		return resp
+	}
+
+	if resp := post(); resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", resp.StatusCode)
+	}
+
+	resp := post()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected request served again, got status %d, replayed %q", resp.StatusCode, resp.Header.Get("Idempotent-Replayed"))
+	}
+}
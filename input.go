@@ -0,0 +1,443 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// target is single URL to fetch.
+type target struct {
+	URL string `json:"url"`
+	// Headers are added to outgoing request
+	// overriding any other headers.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// normalized is normalized form of URL, if normalization is enabled.
+	normalized string
+}
+
+// fetchURL returns URL outgoing request is made to.
+func (t target) fetchURL() string {
+	if t.normalized != "" {
+		return t.normalized
+	}
+
+	return t.URL
+}
+
+// UnmarshalJSON allows target to be either URL string or object.
+func (t *target) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &t.URL)
+	}
+
+	type plain target
+
+	return json.Unmarshal(data, (*plain)(t))
+}
+
+// inputModeHeader is request header which sets the way URLs
+// of request are interpreted, see input modes.
+const inputModeHeader = "X-Input-Mode"
+
+// Input modes.
+const (
+	// inputURLs makes URLs fetched as is.
+	inputURLs = ""
+	// inputSitemap makes URLs, which point to sitemaps or sitemap
+	// indexes, expanded into URLs listed in them, see WithSitemapExpansion.
+	inputSitemap = "sitemap"
+	// inputCrawl makes URLs seeds of crawl, see WithCrawl.
+	inputCrawl = "crawl"
+)
+
+// jsonBody is JSON request body containing per-request options.
+type jsonBody struct {
+	URLs    []target `json:"urls"`
+	Timeout string   `json:"timeout"`
+	Format  string   `json:"format"`
+	Ordered bool     `json:"ordered"`
+	Method  string   `json:"method"`
+	// Sort is order results are sorted by documents' lengths in.
+	Sort SortOrder `json:"sort"`
+	// Checksum is name of checksum algorithm.
+	Checksum ChecksumAlgorithm `json:"checksum"`
+	// Links is link extraction mode.
+	Links LinkMode `json:"links"`
+	// SameHostLinks makes links to other hosts skipped.
+	SameHostLinks bool `json:"same_host_links"`
+	// TextStats makes words and lines of documents counted.
+	TextStats bool `json:"text_stats"`
+	// Dedupe makes identical URLs fetched once.
+	Dedupe bool `json:"dedupe"`
+	// Normalize enables URL normalization.
+	Normalize bool `json:"normalize"`
+	// RemoveTracking makes tracking query parameters removed during normalization.
+	RemoveTracking bool `json:"remove_tracking"`
+	// Strict makes the first failure abort the whole request.
+	Strict bool `json:"strict"`
+	// InputMode is the way URLs are interpreted, see inputModeHeader.
+	InputMode string `json:"input_mode"`
+	// Filter selects results written to response, see resultFilterHeader.
+	Filter string `json:"filter"`
+	// Duplicates makes URLs with identical content grouped.
+	Duplicates bool `json:"duplicates"`
+	// Baseline is ID of stored run of scheduled batch
+	// results are compared to, see JobStore.
+	Baseline string `json:"baseline"`
+}
+
+// parseRequest sets batch's targets. They are taken from query
+// of GET requests if GET mode is enabled, or from body otherwise.
+// If input is chunked, only the first chunk of plain text body
+// is parsed, and the rest is left to batch's input.
+func (h *Handler) parseRequest(b *batch, request *http.Request) error {
+	if request.Method == http.MethodGet && h.getMode {
+		return parseQuery(b, request.URL.Query())
+	}
+
+	body, err := h.openBody(request)
+	if err != nil {
+		return err
+	}
+
+	contentType := request.Header.Get("Content-Type")
+
+	if h.chunkSize > 0 && h.chunkable(b, contentType) {
+		input := &chunkedInput{
+			lines: newLineReader(body, h.maxLineLength),
+			body:  body,
+		}
+
+		if b.targets, err = input.lines.next(h.chunkSize); err != nil || len(b.targets) < h.chunkSize {
+			body.Close()
+
+			return err
+		}
+
+		b.input = input
+
+		return nil
+	}
+	defer body.Close()
+
+	return h.parseBody(b, contentType, body)
+}
+
+// setInputMode sets the way batch's URLs are interpreted.
+// Modes must be enabled by corresponding options.
+func (b *batch) setInputMode(h *Handler, mode string) error {
+	switch mode = strings.ToLower(mode); mode {
+	case inputURLs, "urls":
+		b.inputMode = inputURLs
+	case inputSitemap:
+		if h.sitemapLimit <= 0 {
+			return errSitemapDisabled
+		}
+
+		b.inputMode = mode
+	case inputCrawl:
+		if h.crawlPages <= 0 {
+			return errCrawlDisabled
+		}
+
+		b.inputMode = mode
+	default:
+		return fmt.Errorf("unknown input mode %q", mode)
+	}
+
+	return nil
+}
+
+// parseQuery parses query of GET request. URLs are passed either
+// as repeated "url" parameters, or as comma-separated "urls" ones.
+// Output format can be set by "format" parameter, and filter
+// of results by "filter" one, see resultFilterHeader.
+func parseQuery(b *batch, query url.Values) error {
+	for _, u := range query["url"] {
+		b.targets = append(b.targets, target{URL: u})
+	}
+
+	for _, urls := range query["urls"] {
+		for _, u := range strings.Split(urls, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				b.targets = append(b.targets, target{URL: u})
+			}
+		}
+	}
+
+	if len(b.targets) == 0 {
+		return errors.New("no URLs in query")
+	}
+
+	if format := query.Get("format"); format != "" {
+		if _, ok := formats[format]; !ok {
+			return fmt.Errorf("unknown format %q", format)
+		}
+
+		b.format = format
+	}
+
+	if filter := query.Get("filter"); filter != "" {
+		if err := b.setFilter(filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseBody parses request body according to its content type
+// and sets batch's targets. Plain text body contains URLs separated
+// by new line. JSON body contains either array of targets, or object
+// with targets and per-request options. Multipart body contains one
+// or more files, each of them is parsed according to its content type.
+func (h *Handler) parseBody(b *batch, contentType string, r io.Reader) error {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/json":
+		return h.parseJSON(b, r)
+	case "multipart/form-data":
+		return h.parseMultipart(b, params["boundary"], r)
+	default:
+		return h.parseLines(b, r)
+	}
+}
+
+// lineReader reads targets of plain text body line by line. Surrounding
+// whitespace is trimmed, blank lines and lines starting with # are skipped.
+type lineReader struct {
+	scanner *bufio.Scanner
+	limit   int
+	line    int
+}
+
+// newLineReader creates new lineReader failing on lines longer than limit.
+func newLineReader(r io.Reader, limit int) *lineReader {
+	scanner := bufio.NewScanner(r)
+	// initial buffer must not exceed limit, since the larger of them is used
+	size := 4096
+	if limit < size {
+		size = limit
+	}
+	scanner.Buffer(make([]byte, 0, size), limit)
+
+	return &lineReader{
+		scanner: scanner,
+		limit:   limit,
+	}
+}
+
+// next returns up to n next targets, or all remaining ones if n is zero.
+// At the end of body, it returns no targets.
+func (r *lineReader) next(n int) ([]target, error) {
+	var targets []target
+
+	for (n == 0 || len(targets) < n) && r.scanner.Scan() {
+		r.line++
+
+		url := strings.TrimSpace(r.scanner.Text())
+		if url == "" || strings.HasPrefix(url, "#") {
+			continue
+		}
+
+		targets = append(targets, target{URL: url})
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("line %d: line is longer than %d bytes", r.line+1, r.limit)
+		}
+
+		return nil, fmt.Errorf("line %d: %w", r.line+1, err)
+	}
+
+	return targets, nil
+}
+
+// parseLines parses plain text body, see lineReader.
+func (h *Handler) parseLines(b *batch, r io.Reader) error {
+	targets, err := newLineReader(r, h.maxLineLength).next(0)
+	if err != nil {
+		return err
+	}
+
+	b.targets = targets
+
+	return nil
+}
+
+// parseJSON parses JSON body.
+func (h *Handler) parseJSON(b *batch, r io.Reader) error {
+	var data json.RawMessage
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		if errors.Is(err, errBodyTooLarge) {
+			return err
+		}
+
+		return fmt.Errorf("invalid JSON body: %s", err)
+	}
+
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &b.targets); err != nil {
+			return fmt.Errorf("invalid JSON body: %s", err)
+		}
+
+		return nil
+	}
+	var body jsonBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("invalid JSON body: %s", err)
+	}
+
+	b.targets = body.URLs
+
+	if body.Timeout != "" {
+		timeout, err := time.ParseDuration(body.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %s", err)
+		}
+
+		b.timeout = timeout
+	}
+
+	if body.Format != "" {
+		if _, ok := formats[body.Format]; !ok {
+			return fmt.Errorf("unknown format %q", body.Format)
+		}
+
+		b.format = body.Format
+	}
+
+	if body.Ordered {
+		b.ordered = true
+	}
+
+	switch body.Sort {
+	case SortNone:
+	case SortAscending, SortDescending:
+		b.sort = body.Sort
+	default:
+		return fmt.Errorf("unknown sort order %q", body.Sort)
+	}
+
+	if body.Checksum != "" {
+		if _, ok := checksums[body.Checksum]; !ok {
+			return fmt.Errorf("unknown checksum algorithm %q", body.Checksum)
+		}
+
+		b.checksum = body.Checksum
+	}
+
+	switch body.Links {
+	case LinksNone:
+	case LinksCount, LinksList:
+		b.links = body.Links
+	default:
+		return fmt.Errorf("unknown links mode %q", body.Links)
+	}
+
+	if body.SameHostLinks {
+		b.sameHostLinks = true
+	}
+
+	if body.TextStats {
+		b.textStats = true
+	}
+
+	if body.Dedupe {
+		b.dedupe = true
+	}
+
+	if body.Normalize {
+		b.normalize = true
+	}
+	if body.RemoveTracking {
+		b.removeTracking = true
+	}
+
+	if body.Strict {
+		b.strict = true
+	}
+
+	if body.Duplicates {
+		b.duplicates = true
+	}
+
+	if body.Baseline != "" {
+		b.baselineRun = body.Baseline
+	}
+
+	if body.InputMode != "" {
+		if err := b.setInputMode(h, body.InputMode); err != nil {
+			return err
+		}
+	}
+
+	if body.Filter != "" {
+		if err := b.setFilter(body.Filter); err != nil {
+			return err
+		}
+	}
+
+	if body.Method != "" {
+		if err := b.setMethod(h.allowedMethods, body.Method); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseMultipart parses multipart form. Targets of all
+// file parts are merged, other parts are ignored.
+func (h *Handler) parseMultipart(b *batch, boundary string, body io.Reader) error {
+	if boundary == "" {
+		return errors.New("invalid multipart body: no boundary")
+	}
+
+	r := multipart.NewReader(body, boundary)
+
+	var targets []target
+
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if errors.Is(err, errBodyTooLarge) {
+				return err
+			}
+
+			return fmt.Errorf("invalid multipart body: %s", err)
+		}
+
+		if part.FileName() == "" {
+			continue
+		}
+
+		if err := h.parseBody(b, part.Header.Get("Content-Type"), part); err != nil {
+			return fmt.Errorf("%s: %w", part.FileName(), err)
+		}
+
+		targets = append(targets, b.targets...)
+	}
+
+	b.targets = targets
+
+	return nil
+}
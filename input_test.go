@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandlerJSONTargets(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		tokens = make(map[string]string)
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mu.Lock()
+		tokens[request.URL.Path] = request.Header.Get("Authorization")
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	body := `[{"url": "` + server.URL + `/a", "headers": {"Authorization": "token-a"}}, {"url": "` + server.URL + `/b"}]`
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if results := doFetchResults(t, req); len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+
+	if tokens["/a"] != "token-a" || tokens["/b"] != "" {
+		t.Errorf("unexpected tokens: %v", tokens)
+	}
+}
+
+func TestHandlerInvalidJSON(t *testing.T) {
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	resp, err := http.Post(s.URL, "application/json", strings.NewReader(`[{"url":`))
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestHandlerJSONOptions(t *testing.T) {
+	server := createServer(0)
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	body := `{
+		"urls": [
+			"` + getUrl(server.URL, 100, time.Millisecond*100) + `",
+			{"url": "` + getUrl(server.URL, 200, time.Millisecond*300) + `"},
+			"` + getUrl(server.URL, 300, 0) + `"
+		],
+		"timeout": "200ms",
+		"format": "json",
+		"ordered": true
+	}`
+
+	resp, err := http.Post(s.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var results []Result
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+
+	for i, length := range []int{100, 0, 300} {
+		if results[i].Length != length {
+			t.Errorf("expected result %d to have length %d, got %+v", i, length, results[i])
+		}
+	}
+
+	if results[1].Error == "" {
+		t.Errorf("expected result 1 to time out, got %+v", results[1])
+	}
+}
+
+func TestHandlerMultipart(t *testing.T) {
+	server := createServer(0)
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	var body bytes.Buffer
+
+	w := multipart.NewWriter(&body)
+	w.WriteField("comment", "ignored")
+
+	f, _ := w.CreateFormFile("urls", "a.txt")
+	f.Write([]byte(getUrl(server.URL, 100, 0)))
+
+	f, _ = w.CreateFormFile("urls", "b.txt")
+	f.Write([]byte(getUrl(server.URL, 200, 0) + "\n" + getUrl(server.URL, 300, 0)))
+
+	w.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	results := doFetchResults(t, req)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+
+	var total int
+	for _, r := range results {
+		total += r.Length
+	}
+
+	if total != 600 {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+func TestHandlerMultipartTooLarge(t *testing.T) {
+	s := httptest.NewServer(NewHandler(LimitBodySize(1024)))
+	defer s.Close()
+
+	var body bytes.Buffer
+
+	w := multipart.NewWriter(&body)
+	f, _ := w.CreateFormFile("urls", "a.txt")
+	f.Write([]byte(strings.Repeat("https://example.com/\n", 100)))
+	w.Close()
+
+	resp, err := http.Post(s.URL, w.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerPlainTextLines(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	body := "# documents\r\n\r\n  " + getUrl(server.URL, 10, 0) + "  \r\n# " + getUrl(server.URL, 20, 0) + "\n\n" + getUrl(server.URL, 30, 0) + "\n"
+
+	results := fetchResults(t, s.URL, strings.NewReader(body))
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+
+	for _, r := range results {
+		if r.Err() != nil || r.Error != "" {
+			t.Errorf("unexpected error for %s: %s", r.URL, r.Error)
+		}
+	}
+}
+
+func TestHandlerLineTooLong(t *testing.T) {
+	s := httptest.NewServer(NewHandler(LimitLineLength(64)))
+	defer s.Close()
+
+	body := "https://example.com\n" + "https://example.com/" + strings.Repeat("a", 100) + "\n"
+
+	resp, err := http.Post(s.URL, "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	message, _ := ioutil.ReadAll(resp.Body)
+	if !strings.HasPrefix(string(message), "line 2:") {
+		t.Errorf("expected error pointing to line 2, got %q", message)
+	}
+}
+
+func TestHandlerGetMode(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(EnableGetMode()))
+	defer s.Close()
+
+	query := url.Values{
+		"url":    {getUrl(server.URL, 10, 0)},
+		"urls":   {server.URL + "?length=20," + server.URL + "?length=30"},
+		"format": {"json"},
+	}
+
+	resp, err := http.Get(s.URL + "?" + query.Encode())
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var results []Result
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+
+	resp, err = http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
@@ -0,0 +1,202 @@
+// Package resp implements minimal client of Redis serialization
+// protocol, supporting commands with integer and status replies.
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parameters of connections.
+const (
+	dialTimeout = time.Second * 5
+	idleConns   = 8
+)
+
+// Error is error reply of Redis.
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// conn is connection to Redis.
+type conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Client sends commands to Redis. Connections are established
+// lazily and reused. Client is safe for concurrent use.
+type Client struct {
+	addr     string
+	username string
+	password string
+	db       int
+
+	idle chan *conn
+}
+
+// NewClient creates new Client connecting to Redis at addr,
+// authenticating with password, if any, and selecting database db.
+func NewClient(addr, username, password string, db int) *Client {
+	return &Client{
+		addr:     addr,
+		username: username,
+		password: password,
+		db:       db,
+		idle:     make(chan *conn, idleConns),
+	}
+}
+
+// Do sends command to Redis and returns its integer reply.
+// Status and bulk replies are ignored, and zero is returned.
+func (c *Client) Do(ctx context.Context, args ...string) (int64, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := cn.do(ctx, args...)
+	if err != nil {
+		var rerr Error
+		// connection may be reused after error reply
+		if !errors.As(err, &rerr) {
+			cn.conn.Close()
+
+			return 0, err
+		}
+	}
+
+	c.put(cn)
+
+	return n, err
+}
+
+// Close closes idle connections.
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// get returns idle connection, or establishes new one.
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	dialer := net.Dialer{
+		Timeout: dialTimeout,
+	}
+
+	nc, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{
+		conn: nc,
+		r:    bufio.NewReader(nc),
+	}
+
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+
+		if _, err := cn.do(ctx, args...); err != nil {
+			nc.Close()
+
+			return nil, err
+		}
+	}
+
+	if c.db != 0 {
+		if _, err := cn.do(ctx, "SELECT", strconv.Itoa(c.db)); err != nil {
+			nc.Close()
+
+			return nil, err
+		}
+	}
+
+	return cn, nil
+}
+
+// put returns connection to idle ones, or closes it if there are enough.
+func (c *Client) put(cn *conn) {
+	select {
+	case c.idle <- cn:
+	default:
+		cn.conn.Close()
+	}
+}
+
+// do sends command and reads its reply. Integer reply is returned,
+// other non-error replies are ignored.
+func (c *conn) do(ctx context.Context, args ...string) (int64, error) {
+	deadline, _ := ctx.Deadline()
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := io.WriteString(c.conn, sb.String()); err != nil {
+		return 0, err
+	}
+
+	return c.reply()
+}
+
+// reply reads single reply.
+func (c *conn) reply() (int64, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return 0, errors.New("redis: invalid reply")
+	}
+
+	switch value := line[1:]; line[0] {
+	case '+':
+		return 0, nil
+	case '-':
+		return 0, Error(value)
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, err
+		}
+
+		_, err = c.r.Discard(n + 2)
+
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+// defaultRunHistory is number of runs of every scheduled
+// batch kept by default JobStore, see WithJobStore.
+const defaultRunHistory = 3
+
+// ErrRunNotFound is returned by JobStore if there is no run with given ID.
+var ErrRunNotFound = errors.New("run is not found")
+
+// JobStore persists completed runs of scheduled batches, so their results
+// are available by IDs of runs, e.g. as baselines of requests. Methods
+// are called concurrently, and runs passed to SaveRun are not modified.
+type JobStore interface {
+	// SaveRun stores completed run of scheduled batch.
+	SaveRun(ctx context.Context, run *ScheduledRun) error
+	// Run returns stored run with ID, or ErrRunNotFound.
+	Run(ctx context.Context, id string) (*ScheduledRun, error)
+	// Runs returns IDs of stored runs of scheduled
+	// batch, from the newest to the oldest.
+	Runs(ctx context.Context, schedule string) ([]string, error)
+}
+
+// memoryJobStore keeps runs in memory.
+type memoryJobStore struct {
+	history int
+
+	mu   sync.Mutex
+	runs map[string]*ScheduledRun
+	// ids lists IDs of runs of every scheduled
+	// batch from the oldest to the newest.
+	ids map[string][]string
+}
+
+// NewMemoryJobStore returns JobStore keeping up to history the latest
+// runs of every scheduled batch in memory, but at least one.
+func NewMemoryJobStore(history int) JobStore {
+	if history < 1 {
+		history = 1
+	}
+
+	return &memoryJobStore{
+		history: history,
+		runs:    make(map[string]*ScheduledRun),
+		ids:     make(map[string][]string),
+	}
+}
+
+// SaveRun implements JobStore interface.
+func (s *memoryJobStore) SaveRun(ctx context.Context, run *ScheduledRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := append(s.ids[run.Schedule], run.ID)
+	for len(ids) > s.history {
+		delete(s.runs, ids[0])
+		ids = ids[1:]
+	}
+
+	s.ids[run.Schedule] = ids
+	s.runs[run.ID] = run
+
+	return nil
+}
+
+// Run implements JobStore interface.
+func (s *memoryJobStore) Run(ctx context.Context, id string) (*ScheduledRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[id]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+
+	return run, nil
+}
+
+// Runs implements JobStore interface.
+func (s *memoryJobStore) Runs(ctx context.Context, schedule string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.ids[schedule]
+	newest := make([]string, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		newest = append(newest, ids[i])
+	}
+
+	return newest, nil
+}
+
+// newRunID returns random ID of run of scheduled batch.
+func newRunID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
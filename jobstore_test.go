@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryJobStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryJobStore(2)
+
+	for _, run := range []*ScheduledRun{
+		{ID: "a1", Schedule: "a"},
+		{ID: "b1", Schedule: "b"},
+		{ID: "a2", Schedule: "a"},
+		{ID: "a3", Schedule: "a"},
+	} {
+		if err := s.SaveRun(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ids, _ := s.Runs(ctx, "a"); !reflect.DeepEqual(ids, []string{"a3", "a2"}) {
+		t.Errorf("unexpected runs %q", ids)
+	}
+	if ids, _ := s.Runs(ctx, "c"); len(ids) != 0 {
+		t.Errorf("unexpected runs %q", ids)
+	}
+
+	if _, err := s.Run(ctx, "a1"); err != ErrRunNotFound {
+		t.Errorf("expected %q, got %v", ErrRunNotFound, err)
+	}
+	if run, err := s.Run(ctx, "b1"); err != nil || run.Schedule != "b" {
+		t.Errorf("unexpected run %+v: %v", run, err)
+	}
+}
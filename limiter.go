@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrLimitExceeded is returned by Limiter created by NewSemaphore
+// if limit of concurrent incoming requests is reached.
+var ErrLimitExceeded = errors.New("limit of concurrent requests is exceeded")
+
+// Errors of weighted admission.
+var (
+	// errBatchTooLarge is returned if cost of batch exceeds capacity.
+	errBatchTooLarge = errors.New("batch is too large")
+	// errCapacityExceeded is returned if cost of batch is not available.
+	errCapacityExceeded = errors.New("admission capacity is exceeded")
+	// errNegativeCost is returned if CostFunc returns negative cost.
+	errNegativeCost = errors.New("cost of batch is negative")
+)
+
+// Limiter admits incoming requests. Acquire is called before request's
+// body is read, and if it returns error, request is rejected with
+// 503 Service Unavailable. Otherwise, Release is called once request
+// is served. Limiter is called concurrently, so it may adapt
+// the limit, e.g. to observed latency.
+type Limiter interface {
+	Acquire(ctx context.Context) error
+	Release()
+}
+
+// semaphore is Limiter limiting number of concurrent incoming requests.
+type semaphore struct {
+	ch chan struct{}
+}
+
+// NewSemaphore creates Limiter which admits up to limit concurrent
+// requests and rejects the rest without waiting. It is used by default,
+// with limit set by LimitRequests option.
+func NewSemaphore(limit int) Limiter {
+	return newSemaphore(limit)
+}
+
+// newSemaphore creates new semaphore.
+func newSemaphore(cap int) *semaphore {
+	return &semaphore{
+		ch: make(chan struct{}, cap),
+	}
+}
+
+// semaphore tries to increase semaphore counter
+// and returns true on success, and false otherwise.
+func (s *semaphore) acquire() bool {
+	select {
+	case s.ch <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release decreases semaphore counter.
+func (s *semaphore) release() {
+	<-s.ch
+}
+
+// Acquire implements Limiter interface.
+func (s *semaphore) Acquire(ctx context.Context) error {
+	if !s.acquire() {
+		return ErrLimitExceeded
+	}
+
+	return nil
+}
+
+// Release implements Limiter interface.
+func (s *semaphore) Release() {
+	s.release()
+}
+
+// CostFunc returns cost of batch of urls URLs for weighted admission.
+type CostFunc func(urls int) int64
+
+// weightedSemaphore admits batches while total cost
+// of admitted ones does not exceed capacity.
+type weightedSemaphore struct {
+	capacity int64
+	cost     CostFunc
+
+	mu   sync.Mutex
+	used int64
+}
+
+// newWeightedSemaphore creates new weightedSemaphore.
+// If cost is nil, each URL costs 1.
+func newWeightedSemaphore(capacity int64, cost CostFunc) *weightedSemaphore {
+	if cost == nil {
+		cost = func(urls int) int64 {
+			return int64(urls)
+		}
+	}
+
+	return &weightedSemaphore{
+		capacity: capacity,
+		cost:     cost,
+	}
+}
+
+// acquire takes n of capacity and reports whether it is available.
+func (s *weightedSemaphore) acquire(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.used+n > s.capacity {
+		return false
+	}
+
+	s.used += n
+
+	return true
+}
+
+// release returns n taken by acquire.
+func (s *weightedSemaphore) release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.used -= n
+}
+
+// batchCost is cost taken by batch from weighted semaphore.
+type batchCost struct {
+	mu    sync.Mutex
+	taken int64
+	// released makes cost of the rest of chunked input not taken
+	// once batch is served.
+	released bool
+}
+
+// take takes cost of batch of urls URLs, besides cost already taken
+// by batch, so batch with chunked input holds cost of all URLs read
+// so far, as if they were sent at once.
+func (s *weightedSemaphore) take(c *batchCost, urls int) error {
+	cost := s.cost(urls)
+
+	switch {
+	case cost < 0:
+		return errNegativeCost
+	case cost > s.capacity:
+		return errBatchTooLarge
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.released || cost <= c.taken {
+		return nil
+	}
+
+	if !s.acquire(cost - c.taken) {
+		return errCapacityExceeded
+	}
+	c.taken = cost
+
+	return nil
+}
+
+// put returns cost taken by batch.
+func (s *weightedSemaphore) put(c *batchCost) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.release(c.taken)
+	c.taken, c.released = 0, true
+}
+
+// load returns cost of admitted batches.
+func (s *weightedSemaphore) load() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.used
+}
+
+// admitBatch takes cost of batch from weighted semaphore, if any.
+// If batch can not be admitted, it writes error response and returns
+// false. Otherwise, returned func releases taken cost, including cost
+// of chunks taken later, see admitChunk.
+func (h *Handler) admitBatch(writer http.ResponseWriter, b *batch) (func(), bool) {
+	if h.weighted == nil {
+		return func() {}, true
+	}
+
+	if err := h.weighted.take(&b.cost, len(b.targets)); err != nil {
+		admissionError(writer, b.logger, err)
+
+		return nil, false
+	}
+
+	return func() {
+		h.weighted.put(&b.cost)
+	}, true
+}
+
+// admissionError writes error response of batch rejected by weighted admission.
+func admissionError(writer http.ResponseWriter, logger *log.Logger, err error) {
+	switch err {
+	case errBatchTooLarge:
+		http.Error(writer, err.Error(), http.StatusRequestEntityTooLarge)
+	case errNegativeCost:
+		logger.Printf("weighted admission: %s", err)
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	default:
+		http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	}
+}
+
+// admitChunk takes cost of next chunk of n URLs of batch
+// from weighted semaphore, if any.
+func (h *Handler) admitChunk(b *batch, n int) error {
+	if h.weighted == nil {
+		return nil
+	}
+
+	return h.weighted.take(&b.cost, int(atomic.LoadInt64(&b.total))+n)
+}
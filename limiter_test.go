@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testLimiter struct {
+	reject   bool
+	acquired int32
+	released int32
+}
+
+func (l *testLimiter) Acquire(ctx context.Context) error {
+	if l.reject {
+		return errors.New("rejected")
+	}
+
+	atomic.AddInt32(&l.acquired, 1)
+
+	return nil
+}
+
+func (l *testLimiter) Release() {
+	atomic.AddInt32(&l.released, 1)
+}
+
+func TestHandlerLimiter(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	limiter := &testLimiter{}
+
+	h := NewHandler(WithLimiter(limiter), LimitRequests(5))
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	if results := fetchResults(t, s.URL, strings.NewReader(getUrl(server.URL, 10, 0))); len(results) != 1 {
+		t.Errorf("expected 1 result, got %+v", results)
+	}
+
+	if limiter.acquired != 1 || limiter.released != 1 {
+		t.Errorf("expected slot acquired and released once, got %d and %d", limiter.acquired, limiter.released)
+	}
+	if stats := h.LoadStats(); stats.MaxRequests != 0 || stats.InFlightRequests != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	limiter.reject = true
+
+	resp, err := http.Post(s.URL, "text/plain", strings.NewReader(getUrl(server.URL, 10, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", resp.StatusCode)
+	}
+}
+
+func TestNewSemaphore(t *testing.T) {
+	l := NewSemaphore(1)
+
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Acquire(context.Background()); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+
+	l.Release()
+
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestHandlerWeightedAdmission(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	h := NewHandler(WithWeightedAdmission(4, func(urls int) int64 {
+		return int64(urls) * 2
+	}))
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	post := func(urls ...string) int {
+		resp, err := http.Post(s.URL, "text/plain", strings.NewReader(strings.Join(urls, "\n")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		ioutil.ReadAll(resp.Body)
+
+		return resp.StatusCode
+	}
+
+	fast := getUrl(server.URL, 10, 0)
+	slow := getUrl(server.URL, 10, time.Millisecond*300)
+
+	if status := post(fast, fast, fast); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", status)
+	}
+
+	done := make(chan int)
+	go func() {
+		done <- post(slow)
+	}()
+
+	time.Sleep(time.Millisecond * 100)
+
+	if stats := h.LoadStats(); stats.Cost != 2 || stats.MaxCost != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if status := post(fast, fast); status != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", status)
+	}
+	if status := post(fast); status != http.StatusOK {
+		t.Errorf("expected status 200, got %d", status)
+	}
+
+	if status := <-done; status != http.StatusOK {
+		t.Errorf("expected status 200, got %d", status)
+	}
+	if stats := h.LoadStats(); stats.Cost != 0 {
+		t.Errorf("expected no cost, got %d", stats.Cost)
+	}
+}
+
+func TestHandlerWeightedAdmissionChunks(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	h := NewHandler(WithChunkedInput(10), WithWeightedAdmission(25, nil))
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	urls := strings.TrimSpace(strings.Repeat(getUrl(server.URL, 10, 0)+"\n", 35))
+
+	resp, err := http.Post(s.URL, "text/plain", strings.NewReader(urls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+
+	if n := strings.Count(string(data), "10\n"); n != 20 {
+		t.Errorf("expected 20 results, got %d", n)
+	}
+	if got := resp.Trailer.Get(inputErrorHeader); got != errBatchTooLarge.Error() {
+		t.Errorf("expected input error %q, got %q", errBatchTooLarge, got)
+	}
+	if stats := h.LoadStats(); stats.Cost != 0 {
+		t.Errorf("expected no cost, got %d", stats.Cost)
+	}
+
+	s = httptest.NewServer(NewHandler(WithWeightedAdmission(10, func(urls int) int64 {
+		return -1
+	})))
+	defer s.Close()
+
+	resp, err = http.Post(s.URL, "text/plain", strings.NewReader(getUrl(server.URL, 10, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected status 500 for negative cost, got %d", resp.StatusCode)
+	}
+}
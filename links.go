@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// LinkMode defines whether links are extracted from HTML documents.
+type LinkMode string
+
+// Supported link extraction modes.
+const (
+	// LinksNone disables link extraction.
+	LinksNone LinkMode = ""
+	// LinksCount makes only number of links reported.
+	LinksCount LinkMode = "count"
+	// LinksList makes both list and number of links reported.
+	LinksList LinkMode = "list"
+)
+
+// linkExtractor parses HTML document written to it
+// and collects absolute URLs of its links.
+type linkExtractor struct {
+	*streamConsumer
+
+	base     *url.URL
+	sameHost bool
+	seen     map[string]struct{}
+	links    []string
+}
+
+// newLinkExtractor creates new link extractor and starts parsing.
+// Relative links are resolved against base. If sameHost is true,
+// links to other hosts are skipped.
+func newLinkExtractor(base *url.URL, sameHost bool) *linkExtractor {
+	e := &linkExtractor{
+		base:     base,
+		sameHost: sameHost,
+		seen:     make(map[string]struct{}),
+	}
+
+	e.streamConsumer = newStreamConsumer(e.parse)
+
+	return e
+}
+
+// result waits until parsing is finished and returns found links.
+func (e *linkExtractor) result() []string {
+	e.finish()
+
+	return e.links
+}
+
+// parse tokenizes document and collects links.
+func (e *linkExtractor) parse(r io.Reader) {
+	z := html.NewTokenizer(r)
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if !hasAttr {
+				continue
+			}
+
+			switch atom.Lookup(name) {
+			case atom.Base:
+				if href := attr(z, "href"); href != "" {
+					if u, err := e.base.Parse(href); err == nil {
+						e.base = u
+					}
+				}
+			case atom.A, atom.Area:
+				e.add(attr(z, "href"))
+			}
+		}
+	}
+}
+
+// add resolves href and adds it to found links.
+func (e *linkExtractor) add(href string) {
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return
+	}
+
+	u, err := e.base.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return
+	}
+
+	if e.sameHost && !strings.EqualFold(u.Hostname(), e.base.Hostname()) {
+		return
+	}
+
+	u.Fragment = ""
+	link := u.String()
+
+	if _, ok := e.seen[link]; ok {
+		return
+	}
+
+	e.seen[link] = struct{}{}
+	e.links = append(e.links, link)
+}
+
+// attr returns value of current tag's attribute.
+func attr(z *html.Tokenizer, name string) string {
+	for {
+		key, val, more := z.TagAttr()
+		if string(key) == name {
+			return string(val)
+		}
+
+		if !more {
+			return ""
+		}
+	}
+}
+
+// isHTML reports whether media type denotes HTML document.
+func isHTML(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
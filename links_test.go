@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/html")
+		writer.Write([]byte(`<html><body>
+			<a href="/a#top">A</a>
+			<a href="b">B</a>
+			<a href="/a">A again</a>
+			<a href="mailto:someone@example.com">mail</a>
+			<a href="https://other.example.com/c">C</a>
+		</body></html>`))
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	tests := map[string]struct {
+		body  string
+		links []string
+	}{
+		"list": {
+			body:  `{"urls": ["` + server.URL + `/dir/"], "links": "list"}`,
+			links: []string{server.URL + "/a", server.URL + "/dir/b", "https://other.example.com/c"},
+		},
+		"same host": {
+			body:  `{"urls": ["` + server.URL + `/dir/"], "links": "list", "same_host_links": true}`,
+			links: []string{server.URL + "/a", server.URL + "/dir/b"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			results := doFetchResults(t, req)
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %+v", results)
+			}
+
+			r := results[0]
+			if r.LinkCount != len(test.links) || strings.Join(r.Links, " ") != strings.Join(test.links, " ") {
+				t.Errorf("expected links %v, got %d %v", test.links, r.LinkCount, r.Links)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"sync/atomic"
+)
+
+// LoadStats is snapshot of Handler's load.
+type LoadStats struct {
+	// InFlightRequests is number of incoming requests being served.
+	InFlightRequests int
+	// MaxRequests is limit of in-flight requests, see LimitRequests.
+	// Zero means limit is unknown, i.e. custom Limiter is used.
+	MaxRequests int
+	// ActiveFetches is number of URLs being fetched.
+	ActiveFetches int
+	// MaxFetches is limit of active fetches, see LimitFetches.
+	// It is the current limit if WithAdaptiveConcurrency is used.
+	// Zero means no limit.
+	MaxFetches int
+	// QueueDepth is number of fetches waiting for slots
+	// because of LimitFetches option.
+	QueueDepth int
+	// Cost is total cost of admitted batches, and MaxCost is its limit,
+	// see WithWeightedAdmission. Both are zero if it is not used.
+	Cost    int64
+	MaxCost int64
+}
+
+// InFlightRequests returns number of incoming requests being served.
+func (h *Handler) InFlightRequests() int {
+	return int(atomic.LoadInt64(&h.inFlight))
+}
+
+// release releases slot of incoming request acquired from limiter.
+func (h *Handler) release() {
+	atomic.AddInt64(&h.inFlight, -1)
+	h.limiter.Release()
+
+	if h.shedQueue != nil {
+		h.shedQueue.notify()
+	}
+}
+
+// ActiveFetches returns number of URLs being fetched.
+func (h *Handler) ActiveFetches() int {
+	return int(atomic.LoadInt64(&h.activeFetches))
+}
+
+// QueueDepth returns number of fetches waiting for slots
+// because of LimitFetches option.
+func (h *Handler) QueueDepth() int {
+	return int(atomic.LoadInt64(&h.queuedFetches))
+}
+
+// LoadStats returns snapshot of Handler's load.
+func (h *Handler) LoadStats() LoadStats {
+	stats := LoadStats{
+		InFlightRequests: h.InFlightRequests(),
+		MaxRequests:      h.maxRequests,
+		ActiveFetches:    h.ActiveFetches(),
+		MaxFetches:       h.maxFetches,
+		QueueDepth:       h.QueueDepth(),
+	}
+
+	if h.adaptive != nil {
+		stats.MaxFetches = h.adaptive.current()
+	}
+
+	if h.weighted != nil {
+		stats.Cost = h.weighted.load()
+		stats.MaxCost = h.weighted.capacity
+	}
+
+	return stats
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerLoadStats(t *testing.T) {
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	h := NewHandler(LimitRequests(5), LimitFetches(1))
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		fetchResults(t, s.URL, strings.NewReader(strings.Join([]string{server.URL + "/1", server.URL + "/2", server.URL + "/3"}, "\n")))
+	}()
+
+	expected := LoadStats{
+		InFlightRequests: 1,
+		MaxRequests:      5,
+		ActiveFetches:    1,
+		MaxFetches:       1,
+		QueueDepth:       2,
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for h.LoadStats() != expected && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if stats := h.LoadStats(); stats != expected {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+
+	close(release)
+	<-done
+
+	if stats := h.LoadStats(); stats.InFlightRequests != 0 || stats.ActiveFetches != 0 || stats.QueueDepth != 0 {
+		t.Errorf("load is not released: %+v", stats)
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// fetchDepthHeader is header of outgoing requests containing number of
+// handlers request has passed through, so requests looping through
+// handlers fetching each other can be refused.
+const fetchDepthHeader = "X-Fetch-Depth"
+
+// errSelfRequest is error of outgoing requests made to Handler itself.
+var errSelfRequest = errors.New("request to handler itself is refused")
+
+// setDepth sets batch's depth from request's fetch depth header.
+func (b *batch) setDepth(header http.Header) error {
+	value := header.Get(fetchDepthHeader)
+	if value == "" {
+		return nil
+	}
+
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 0 {
+		return fmt.Errorf("invalid %s header: %q", fetchDepthHeader, value)
+	}
+
+	b.depth = depth
+
+	return nil
+}
+
+// selfDial returns DialFunc which refuses connections to address incoming
+// request is served on, so Handler does not fetch URLs pointing to itself.
+func selfDial(dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if local, ok := ctx.Value(http.LocalAddrContextKey).(net.Addr); ok && isSelf(conn.RemoteAddr(), local) {
+			conn.Close()
+
+			return nil, errSelfRequest
+		}
+
+		return conn, nil
+	}
+}
+
+// isSelf reports whether remote address is local address incoming request
+// is served on. If handler listens on all interfaces, connections to any
+// local address with the same port are considered connections to itself.
+func isSelf(remote, local net.Addr) bool {
+	r, ok := remote.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	l, ok := local.(*net.TCPAddr)
+	if !ok || r.Port != l.Port {
+		return false
+	}
+
+	if r.IP.Equal(l.IP) || r.IP.IsLoopback() {
+		return true
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+
+	for _, addr := range addrs {
+		if n, ok := addr.(*net.IPNet); ok && n.IP.Equal(r.IP) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerLoopProtectionSelf(t *testing.T) {
+	s := httptest.NewServer(NewHandler(WithLoopProtection(5)))
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, strings.NewReader(s.URL+"/"))
+	if len(results) != 1 || !strings.Contains(results[0].Error, errSelfRequest.Error()) {
+		t.Errorf("expected request to itself refused, got %+v", results)
+	}
+}
+
+func TestHandlerLoopProtectionDepth(t *testing.T) {
+	depths := make(chan string, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		depths <- r.Header.Get(fetchDepthHeader)
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithLoopProtection(2)))
+	defer s.Close()
+
+	cases := []struct {
+		depth    string
+		status   int
+		outgoing string
+	}{
+		{"", http.StatusOK, "1"},
+		{"1", http.StatusOK, "2"},
+		{"2", http.StatusLoopDetected, ""},
+		{"x", http.StatusBadRequest, ""},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(server.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.depth != "" {
+			req.Header.Set(fetchDepthHeader, c.depth)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Errorf("%q: expected status %d, got %d", c.depth, c.status, resp.StatusCode)
+		}
+
+		if c.outgoing != "" {
+			if depth := <-depths; depth != c.outgoing {
+				t.Errorf("%q: expected outgoing depth %s, got %q", c.depth, c.outgoing, depth)
+			}
+		}
+	}
+}
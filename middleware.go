@@ -0,0 +1,17 @@
+package handler
+
+import "net/http"
+
+// Use wraps Handler's request handling with middleware. Middleware are
+// applied in order, so the first one is the outermost. Use must be
+// called before Handler starts serving requests.
+func (h *Handler) Use(middleware ...func(http.Handler) http.Handler) {
+	h.middleware = append(h.middleware, middleware...)
+
+	var next http.Handler = http.HandlerFunc(h.serve)
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		next = h.middleware[i](next)
+	}
+
+	h.chain = next
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerUse(t *testing.T) {
+	var calls []string
+
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(writer, request)
+			})
+		}
+	}
+
+	h := NewHandler(WithMiddleware(middleware("a")))
+	h.Use(middleware("b"), middleware("c"))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if got := strings.Join(calls, ""); got != "abc" {
+		t.Errorf("unexpected order of middleware: %s", got)
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/url"
+	"strings"
+)
+
+// trackingParams contains query parameters used for tracking,
+// which are removed during normalization if requested.
+var trackingParams = map[string]struct{}{
+	"gclid":   {},
+	"dclid":   {},
+	"fbclid":  {},
+	"msclkid": {},
+	"yclid":   {},
+	"mc_cid":  {},
+	"mc_eid":  {},
+	"_ga":     {},
+}
+
+// isTrackingParam reports whether query parameter is used for tracking.
+func isTrackingParam(name string) bool {
+	if strings.HasPrefix(name, "utm_") {
+		return true
+	}
+
+	_, ok := trackingParams[name]
+
+	return ok
+}
+
+// normalizeURL returns normalized form of raw URL: scheme and host are
+// lowercased, default port, fragment and dot segments are removed, and
+// empty path is replaced with "/". If removeTracking is true, tracking
+// query parameters like utm_source are removed as well.
+// URLs which can not be parsed are returned as is.
+func normalizeURL(raw string, removeTracking bool) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return raw
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	if u.Opaque != "" {
+		return u.String()
+	}
+
+	u.Host = strings.ToLower(u.Host)
+	switch {
+	case u.Scheme == "http" && strings.HasSuffix(u.Host, ":80"):
+		u.Host = strings.TrimSuffix(u.Host, ":80")
+	case u.Scheme == "https" && strings.HasSuffix(u.Host, ":443"):
+		u.Host = strings.TrimSuffix(u.Host, ":443")
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	// resolving empty reference removes dot segments
+	u = u.ResolveReference(&url.URL{})
+
+	if u.Path == "" && u.Host != "" {
+		u.Path = "/"
+	}
+
+	if removeTracking && u.RawQuery != "" {
+		query := u.Query()
+		removed := false
+
+		for name := range query {
+			if isTrackingParam(name) {
+				query.Del(name)
+				removed = true
+			}
+		}
+
+		if removed {
+			u.RawQuery = query.Encode()
+		}
+	}
+
+	return u.String()
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw            string
+		removeTracking bool
+		normalized     string
+	}{
+		{"HTTP://Example.COM", false, "http://example.com/"},
+		{"https://example.com:443/a/./b/../c#top", false, "https://example.com/a/c"},
+		{"http://example.com:8080/a/", false, "http://example.com:8080/a/"},
+		{"https://example.com/?utm_source=x&id=1&gclid=y", false, "https://example.com/?utm_source=x&id=1&gclid=y"},
+		{"https://example.com/?utm_source=x&id=1&gclid=y", true, "https://example.com/?id=1"},
+		{"DATA:,Hello", false, "data:,Hello"},
+		{"not a url", false, "not a url"},
+	}
+
+	for _, test := range tests {
+		if normalized := normalizeURL(test.raw, test.removeTracking); normalized != test.normalized {
+			t.Errorf("%s: expected %s, got %s", test.raw, test.normalized, normalized)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauth2ExpiryDelta is time before token's expiry it is refreshed at.
+const oauth2ExpiryDelta = 30 * time.Second
+
+// oauth2Client obtains access tokens. Since fetches wait for token,
+// token endpoint must not stall them indefinitely.
+var oauth2Client = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// oauth2Signer attaches access tokens obtained with OAuth 2.0
+// client credentials grant to outgoing requests.
+type oauth2Signer struct {
+	clientID string
+	secret   string
+	tokenURL string
+	scopes   []string
+	client   *http.Client
+	// now is clock token's expiry is checked by. It is
+	// replaced by Handler's clock, see WithClock.
+	now func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// OAuth2ClientCredentials returns Signer which obtains access token from
+// tokenURL with OAuth 2.0 client credentials grant and attaches it to
+// outgoing requests as bearer token. Token is refreshed before it expires.
+func OAuth2ClientCredentials(clientID, secret, tokenURL string, scopes []string) Signer {
+	return &oauth2Signer{
+		clientID: clientID,
+		secret:   secret,
+		tokenURL: tokenURL,
+		scopes:   scopes,
+		client:   oauth2Client,
+		now:      time.Now,
+	}
+}
+
+// Sign implements Signer interface.
+func (s *oauth2Signer) Sign(req *http.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == "" || (!s.expires.IsZero() && s.now().After(s.expires)) {
+		if err := s.refresh(req); err != nil {
+			return err
+		}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	return nil
+}
+
+// refresh obtains new access token.
+func (s *oauth2Signer) refresh(req *http.Request) error {
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+	}
+	if len(s.scopes) != 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+
+	tokenReq, err := http.NewRequestWithContext(req.Context(), http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tokenReq.Header.Set("Accept", "application/json")
+	tokenReq.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.secret))
+
+	resp, err := s.client.Do(tokenReq)
+	if err != nil {
+		return fmt.Errorf("oauth2: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("oauth2: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oauth2: token endpoint responded with %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return fmt.Errorf("oauth2: invalid token response: %s", err)
+	}
+	if token.AccessToken == "" {
+		return fmt.Errorf("oauth2: token response contains no access token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return fmt.Errorf("oauth2: unsupported token type %q", token.TokenType)
+	}
+
+	s.token = token.AccessToken
+	s.expires = time.Time{}
+	if token.ExpiresIn > 0 {
+		s.expires = s.now().Add(time.Duration(token.ExpiresIn)*time.Second - oauth2ExpiryDelta)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHandlerOAuth2(t *testing.T) {
+	var issued int64
+
+	auth := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id, secret, _ := request.BasicAuth()
+		if id != "client" || secret != "secret" || request.FormValue("grant_type") != "client_credentials" || request.FormValue("scope") != "a b" {
+			http.Error(writer, "invalid client", http.StatusUnauthorized)
+
+			return
+		}
+
+		atomic.AddInt64(&issued, 1)
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte(`{"access_token": "token", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer auth.Close()
+
+	var authorized, leaked int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "Bearer token" {
+			return
+		}
+
+		if strings.HasPrefix(request.Host, "localhost:") {
+			atomic.AddInt64(&leaked, 1)
+		} else {
+			atomic.AddInt64(&authorized, 1)
+		}
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithOAuth2("127.0.0.1", "client", "secret", auth.URL, []string{"a", "b"})))
+	defer s.Close()
+
+	// the same server is reached by host not matching pattern
+	other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	fetchResults(t, s.URL, strings.NewReader(server.URL+"/a\n"+server.URL+"/b\n"+other+"/c"))
+
+	if n := atomic.LoadInt64(&authorized); n != 2 {
+		t.Errorf("expected 2 authorized requests, got %d", n)
+	}
+	if n := atomic.LoadInt64(&leaked); n != 0 {
+		t.Errorf("expected token not sent to other hosts, got %d requests", n)
+	}
+	if n := atomic.LoadInt64(&issued); n != 1 {
+		t.Errorf("expected token issued once, got %d", n)
+	}
+}
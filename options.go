@@ -1,8 +1,13 @@
 package handler
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"log"
 	"net/http"
+	"strings"
+	"text/template"
+	"time"
 )
 
 // Option is a common interface for defining options
@@ -27,6 +32,30 @@ func (opt *clientOption) apply(h *Handler) {
 	h.client = opt.client
 }
 
+type hostClientOption struct {
+	pattern string
+	client  *http.Client
+}
+
+// WithClientFor creates new Option which sets HTTP client used to make
+// requests to hosts matching pattern, e.g. "*.internal". Patterns are
+// matched in order they are provided; client set by WithClient is used
+// for hosts not matching any pattern. Transport options like WithTLSConfig
+// do not affect clients set by this option.
+func WithClientFor(pattern string, client *http.Client) Option {
+	return &hostClientOption{
+		pattern: pattern,
+		client:  client,
+	}
+}
+
+func (opt *hostClientOption) apply(h *Handler) {
+	h.hostClients = append(h.hostClients, hostClient{
+		pattern: opt.pattern,
+		client:  opt.client,
+	})
+}
+
 type loggerOption struct {
 	logger *log.Logger
 }
@@ -57,3 +86,1766 @@ func LimitRequests(limit int) Option {
 func (opt *limitRequestsOption) apply(h *Handler) {
 	h.maxRequests = opt.limit
 }
+
+type limitBodySizeOption struct {
+	size int64
+}
+
+// LimitBodySize creates new Option which sets maximum size of
+// incoming request body after decompression. Requests with larger
+// bodies are rejected. By default, limit is 32 MiB.
+func LimitBodySize(size int64) Option {
+	return &limitBodySizeOption{
+		size: size,
+	}
+}
+
+func (opt *limitBodySizeOption) apply(h *Handler) {
+	h.maxBodySize = opt.size
+}
+
+type limitClientRateOption struct {
+	rate  float64
+	burst int
+}
+
+// LimitClientRate creates new Option which limits rate of incoming requests
+// per client IP address. Each client is allowed to make rate requests per
+// second on average, and up to burst requests at once. Requests exceeding
+// limit are rejected with 429 status. See also WithTrustedProxies.
+func LimitClientRate(rate float64, burst int) Option {
+	return &limitClientRateOption{
+		rate:  rate,
+		burst: burst,
+	}
+}
+
+func (opt *limitClientRateOption) apply(h *Handler) {
+	h.clientRate = opt.rate
+	h.clientBurst = opt.burst
+}
+
+type trustedProxiesOption struct {
+	proxies []string
+}
+
+// WithTrustedProxies creates new Option which sets IP addresses or CIDR
+// networks of trusted reverse proxies. If request is received from trusted
+// proxy, client IP address is taken from X-Forwarded-For header.
+func WithTrustedProxies(proxies ...string) Option {
+	return &trustedProxiesOption{
+		proxies: proxies,
+	}
+}
+
+func (opt *trustedProxiesOption) apply(h *Handler) {
+	h.proxies = opt.proxies
+}
+
+type corsOption struct {
+	policy *corsPolicy
+}
+
+// WithCORS creates new Option which allows browsers to call Handler
+// from given origins, "*" allows any origin. Handler responds to CORS
+// preflight requests, allowing POST method and given request headers,
+// and preflight responses are cached by browsers for maxAge.
+func WithCORS(origins, headers []string, maxAge time.Duration) Option {
+	return &corsOption{
+		policy: &corsPolicy{
+			origins: origins,
+			headers: headers,
+			maxAge:  maxAge,
+		},
+	}
+}
+
+func (opt *corsOption) apply(h *Handler) {
+	h.cors = opt.policy
+}
+
+type authOption struct {
+	auth Authenticator
+}
+
+// WithAuth creates new Option which makes Handler authenticate incoming
+// requests with auth. Unauthenticated requests are rejected with 401
+// status. See BearerTokens for static tokens authentication.
+func WithAuth(auth Authenticator) Option {
+	return &authOption{
+		auth: auth,
+	}
+}
+
+func (opt *authOption) apply(h *Handler) {
+	h.auth = opt.auth
+}
+
+type allowedClientsOption struct {
+	clients []string
+}
+
+// WithAllowedClients creates new Option which makes Handler serve only
+// requests from given IP addresses or CIDR networks. Other requests are
+// rejected with 403 status. Client address is determined with respect
+// to WithTrustedProxies option.
+func WithAllowedClients(clients ...string) Option {
+	return &allowedClientsOption{
+		clients: clients,
+	}
+}
+
+func (opt *allowedClientsOption) apply(h *Handler) {
+	h.clients = opt.clients
+}
+
+type idempotencyOption struct {
+	retention time.Duration
+}
+
+// WithIdempotency creates new Option which makes Handler honor
+// Idempotency-Key header. Concurrent or repeated requests with the same
+// key reuse response of the first one instead of fetching batch again.
+// Responses are kept for retention after they are completed, except for
+// responses with 429 and 5XX statuses, so such requests can be retried.
+// Up to 10000 responses with bodies of 64MB in total are kept, and the
+// oldest ones are evicted beyond that.
+func WithIdempotency(retention time.Duration) Option {
+	return &idempotencyOption{
+		retention: retention,
+	}
+}
+
+func (opt *idempotencyOption) apply(h *Handler) {
+	h.idempotencyRetention = opt.retention
+}
+
+type tenantsOption struct {
+	tenants map[string]Tenant
+}
+
+// WithTenants creates new Option which makes Handler require API key
+// in X-API-Key header of incoming requests. Tenants are keyed by their
+// API keys, and requests with unknown keys are rejected with 401 status.
+// Requests exceeding tenant's limits are rejected with 429 status.
+// Log messages of tenant's requests are prefixed with tenant's name.
+func WithTenants(tenants map[string]Tenant) Option {
+	return &tenantsOption{
+		tenants: tenants,
+	}
+}
+
+func (opt *tenantsOption) apply(h *Handler) {
+	h.tenantOpts = opt.tenants
+}
+
+type limitFetchesOption struct {
+	max int
+}
+
+// LimitFetches creates new Option which limits number of concurrent
+// outgoing requests of all incoming requests. If limit is reached,
+// fetches wait for free slot. Slots are given to batches of higher
+// priority first, which is set by X-Priority header of incoming
+// request: "high", "normal" (default) or "low".
+func LimitFetches(max int) Option {
+	return &limitFetchesOption{
+		max: max,
+	}
+}
+
+func (opt *limitFetchesOption) apply(h *Handler) {
+	h.maxFetches = opt.max
+}
+
+type fairSchedulingOption struct{}
+
+// WithFairScheduling creates new Option which makes fetch slots limited
+// by LimitFetches option given to incoming requests in turns, so single
+// huge batch can not monopolize them. If WithTenants option is provided,
+// slots are given to tenants in turns instead.
+func WithFairScheduling() Option {
+	return &fairSchedulingOption{}
+}
+
+func (opt *fairSchedulingOption) apply(h *Handler) {
+	h.fairScheduling = true
+}
+
+type limitLineLengthOption struct {
+	length int
+}
+
+// LimitLineLength creates new Option which sets maximum length of
+// plain text body's line. Requests with longer lines are rejected.
+// By default, limit is 16 KiB.
+func LimitLineLength(length int) Option {
+	return &limitLineLengthOption{
+		length: length,
+	}
+}
+
+func (opt *limitLineLengthOption) apply(h *Handler) {
+	h.maxLineLength = opt.length
+}
+
+type clientCertificateOption struct {
+	cert tls.Certificate
+	ca   *x509.CertPool
+}
+
+// WithClientCertificate creates new Option which sets client certificate
+// presented to servers requiring mutual TLS. If ca is not nil, it replaces
+// system root CAs used to verify servers' certificates.
+func WithClientCertificate(cert tls.Certificate, ca *x509.CertPool) Option {
+	return &clientCertificateOption{
+		cert: cert,
+		ca:   ca,
+	}
+}
+
+func (opt *clientCertificateOption) apply(h *Handler) {
+	h.clientCert = &opt.cert
+	h.rootCAs = opt.ca
+}
+
+type hostClientCertificateOption struct {
+	pattern string
+	cert    tls.Certificate
+}
+
+// WithClientCertificateFor creates new Option which sets client certificate
+// presented to hosts matching pattern, e.g. "*.internal".
+// It takes precedence over certificate set by WithClientCertificate.
+func WithClientCertificateFor(pattern string, cert tls.Certificate) Option {
+	return &hostClientCertificateOption{
+		pattern: pattern,
+		cert:    cert,
+	}
+}
+
+func (opt *hostClientCertificateOption) apply(h *Handler) {
+	h.hostCerts = append(h.hostCerts, hostCertificate{
+		pattern: opt.pattern,
+		cert:    opt.cert,
+	})
+}
+
+type tlsConfigOption struct {
+	config *tls.Config
+}
+
+// WithTLSConfig creates new Option which sets TLS configuration
+// of outgoing requests, e.g. minimum version, custom root CAs or
+// InsecureSkipVerify for test environments. Certificates set by
+// WithClientCertificate are applied on top of it.
+func WithTLSConfig(config *tls.Config) Option {
+	return &tlsConfigOption{
+		config: config,
+	}
+}
+
+func (opt *tlsConfigOption) apply(h *Handler) {
+	h.tlsConfig = opt.config
+}
+
+type http2Option struct {
+	mode http2Mode
+}
+
+// PreferHTTP2 creates new Option which makes Handler attempt HTTP/2
+// for outgoing requests even if custom TLS configuration is provided.
+// Servers not supporting HTTP/2 are fetched using HTTP/1.1.
+func PreferHTTP2() Option {
+	return &http2Option{
+		mode: http2Prefer,
+	}
+}
+
+// ForceHTTP2 creates new Option which makes Handler use HTTP/2 only.
+// Fetching from servers not supporting HTTP/2 fails.
+func ForceHTTP2() Option {
+	return &http2Option{
+		mode: http2Force,
+	}
+}
+
+func (opt *http2Option) apply(h *Handler) {
+	h.http2 = opt.mode
+}
+
+type roundTripperOption struct {
+	rt http.RoundTripper
+}
+
+// WithRoundTripper creates new Option which sets round tripper used to
+// make outgoing requests instead of transport of default client, e.g.
+// HTTP/3 one provided by github.com/quic-go/quic-go/http3. Since its
+// connections are not made by Handler, it is ignored if any of transport
+// options, e.g. WithTLSConfig, WithDialer or WithLoopProtection, is provided.
+func WithRoundTripper(rt http.RoundTripper) Option {
+	return &roundTripperOption{
+		rt: rt,
+	}
+}
+
+func (opt *roundTripperOption) apply(h *Handler) {
+	h.roundTripper = opt.rt
+}
+
+type dnsCacheOption struct {
+	ttl time.Duration
+}
+
+// WithDNSCache creates new Option which enables caching of resolved
+// host addresses for ttl. Expired entries are refreshed in background
+// while stale addresses are still used. See Handler.DNSCacheStats.
+func WithDNSCache(ttl time.Duration) Option {
+	return &dnsCacheOption{
+		ttl: ttl,
+	}
+}
+
+func (opt *dnsCacheOption) apply(h *Handler) {
+	h.dnsTTL = opt.ttl
+}
+
+type dialerOption struct {
+	dial DialFunc
+}
+
+// WithDialer creates new Option which sets function used to establish
+// outgoing connections, e.g. to bind source IP, filter egress traffic
+// or reject private addresses. If WithDNSCache is used, dial receives
+// resolved IP addresses instead of host names.
+func WithDialer(dial DialFunc) Option {
+	return &dialerOption{
+		dial: dial,
+	}
+}
+
+func (opt *dialerOption) apply(h *Handler) {
+	h.dial = opt.dial
+}
+
+type redirectOption struct {
+	checkRedirect func(req *http.Request, via []*http.Request) error
+}
+
+// WithMaxRedirects creates new Option which limits number
+// of redirects followed while fetching single URL.
+func WithMaxRedirects(n int) Option {
+	return &redirectOption{
+		checkRedirect: maxRedirectsPolicy(n),
+	}
+}
+
+// DisableRedirects creates new Option which disables following redirects.
+// Length of redirect response's body is reported instead.
+func DisableRedirects() Option {
+	return &redirectOption{
+		checkRedirect: noRedirectsPolicy,
+	}
+}
+
+func (opt *redirectOption) apply(h *Handler) {
+	h.checkRedirect = opt.checkRedirect
+}
+
+type preferHeadOption struct{}
+
+// PreferHeadRequests creates new Option which makes Handler determine
+// documents' lengths by Content-Length header of HEAD responses,
+// falling back to GET if header is missing. It can be overridden
+// per request by X-Fetch-Mode header with "head" or "body" value.
+func PreferHeadRequests() Option {
+	return &preferHeadOption{}
+}
+
+func (opt *preferHeadOption) apply(h *Handler) {
+	h.preferHead = true
+}
+
+type allowedMethodsOption struct {
+	methods []string
+}
+
+// WithAllowedMethods creates new Option which sets HTTP methods
+// incoming requests may choose for outgoing requests using
+// X-Fetch-Method header. By default, GET and HEAD are allowed.
+func WithAllowedMethods(methods ...string) Option {
+	return &allowedMethodsOption{
+		methods: methods,
+	}
+}
+
+func (opt *allowedMethodsOption) apply(h *Handler) {
+	h.allowedMethods = make([]string, len(opt.methods))
+
+	for i, method := range opt.methods {
+		h.allowedMethods[i] = strings.ToUpper(method)
+	}
+}
+
+type outboundHeadersOption struct {
+	header http.Header
+}
+
+// WithOutboundHeaders creates new Option which sets headers added
+// to every outgoing request, e.g. User-Agent or Authorization.
+func WithOutboundHeaders(header http.Header) Option {
+	return &outboundHeadersOption{
+		header: header,
+	}
+}
+
+func (opt *outboundHeadersOption) apply(h *Handler) {
+	h.outboundHeaders = opt.header.Clone()
+}
+
+type forwardedHeadersOption struct {
+	keys []string
+}
+
+// WithForwardedHeaders creates new Option which sets headers copied
+// from incoming request to every outgoing request, e.g. Authorization
+// or X-Request-ID. Other incoming headers are never forwarded.
+// Forwarded headers override ones set by WithOutboundHeaders.
+func WithForwardedHeaders(keys ...string) Option {
+	return &forwardedHeadersOption{
+		keys: keys,
+	}
+}
+
+func (opt *forwardedHeadersOption) apply(h *Handler) {
+	for _, key := range opt.keys {
+		h.forwardedHeaders = append(h.forwardedHeaders, http.CanonicalHeaderKey(key))
+	}
+}
+
+type compressionOption struct {
+	threshold int
+}
+
+// WithCompressionThreshold creates new Option which sets minimal size
+// of response compressed if client accepts gzip encoding. Smaller
+// responses are written uncompressed. By default, threshold is 1 KiB.
+func WithCompressionThreshold(threshold int) Option {
+	return &compressionOption{
+		threshold: threshold,
+	}
+}
+
+// DisableCompression creates new Option which disables response compression.
+func DisableCompression() Option {
+	return &compressionOption{
+		threshold: -1,
+	}
+}
+
+func (opt *compressionOption) apply(h *Handler) {
+	h.compressionThreshold = opt.threshold
+}
+
+type checksumOption struct {
+	algorithm ChecksumAlgorithm
+}
+
+// WithChecksum creates new Option which makes Handler compute checksum
+// of every fetched document and include it in detailed results.
+// It can be also enabled per request by "checksum" field of JSON body.
+func WithChecksum(algorithm ChecksumAlgorithm) Option {
+	return &checksumOption{
+		algorithm: algorithm,
+	}
+}
+
+func (opt *checksumOption) apply(h *Handler) {
+	h.checksum = opt.algorithm
+}
+
+type linksOption struct {
+	mode     LinkMode
+	sameHost bool
+}
+
+// WithLinkExtraction creates new Option which makes Handler extract
+// absolute links from fetched HTML documents and include their list
+// or number in detailed results. If sameHost is true, links to other
+// hosts are skipped. It can be also enabled per request by "links"
+// and "same_host_links" fields of JSON body.
+func WithLinkExtraction(mode LinkMode, sameHost bool) Option {
+	return &linksOption{
+		mode:     mode,
+		sameHost: sameHost,
+	}
+}
+
+func (opt *linksOption) apply(h *Handler) {
+	h.links = opt.mode
+	h.sameHostLinks = opt.sameHost
+}
+
+type sortOption struct {
+	order SortOrder
+}
+
+// WithSortedResults creates new Option which makes Handler write results
+// sorted by documents' lengths in given order. Since order is known only
+// after all documents are fetched, results are written at once. Failed
+// results are written last. It can be also set per request by "sort"
+// field of JSON body.
+func WithSortedResults(order SortOrder) Option {
+	return &sortOption{
+		order: order,
+	}
+}
+
+func (opt *sortOption) apply(h *Handler) {
+	h.sort = opt.order
+}
+
+type failureStatusOption struct {
+	partial int
+	failure int
+}
+
+// WithFailureStatus creates new Option which sets response status used
+// if some of URLs failed (e.g. 207 Multi-Status), and status used if all
+// of them failed (e.g. 502 Bad Gateway). Zero status leaves 200 OK in
+// corresponding case. Since status depends on results, they are written
+// after all documents are fetched.
+func WithFailureStatus(partial, failure int) Option {
+	return &failureStatusOption{
+		partial: partial,
+		failure: failure,
+	}
+}
+
+func (opt *failureStatusOption) apply(h *Handler) {
+	h.partialStatus = opt.partial
+	h.failureStatus = opt.failure
+}
+
+type textStatsOption struct{}
+
+// WithTextStats creates new Option which makes Handler count words
+// and lines of fetched documents and include them in detailed results.
+// Documents are counted while being read, so they are never buffered.
+// It can be also enabled per request by "text_stats" field of JSON body.
+func WithTextStats() Option {
+	return &textStatsOption{}
+}
+
+func (opt *textStatsOption) apply(h *Handler) {
+	h.textStats = true
+}
+
+type analyzerOption struct {
+	name     string
+	analyzer Analyzer
+}
+
+// WithAnalyzer creates new Option which registers Analyzer run on every
+// fetched document. Its output is included in detailed results under
+// "analysis" field with the given name. Any number of analyzers can be
+// registered; each of them receives document while it is being read.
+func WithAnalyzer(name string, analyzer Analyzer) Option {
+	return &analyzerOption{
+		name:     name,
+		analyzer: analyzer,
+	}
+}
+
+func (opt *analyzerOption) apply(h *Handler) {
+	h.analyzers = append(h.analyzers, namedAnalyzer{
+		name:     opt.name,
+		analyzer: opt.analyzer,
+	})
+}
+
+type schemeFetcherOption struct {
+	scheme  string
+	fetcher SchemeFetcher
+}
+
+// WithSchemeFetcher creates new Option which registers SchemeFetcher
+// used to fetch URLs with given scheme, e.g. "file" or "s3".
+// HTTP and HTTPS URLs are fetched by HTTP client unless
+// fetcher is registered for their scheme.
+func WithSchemeFetcher(scheme string, fetcher SchemeFetcher) Option {
+	return &schemeFetcherOption{
+		scheme:  scheme,
+		fetcher: fetcher,
+	}
+}
+
+func (opt *schemeFetcherOption) apply(h *Handler) {
+	if h.fetchers == nil {
+		h.fetchers = make(map[string]SchemeFetcher)
+	}
+
+	h.fetchers[strings.ToLower(opt.scheme)] = opt.fetcher
+}
+
+type dedupeOption struct{}
+
+// WithDeduplication creates new Option which makes Handler fetch
+// identical URLs of single request once. Plain text output contains
+// result of such URL once, while ordered and detailed outputs contain
+// it for every occurrence. It can be also enabled per request
+// by "dedupe" field of JSON body.
+func WithDeduplication() Option {
+	return &dedupeOption{}
+}
+
+func (opt *dedupeOption) apply(h *Handler) {
+	h.dedupe = true
+}
+
+type normalizationOption struct {
+	removeTracking bool
+}
+
+// WithNormalization creates new Option which makes Handler normalize URLs
+// before deduplication and fetching: scheme and host are lowercased, default
+// port, fragment and dot segments are removed. If removeTracking is true,
+// tracking query parameters like utm_source or gclid are removed as well.
+// Normalized URLs are included in detailed results. It can be also enabled
+// per request by "normalize" and "remove_tracking" fields of JSON body.
+func WithNormalization(removeTracking bool) Option {
+	return &normalizationOption{
+		removeTracking: removeTracking,
+	}
+}
+
+func (opt *normalizationOption) apply(h *Handler) {
+	h.normalize = true
+	h.removeTracking = opt.removeTracking
+}
+
+type middlewareOption struct {
+	middleware []func(http.Handler) http.Handler
+}
+
+// WithMiddleware creates new Option which wraps Handler's
+// request handling with middleware, see Handler.Use.
+func WithMiddleware(middleware ...func(http.Handler) http.Handler) Option {
+	return &middlewareOption{
+		middleware: middleware,
+	}
+}
+
+func (opt *middlewareOption) apply(h *Handler) {
+	h.middleware = append(h.middleware, opt.middleware...)
+}
+
+type propagatePanicsOption struct{}
+
+// PropagatePanics creates new Option which makes panics occurred while
+// handling requests, fetching URLs or running analyzers raised again
+// after being logged. By default, they are recovered and reported as
+// 500 responses or URLs' errors. It is intended for debugging.
+func PropagatePanics() Option {
+	return &propagatePanicsOption{}
+}
+
+func (opt *propagatePanicsOption) apply(h *Handler) {
+	h.propagatePanics = true
+}
+
+type incomingMethodsOption struct {
+	methods []string
+}
+
+// WithIncomingMethods creates new Option which sets HTTP methods of
+// incoming requests served by Handler. Requests of other methods are
+// rejected with 405 status. By default, only POST requests are served.
+func WithIncomingMethods(methods ...string) Option {
+	return &incomingMethodsOption{
+		methods: methods,
+	}
+}
+
+func (opt *incomingMethodsOption) apply(h *Handler) {
+	h.incomingMethods = make([]string, len(opt.methods))
+
+	for i, method := range opt.methods {
+		h.incomingMethods[i] = strings.ToUpper(method)
+	}
+}
+
+type getModeOption struct{}
+
+// EnableGetMode creates new Option which makes Handler serve GET requests
+// with URLs passed in query, either as repeated "url" parameters, or as
+// comma-separated "urls" parameter. Output format can be set by "format"
+// parameter. It allows to use Handler from browsers and simple probes.
+func EnableGetMode() Option {
+	return &getModeOption{}
+}
+
+func (opt *getModeOption) apply(h *Handler) {
+	h.getMode = true
+}
+
+type signerOption struct {
+	pattern string
+	signer  Signer
+}
+
+// WithSigner creates new Option which makes outgoing requests to hosts
+// matching pattern signed by signer, see HMACSigner and AWSSigV4Signer.
+// Pattern may contain shell-like wildcards, e.g. "*.s3.amazonaws.com".
+// If several patterns match host, the first provided one is used.
+func WithSigner(pattern string, signer Signer) Option {
+	return &signerOption{
+		pattern: pattern,
+		signer:  signer,
+	}
+}
+
+func (opt *signerOption) apply(h *Handler) {
+	h.signers = append(h.signers, hostSigner{
+		pattern: opt.pattern,
+		signer:  opt.signer,
+	})
+}
+
+// WithOAuth2 creates new Option which makes outgoing requests to hosts
+// matching pattern authorized with access token obtained with OAuth 2.0
+// client credentials grant, see OAuth2ClientCredentials and WithSigner.
+// Since URLs are chosen by clients, pattern must match trusted hosts
+// only, otherwise token can be sent to host controlled by client.
+// Empty pattern matches no hosts.
+func WithOAuth2(pattern, clientID, secret, tokenURL string, scopes []string) Option {
+	return WithSigner(pattern, OAuth2ClientCredentials(clientID, secret, tokenURL, scopes))
+}
+
+type credentialProviderOption struct {
+	provider CredentialProvider
+}
+
+// WithCredentialProvider creates new Option which makes credentials
+// provided for target's host attached to outgoing requests, see
+// StaticCredentials. Headers of targets in JSON body take precedence
+// over provided credentials. Credentials are not sent to other hosts
+// requests are redirected to.
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return &credentialProviderOption{
+		provider: provider,
+	}
+}
+
+func (opt *credentialProviderOption) apply(h *Handler) {
+	h.credentials = opt.provider
+}
+
+type redactionOption struct {
+	rules RedactionRules
+}
+
+// WithRedaction creates new Option which sets rules of sensitive data
+// redacted before URLs and headers are logged or included in results.
+// By default, only credentials of URL userinfo are redacted.
+func WithRedaction(rules RedactionRules) Option {
+	return &redactionOption{
+		rules: rules,
+	}
+}
+
+func (opt *redactionOption) apply(h *Handler) {
+	h.redactor = newRedactor(opt.rules)
+}
+
+type auditOption struct {
+	sink AuditSink
+}
+
+// WithAudit creates new Option which makes every outgoing fetch recorded
+// by sink, including time, client's identity, URL, status and number of
+// bytes. See JSONAuditSink, FileAuditSink and HTTPAuditSink.
+func WithAudit(sink AuditSink) Option {
+	return &auditOption{
+		sink: sink,
+	}
+}
+
+func (opt *auditOption) apply(h *Handler) {
+	h.auditSink = opt.sink
+}
+
+type jobStoreOption struct {
+	store JobStore
+}
+
+// WithJobStore creates new Option which sets store completed runs of
+// scheduled batches are saved to, see Schedule. By default, the latest
+// 3 runs of every scheduled batch are kept in memory.
+func WithJobStore(store JobStore) Option {
+	return &jobStoreOption{
+		store: store,
+	}
+}
+
+func (opt *jobStoreOption) apply(h *Handler) {
+	h.jobStore = opt.store
+}
+
+type slowFetchThresholdOption struct {
+	threshold time.Duration
+}
+
+// WithSlowFetchThreshold creates new Option which makes fetches taking
+// longer than threshold logged as warnings with timing of their phases:
+// DNS lookup, connection, TLS handshake, time to first byte and reading.
+func WithSlowFetchThreshold(threshold time.Duration) Option {
+	return &slowFetchThresholdOption{
+		threshold: threshold,
+	}
+}
+
+func (opt *slowFetchThresholdOption) apply(h *Handler) {
+	h.slowFetchThreshold = opt.threshold
+}
+
+type responseHeadersOption struct {
+	keys []string
+}
+
+// WithResponseHeaders creates new Option which makes listed headers
+// of fetched documents' responses, e.g. ETag or Last-Modified, included
+// into detailed results. Other response headers are never included.
+// Headers redacted by WithRedaction are included with redacted values.
+func WithResponseHeaders(keys ...string) Option {
+	return &responseHeadersOption{
+		keys: keys,
+	}
+}
+
+func (opt *responseHeadersOption) apply(h *Handler) {
+	for _, key := range opt.keys {
+		h.responseHeaders = append(h.responseHeaders, http.CanonicalHeaderKey(key))
+	}
+}
+
+type httpCacheOption struct {
+	maxBytes int64
+}
+
+// WithHTTPCache creates new Option which makes responses of outgoing
+// requests cached according to RFC 7234 in memory, storing up to maxBytes
+// of documents. Fresh responses are served from cache, stale ones are
+// revalidated by conditional requests, and 304 response is treated
+// as cache hit. Single response is stored only if it takes up to 1/8 of
+// maxBytes. Responses to requests with cookies, credentials headers or
+// signatures are never cached. Cache status of every result is included
+// into detailed results. Cache applies to clients set by WithClientFor
+// as well.
+func WithHTTPCache(maxBytes int64) Option {
+	return &httpCacheOption{
+		maxBytes: maxBytes,
+	}
+}
+
+func (opt *httpCacheOption) apply(h *Handler) {
+	h.httpCacheSize = opt.maxBytes
+}
+
+type hedgingOption struct {
+	delay time.Duration
+}
+
+// WithHedging creates new Option which makes the second attempt of outgoing
+// GET or HEAD request if the first one is not responded within delay.
+// Response received first is used, and the other attempt is canceled.
+// It reduces tail latency caused by slow origins at cost of extra requests.
+func WithHedging(delay time.Duration) Option {
+	return &hedgingOption{
+		delay: delay,
+	}
+}
+
+func (opt *hedgingOption) apply(h *Handler) {
+	h.hedgeDelay = opt.delay
+}
+
+type retriesOption struct {
+	retries int
+	backoff time.Duration
+}
+
+// WithRetries creates new Option which makes outgoing requests with
+// idempotent methods retried up to retries times after network errors
+// and 429, 502, 503 and 504 responses. Delay before retry starts from
+// backoff and doubles after each attempt, with random jitter, unless
+// longer delay is requested by Retry-After header. Retries are bounded
+// by retry budget, see WithRetryBudget. Negative backoff is replaced
+// by default one of 100ms.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return &retriesOption{
+		retries: retries,
+		backoff: backoff,
+	}
+}
+
+func (opt *retriesOption) apply(h *Handler) {
+	h.retries = opt.retries
+	h.retryBackoff = opt.backoff
+	if opt.backoff < 0 {
+		h.retryBackoff = defaultRetryBackoff
+	}
+}
+
+type retryBudgetOption struct {
+	budget *RetryBudget
+}
+
+// WithRetryBudget creates new Option which sets budget retries made due to
+// WithRetries option are withdrawn from. Once budget is exhausted, failures
+// are not retried. Budget may be shared by several handlers to bound retries
+// of the whole process. By default, DefaultRetryBudget is used.
+func WithRetryBudget(budget *RetryBudget) Option {
+	return &retryBudgetOption{
+		budget: budget,
+	}
+}
+
+func (opt *retryBudgetOption) apply(h *Handler) {
+	h.retryBudget = opt.budget
+}
+
+type perHostConcurrencyOption struct {
+	limit int
+}
+
+// WithPerHostConcurrency creates new Option which limits number of
+// simultaneous outgoing requests to single host, regardless of number
+// of URLs pointing to it in all batches. Requests exceeding the limit
+// wait for running ones to complete. Hosts with different ports are
+// limited separately. Each attempt of hedged request, as well as
+// each redirect, holds separate slot.
+func WithPerHostConcurrency(limit int) Option {
+	return &perHostConcurrencyOption{
+		limit: limit,
+	}
+}
+
+func (opt *perHostConcurrencyOption) apply(h *Handler) {
+	h.perHostConcurrency = opt.limit
+}
+
+type outboundRateLimitOption struct {
+	rate  float64
+	burst int
+}
+
+// WithOutboundRateLimit creates new Option which limits aggregate rate of
+// outgoing requests to rate requests per second, allowing bursts of up to
+// burst requests. Requests exceeding the limit wait for their turn, so
+// handler can be pointed at rate limited APIs. Each attempt of retried
+// or hedged request, as well as each redirect, is counted.
+func WithOutboundRateLimit(rate float64, burst int) Option {
+	return &outboundRateLimitOption{
+		rate:  rate,
+		burst: burst,
+	}
+}
+
+func (opt *outboundRateLimitOption) apply(h *Handler) {
+	h.outboundRate = opt.rate
+	h.outboundBurst = opt.burst
+}
+
+type hostLimitOption struct {
+	pattern string
+	limit   HostLimit
+}
+
+// WithHostLimit creates new Option which limits rate of outgoing requests
+// to every host matching pattern, e.g. "*.example.com", and optionally sets
+// minimum delay between them. Each matching host is limited separately.
+// Patterns are matched in order they are provided. Requests exceeding
+// the limits wait for their turn; host limits are applied in addition
+// to limit set by WithOutboundRateLimit.
+func WithHostLimit(pattern string, limit HostLimit) Option {
+	return &hostLimitOption{
+		pattern: pattern,
+		limit:   limit,
+	}
+}
+
+func (opt *hostLimitOption) apply(h *Handler) {
+	h.hostLimits = append(h.hostLimits, hostLimit{
+		pattern: opt.pattern,
+		limit:   opt.limit,
+	})
+}
+
+type transportSettingsOption struct {
+	settings TransportSettings
+}
+
+// WithTransportSettings creates new Option which tunes connection
+// management of outgoing transport, e.g. number of idle connections
+// kept per host. Like other transport options, it has no effect
+// if client set by WithClient uses custom round tripper.
+func WithTransportSettings(settings TransportSettings) Option {
+	return &transportSettingsOption{
+		settings: settings,
+	}
+}
+
+func (opt *transportSettingsOption) apply(h *Handler) {
+	h.transportSettings = &opt.settings
+}
+
+type workerPoolOption struct {
+	size int
+}
+
+// WithWorkerPool creates new Option which makes URLs fetched by pool of size
+// long-lived workers shared by all batches, instead of starting goroutine
+// per URL. Since each worker fetches one URL at a time, size also limits
+// number of simultaneous fetches. Worker is returned to pool once document
+// is fetched, so slow clients receiving results do not hold workers.
+// Workers are stopped by Handler.Close.
+func WithWorkerPool(size int) Option {
+	return &workerPoolOption{
+		size: size,
+	}
+}
+
+func (opt *workerPoolOption) apply(h *Handler) {
+	h.workerPoolSize = opt.size
+}
+
+type chunkedInputOption struct {
+	size int
+}
+
+// WithChunkedInput creates new Option which makes plain text bodies read
+// and fetched in chunks of size URLs: the next chunk is read once results
+// of the previous one are written and flushed, so memory usage stays flat
+// for bodies with any number of URLs. Input is not chunked if results are
+// sorted, response status depends on them, or batch is strict, as well as
+// if server can not read request body while response is written, which
+// requires HTTP/2 or, for HTTP/1, Go 1.21 or later. URLs are
+// deduplicated within chunk only. If input can not be read after results
+// started being written, the rest of it is skipped, and the error is
+// reported in X-Input-Error trailer.
+func WithChunkedInput(size int) Option {
+	return &chunkedInputOption{
+		size: size,
+	}
+}
+
+func (opt *chunkedInputOption) apply(h *Handler) {
+	h.chunkSize = opt.size
+}
+
+type adminOption struct {
+	prefix string
+	auth   Authenticator
+}
+
+// WithAdmin creates new Option which mounts admin endpoint under path
+// prefix. GET <prefix>/batches lists running batches with their clients,
+// start times and progress, and DELETE <prefix>/batches/<id> cancels
+// remaining fetches of batch. Admin requests are authenticated by auth
+// rather than by authenticator set by WithAuth option, since clients
+// allowed to fetch URLs must not manage batches of others, and are
+// subject to WithAllowedClients option. NewHandler panics if auth is nil,
+// or prefix is empty or "/", since admin endpoint would shadow Handler.
+func WithAdmin(prefix string, auth Authenticator) Option {
+	return &adminOption{
+		prefix: prefix,
+		auth:   auth,
+	}
+}
+
+func (opt *adminOption) apply(h *Handler) {
+	h.adminPrefix = opt.prefix
+	h.adminAuth = opt.auth
+	h.admin = true
+}
+
+type debugEndpointsOption struct{}
+
+// WithDebugEndpoints creates new Option which makes /debug/pprof/ and
+// /debug/vars endpoints served by http.Handler returned by Mux.
+// They expose internals of process, so access to them should be restricted.
+func WithDebugEndpoints() Option {
+	return &debugEndpointsOption{}
+}
+
+func (opt *debugEndpointsOption) apply(h *Handler) {
+	h.debugEndpoints = true
+}
+
+type faultInjectionOption struct {
+	faults FaultInjection
+}
+
+// WithFaultInjection creates new Option which makes Handler randomly
+// delay or fail outgoing requests and admission of incoming ones as
+// configured by faults. It is intended for resilience testing of Handler's
+// consumers and must not be used in production.
+func WithFaultInjection(faults FaultInjection) Option {
+	return &faultInjectionOption{
+		faults: faults,
+	}
+}
+
+func (opt *faultInjectionOption) apply(h *Handler) {
+	faults := opt.faults
+	h.faults = &faults
+}
+
+type cassetteOption struct {
+	path string
+	mode CassetteMode
+}
+
+// WithCassette creates new Option which makes outgoing HTTP requests
+// recorded to cassette file at path, or replayed from it, depending
+// on mode. Recorded file contains responses' metadata and bodies, one
+// interaction per line, with URLs and headers redacted. During replay,
+// no requests are sent to network: responses are looked up by method
+// and URL and replayed in recorded order, and requests which were not
+// recorded fail. If cassette to record can not be opened, it is ignored,
+// while if cassette to replay can not be loaded, all requests fail, so
+// they never reach network. Handler must be closed to close cassette file.
+func WithCassette(path string, mode CassetteMode) Option {
+	return &cassetteOption{
+		path: path,
+		mode: mode,
+	}
+}
+
+func (opt *cassetteOption) apply(h *Handler) {
+	h.cassettePath = opt.path
+	h.cassetteMode = opt.mode
+}
+
+type clockOption struct {
+	now func() time.Time
+}
+
+// WithClock creates new Option which sets clock used for durations
+// reported in summary, Server-Timing header and audit records. By
+// default, time.Now is used. Batches' deadlines and rate limits are
+// enforced with timers, so they always use real clock.
+func WithClock(now func() time.Time) Option {
+	return &clockOption{
+		now: now,
+	}
+}
+
+func (opt *clockOption) apply(h *Handler) {
+	h.now = opt.now
+}
+
+type randomSeedOption struct {
+	seed int64
+}
+
+// WithRandomSeed creates new Option which seeds random source of retries'
+// jitter and injected faults, so they are reproducible.
+func WithRandomSeed(seed int64) Option {
+	return &randomSeedOption{
+		seed: seed,
+	}
+}
+
+func (opt *randomSeedOption) apply(h *Handler) {
+	h.seed = opt.seed
+	h.seeded = true
+}
+
+type synchronousFetchingOption struct{}
+
+// WithSynchronousFetching creates new Option which makes batch's URLs
+// fetched one by one in order of request instead of concurrently.
+func WithSynchronousFetching() Option {
+	return &synchronousFetchingOption{}
+}
+
+func (opt *synchronousFetchingOption) apply(h *Handler) {
+	h.synchronous = true
+}
+
+type orderedResultsOption struct{}
+
+// WithOrderedResults creates new Option which makes results
+// written in order of URLs in request, as if every request
+// asked for it.
+func WithOrderedResults() Option {
+	return &orderedResultsOption{}
+}
+
+func (opt *orderedResultsOption) apply(h *Handler) {
+	h.ordered = true
+}
+
+type deterministicOption struct {
+	opts []Option
+}
+
+// WithDeterministicMode creates new Option which makes Handler's output
+// reproducible for tests: results are ordered, URLs are fetched
+// synchronously, clock is set to now, and random source is seeded with seed.
+func WithDeterministicMode(now func() time.Time, seed int64) Option {
+	return &deterministicOption{
+		opts: []Option{
+			WithOrderedResults(),
+			WithSynchronousFetching(),
+			WithClock(now),
+			WithRandomSeed(seed),
+		},
+	}
+}
+
+func (opt *deterministicOption) apply(h *Handler) {
+	for _, o := range opt.opts {
+		o.apply(h)
+	}
+}
+
+type robotsPolicyOption struct {
+	userAgent string
+}
+
+// WithRobotsPolicy creates new Option which makes URLs disallowed by
+// robots.txt of their hosts for userAgent skipped. Skipped URLs are
+// reported as failed with "policy" error kind. robots.txt is fetched
+// with userAgent as User-Agent header and cached for 24 hours per host.
+// Missing robots.txt allows everything, and unreachable one, e.g.
+// responding with 5XX status, disallows everything for 5 minutes.
+func WithRobotsPolicy(userAgent string) Option {
+	return &robotsPolicyOption{
+		userAgent: userAgent,
+	}
+}
+
+func (opt *robotsPolicyOption) apply(h *Handler) {
+	h.robotsAgent = opt.userAgent
+}
+
+type sitemapExpansionOption struct {
+	limit int
+}
+
+// WithSitemapExpansion creates new Option which allows requests to ask
+// for sitemap input mode by X-Input-Mode header or "input_mode" field of
+// JSON body set to "sitemap". In this mode, URLs of request point to
+// sitemaps or sitemap indexes, which are fetched and expanded into URLs
+// they list, and the latter are fetched. At most limit URLs are fetched;
+// if sitemaps list more, the rest is skipped and X-Sitemap-Truncated
+// response header is set. If sitemap can not be fetched or parsed,
+// request fails with 502 Bad Gateway.
+func WithSitemapExpansion(limit int) Option {
+	return &sitemapExpansionOption{
+		limit: limit,
+	}
+}
+
+func (opt *sitemapExpansionOption) apply(h *Handler) {
+	h.sitemapLimit = opt.limit
+}
+
+type crawlOption struct {
+	depth int
+	pages int
+}
+
+// WithCrawl creates new Option which allows requests to ask for crawl
+// input mode by X-Input-Mode header or "input_mode" field of JSON body set
+// to "crawl". In this mode, links to the same hosts found in HTML documents
+// are followed up to depth links away from URLs of request, until pages,
+// including URLs of request, are fetched. Each page is fetched once, and
+// its result reports its depth. Links are reported in results only if
+// requested.
+func WithCrawl(depth, pages int) Option {
+	return &crawlOption{
+		depth: depth,
+		pages: pages,
+	}
+}
+
+func (opt *crawlOption) apply(h *Handler) {
+	h.crawlDepth = opt.depth
+	h.crawlPages = opt.pages
+}
+
+type loopProtectionOption struct {
+	maxDepth int
+}
+
+// WithLoopProtection creates new Option which protects Handler from
+// amplifying requests against itself. Outgoing requests carry X-Fetch-Depth
+// header containing number of handlers they have passed through, and
+// incoming requests whose depth reaches maxDepth are refused with
+// 508 Loop Detected. URLs pointing to address Handler serves request
+// on fail without being fetched. Since the latter requires custom
+// dialer, it is not applied to clients with custom round trippers.
+func WithLoopProtection(maxDepth int) Option {
+	return &loopProtectionOption{
+		maxDepth: maxDepth,
+	}
+}
+
+func (opt *loopProtectionOption) apply(h *Handler) {
+	h.maxFetchDepth = opt.maxDepth
+}
+
+type limiterOption struct {
+	limiter Limiter
+}
+
+// WithLimiter creates new Option which sets Limiter admitting incoming
+// requests, e.g. adaptive one. It replaces the default one, which admits
+// number of concurrent requests set by LimitRequests option.
+func WithLimiter(limiter Limiter) Option {
+	return &limiterOption{
+		limiter: limiter,
+	}
+}
+
+func (opt *limiterOption) apply(h *Handler) {
+	h.limiter = opt.limiter
+}
+
+type weightedAdmissionOption struct {
+	capacity int64
+	cost     CostFunc
+}
+
+// WithWeightedAdmission creates new Option which admits batches while
+// total cost of batches being served does not exceed capacity, so one
+// large batch takes as much of it as many small ones. Cost of batch is
+// computed by cost from number of its URLs; if cost is nil, each URL
+// costs 1, and negative cost makes batch rejected with 500 Internal
+// Server Error. Batches which may not be admitted are rejected with
+// 503 Service Unavailable, and ones whose cost exceeds capacity with
+// 413 Request Entity Too Large. For chunked input, cost of URLs read
+// so far is taken before every chunk, and the rest of input is skipped
+// once it can not be taken.
+func WithWeightedAdmission(capacity int64, cost CostFunc) Option {
+	return &weightedAdmissionOption{
+		capacity: capacity,
+		cost:     cost,
+	}
+}
+
+func (opt *weightedAdmissionOption) apply(h *Handler) {
+	h.weighted = newWeightedSemaphore(opt.capacity, opt.cost)
+}
+
+type distributedRateLimitOption struct {
+	backend LimiterBackend
+	key     string
+	rate    int64
+}
+
+// WithDistributedRateLimit creates new Option which limits aggregate rate
+// of outgoing requests made by all replicas sharing backend to rate requests
+// per second. Requests are counted in one-second windows stored at keys
+// prefixed by key, and requests exceeding the limit wait for the next window.
+// Requests fail if backend fails.
+func WithDistributedRateLimit(backend LimiterBackend, key string, rate int64) Option {
+	return &distributedRateLimitOption{
+		backend: backend,
+		key:     key,
+		rate:    rate,
+	}
+}
+
+func (opt *distributedRateLimitOption) apply(h *Handler) {
+	h.distributedRate = &distributedRate{
+		backend: opt.backend,
+		key:     opt.key,
+		rate:    opt.rate,
+		now:     time.Now,
+	}
+}
+
+type phaseTimingOption struct{}
+
+// WithPhaseTiming creates new Option which makes durations of phases of
+// every fetch, i.e. DNS lookup, connection, TLS handshake, time to first
+// byte and reading, included into detailed results. Their totals are also
+// published as fetch_phases variable of expvar, see WithDebugEndpoints.
+func WithPhaseTiming() Option {
+	return &phaseTimingOption{}
+}
+
+func (opt *phaseTimingOption) apply(h *Handler) {
+	h.phaseTiming = true
+}
+
+type bodyPreviewOption struct {
+	size     int
+	total    int64
+	encoding PreviewEncoding
+}
+
+// WithBodyPreview creates new Option which makes first size bytes of every
+// fetched document, up to 64KB, included into detailed results in provided
+// encoding. Previews of single response take up to total bytes, 1MB if it
+// is not positive; once they are exhausted, previews are truncated and then
+// omitted. Bodies of documents are always read to take previews.
+func WithBodyPreview(size int, total int64, encoding PreviewEncoding) Option {
+	return &bodyPreviewOption{
+		size:     size,
+		total:    total,
+		encoding: encoding,
+	}
+}
+
+func (opt *bodyPreviewOption) apply(h *Handler) {
+	p := &preview{
+		size:     opt.size,
+		total:    opt.total,
+		encoding: opt.encoding,
+	}
+
+	if p.size > maxPreviewSize {
+		p.size = maxPreviewSize
+	}
+	if p.total <= 0 {
+		p.total = defaultPreviewTotal
+	}
+
+	h.preview = p
+}
+
+type passthroughOption struct {
+	headers []string
+}
+
+// WithPassthrough creates new Option which allows requests with
+// X-Passthrough header set to "true" to receive document of their single
+// URL instead of results, with its status and Content-Type, Content-Length
+// and listed headers of response. Such requests are subject to the same
+// policies and limits as other fetches, including size limits of content
+// rules and byte budget. Responses have X-Content-Type-Options: nosniff
+// and Content-Security-Policy: sandbox headers, so documents are not
+// rendered by browsers as handler's own content.
+func WithPassthrough(headers ...string) Option {
+	return &passthroughOption{
+		headers: headers,
+	}
+}
+
+func (opt *passthroughOption) apply(h *Handler) {
+	h.passthrough = true
+
+	for _, key := range opt.headers {
+		h.passthroughHeaders = append(h.passthroughHeaders, http.CanonicalHeaderKey(key))
+	}
+}
+
+type archiveOption struct {
+	limit int
+}
+
+// WithArchive creates new Option which allows requests with X-Archive
+// header set to "zip" or "tar.gz" to receive fetched documents bundled
+// into archive of that format instead of results. Documents are named
+// by hashes of their URLs, and index.json manifest maps URLs to them.
+// Documents larger than limit bytes are listed in manifest only, since
+// each document is held in memory until it is written to archive.
+// Documents held by single request take up to 8 times limit together,
+// and documents which do not fit are listed in manifest only as well.
+func WithArchive(limit int) Option {
+	return &archiveOption{
+		limit: limit,
+	}
+}
+
+func (opt *archiveOption) apply(h *Handler) {
+	h.archiveLimit = opt.limit
+}
+
+type outputTemplateOption struct {
+	tmpl *template.Template
+}
+
+// WithOutputTemplate creates new Option which makes plain text output
+// rendered by tmpl instead of lengths, one line per result, including
+// failed ones. Template is executed with *Result, so it can refer
+// to any of its fields and methods, e.g. {{.URL}}, {{.Length}},
+// {{.Status}}, {{.Duration}} and {{.Error}}.
+func WithOutputTemplate(tmpl *template.Template) Option {
+	return &outputTemplateOption{
+		tmpl: tmpl,
+	}
+}
+
+func (opt *outputTemplateOption) apply(h *Handler) {
+	h.outputTemplate = opt.tmpl
+}
+
+type progressOption struct {
+	interval time.Duration
+}
+
+// WithProgress creates new Option which makes progress of batch written
+// to streamed response every interval, so clients and intermediaries do
+// not time out idle connections during slow batches. Plain text output
+// gets comment lines, e.g. "# 120/500 done", XML output gets comments,
+// and JSON output gets new lines. Progress is not written if results are
+// buffered, e.g. sorted, or rendered by WithOutputTemplate. Progress is
+// also reported by admin endpoint, see WithAdmin.
+func WithProgress(interval time.Duration) Option {
+	return &progressOption{
+		interval: interval,
+	}
+}
+
+func (opt *progressOption) apply(h *Handler) {
+	h.progressInterval = opt.interval
+}
+
+type fetchOverridesOption struct {
+	overrides FetchOverrides
+}
+
+// WithFetchOverrides creates new Option which allows X-Fetch-Timeout,
+// X-Fetch-Concurrency, X-Fetch-Retries and X-Fetch-Format request headers
+// to override defaults for single request within provided bounds, so
+// different callers can tune fetching without separate deployments.
+// Without this option, these headers are ignored.
+func WithFetchOverrides(overrides FetchOverrides) Option {
+	return &fetchOverridesOption{
+		overrides: overrides,
+	}
+}
+
+func (opt *fetchOverridesOption) apply(h *Handler) {
+	overrides := opt.overrides
+	h.overrides = &overrides
+}
+
+type duplicateDetectionOption struct{}
+
+// WithDuplicateDetection creates new Option which makes Handler group URLs
+// of single request whose documents are identical, e.g. mirrors. Results of
+// each group of two or more URLs share number in "duplicate_group" field of
+// detailed results, and X-Duplicate-Groups header contains number of groups.
+// Since groups are known once all documents are fetched, results are written
+// after that. It can be also enabled per request by "duplicates" field of
+// JSON body.
+func WithDuplicateDetection() Option {
+	return &duplicateDetectionOption{}
+}
+
+func (opt *duplicateDetectionOption) apply(h *Handler) {
+	h.duplicates = true
+}
+
+type bandwidthLimitOption struct {
+	rate int64
+}
+
+// WithBandwidthLimit creates new Option which limits aggregate rate of
+// reading response bodies of outgoing requests to rate bytes per second,
+// so large batches can not saturate network link. Reading exceeding the
+// limit is delayed; bandwidth of hosts can be also limited separately
+// by Bandwidth field of HostLimit.
+func WithBandwidthLimit(rate int64) Option {
+	return &bandwidthLimitOption{
+		rate: rate,
+	}
+}
+
+func (opt *bandwidthLimitOption) apply(h *Handler) {
+	h.bandwidth = opt.rate
+}
+
+type byteBudgetOption struct {
+	limit int64
+}
+
+// WithByteBudget creates new Option which limits total size of documents
+// downloaded for single incoming request. Once limit is exceeded, remaining
+// fetches are canceled, and their results, as well as result of document
+// being read, are reported with "budget" error kind, so pathological batches
+// can not exhaust shared capacity.
+func WithByteBudget(limit int64) Option {
+	return &byteBudgetOption{
+		limit: limit,
+	}
+}
+
+func (opt *byteBudgetOption) apply(h *Handler) {
+	h.byteBudget = opt.limit
+}
+
+type adaptiveConcurrencyOption struct {
+	settings AdaptiveConcurrency
+}
+
+// WithAdaptiveConcurrency creates new Option which limits number of
+// concurrent outgoing requests like LimitFetches, but adjusts the limit
+// between settings' bounds according to outcomes of fetches, so it does
+// not have to be tuned by hand. The limit is halved once fetch times out
+// or fails due to connection error, gets 429 or 5xx response, or takes
+// longer than settings' latency, while failures of DNS, TLS or invalid
+// URLs do not affect it. The limit is increased by one once as many
+// fetches as the limit succeed. It takes precedence over LimitFetches;
+// the current limit is reported by LoadStats.
+func WithAdaptiveConcurrency(settings AdaptiveConcurrency) Option {
+	return &adaptiveConcurrencyOption{
+		settings: settings,
+	}
+}
+
+func (opt *adaptiveConcurrencyOption) apply(h *Handler) {
+	settings := opt.settings
+	h.adaptiveSettings = &settings
+}
+
+type contentRulesOption struct {
+	rules []ContentRule
+}
+
+// WithContentRules creates new Option which makes documents handled
+// according to rules of their content types, e.g. analyzers run only
+// on HTML documents, size of videos limited, and bodies of images not
+// read at all. Content type is taken from Content-Type header of
+// response, and the first matching rule is applied. Documents not
+// matching any rule are handled as usual.
+func WithContentRules(rules ...ContentRule) Option {
+	return &contentRulesOption{
+		rules: rules,
+	}
+}
+
+func (opt *contentRulesOption) apply(h *Handler) {
+	h.contentRules = append(h.contentRules, opt.rules...)
+}
+
+type resultSpilloverOption struct {
+	limit int64
+	dir   string
+}
+
+// WithResultSpillover creates new Option which limits estimated size of
+// results buffered in memory by single incoming request, e.g. to write
+// them in order or sorted. Results exceeding limit are spilled to temporary
+// file in dir, or in default directory for temporary files if dir is empty,
+// and read back once they are written, so massive batch can not exhaust
+// memory. File is removed once request is served.
+func WithResultSpillover(limit int64, dir string) Option {
+	return &resultSpilloverOption{
+		limit: limit,
+		dir:   dir,
+	}
+}
+
+func (opt *resultSpilloverOption) apply(h *Handler) {
+	h.spillLimit = opt.limit
+	h.spillDir = opt.dir
+}
+
+type cookieJarOption struct {
+	jar http.CookieJar
+}
+
+// WithCookieJar creates new Option which makes outgoing requests carry
+// cookies stored in jar, and cookies set by responses stored in it, e.g.
+// session cookies. The jar is shared by all incoming requests, see also
+// WithBatchCookies.
+func WithCookieJar(jar http.CookieJar) Option {
+	return &cookieJarOption{
+		jar: jar,
+	}
+}
+
+func (opt *cookieJarOption) apply(h *Handler) {
+	h.cookieJar = opt.jar
+}
+
+type batchCookiesOption struct{}
+
+// WithBatchCookies creates new Option which gives every incoming request
+// ephemeral cookie jar of its own, so its fetches carry cookies set by
+// responses to its earlier fetches, but not by ones of other requests.
+// It takes precedence over WithCookieJar. Since URLs are fetched
+// concurrently, fetches which depend on cookies set by the first one
+// should be made one by one, e.g. by WithSynchronousFetching.
+func WithBatchCookies() Option {
+	return &batchCookiesOption{}
+}
+
+func (opt *batchCookiesOption) apply(h *Handler) {
+	h.batchCookies = true
+}
+
+type textFormatOption struct {
+	format TextFormat
+}
+
+// WithTextFormat creates new Option which makes plain text output laid
+// out by format, e.g. records of URL and length separated by tab and
+// terminated by NUL, so URLs containing spaces or new lines can be
+// safely consumed by shell pipelines, e.g. xargs -0. Record terminator
+// also applies to progress comments and to WithOutputTemplate.
+func WithTextFormat(format TextFormat) Option {
+	return &textFormatOption{
+		format: format,
+	}
+}
+
+func (opt *textFormatOption) apply(h *Handler) {
+	h.textFormat = opt.format
+}
+
+type shedPolicyOption struct {
+	policy  ShedPolicy
+	timeout time.Duration
+}
+
+// WithShedPolicy creates new Option which makes incoming requests
+// accepted, rejected, queued or degraded to fetching by HEAD requests
+// as policy decides depending on load of Handler, see ShedDecision.
+// Queued requests are rejected once they wait longer than timeout.
+// Zero timeout means they wait until policy decides otherwise or
+// they are canceled. Readiness endpoint, see Mux, reports Handler
+// not ready while policy rejects requests.
+func WithShedPolicy(policy ShedPolicy, timeout time.Duration) Option {
+	return &shedPolicyOption{
+		policy:  policy,
+		timeout: timeout,
+	}
+}
+
+func (opt *shedPolicyOption) apply(h *Handler) {
+	h.shedPolicy = opt.policy
+	h.shedTimeout = opt.timeout
+}
+
+type forwardCacheOption struct {
+	cacheControl string
+}
+
+// WithForwardCache creates new Option which makes status of forward cache
+// or CDN, e.g. Squid, Varnish or Cloudflare, reported in detailed results
+// as hit or miss, along with age of its response. Status is taken from
+// X-Cache, CF-Cache-Status and Age response headers. Unless cacheControl
+// is empty, it is set as Cache-Control header of outgoing requests, e.g.
+// "max-age=3600" to accept responses cached for up to an hour, or
+// "no-cache" to make cache revalidate them. Forwarded and per-URL
+// headers override it.
+func WithForwardCache(cacheControl string) Option {
+	return &forwardCacheOption{
+		cacheControl: cacheControl,
+	}
+}
+
+func (opt *forwardCacheOption) apply(h *Handler) {
+	h.forwardCache = true
+	h.cacheControl = opt.cacheControl
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request headers overriding Handler's defaults, see WithFetchOverrides.
+const (
+	fetchTimeoutHeader     = "X-Fetch-Timeout"
+	fetchConcurrencyHeader = "X-Fetch-Concurrency"
+	fetchRetriesHeader     = "X-Fetch-Retries"
+	fetchFormatHeader      = "X-Fetch-Format"
+)
+
+// defaultRetryBackoff is backoff of retries requested
+// by X-Fetch-Retries header unless WithRetries sets other one.
+const defaultRetryBackoff = time.Millisecond * 100
+
+// FetchOverrides bounds values of request headers which override
+// Handler's defaults for single request:
+//
+//	X-Fetch-Timeout      timeout of fetching single URL, e.g. "1.5s" or "2"
+//	X-Fetch-Concurrency  number of batch's URLs fetched simultaneously
+//	X-Fetch-Retries      number of retries of failed fetches
+//	X-Fetch-Format       output format, e.g. "json"
+//
+// Requests with values exceeding bounds are rejected. Headers
+// with zero bounds are not accepted; format is always accepted.
+type FetchOverrides struct {
+	MaxTimeout     time.Duration
+	MaxConcurrency int
+	MaxRetries     int
+}
+
+// retriesKey is context key of number of retries overriding default one.
+type retriesKey struct{}
+
+// withRetries returns context making requests retried n times.
+func withRetries(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, retriesKey{}, n)
+}
+
+// retriesFrom returns number of retries of request, or def
+// if it is not overridden.
+func retriesFrom(ctx context.Context, def int) int {
+	if n, ok := ctx.Value(retriesKey{}).(int); ok {
+		return n
+	}
+
+	return def
+}
+
+// setOverrides sets batch's parameters from X-Fetch-* headers
+// within bounds of Handler's overrides.
+func (b *batch) setOverrides(o *FetchOverrides, header http.Header) error {
+	if value := header.Get(fetchTimeoutHeader); value != "" {
+		if o.MaxTimeout <= 0 {
+			return fmt.Errorf("%s header is not accepted", fetchTimeoutHeader)
+		}
+
+		timeout, err := parseTimeout(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s header: %s", fetchTimeoutHeader, err)
+		}
+		if timeout <= 0 || timeout > o.MaxTimeout {
+			return fmt.Errorf("%s must be positive and at most %s", fetchTimeoutHeader, o.MaxTimeout)
+		}
+
+		b.timeout = timeout
+	}
+
+	if value := header.Get(fetchConcurrencyHeader); value != "" {
+		n, err := parseOverride(fetchConcurrencyHeader, value, 1, o.MaxConcurrency)
+		if err != nil {
+			return err
+		}
+
+		b.concurrency = n
+	}
+
+	if value := header.Get(fetchRetriesHeader); value != "" {
+		n, err := parseOverride(fetchRetriesHeader, value, 0, o.MaxRetries)
+		if err != nil {
+			return err
+		}
+
+		b.ctx = withRetries(b.ctx, n)
+	}
+
+	if format := strings.ToLower(header.Get(fetchFormatHeader)); format != "" {
+		if _, ok := formats[format]; !ok {
+			return fmt.Errorf("unknown format %q", format)
+		}
+
+		b.format = format
+	}
+
+	return nil
+}
+
+// parseOverride parses integer value of header, which must be within [min, max].
+func parseOverride(header, value string, min, max int) (int, error) {
+	if max < min {
+		return 0, fmt.Errorf("%s header is not accepted", header)
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s header: %s", header, err)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("%s must be between %d and %d", header, min, max)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerFetchOverrides(t *testing.T) {
+	var (
+		active, maxActive int32
+		failures          int32
+	)
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("flaky") != "" && atomic.AddInt32(&failures, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+				break
+			}
+		}
+
+		delay, _ := time.ParseDuration(r.URL.Query().Get("delay"))
+		time.Sleep(delay)
+
+		w.Write([]byte("hello"))
+	}))
+	defer target.Close()
+
+	s := httptest.NewServer(NewHandler(WithFetchOverrides(FetchOverrides{
+		MaxTimeout:     time.Second,
+		MaxConcurrency: 4,
+		MaxRetries:     2,
+	})))
+	defer s.Close()
+
+	post := func(header map[string]string, urls ...string) (*http.Response, string) {
+		req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		return resp, string(body)
+	}
+
+	t.Run("concurrency", func(t *testing.T) {
+		urls := make([]string, 6)
+		for i := range urls {
+			urls[i] = target.URL + "?delay=50ms"
+		}
+
+		if _, body := post(map[string]string{fetchConcurrencyHeader: "2"}, urls...); body != strings.Repeat("5\n", 6) {
+			t.Errorf("unexpected body %q", body)
+		}
+		if maxActive != 2 {
+			t.Errorf("expected at most 2 simultaneous fetches, got %d", maxActive)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		header := map[string]string{fetchTimeoutHeader: "50ms", fetchFormatHeader: "json"}
+		if _, body := post(header, target.URL+"?delay=200ms"); !strings.Contains(body, `"error_kind":"timeout"`) {
+			t.Errorf("expected fetch timed out, got %s", body)
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		if _, body := post(map[string]string{fetchRetriesHeader: "2"}, target.URL+"?flaky=1"); body != "5\n" {
+			t.Errorf("expected fetch retried, got %q", body)
+		}
+	})
+
+	t.Run("bounds", func(t *testing.T) {
+		for key, value := range map[string]string{
+			fetchTimeoutHeader:     "5s",
+			fetchConcurrencyHeader: "0",
+			fetchRetriesHeader:     "3",
+			fetchFormatHeader:      "yaml",
+		} {
+			if resp, body := post(map[string]string{key: value}, target.URL); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s: %s: expected status 400, got %d: %s", key, value, resp.StatusCode, body)
+			}
+		}
+	})
+}
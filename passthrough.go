@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// passthroughHeader is request header which makes document of single
+// URL streamed back instead of results, see WithPassthrough.
+const passthroughHeader = "X-Passthrough"
+
+// Errors of passthrough requests.
+var (
+	// errPassthroughDisabled is returned for passthrough
+	// requests unless WithPassthrough option is provided.
+	errPassthroughDisabled = errors.New("passthrough is not enabled")
+	// errPassthroughURLs is returned for passthrough
+	// requests containing other than single URL.
+	errPassthroughURLs = errors.New("passthrough requires single URL")
+)
+
+// setPassthrough makes batch passthrough one if header is set.
+func (b *batch) setPassthrough(h *Handler, header http.Header) error {
+	value := header.Get(passthroughHeader)
+	if value == "" {
+		return nil
+	}
+
+	passthrough, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.New("invalid " + passthroughHeader + " header")
+	}
+	if passthrough && !h.passthrough {
+		return errPassthroughDisabled
+	}
+
+	b.passthrough = passthrough
+
+	return nil
+}
+
+// checkPassthrough returns error if passthrough batch
+// does not consist of single URL.
+func (b *batch) checkPassthrough() error {
+	if len(b.targets) != 1 || b.input != nil || b.inputMode != inputURLs {
+		return errPassthroughURLs
+	}
+
+	return nil
+}
+
+// servePassthrough fetches the only URL of batch and streams its document
+// back with status, Content-Type and passed through headers of response.
+// Since document comes from arbitrary origin, browsers are not allowed to
+// sniff its type nor run its scripts. If document can not be fetched or
+// exceeds size limit of its content type, 502 Bad Gateway is returned, or
+// 504 Gateway Timeout if fetch times out, or 403 Forbidden if URL is
+// disallowed by policy, e.g. robots.txt. Streamed document is cut once
+// it exceeds size limit or byte budget of request.
+func (h *Handler) servePassthrough(writer http.ResponseWriter, b *batch) {
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.Header().Set("Content-Security-Policy", "sandbox")
+
+	t := b.targets[0]
+	if b.normalize {
+		t.normalized = normalizeURL(t.URL, b.removeTracking)
+	}
+
+	if b.deadline.IsZero() {
+		b.ctx, b.cancel = context.WithCancel(b.ctx)
+	} else {
+		b.ctx, b.cancel = context.WithDeadline(b.ctx, b.deadline)
+	}
+	defer b.cancel()
+
+	start := h.now()
+	result := &Result{
+		URL:           h.redactor.url(t.URL),
+		NormalizedURL: h.redactor.url(t.normalized),
+	}
+	defer func() {
+		result.classify()
+		h.audit(b, start, result)
+	}()
+
+	ctx, done, ok := h.startFetch(b, t, result)
+	if !ok {
+		passthroughError(writer, result)
+
+		return
+	}
+	defer done()
+
+	resp, err := h.do(ctx, b, b.method, t, result)
+	if err != nil {
+		h.fail(b, result, err)
+		passthroughError(writer, result)
+
+		return
+	}
+	defer resp.Body.Close()
+
+	var r io.Reader = resp.Body
+	if b.budgeted {
+		r = &budgetReader{
+			r: r,
+			b: b,
+		}
+	}
+	if rule := h.contentRule(resp.Header); rule != nil && rule.MaxSize > 0 {
+		if resp.ContentLength > rule.MaxSize {
+			h.fail(b, result, errDocumentTooLarge)
+			passthroughError(writer, result)
+
+			return
+		}
+
+		r = &sizeLimitReader{
+			r:    r,
+			left: rule.MaxSize,
+		}
+	}
+
+	header := writer.Header()
+	for _, key := range append([]string{"Content-Type", "Content-Length"}, h.passthroughHeaders...) {
+		if values, ok := resp.Header[key]; ok {
+			header[key] = append([]string(nil), values...)
+		}
+	}
+
+	writer.WriteHeader(resp.StatusCode)
+
+	buf := copyBuffers.Get().(*[]byte)
+	n, err := io.CopyBuffer(writer, r, *buf)
+	copyBuffers.Put(buf)
+	result.Length = int(n)
+
+	if err != nil {
+		// response is started, so failure can only be logged
+		h.fail(b, result, err)
+	}
+}
+
+// passthroughError writes error response of failed passthrough result.
+func passthroughError(writer http.ResponseWriter, result *Result) {
+	status := http.StatusBadGateway
+	switch result.ErrorKind {
+	case ErrorKindTimeout:
+		status = http.StatusGatewayTimeout
+	case ErrorKindPolicy:
+		status = http.StatusForbidden
+	}
+
+	http.Error(writer, result.Error, status)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerPassthrough(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("a,b\n1,2\n"))
+	}))
+	defer target.Close()
+
+	tests := []struct {
+		name    string
+		options []Option
+		header  string
+		urls    []string
+		status  int
+		body    string
+	}{
+		{"passthrough", []Option{WithPassthrough("etag")}, "true", []string{target.URL}, http.StatusAccepted, "a,b\n1,2\n"},
+		{"disabled", nil, "true", []string{target.URL}, http.StatusBadRequest, errPassthroughDisabled.Error() + "\n"},
+		{"several URLs", []Option{WithPassthrough()}, "true", []string{target.URL, target.URL}, http.StatusBadRequest, errPassthroughURLs.Error() + "\n"},
+		{"unreachable", []Option{WithPassthrough()}, "1", []string{"http://127.0.0.1:1"}, http.StatusBadGateway, ""},
+		{"too large", []Option{WithPassthrough(), WithContentRules(ContentRule{ContentType: "text/*", MaxSize: 4})}, "true", []string{target.URL}, http.StatusBadGateway, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := httptest.NewServer(NewHandler(test.options...))
+			defer s.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(strings.Join(test.urls, "\n")))
+			req.Header.Set(passthroughHeader, test.header)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			if resp.StatusCode != test.status {
+				t.Errorf("expected status %d, got %d: %s", test.status, resp.StatusCode, body)
+			}
+			if test.body != "" && string(body) != test.body {
+				t.Errorf("expected body %q, got %q", test.body, body)
+			}
+
+			sandboxed := resp.Header.Get("X-Content-Type-Options") == "nosniff" && resp.Header.Get("Content-Security-Policy") == "sandbox"
+			if test.status != http.StatusBadRequest && !sandboxed {
+				t.Errorf("expected document to be sandboxed, got headers %v", resp.Header)
+			}
+
+			if test.status != http.StatusAccepted {
+				return
+			}
+
+			if ct := resp.Header.Get("Content-Type"); ct != "text/csv" {
+				t.Errorf("expected Content-Type text/csv, got %s", ct)
+			}
+			if etag := resp.Header.Get("ETag"); etag != `"v1"` {
+				t.Errorf("expected ETag to be passed through, got %q", etag)
+			}
+			if cookie := resp.Header.Get("Set-Cookie"); cookie != "" {
+				t.Errorf("unexpected Set-Cookie %q", cookie)
+			}
+		})
+	}
+}
+
+func TestHandlerPassthroughBudget(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat("x", 1<<20)))
+	}))
+	defer target.Close()
+
+	s := httptest.NewServer(NewHandler(WithPassthrough(), WithByteBudget(1024)))
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(target.URL))
+	req.Header.Set(passthroughHeader, "true")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if len(body) >= 1<<20 {
+		t.Errorf("expected document cut by byte budget, got %d bytes", len(body))
+	}
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profiling endpoints are served by handlers below rather than by
+// net/http/pprof, since importing it registers them on
+// http.DefaultServeMux of every program using this package.
+
+// pprofPrefix is path of profiling endpoints, see WithDebugEndpoints.
+const pprofPrefix = "/debug/pprof/"
+
+// maxProfileDuration is maximum duration of CPU profile and execution trace.
+const maxProfileDuration = time.Minute
+
+// servePprofIndex lists profiles, or writes
+// profile named by the rest of path, e.g. "heap".
+func servePprofIndex(w http.ResponseWriter, r *http.Request) {
+	if name := strings.TrimPrefix(r.URL.Path, pprofPrefix); name != "" {
+		servePprofProfile(w, r, name)
+
+		return
+	}
+
+	profiles := pprof.Profiles()
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name() < profiles[j].Name()
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	var sb strings.Builder
+	sb.WriteString("<html><head><title>/debug/pprof/</title></head><body><table>\n")
+	for _, p := range profiles {
+		name := html.EscapeString(p.Name())
+		fmt.Fprintf(&sb, "<tr><td>%d</td><td><a href=\"%s?debug=1\">%s</a></td></tr>\n", p.Count(), name, name)
+	}
+	sb.WriteString("<tr><td></td><td><a href=\"cmdline\">cmdline</a></td></tr>\n")
+	sb.WriteString("<tr><td></td><td><a href=\"profile\">profile</a></td></tr>\n")
+	sb.WriteString("<tr><td></td><td><a href=\"trace\">trace</a></td></tr>\n")
+	sb.WriteString("</table></body></html>\n")
+
+	w.Write([]byte(sb.String()))
+}
+
+// servePprofProfile writes named profile in format selected
+// by debug parameter, binary one by default.
+func servePprofProfile(w http.ResponseWriter, r *http.Request, name string) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	if name == "heap" && r.FormValue("gc") != "" {
+		runtime.GC()
+	}
+
+	if debug != 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}
+
+	p.WriteTo(w, debug)
+}
+
+// servePprofCmdline writes command line of process, arguments separated by NUL.
+func servePprofCmdline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(strings.Join(os.Args, "\x00")))
+}
+
+// servePprofCPU writes CPU profile collected
+// for seconds parameter, 30 seconds by default.
+func servePprofCPU(w http.ResponseWriter, r *http.Request) {
+	duration, ok := profileDuration(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+
+	if err := pprof.StartCPUProfile(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, fmt.Sprintf("could not enable CPU profiling: %s", err), http.StatusInternalServerError)
+
+		return
+	}
+
+	waitProfile(r, duration)
+	pprof.StopCPUProfile()
+}
+
+// servePprofTrace writes execution trace collected
+// for seconds parameter, 1 second by default.
+func servePprofTrace(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("seconds") == "" {
+		r.Form.Set("seconds", "1")
+	}
+
+	duration, ok := profileDuration(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="trace"`)
+
+	if err := trace.Start(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, fmt.Sprintf("could not enable tracing: %s", err), http.StatusInternalServerError)
+
+		return
+	}
+
+	waitProfile(r, duration)
+	trace.Stop()
+}
+
+// profileDuration returns duration set by seconds parameter, 30 seconds
+// by default, or writes error response and returns false if it is invalid.
+func profileDuration(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	seconds := 30.0
+	if value := r.FormValue("seconds"); value != "" {
+		s, err := strconv.ParseFloat(value, 64)
+		if err != nil || s <= 0 || time.Duration(s*float64(time.Second)) > maxProfileDuration {
+			http.Error(w, "invalid seconds parameter", http.StatusBadRequest)
+
+			return 0, false
+		}
+		seconds = s
+	}
+
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// waitProfile waits for duration unless request is canceled.
+func waitProfile(r *http.Request, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
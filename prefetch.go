@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// maxAdminPrefetchURLs is maximum number of URLs prefetched by admin endpoint.
+const maxAdminPrefetchURLs = 1000
+
+// errPrefetchTooLarge is returned if admin endpoint is
+// requested to prefetch more than maxAdminPrefetchURLs URLs.
+var errPrefetchTooLarge = fmt.Errorf("number of prefetched URLs exceeds %d", maxAdminPrefetchURLs)
+
+// internalBatch creates batch of URLs fetched by Handler itself rather
+// than on behalf of incoming request, e.g. scheduled or prefetched one.
+// Its parameters are taken from Handler's options, and client names it
+// in logs and admin endpoint.
+func (h *Handler) internalBatch(ctx context.Context, client string, urls []string) (*batch, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := h.newBatch(request)
+	if err != nil {
+		return nil, err
+	}
+
+	b.client = client
+	for _, u := range urls {
+		b.targets = append(b.targets, target{URL: u})
+	}
+	atomic.AddInt64(&b.total, int64(len(b.targets)))
+
+	return b, nil
+}
+
+// Prefetch fetches URLs without producing results, so HTTP cache,
+// DNS cache and idle connections are populated before incoming
+// requests need them, e.g. by periodic warmers. Documents are read
+// fully, since cacheable responses are stored once read. It returns
+// number of URLs failed to be fetched, or ctx's error if ctx is done
+// before all URLs are fetched.
+func (h *Handler) Prefetch(ctx context.Context, urls []string) (int, error) {
+	b, err := h.internalBatch(ctx, "prefetch", urls)
+	if err != nil {
+		return 0, err
+	}
+	defer b.stop()
+
+	b.head = false
+
+	if h.running != nil {
+		h.running.add(b)
+		defer h.running.remove(b)
+	}
+
+	failed := 0
+	for result := range h.fetch(b) {
+		if result.err != nil {
+			failed++
+		}
+	}
+
+	return failed, ctx.Err()
+}
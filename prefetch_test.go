@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHandlerPrefetch(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	h := NewHandler(WithHTTPCache(1<<20), WithAdmin("/admin", allowAdmin))
+
+	failed, err := h.Prefetch(context.Background(), []string{server.URL + "/fresh", "http://127.0.0.1:0/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 1 {
+		t.Errorf("expected 1 failed URL, got %d", failed)
+	}
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, strings.NewReader(server.URL+"/fresh"))
+	if len(results) != 1 || results[0].Cache != cacheHit || results[0].Length != 5 {
+		t.Errorf("expected prefetched document served from cache, got %+v", results)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+
+	resp, err := http.Post(s.URL+"/admin/prefetch", "application/json", strings.NewReader(`{"urls": ["`+server.URL+`/missing"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get(failedCountHeader) != "0" {
+		t.Errorf("unexpected response: %d, %s", resp.StatusCode, resp.Header)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestHandlerAdminPrefetchLimits(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	limiter := &testLimiter{}
+
+	s := httptest.NewServer(NewHandler(WithAdmin("/admin", allowAdmin), WithLimiter(limiter), WithWeightedAdmission(2, nil)))
+	defer s.Close()
+
+	post := func(urls ...string) int {
+		data, _ := json.Marshal(prefetchRequest{URLs: urls})
+
+		resp, err := http.Post(s.URL+"/admin/prefetch", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	url := getUrl(server.URL, 10, 0)
+
+	if status := post(url); status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+	if n := atomic.LoadInt32(&limiter.acquired); n != 1 {
+		t.Errorf("expected prefetch admitted by limiter, got %d admissions", n)
+	}
+	if status := post(url, url, url); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 by weighted admission, got %d", status)
+	}
+	if status := post(make([]string, maxAdminPrefetchURLs+1)...); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", status)
+	}
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PreviewEncoding is encoding of documents' previews in results.
+type PreviewEncoding string
+
+// Supported preview encodings.
+const (
+	// PreviewText makes preview UTF-8 text, with invalid sequences
+	// and control characters other than whitespace replaced by U+FFFD.
+	PreviewText PreviewEncoding = "text"
+	// PreviewBase64 makes preview base64 of raw bytes.
+	PreviewBase64 PreviewEncoding = "base64"
+)
+
+// Limits of previews.
+const (
+	// maxPreviewSize is maximum size of preview of single document.
+	maxPreviewSize = 64 << 10
+	// defaultPreviewTotal is total size of previews of single response
+	// used unless other one is set.
+	defaultPreviewTotal = 1 << 20
+)
+
+// preview defines previews of documents included into results.
+type preview struct {
+	size     int
+	total    int64
+	encoding PreviewEncoding
+}
+
+// takePreview takes up to n bytes of batch's preview budget
+// and returns number of bytes taken.
+func (b *batch) takePreview(n int) int {
+	left := atomic.AddInt64(&b.previewLeft, -int64(n))
+	if left >= 0 {
+		return n
+	}
+
+	// budget is exhausted by this preview
+	if taken := int64(n) + left; taken > 0 {
+		return int(taken)
+	}
+
+	return 0
+}
+
+// setPreview records preview of document's prefix in result,
+// as long as batch's preview budget is not exhausted.
+func (h *Handler) setPreview(b *batch, prefix []byte, result *Result) {
+	prefix = prefix[:b.takePreview(len(prefix))]
+	if len(prefix) == 0 {
+		return
+	}
+
+	result.PreviewEncoding = string(h.preview.encoding)
+
+	if h.preview.encoding == PreviewBase64 {
+		result.Preview = base64.StdEncoding.EncodeToString(prefix)
+
+		return
+	}
+
+	result.Preview = sanitizePreview(prefix)
+}
+
+// sanitizePreview returns prefix as valid UTF-8 text. Rune cut
+// at the end of prefix is dropped, invalid sequences and control
+// characters other than whitespace are replaced by U+FFFD.
+func sanitizePreview(prefix []byte) string {
+	for i := 1; i < utf8.UTFMax && i <= len(prefix); i++ {
+		if r := prefix[len(prefix)-i]; utf8.RuneStart(r) {
+			if !utf8.FullRune(prefix[len(prefix)-i:]) {
+				prefix = prefix[:len(prefix)-i]
+			}
+
+			break
+		}
+	}
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return utf8.RuneError
+		}
+
+		return r
+	}, strings.ToValidUTF8(string(prefix), string(utf8.RuneError)))
+}
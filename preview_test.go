@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSanitizePreview(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected string
+	}{
+		{"plain text\n", "plain text\n"},
+		{"caf\xc3\xa9", "café"},
+		// rune cut by preview's size
+		{"caf\xc3", "caf"},
+		{"bin\x00\xffary", "bin��ary"},
+	}
+
+	for _, test := range tests {
+		if got := sanitizePreview([]byte(test.prefix)); got != test.expected {
+			t.Errorf("preview of %q: expected %q, got %q", test.prefix, test.expected, got)
+		}
+	}
+}
+
+func TestHandlerBodyPreview(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello, world"))
+	}))
+	defer target.Close()
+
+	tests := []struct {
+		name     string
+		option   Option
+		urls     int
+		previews []string
+	}{
+		{"text", WithBodyPreview(5, 0, PreviewText), 2, []string{"hello", "hello"}},
+		{"base64", WithBodyPreview(5, 0, PreviewBase64), 1, []string{"aGVsbG8="}},
+		{"total", WithBodyPreview(5, 7, PreviewText), 3, []string{"hello", "he", ""}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := NewHandler(test.option, WithSynchronousFetching(), WithOrderedResults())
+
+			s := httptest.NewServer(h)
+			defer s.Close()
+
+			urls := strings.Repeat(target.URL+"\n", test.urls)
+
+			results := fetchResults(t, s.URL, strings.NewReader(urls))
+			if len(results) != len(test.previews) {
+				t.Fatalf("expected %d results, got %+v", len(test.previews), results)
+			}
+
+			for i, result := range results {
+				if result.Preview != test.previews[i] {
+					t.Errorf("result %d: expected preview %q, got %q", i, test.previews[i], result.Preview)
+				}
+			}
+		})
+	}
+}
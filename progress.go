@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// progressEncoder is encoder which can report progress of batch
+// between results, so idle connections are not timed out
+// by clients and intermediaries during slow batches.
+type progressEncoder interface {
+	// progress writes number of fetched URLs and all URLs read so far.
+	progress(w io.Writer, done, total int64) error
+}
+
+// progress writes comment record, e.g. "# 120/500 done".
+func (e *textEncoder) progress(w io.Writer, done, total int64) error {
+	_, err := fmt.Fprintf(w, "# %d/%d done%s", done, total, e.format.terminator())
+
+	return err
+}
+
+// progress writes new line, since JSON has no comments.
+func (e *jsonEncoder) progress(w io.Writer, done, total int64) error {
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// progress writes comment, e.g. "<!-- 120/500 done -->".
+func (e *xmlEncoder) progress(w io.Writer, done, total int64) error {
+	_, err := fmt.Fprintf(w, "<!-- %d/%d done -->\n", done, total)
+
+	return err
+}
+
+// writeProgress reports progress of batch if encoder supports it,
+// and flushes response.
+func writeProgress(w io.Writer, enc encoder, b *batch) error {
+	pe, ok := enc.(progressEncoder)
+	if !ok {
+		return nil
+	}
+
+	if err := pe.progress(w, atomic.LoadInt64(&b.done), atomic.LoadInt64(&b.total)); err != nil {
+		return err
+	}
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
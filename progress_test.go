@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerProgress(t *testing.T) {
+	target := createServer(0)
+	defer target.Close()
+
+	s := httptest.NewServer(NewHandler(WithProgress(time.Millisecond * 50)))
+	defer s.Close()
+
+	fast := getUrl(target.URL, 10, 0)
+	slow := getUrl(target.URL, 20, time.Millisecond*200)
+	urls := strings.NewReader(fast + "\n" + slow)
+
+	resp, err := http.Post(s.URL, "text/plain", urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "# 1/2 done\n") {
+		t.Errorf("progress is not reported: %q", body)
+	}
+	if !strings.HasSuffix(string(body), "20\n") {
+		t.Errorf("expected results after progress, got %q", body)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(fast+"\n"+slow))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var results []Result
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil || len(results) != 2 {
+		t.Errorf("expected valid JSON with 2 results, got %+v: %v", results, err)
+	}
+}
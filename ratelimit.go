@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// bucketIdleTTL is time after which buckets of inactive clients are dropped.
+const bucketIdleTTL = 10 * time.Minute
+
+// bucket is token bucket of single client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter limits rate of requests per key with token buckets.
+// Each bucket holds up to burst tokens and is refilled with rate
+// tokens per second; every request takes one token.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// newRateLimiter creates new rateLimiter.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes token from key's bucket and reports whether it was available.
+// If not, it also returns time after which the next token is available.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key)
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// reserve takes n tokens from key's bucket, letting it run into debt,
+// and returns time after which the debt is repaid.
+func (l *rateLimiter) reserve(key string, n float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / l.rate * float64(time.Second))
+}
+
+// refill returns key's bucket refilled with tokens
+// accumulated since its last use. It must be called with mu held.
+func (l *rateLimiter) refill(key string) *bucket {
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens: l.burst,
+			last:   now,
+		}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	return b
+}
+
+// wait takes token from key's bucket, waiting
+// for it to be available until ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, key string) error {
+	for {
+		ok, delay := l.allow(key)
+		if ok {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		}
+	}
+}
+
+// sweep drops buckets which have not been used for bucketIdleTTL
+// and are full, so dropping them changes nothing.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < bucketIdleTTL {
+		return
+	}
+	l.swept = now
+
+	idle := bucketIdleTTL
+	if full := time.Duration(l.burst / l.rate * float64(time.Second)); full > idle {
+		idle = full
+	}
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= idle {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+
+	l := newRateLimiter(2, 3)
+	l.now = func() time.Time {
+		return now
+	}
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("request %d is not allowed", i)
+		}
+	}
+
+	ok, wait := l.allow("a")
+	if ok {
+		t.Fatal("request exceeding burst is allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("unexpected wait time: %s", wait)
+	}
+
+	// other clients are not affected
+	if ok, _ := l.allow("b"); !ok {
+		t.Error("request of other client is not allowed")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("request is not allowed after refill")
+	}
+}
+
+func TestHandlerClientRate(t *testing.T) {
+	h := NewHandler(LimitClientRate(1, 1), WithTrustedProxies("192.0.2.1"))
+
+	post := func(remote, forwarded string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = remote + ":1234"
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	if code := post("192.0.2.1", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := post("192.0.2.1", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, code)
+	}
+
+	// the same proxy forwards other client
+	if code := post("192.0.2.1", "198.51.100.1, 198.51.100.2"); code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, code)
+	}
+
+	// untrusted client can not spoof its address
+	if code := post("203.0.113.1", "198.51.100.3"); code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := post("203.0.113.1", "198.51.100.4"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, code)
+	}
+}
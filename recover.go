@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// panicError is error made of recovered panic.
+type panicError struct {
+	value interface{}
+}
+
+// Error implements error interface.
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// recovered logs recovered panic with stack trace and converts it to error.
+// If PropagatePanics option is provided, panic is raised again instead.
+func (h *Handler) recovered(logger *log.Logger, value interface{}, where string) error {
+	err := &panicError{value: value}
+
+	logger.Printf("%s: %s\n%s", where, err, debug.Stack())
+
+	if h.propagatePanics {
+		panic(value)
+	}
+
+	return err
+}
+
+// recoverRequest recovers panic occurred while handling request
+// and responds with 500 status. It must be called with defer.
+func (h *Handler) recoverRequest(writer http.ResponseWriter, request *http.Request) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	// aborting handler is not a failure
+	if value == http.ErrAbortHandler {
+		panic(value)
+	}
+
+	h.recovered(h.logger, value, request.Method+" "+request.URL.Path)
+
+	http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// fetchSafely fetches single URL, recording panic
+// occurred meanwhile as error of result.
+func (h *Handler) fetchSafely(b *batch, t target) (result *Result) {
+	defer func() {
+		if value := recover(); value != nil {
+			result = &Result{
+				URL:           h.redactor.url(t.URL),
+				NormalizedURL: h.redactor.url(t.normalized),
+			}
+			result.setError(h.recovered(b.logger, value, result.URL))
+		}
+	}()
+
+	return h.fetchOne(b, t)
+}
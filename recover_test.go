@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandlerRecoverRequest(t *testing.T) {
+	var buf bytes.Buffer
+
+	h := NewHandler(
+		WithLogger(log.New(&buf, "", 0)),
+		WithAuth(AuthenticatorFunc(func(*http.Request) error {
+			panic("boom")
+		})),
+	)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if !strings.Contains(buf.String(), "panic: boom") {
+		t.Errorf("panic is not logged: %s", buf.String())
+	}
+}
+
+func TestHandlerRecoverFetch(t *testing.T) {
+	h := NewHandler(
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithSchemeFetcher("boom", SchemeFetcherFunc(func(ctx context.Context, method string, u *url.URL) (*Document, error) {
+			panic("fetcher")
+		})),
+		WithAnalyzer("boom", AnalyzerFunc(func(url string, header http.Header, body io.Reader) (interface{}, error) {
+			panic("analyzer")
+		})),
+	)
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, strings.NewReader("boom://a\ndata:,hello"))
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+
+	for _, r := range results {
+		switch r.URL {
+		case "boom://a":
+			if r.Error != "panic: fetcher" {
+				t.Errorf("unexpected error: %q", r.Error)
+			}
+		default:
+			if r.Error != "" || r.AnalysisErrors["boom"] != "panic: analyzer" {
+				t.Errorf("unexpected result: %+v", r)
+			}
+		}
+	}
+}
+
+func TestPropagatePanics(t *testing.T) {
+	h := NewHandler(
+		WithLogger(log.New(io.Discard, "", 0)),
+		PropagatePanics(),
+		WithAuth(AuthenticatorFunc(func(*http.Request) error {
+			panic("boom")
+		})),
+	)
+
+	defer func() {
+		if recover() != "boom" {
+			t.Error("panic is not propagated")
+		}
+	}()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redactedValue replaces redacted values.
+const redactedValue = "xxxxx"
+
+// RedactionRules define sensitive data redacted from logs and results.
+type RedactionRules struct {
+	// QueryParams are names of URL query parameters whose values
+	// are redacted. Names are case-insensitive.
+	QueryParams []string
+	// Headers are names of headers whose values are redacted.
+	Headers []string
+	// KeepUserinfo disables redaction of credentials of URL userinfo.
+	KeepUserinfo bool
+}
+
+// redactor redacts sensitive data according to RedactionRules.
+type redactor struct {
+	params       map[string]bool
+	headers      map[string]bool
+	keepUserinfo bool
+}
+
+// defaultRedactor redacts credentials of URL userinfo only.
+var defaultRedactor = newRedactor(RedactionRules{})
+
+// newRedactor creates new redactor.
+func newRedactor(rules RedactionRules) *redactor {
+	r := &redactor{
+		params:       make(map[string]bool, len(rules.QueryParams)),
+		headers:      make(map[string]bool, len(rules.Headers)),
+		keepUserinfo: rules.KeepUserinfo,
+	}
+
+	for _, param := range rules.QueryParams {
+		r.params[strings.ToLower(param)] = true
+	}
+	for _, header := range rules.Headers {
+		r.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return r
+}
+
+// url returns raw URL with sensitive data redacted, so it can be logged
+// and echoed in results. Credentials of userinfo are still used for basic
+// authentication of outgoing requests.
+func (r *redactor) url(raw string) string {
+	if raw == "" {
+		return raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	if u.User != nil && !r.keepUserinfo {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedValue)
+		} else {
+			// username only may be token itself
+			u.User = url.User(redactedValue)
+		}
+	}
+
+	if len(r.params) != 0 && u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			key := param
+			if j := strings.IndexByte(param, '='); j >= 0 {
+				key = param[:j]
+			}
+
+			if name, err := url.QueryUnescape(key); err == nil && r.params[strings.ToLower(name)] {
+				params[i] = key + "=" + redactedValue
+			}
+		}
+		u.RawQuery = strings.Join(params, "&")
+	}
+
+	return u.String()
+}
+
+// header returns copy of header with sensitive values redacted.
+func (r *redactor) header(header http.Header) http.Header {
+	redacted := header.Clone()
+
+	for key, values := range redacted {
+		if r.headers[key] {
+			for i := range values {
+				values[i] = redactedValue
+			}
+		}
+	}
+
+	return redacted
+}
+
+// error redacts URL contained in err, if any.
+func (r *redactor) error(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = r.url(urlErr.URL)
+	}
+
+	return err
+}
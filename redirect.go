@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// maxRedirectsPolicy returns redirect policy which stops
+// after n consecutive redirects.
+func maxRedirectsPolicy(n int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > n {
+			return fmt.Errorf("stopped after %d redirects", n)
+		}
+
+		return nil
+	}
+}
+
+// noRedirectsPolicy makes client return redirect response as is.
+func noRedirectsPolicy(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// redirectsCount returns number of redirects followed to get resp.
+func redirectsCount(resp *http.Response) int {
+	n := 0
+
+	for r := resp.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		n++
+	}
+
+	return n
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestHandlerRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		n, _ := strconv.Atoi(request.URL.Query().Get("n"))
+		if n > 0 {
+			http.Redirect(writer, request, "/?n="+strconv.Itoa(n-1), http.StatusFound)
+
+			return
+		}
+
+		writer.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	tests := map[string]struct {
+		opts      []Option
+		redirects int
+		finalURL  string
+		failed    bool
+	}{
+		"default": {
+			redirects: 3,
+			finalURL:  server.URL + "/?n=0",
+		},
+		"max redirects": {
+			opts:   []Option{WithMaxRedirects(2)},
+			failed: true,
+		},
+		"disabled": {
+			opts:     []Option{DisableRedirects()},
+			finalURL: server.URL + "/?n=3",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := httptest.NewServer(NewHandler(test.opts...))
+			defer s.Close()
+
+			results := fetchResults(t, s.URL, getRequestBodyBuffer(server.URL+"/?n=3"))
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(results))
+			}
+
+			r := results[0]
+			if test.failed {
+				if r.Error == "" {
+					t.Errorf("expected error, got %+v", r)
+				}
+
+				return
+			}
+
+			if r.Redirects != test.redirects || r.FinalURL != test.finalURL {
+				t.Errorf("unexpected result: %+v", r)
+			}
+		})
+	}
+}
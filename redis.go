@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lo00l/http-handler/internal/resp"
+)
+
+// redisIncrementScript increments counter and sets its expiration atomically.
+const redisIncrementScript = `local n = redis.call('INCRBY', KEYS[1], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return n`
+
+// redisLeaseScript removes expired leases from sorted set scored by
+// expiration times, and adds lease of holder unless limit is reached.
+// Time of Redis is used, so clocks of replicas do not matter.
+const redisLeaseScript = `local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[3]), ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1`
+
+// RedisBackend is LimiterBackend and LeaseBackend storing
+// counters and leases in Redis.
+type RedisBackend struct {
+	client *resp.Client
+}
+
+// NewRedisBackend creates new RedisBackend connecting to Redis at URL of
+// form redis://[[user]:password@]host[:port][/db]. Connections are
+// established lazily and reused.
+func NewRedisBackend(rawURL string) (*RedisBackend, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	var username, password string
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+
+	var db int
+	if value := strings.Trim(u.Path, "/"); value != "" {
+		if db, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid database %q", value)
+		}
+	}
+
+	return &RedisBackend{
+		client: resp.NewClient(addr, username, password, db),
+	}, nil
+}
+
+// Increment implements LimiterBackend interface.
+func (b *RedisBackend) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return b.client.Do(ctx,
+		"EVAL", redisIncrementScript, "1", key,
+		strconv.FormatInt(delta, 10), strconv.FormatInt(ttl.Milliseconds(), 10),
+	)
+}
+
+// AcquireLease implements LeaseBackend interface.
+func (b *RedisBackend) AcquireLease(ctx context.Context, key, holder string, limit int64, ttl time.Duration) (bool, error) {
+	n, err := b.client.Do(ctx,
+		"EVAL", redisLeaseScript, "1", key,
+		holder, strconv.FormatInt(limit, 10), strconv.FormatInt(ttl.Milliseconds(), 10),
+	)
+
+	return n == 1, err
+}
+
+// ReleaseLease implements LeaseBackend interface.
+func (b *RedisBackend) ReleaseLease(ctx context.Context, key, holder string) error {
+	_, err := b.client.Do(ctx, "ZREM", key, holder)
+
+	return err
+}
+
+// Close closes idle connections.
+func (b *RedisBackend) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"expvar"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrorKind is machine-readable class of failure, so downstream
+// systems can branch on it instead of parsing error messages.
+// It is reported in detailed results, logs, fetch_errors
+// variable of expvar and audit records.
+type ErrorKind string
+
+// errorMetrics contains numbers of results of every
+// error kind, published at /debug/vars.
+var errorMetrics = expvar.NewMap("fetch_errors")
+
+// Kinds of errors.
+const (
+	// ErrorKindTLS marks results failed due to TLS handshake
+	// or certificate verification errors.
+	ErrorKindTLS ErrorKind = "tls"
+	// ErrorKindTimeout marks results failed due to
+	// URL's timeout or batch's deadline.
+	ErrorKindTimeout ErrorKind = "timeout"
+	// ErrorKindPolicy marks results skipped due to policy, e.g. robots.txt.
+	ErrorKindPolicy ErrorKind = "policy"
+	// ErrorKindBudget marks results interrupted or skipped
+	// due to exceeded byte budget, see WithByteBudget.
+	ErrorKindBudget ErrorKind = "budget"
+	// ErrorKindDNS marks results failed due to DNS lookup errors.
+	ErrorKindDNS ErrorKind = "dns"
+	// ErrorKindConnection marks results failed due to
+	// network errors, e.g. refused or reset connection.
+	ErrorKindConnection ErrorKind = "connection"
+	// ErrorKindTooLarge marks results failed due to document
+	// exceeding size limit, see ContentRule.
+	ErrorKindTooLarge ErrorKind = "too_large"
+	// ErrorKindCanceled marks results canceled along with batch,
+	// e.g. by strict mode or admin endpoint.
+	ErrorKindCanceled ErrorKind = "canceled"
+	// ErrorKindStatus marks results of non-2xx responses.
+	// Unlike other kinds, they are not failures, so their
+	// Error field is empty.
+	ErrorKindStatus ErrorKind = "status"
+	// ErrorKindOther marks results failed due to other errors.
+	ErrorKindOther ErrorKind = "other"
+)
+
+// Result describes outcome of fetching single URL.
+type Result struct {
+	URL           string   `json:"url" xml:"url"`
+	NormalizedURL string   `json:"normalized_url,omitempty" xml:"normalized_url,omitempty"`
+	Length        int      `json:"length" xml:"length"`
+	Method        string   `json:"method,omitempty" xml:"method,omitempty"`
+	Status        int      `json:"status,omitempty" xml:"status,omitempty"`
+	Protocol      string   `json:"protocol,omitempty" xml:"protocol,omitempty"`
+	FinalURL      string   `json:"final_url,omitempty" xml:"final_url,omitempty"`
+	Redirects     int      `json:"redirects,omitempty" xml:"redirects,omitempty"`
+	Cache         string   `json:"cache,omitempty" xml:"cache,omitempty"`
+	UpstreamCache string   `json:"upstream_cache,omitempty" xml:"upstream_cache,omitempty"`
+	UpstreamAge   int      `json:"upstream_age,omitempty" xml:"upstream_age,omitempty"`
+	Checksum      string   `json:"checksum,omitempty" xml:"checksum,omitempty"`
+	ContentType   string   `json:"content_type,omitempty" xml:"content_type,omitempty"`
+	Charset       string   `json:"charset,omitempty" xml:"charset,omitempty"`
+	Words         int      `json:"words,omitempty" xml:"words,omitempty"`
+	Lines         int      `json:"lines,omitempty" xml:"lines,omitempty"`
+	LinkCount     int      `json:"link_count,omitempty" xml:"link_count,omitempty"`
+	Links         []string `json:"links,omitempty" xml:"links>link,omitempty"`
+	// Preview is prefix of document, see WithBodyPreview.
+	Preview         string `json:"preview,omitempty" xml:"preview,omitempty"`
+	PreviewEncoding string `json:"preview_encoding,omitempty" xml:"preview_encoding,omitempty"`
+	// Depth is number of links followed to URL during crawl.
+	Depth int `json:"depth,omitempty" xml:"depth,omitempty"`
+	// DuplicateGroup numbers group of URLs with identical
+	// content, see WithDuplicateDetection.
+	DuplicateGroup int `json:"duplicate_group,omitempty" xml:"duplicate_group,omitempty"`
+	// Delta describes change compared to baseline, if it is provided.
+	Delta *Delta `json:"delta,omitempty" xml:"delta,omitempty"`
+	// Timing contains durations of fetch's phases, see WithPhaseTiming.
+	Timing *Timing `json:"timing,omitempty" xml:"timing,omitempty"`
+
+	Headers ResponseHeaders `json:"headers,omitempty" xml:"header,omitempty"`
+
+	Analysis       Analyses  `json:"analysis,omitempty" xml:"analysis,omitempty"`
+	AnalysisErrors Analyses  `json:"analysis_errors,omitempty" xml:"analysis_error,omitempty"`
+	Error          string    `json:"error,omitempty" xml:"error,omitempty"`
+	ErrorKind      ErrorKind `json:"error_kind,omitempty" xml:"error_kind,omitempty"`
+
+	err error
+	// index is position of URL in request.
+	index int
+	// body is document captured for archive, see WithArchive.
+	body *archiveBuffer
+	// duration is time spent on fetching URL.
+	duration time.Duration
+	// contentHash is hash of document, computed to detect duplicates.
+	contentHash string
+	// spilled locates result in spool's file if this is its stub,
+	// see WithResultSpillover.
+	spilled *spoolEntry
+}
+
+// Err returns error occurred while fetching URL, if any.
+func (r *Result) Err() error {
+	return r.err
+}
+
+// Duration returns time spent on fetching URL,
+// including waiting for fetch slot.
+func (r *Result) Duration() time.Duration {
+	return r.duration
+}
+
+// setError records err in result.
+func (r *Result) setError(err error) {
+	r.err = err
+	r.Error = err.Error()
+	r.ErrorKind = classifyError(err)
+}
+
+// classify records kind of successful result of non-2xx response
+// and counts result's kind, if any, in errorMetrics.
+func (r *Result) classify() {
+	if r.err == nil && r.Status != 0 && (r.Status < 200 || r.Status > 299) {
+		r.ErrorKind = ErrorKindStatus
+	}
+
+	if r.ErrorKind != "" {
+		errorMetrics.Add(string(r.ErrorKind), 1)
+	}
+}
+
+// classifyError returns kind of error.
+func classifyError(err error) ErrorKind {
+	var dnsErr *net.DNSError
+
+	switch {
+	case isTLSError(err):
+		return ErrorKindTLS
+	case isTimeout(err):
+		return ErrorKindTimeout
+	case errors.Is(err, errRobotsDisallowed):
+		return ErrorKindPolicy
+	case errors.Is(err, errBudgetExceeded):
+		return ErrorKindBudget
+	case errors.Is(err, errDocumentTooLarge):
+		return ErrorKindTooLarge
+	case errors.Is(err, context.Canceled):
+		return ErrorKindCanceled
+	case errors.As(err, &dnsErr):
+		return ErrorKindDNS
+	case isConnectionError(err):
+		return ErrorKindConnection
+	}
+
+	return ErrorKindOther
+}
+
+// isConnectionError reports whether err is caused by network failure.
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+
+	return errors.As(err, &opErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// isTimeout reports whether err is caused by timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isTLSError reports whether err is caused by TLS handshake failure.
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+
+	switch {
+	case errors.As(err, &unknownAuthority),
+		errors.As(err, &hostname),
+		errors.As(err, &invalid),
+		errors.As(err, &recordHeader):
+		return true
+	}
+
+	// TLS alerts are not exported, so they can be detected by message only.
+	return strings.Contains(err.Error(), "tls: ")
+}
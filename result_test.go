@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{context.DeadlineExceeded, ErrorKindTimeout},
+		{context.Canceled, ErrorKindCanceled},
+		{fmt.Errorf("fetch: %w", &net.DNSError{Err: "no such host", Name: "example.invalid"}), ErrorKindDNS},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, ErrorKindConnection},
+		{errRobotsDisallowed, ErrorKindPolicy},
+		{errDocumentTooLarge, ErrorKindTooLarge},
+		{errBudgetExceeded, ErrorKindBudget},
+		{errors.New("unexpected"), ErrorKindOther},
+	}
+
+	for _, test := range tests {
+		if kind := classifyError(test.err); kind != test.kind {
+			t.Errorf("%v: expected kind %s, got %s", test.err, test.kind, kind)
+		}
+	}
+}
+
+func TestHandlerErrorKinds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	var records []AuditRecord
+
+	s := httptest.NewServer(NewHandler(
+		WithOrderedResults(),
+		WithSynchronousFetching(),
+		WithAudit(AuditSinkFunc(func(record AuditRecord) error {
+			records = append(records, record)
+
+			return nil
+		})),
+	))
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, strings.NewReader(server.URL+"\nhttp://127.0.0.1:0/"))
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+
+	if r := results[0]; r.ErrorKind != ErrorKindStatus || r.Error != "" {
+		t.Errorf("expected result of non-2xx response, got %+v", r)
+	}
+	if r := results[1]; r.ErrorKind != ErrorKindConnection {
+		t.Errorf("expected connection failure, got %+v", r)
+	}
+
+	if len(records) != 2 || records[0].ErrorKind != ErrorKindStatus || records[1].ErrorKind != ErrorKindConnection {
+		t.Errorf("unexpected audit records: %+v", records)
+	}
+
+	if n := errorMetrics.Get(string(ErrorKindConnection)); n == nil || n.String() == "0" {
+		t.Errorf("connection failure is not counted, got %v", n)
+	}
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// budgetBuckets is number of buckets retry budget's window is divided into.
+const budgetBuckets = 10
+
+// retryStatuses contains statuses of responses caused
+// by temporary failures, so requests can be retried.
+var retryStatuses = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// idempotentMethods contains methods which are safe to retry.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// DefaultRetryBudget is retry budget used unless WithRetryBudget option
+// is provided. It is shared by all handlers, so retries of the whole
+// process may not exceed 10% of requests made during the last 10 seconds,
+// plus 10 retries.
+var DefaultRetryBudget = NewRetryBudget(0.1, 10, time.Second*10)
+
+// budgetBucket counts requests and retries made during part of window.
+type budgetBucket struct {
+	epoch    int64
+	requests int
+	retries  int
+}
+
+// RetryBudget bounds number of retries by ratio of recent request volume,
+// so retries back off automatically when targets are badly degraded
+// instead of amplifying outages. It is safe for concurrent use and
+// can be shared by several handlers.
+type RetryBudget struct {
+	ratio      float64
+	minRetries int
+	bucketSize time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	buckets [budgetBuckets]budgetBucket
+}
+
+// NewRetryBudget creates new RetryBudget allowing retries to make up ratio
+// of requests made during window, plus minRetries, so rarely used targets
+// can still be retried.
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+	bucketSize := window / budgetBuckets
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+
+	return &RetryBudget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		bucketSize: bucketSize,
+		now:        time.Now,
+	}
+}
+
+// current returns bucket of current time. It must be called with mu held.
+func (b *RetryBudget) current() *budgetBucket {
+	epoch := b.now().UnixNano() / int64(b.bucketSize)
+
+	bucket := &b.buckets[epoch%budgetBuckets]
+	if bucket.epoch != epoch {
+		*bucket = budgetBucket{
+			epoch: epoch,
+		}
+	}
+
+	return bucket
+}
+
+// request accounts request made.
+func (b *RetryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.current().requests++
+}
+
+// withdraw accounts retry and reports whether it is allowed by budget.
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bucket := b.current()
+	oldest := bucket.epoch - budgetBuckets + 1
+
+	var requests, retries int
+	for _, bb := range b.buckets {
+		if bb.epoch >= oldest {
+			requests += bb.requests
+			retries += bb.retries
+		}
+	}
+
+	if float64(retries+1) > float64(b.minRetries)+b.ratio*float64(requests) {
+		return false
+	}
+
+	bucket.retries++
+
+	return true
+}
+
+// retryTransport retries idempotent requests without body failed due to
+// network errors or temporary failures of target, waiting exponentially
+// growing delay with jitter between attempts. Retries are withdrawn from
+// retry budget, and once it is exhausted, failures are returned as is.
+type retryTransport struct {
+	retries int
+	backoff time.Duration
+	budget  *RetryBudget
+	rand    *rand.Rand
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !idempotentMethods[req.Method] || req.Body != nil && req.Body != http.NoBody {
+		return t.next.RoundTrip(req)
+	}
+
+	t.budget.request()
+
+	retries := retriesFrom(req.Context(), t.retries)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+
+		if attempt >= retries || !t.retryable(req, resp, err) || !t.budget.withdraw() {
+			return resp, err
+		}
+
+		delay := t.delay(attempt, resp)
+
+		if resp != nil {
+			// body is drained, so connection can be reused
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// retryable reports whether request can be retried after attempt.
+func (t *retryTransport) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		// canceled requests are never retried
+		return req.Context().Err() == nil
+	}
+
+	return retryStatuses[resp.StatusCode]
+}
+
+// delay returns time to wait after attempt. It is exponentially growing
+// backoff with jitter, or time requested by Retry-After header if it is longer.
+func (t *retryTransport) delay(attempt int, resp *http.Response) time.Duration {
+	backoff := t.backoff << uint(attempt)
+	if attempt >= 62 || backoff>>uint(attempt) != t.backoff {
+		// doubling overflowed
+		backoff = math.MaxInt64
+	}
+	delay := backoff/2 + time.Duration(t.rand.Int63n(int64(backoff/2)+1))
+
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			if after := time.Duration(seconds) * time.Second; after > delay {
+				delay = after
+			}
+		}
+	}
+
+	return delay
+}
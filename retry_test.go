@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerRetries(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(
+		WithRetries(3, time.Millisecond),
+		WithRetryBudget(NewRetryBudget(0.1, 10, time.Second)),
+	))
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, strings.NewReader(server.URL))
+	if len(results) != 1 || results[0].Status != http.StatusOK || results[0].Length != 5 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+}
+
+func TestRetriesNegativeBackoff(t *testing.T) {
+	h := NewHandler(WithRetries(3, -time.Second))
+	if h.retryBackoff != defaultRetryBackoff {
+		t.Errorf("expected default backoff, got %s", h.retryBackoff)
+	}
+
+	tr := &retryTransport{backoff: time.Second, rand: rand.New(rand.NewSource(1))}
+	if delay := tr.delay(70, nil); delay <= 0 {
+		t.Errorf("expected positive delay, got %s", delay)
+	}
+}
+
+func TestHandlerRetryBudgetExhausted(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(
+		WithRetries(3, time.Millisecond),
+		WithRetryBudget(NewRetryBudget(0, 1, time.Minute)),
+	))
+	defer s.Close()
+
+	for i := 0; i < 2; i++ {
+		results := fetchResults(t, s.URL, strings.NewReader(server.URL))
+		if len(results) != 1 || results[0].Status != http.StatusBadGateway {
+			t.Fatalf("unexpected results: %+v", results)
+		}
+	}
+
+	// the only retry allowed by budget is made during the first batch
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	now := time.Now()
+
+	b := NewRetryBudget(0.1, 0, time.Second*10)
+	b.now = func() time.Time {
+		return now
+	}
+
+	for i := 0; i < 100; i++ {
+		b.request()
+	}
+
+	for i := 0; i < 10; i++ {
+		if !b.withdraw() {
+			t.Fatalf("retry %d is not allowed", i)
+		}
+	}
+	if b.withdraw() {
+		t.Error("retry exceeding budget is allowed")
+	}
+
+	// requests and retries leave window
+	now = now.Add(time.Second * 11)
+
+	if b.withdraw() {
+		t.Error("retry is allowed without recent requests")
+	}
+
+	for i := 0; i < 10; i++ {
+		b.request()
+	}
+	if !b.withdraw() {
+		t.Error("retry is not allowed after new requests")
+	}
+}
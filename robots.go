@@ -0,0 +1,317 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Parameters of robots.txt handling.
+const (
+	// robotsTTL is time robots.txt is cached for.
+	robotsTTL = time.Hour * 24
+	// unreachableRobotsTTL is time unreachable robots.txt is cached for,
+	// so hosts recovered from failures are not blocked for long.
+	unreachableRobotsTTL = time.Minute * 5
+	// robotsTimeout limits time of fetching robots.txt.
+	robotsTimeout = time.Second * 30
+	// maxRobotsSize is maximum size of robots.txt parsed.
+	maxRobotsSize = 500 << 10
+)
+
+// errRobotsDisallowed is error of URLs skipped because of robots.txt.
+var errRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+// robotsRule is single allow or disallow rule of robots.txt.
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsGroup is group of rules applied to user agents.
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+}
+
+// robotsRules are rules of robots.txt applied to particular user agent.
+// Nil rules allow everything.
+type robotsRules []robotsRule
+
+// disallowAll contains rules disallowing everything, used if
+// robots.txt is unreachable, as required by RFC 9309.
+var disallowAll = robotsRules{{pattern: "/"}}
+
+// parseRobots parses robots.txt and returns rules applied to agent,
+// which is product token of user agent, e.g. "mybot".
+func parseRobots(r io.Reader, agent string) robotsRules {
+	var (
+		groups []*robotsGroup
+		group  *robotsGroup
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			// user agent following rules starts new group
+			if group == nil || len(group.rules) != 0 {
+				group = &robotsGroup{}
+				groups = append(groups, group)
+			}
+
+			group.agents = append(group.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			// empty disallow rule allows everything
+			if group == nil || value == "" {
+				continue
+			}
+
+			group.rules = append(group.rules, robotsRule{
+				allow:   key == "allow",
+				pattern: value,
+			})
+		}
+	}
+
+	var matched, wildcard robotsRules
+	for _, g := range groups {
+		for _, a := range g.agents {
+			switch a {
+			case agent:
+				matched = append(matched, g.rules...)
+			case "*":
+				wildcard = append(wildcard, g.rules...)
+			}
+		}
+	}
+
+	if matched != nil {
+		return matched
+	}
+
+	return wildcard
+}
+
+// allowed reports whether path, including query, is allowed by rules.
+// The longest matching rule wins; if allow and disallow rules
+// of the same length match, allow rule wins.
+func (rules robotsRules) allowed(path string) bool {
+	allowed, longest := true, -1
+
+	for _, rule := range rules {
+		n := len(rule.pattern)
+		if n < longest || !robotsMatch(rule.pattern, path) {
+			continue
+		}
+
+		if n > longest || rule.allow {
+			allowed = rule.allow
+		}
+		longest = n
+	}
+
+	return allowed
+}
+
+// robotsMatch reports whether path matches pattern of robots.txt rule.
+// Pattern may contain * wildcards and be anchored by trailing $.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+
+	return !anchored || rest == ""
+}
+
+// robotsEntry is cached robots.txt of host.
+type robotsEntry struct {
+	// ready is closed once rules are fetched.
+	ready   chan struct{}
+	rules   robotsRules
+	expires time.Time
+}
+
+// robotsCache fetches and caches robots.txt of hosts.
+type robotsCache struct {
+	userAgent string
+	// agent is product token of user agent, rules are looked up by.
+	agent string
+	// client returns client robots.txt of host is fetched by.
+	client func(host string) *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+// newRobotsCache creates new robotsCache.
+func newRobotsCache(userAgent string, client func(host string) *http.Client, now func() time.Time) *robotsCache {
+	agent := userAgent
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+
+	return &robotsCache{
+		userAgent: userAgent,
+		agent:     strings.ToLower(agent),
+		client:    client,
+		now:       now,
+		entries:   make(map[string]*robotsEntry),
+	}
+}
+
+// check returns error if raw URL is disallowed by robots.txt of its host.
+// URLs of schemes other than HTTP and HTTPS are not checked.
+func (c *robotsCache) check(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return nil
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	rules, err := c.rules(ctx, u)
+	if err != nil {
+		return err
+	}
+
+	if !rules.allowed(path) {
+		return errRobotsDisallowed
+	}
+
+	return nil
+}
+
+// rules returns rules of robots.txt of u's host, fetching it if needed.
+// Concurrent callers wait for single fetch. Since robots.txt is shared
+// by batches, it is fetched even if ctx is done.
+func (c *robotsCache) rules(ctx context.Context, u *url.URL) (robotsRules, error) {
+	origin := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	entry, ok := c.entries[origin]
+	if !ok || c.now().After(entry.expires) {
+		entry = &robotsEntry{
+			ready: make(chan struct{}),
+			// entry is not expired while it is being fetched
+			expires: c.now().Add(robotsTimeout),
+		}
+		c.entries[origin] = entry
+
+		go func() {
+			rules, reachable := c.fetch(origin)
+
+			ttl := robotsTTL
+			if !reachable {
+				ttl = unreachableRobotsTTL
+			}
+
+			c.mu.Lock()
+			entry.rules = rules
+			entry.expires = c.now().Add(ttl)
+			c.mu.Unlock()
+
+			close(entry.ready)
+		}()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+		return entry.rules, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch fetches robots.txt of origin and returns its rules, reporting
+// whether it is reachable. Unavailable robots.txt, e.g. missing one,
+// allows everything, and unreachable one disallows everything.
+func (c *robotsCache) fetch(origin string) (robotsRules, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), robotsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return disallowAll, false
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.client(req.URL.Hostname()).Do(req)
+	if err != nil {
+		return disallowAll, false
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return disallowAll, false
+	case resp.StatusCode >= 300:
+		return nil, true
+	}
+
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsSize), c.agent), true
+}
+
+// checkRobots fails result if URL of target is disallowed by robots.txt.
+// It reports whether target can be fetched.
+func (h *Handler) checkRobots(b *batch, t target, result *Result) bool {
+	if err := h.robots.check(b.ctx, t.fetchURL()); err != nil {
+		h.fail(b, result, fmt.Errorf("%s: %w", result.URL, err))
+
+		return false
+	}
+
+	return true
+}
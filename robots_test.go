@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testRobots = `
+# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public$
+
+User-agent: MyBot
+User-agent: OtherBot
+Disallow: /*.pdf$
+Disallow: /search
+Allow: /search/about
+`
+
+func TestRobotsRules(t *testing.T) {
+	cases := []struct {
+		agent   string
+		path    string
+		allowed bool
+	}{
+		{"otherbot", "/private/page", true},
+		{"otherbot", "/doc.pdf", false},
+		{"mybot", "/doc.pdf?download=1", true},
+		{"mybot", "/dir/doc.pdf", false},
+		{"mybot", "/search?q=1", false},
+		{"mybot", "/search/about", true},
+		{"mybot", "/", true},
+		{"unknown", "/private/page", false},
+		{"unknown", "/private/public", true},
+		{"unknown", "/private/public/page", false},
+		{"unknown", "/search", true},
+	}
+
+	for _, c := range cases {
+		rules := parseRobots(strings.NewReader(testRobots), c.agent)
+
+		if allowed := rules.allowed(c.path); allowed != c.allowed {
+			t.Errorf("%s %s: expected allowed %t, got %t", c.agent, c.path, c.allowed, allowed)
+		}
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/", "/anything", true},
+		{"/a", "/b", false},
+		{"/a*c", "/abbbc", true},
+		{"/a*c$", "/abcd", false},
+		{"/a*c$", "/abcdc", true},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+		{"*.gif$", "/img/x.gif", true},
+	}
+
+	for _, c := range cases {
+		if match := robotsMatch(c.pattern, c.path); match != c.match {
+			t.Errorf("%q %q: expected match %t, got %t", c.pattern, c.path, c.match, match)
+		}
+	}
+}
+
+func TestHandlerRobotsPolicy(t *testing.T) {
+	var robotsFetches int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddInt32(&robotsFetches, 1)
+
+			if ua := r.Header.Get("User-Agent"); ua != "MyBot/1.0" {
+				t.Errorf("unexpected user agent %q", ua)
+			}
+
+			w.Write([]byte(testRobots))
+
+			return
+		}
+
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithRobotsPolicy("MyBot/1.0")))
+	defer s.Close()
+
+	urls := []string{server.URL + "/page", server.URL + "/search?q=1", server.URL + "/doc.pdf"}
+
+	results := fetchResults(t, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	for _, r := range results {
+		if r.URL == server.URL+"/page" {
+			if r.Error != "" || r.Length != 5 {
+				t.Errorf("unexpected result %+v", r)
+			}
+
+			continue
+		}
+
+		if r.ErrorKind != ErrorKindPolicy || !strings.Contains(r.Error, "robots.txt") {
+			t.Errorf("expected %s to be skipped, got %+v", r.URL, r)
+		}
+	}
+
+	if n := atomic.LoadInt32(&robotsFetches); n != 1 {
+		t.Errorf("expected robots.txt fetched once, got %d", n)
+	}
+}
+
+func TestHandlerRobotsPolicyUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithRobotsPolicy("MyBot")))
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, strings.NewReader(server.URL+"/page"))
+	if len(results) != 1 || results[0].ErrorKind != ErrorKindPolicy {
+		t.Errorf("expected URL to be skipped, got %+v", results)
+	}
+}
@@ -0,0 +1,401 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// minScheduleInterval is minimum interval of scheduled batches.
+const minScheduleInterval = time.Second
+
+// Limits of batches scheduled by admin endpoint.
+const (
+	// maxAdminSchedules is maximum number of scheduled batches.
+	maxAdminSchedules = 100
+	// maxAdminScheduleURLs is maximum number of URLs of scheduled batch.
+	maxAdminScheduleURLs = 1000
+)
+
+// Errors of invalid schedules.
+var (
+	errScheduleName     = errors.New("schedule must have name")
+	errScheduleURLs     = errors.New("schedule must have URLs")
+	errScheduleInterval = errors.New("interval of schedule must be at least " + minScheduleInterval.String())
+	errTooManySchedules = fmt.Errorf("number of scheduled batches exceeds %d", maxAdminSchedules)
+	errScheduleTooLarge = fmt.Errorf("number of URLs of scheduled batch exceeds %d", maxAdminScheduleURLs)
+)
+
+// ErrHandlerClosed is returned by Schedule once Handler is closed.
+var ErrHandlerClosed = errors.New("handler is closed")
+
+// Schedule describes batch of URLs fetched periodically.
+type Schedule struct {
+	Name string
+	URLs []string
+	// Interval is time between starts of runs.
+	Interval time.Duration
+}
+
+// ScheduledRun contains results of single run of scheduled batch.
+type ScheduledRun struct {
+	// ID identifies run, e.g. in JobStore.
+	ID string `json:"id"`
+	// Schedule is name of scheduled batch.
+	Schedule string    `json:"schedule"`
+	Start    time.Time `json:"start"`
+	Duration string    `json:"duration"`
+	Results  []Result  `json:"results"`
+}
+
+// ScheduleInfo describes scheduled batch listed by admin endpoint.
+type ScheduleInfo struct {
+	Name     string   `json:"name"`
+	URLs     []string `json:"urls"`
+	Interval string   `json:"interval"`
+	// LastRun is start time of the last completed run, if any.
+	LastRun *time.Time `json:"last_run,omitempty"`
+}
+
+// scheduleEntry is registered schedule along with its latest run.
+type scheduleEntry struct {
+	schedule Schedule
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu   sync.Mutex
+	last *ScheduledRun
+	// running is run in progress, if any.
+	running *ScheduledRun
+	// changed is closed and replaced once result
+	// is added to running run, or run is completed.
+	changed chan struct{}
+}
+
+// notify wakes up requests waiting for results
+// of running run. It must be called with mu held.
+func (e *scheduleEntry) notify() {
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// latest returns the latest completed run, if any.
+func (e *scheduleEntry) latest() *ScheduledRun {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.last
+}
+
+// scheduleRegistry keeps scheduled batches.
+type scheduleRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*scheduleEntry
+	// closed is set once Handler is closed, so no batches are scheduled.
+	closed bool
+	// wg waits for goroutines running scheduled batches.
+	wg sync.WaitGroup
+}
+
+// newScheduleRegistry creates new scheduleRegistry.
+func newScheduleRegistry() *scheduleRegistry {
+	return &scheduleRegistry{
+		entries: make(map[string]*scheduleEntry),
+	}
+}
+
+// get returns schedule registered under name.
+func (r *scheduleRegistry) get(name string) (*scheduleEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[name]
+
+	return e, ok
+}
+
+// list returns registered schedules ordered by names.
+func (r *scheduleRegistry) list() []ScheduleInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	infos := make([]ScheduleInfo, 0, len(r.entries))
+	for _, e := range r.entries {
+		info := ScheduleInfo{
+			Name:     e.schedule.Name,
+			URLs:     e.schedule.URLs,
+			Interval: e.schedule.Interval.String(),
+		}
+		if last := e.latest(); last != nil {
+			info.LastRun = &last.Start
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
+
+// remove stops schedule registered under name and reports whether it is found.
+func (r *scheduleRegistry) remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[name]
+	if ok {
+		e.cancel()
+		delete(r.entries, name)
+	}
+
+	return ok
+}
+
+// add registers schedule, replacing one with the same name, unless
+// registry is closed or limit of schedules, if positive, is reached.
+// Caller must run schedule and call wg.Done once it is stopped.
+func (r *scheduleRegistry) add(e *scheduleEntry, limit int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, replaced := r.entries[e.schedule.Name]
+
+	switch {
+	case r.closed:
+		return ErrHandlerClosed
+	case limit > 0 && !replaced && len(r.entries) >= limit:
+		return errTooManySchedules
+	}
+
+	if replaced {
+		old.cancel()
+	}
+	r.entries[e.schedule.Name] = e
+	r.wg.Add(1)
+
+	return nil
+}
+
+// close stops all schedules and waits until their running batches
+// are stopped. Afterwards, no batches can be scheduled.
+func (r *scheduleRegistry) close() {
+	r.mu.Lock()
+	r.closed = true
+	for name, e := range r.entries {
+		e.cancel()
+		delete(r.entries, name)
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+}
+
+// Schedule registers batch fetched right away and then every interval until
+// it is unscheduled or Handler is closed. Schedule with the same name is
+// replaced. Scheduled batches are not subject to limits of incoming
+// requests, but their fetches are subject to limits of outgoing ones.
+// Completed runs are saved to JobStore, see WithJobStore, and results
+// of the latest one are also kept in memory, see LatestRun.
+// Once Handler is closed, ErrHandlerClosed is returned.
+func (h *Handler) Schedule(s Schedule) error {
+	return h.schedule(s, 0)
+}
+
+// schedule registers batch unless limit of schedules, if positive, is reached.
+func (h *Handler) schedule(s Schedule, limit int) error {
+	switch {
+	case s.Name == "":
+		return errScheduleName
+	case len(s.URLs) == 0:
+		return errScheduleURLs
+	case s.Interval < minScheduleInterval:
+		return errScheduleInterval
+	}
+
+	e := &scheduleEntry{
+		schedule: s,
+		changed:  make(chan struct{}),
+	}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	if err := h.schedules.add(e, limit); err != nil {
+		e.cancel()
+
+		return err
+	}
+
+	go h.runSchedule(e)
+
+	return nil
+}
+
+// Unschedule stops scheduled batch and reports whether it is found.
+// Its running fetches are canceled.
+func (h *Handler) Unschedule(name string) bool {
+	return h.schedules.remove(name)
+}
+
+// LatestRun returns results of the latest completed run of scheduled batch.
+// It reports false if batch is not scheduled or has not completed any run yet.
+func (h *Handler) LatestRun(name string) (*ScheduledRun, bool) {
+	e, ok := h.schedules.get(name)
+	if !ok {
+		return nil, false
+	}
+
+	last := e.latest()
+
+	return last, last != nil
+}
+
+// runSchedule runs scheduled batch every interval until it is stopped.
+func (h *Handler) runSchedule(e *scheduleEntry) {
+	defer h.schedules.wg.Done()
+
+	ticker := time.NewTicker(e.schedule.Interval)
+	defer ticker.Stop()
+
+	for {
+		h.runScheduled(e)
+
+		select {
+		case <-ticker.C:
+		case <-e.ctx.Done():
+			return
+		}
+	}
+}
+
+// runScheduled fetches URLs of scheduled batch once and records its results,
+// saving them to JobStore. Runs interrupted by stopping schedule are not recorded.
+func (h *Handler) runScheduled(e *scheduleEntry) {
+	b, err := h.internalBatch(e.ctx, "schedule "+e.schedule.Name, e.schedule.URLs)
+	if err != nil {
+		h.logger.Printf("schedule %s: %s", e.schedule.Name, err)
+
+		return
+	}
+	defer b.stop()
+	defer b.spool.close()
+
+	b.ordered = true
+
+	if h.running != nil {
+		h.running.add(b)
+		defer h.running.remove(b)
+	}
+
+	run := &ScheduledRun{
+		ID:       newRunID(),
+		Schedule: e.schedule.Name,
+		Start:    h.now(),
+		Results:  make([]Result, 0, len(b.targets)),
+	}
+
+	e.mu.Lock()
+	e.running = run
+	e.mu.Unlock()
+
+	for result := range inOrder(b, h.fetch(b)) {
+		e.mu.Lock()
+		run.Results = append(run.Results, *result)
+		e.notify()
+		e.mu.Unlock()
+	}
+
+	e.mu.Lock()
+	run.Duration = h.since(run.Start).Round(time.Millisecond).String()
+	e.mu.Unlock()
+
+	// run is saved before it is completed, so the latest
+	// run can be always found in JobStore by its ID
+	completed := e.ctx.Err() == nil
+	if completed {
+		if err := h.jobStore.SaveRun(context.Background(), run); err != nil {
+			h.logger.Printf("schedule %s: saving run %s: %s", e.schedule.Name, run.ID, err)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.running = nil
+	if completed {
+		e.last = run
+	}
+	e.notify()
+}
+
+// ResultPage is page of results of scheduled batch's run.
+type ResultPage struct {
+	// Start is start time of run, so pages of different runs can be told apart.
+	Start time.Time `json:"start"`
+	// Done reports whether run is completed, so no more results are expected.
+	Done bool `json:"done"`
+	// Total is number of results available so far.
+	Total   int      `json:"total"`
+	Results []Result `json:"results"`
+	// Next is offset of the next page.
+	Next int `json:"next"`
+}
+
+// page returns up to limit results of the running run of scheduled batch,
+// or of the latest completed one, starting at offset. If fewer than min
+// results following offset are available yet, it waits for them until run
+// is completed or ctx is done. It reports false if there is no run yet.
+func (e *scheduleEntry) page(ctx context.Context, offset, limit, min int) (*ResultPage, bool) {
+	for {
+		e.mu.Lock()
+
+		run, done := e.running, false
+		if run == nil {
+			run, done = e.last, true
+		}
+
+		waiting := ctx.Err() == nil && min > 0 && (run == nil || !done && len(run.Results)-offset < min)
+		if !waiting {
+			var page *ResultPage
+			if run != nil {
+				page = newResultPage(run, done, offset, limit)
+			}
+			e.mu.Unlock()
+
+			return page, page != nil
+		}
+
+		changed := e.changed
+		e.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// newResultPage returns page of up to limit results of run starting at offset.
+func newResultPage(run *ScheduledRun, done bool, offset, limit int) *ResultPage {
+	total := len(run.Results)
+	if offset > total {
+		offset = total
+	}
+
+	end := total
+	if limit > 0 && limit < end-offset {
+		end = offset + limit
+	}
+
+	return &ResultPage{
+		Start:   run.Start,
+		Done:    done,
+		Total:   total,
+		Results: append([]Result{}, run.Results[offset:end]...),
+		Next:    end,
+	}
+}
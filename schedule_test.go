@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerSchedule(t *testing.T) {
+	target := createServer(0)
+	defer target.Close()
+
+	h := NewHandler()
+	defer h.Close()
+
+	if err := h.Schedule(Schedule{Name: "fast", URLs: []string{"http://example.com"}, Interval: time.Millisecond}); err == nil {
+		t.Error("expected error of too short interval")
+	}
+
+	urls := []string{getUrl(target.URL, 10, 0), getUrl(target.URL, 20, 0)}
+	if err := h.Schedule(Schedule{Name: "monitor", URLs: urls, Interval: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	var run *ScheduledRun
+	for i := 0; i < 50 && run == nil; i++ {
+		time.Sleep(time.Millisecond * 10)
+		run, _ = h.LatestRun("monitor")
+	}
+
+	if run == nil {
+		t.Fatal("scheduled batch is not run")
+	}
+	if len(run.Results) != 2 || run.Results[0].Length != 10 || run.Results[1].Length != 20 {
+		t.Errorf("unexpected results %+v", run.Results)
+	}
+
+	if !h.Unschedule("monitor") {
+		t.Error("schedule is not found")
+	}
+	if _, ok := h.LatestRun("monitor"); ok {
+		t.Error("unscheduled batch is found")
+	}
+}
+
+func TestHandlerScheduleClose(t *testing.T) {
+	target := createServer(0)
+	defer target.Close()
+
+	h := NewHandler(WithWorkerPool(1))
+
+	urls := make([]string, 50)
+	for i := range urls {
+		urls[i] = getUrl(target.URL, 10, time.Millisecond*10)
+	}
+	if err := h.Schedule(Schedule{Name: "monitor", URLs: urls, Interval: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Schedule(Schedule{Name: "late", URLs: urls, Interval: time.Second}); err != ErrHandlerClosed {
+		t.Errorf("expected %q, got %v", ErrHandlerClosed, err)
+	}
+}
+
+func TestAdminSchedules(t *testing.T) {
+	target := createServer(0)
+	defer target.Close()
+
+	h := NewHandler(WithAdmin("/admin", allowAdmin))
+	defer h.Close()
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	body := `{"name": "monitor", "urls": ["` + getUrl(target.URL, 10, 0) + `"], "interval": "1m"}`
+
+	resp, err := http.Post(s.URL+"/admin/schedules", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(s.URL + "/admin/schedules")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var infos []ScheduleInfo
+	err = json.NewDecoder(resp.Body).Decode(&infos)
+	resp.Body.Close()
+
+	if err != nil || len(infos) != 1 || infos[0].Name != "monitor" || infos[0].Interval != "1m0s" {
+		t.Errorf("unexpected schedules %+v: %v", infos, err)
+	}
+
+	var run ScheduledRun
+	for i := 0; i < 50 && len(run.Results) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+
+		resp, err = http.Get(s.URL + "/admin/schedules/monitor")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			json.NewDecoder(resp.Body).Decode(&run)
+		}
+		resp.Body.Close()
+	}
+
+	if len(run.Results) != 1 || run.Results[0].Length != 10 {
+		t.Errorf("unexpected run %+v", run)
+	}
+
+	resp, err = http.Get(s.URL + "/admin/schedules/monitor/runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	err = json.NewDecoder(resp.Body).Decode(&ids)
+	resp.Body.Close()
+
+	if err != nil || len(ids) != 1 || ids[0] != run.ID {
+		t.Errorf("unexpected runs %q: %v", ids, err)
+	}
+
+	resp, err = http.Get(s.URL + "/admin/runs/" + run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored ScheduledRun
+	err = json.NewDecoder(resp.Body).Decode(&stored)
+	resp.Body.Close()
+
+	if err != nil || stored.ID != run.ID || stored.Schedule != "monitor" || len(stored.Results) != 1 {
+		t.Errorf("unexpected stored run %+v: %v", stored, err)
+	}
+
+	resp, err = http.Get(s.URL + "/admin/runs/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, s.URL+"/admin/schedules/monitor", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(s.URL + "/admin/schedules/monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminScheduleResults(t *testing.T) {
+	target := createServer(0)
+	defer target.Close()
+
+	h := NewHandler(WithAdmin("/admin", allowAdmin), WithSynchronousFetching())
+	defer h.Close()
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	getPage := func(query string) *ResultPage {
+		t.Helper()
+
+		resp, err := http.Get(s.URL + "/admin/schedules/monitor/results?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+
+		var page ResultPage
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+
+		return &page
+	}
+
+	resp, err := http.Get(s.URL + "/admin/schedules/missing/results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", resp.StatusCode)
+	}
+
+	urls := []string{
+		getUrl(target.URL, 10, 0),
+		getUrl(target.URL, 20, 0),
+		getUrl(target.URL, 30, time.Millisecond*200),
+	}
+	if err := h.Schedule(Schedule{Name: "monitor", URLs: urls, Interval: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	// long poll waits for the first two results
+	page := getPage("wait=2&timeout=5s")
+	if page == nil || page.Total < 2 || len(page.Results) < 2 || page.Results[1].Length != 20 {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	page = getPage("offset=2&wait=1&timeout=5s")
+	if page == nil || len(page.Results) != 1 || page.Results[0].Length != 30 || page.Next != 3 {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	// waiting for more results than run has ends once it is completed
+	page = getPage("offset=1&limit=1&wait=10&timeout=5s")
+	if page == nil || !page.Done || page.Total != 3 || len(page.Results) != 1 || page.Results[0].Length != 20 || page.Next != 2 {
+		t.Errorf("unexpected page %+v", page)
+	}
+
+	for _, query := range []string{"limit=10001", "limit=9223372036854775807", "offset=-1"} {
+		resp, err := http.Get(s.URL + "/admin/schedules/monitor/results?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestNewResultPage(t *testing.T) {
+	run := &ScheduledRun{Results: make([]Result, 3)}
+
+	page := newResultPage(run, true, 1, math.MaxInt)
+	if len(page.Results) != 2 || page.Next != 3 {
+		t.Errorf("unexpected page %+v", page)
+	}
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// priorityHeader is request header setting priority of batch's fetches.
+// Supported values are "high", "normal" and "low".
+const priorityHeader = "X-Priority"
+
+// priority defines order batches get fetch slots in.
+type priority int
+
+const (
+	priorityLow priority = iota
+	priorityNormal
+	priorityHigh
+
+	priorities = 3
+)
+
+// flowKey returns key of scheduler's flow of request's fetches.
+// If tenants are configured, flows are per tenant, otherwise
+// each incoming request has its own flow.
+func (h *Handler) flowKey(request *http.Request) string {
+	if h.tenants != nil {
+		return "tenant:" + request.Header.Get(apiKeyHeader)
+	}
+
+	return "batch:" + strconv.FormatUint(atomic.AddUint64(&h.batches, 1), 10)
+}
+
+// parsePriority parses priority header's value.
+func parsePriority(value string) (priority, error) {
+	switch strings.ToLower(value) {
+	case "high":
+		return priorityHigh, nil
+	case "normal", "":
+		return priorityNormal, nil
+	case "low":
+		return priorityLow, nil
+	}
+
+	return priorityNormal, fmt.Errorf("unknown priority %q", value)
+}
+
+// slotWaiter is fetch waiting for free slot.
+type slotWaiter struct {
+	ready chan struct{}
+}
+
+// flow is queue of fetches of single batch or tenant.
+type flow struct {
+	key     string
+	waiters []*slotWaiter
+}
+
+// flowQueue is round-robin queue of flows of single priority.
+type flowQueue struct {
+	flows []*flow
+	index map[string]*flow
+}
+
+// push adds waiter to the end of flow of key.
+func (q *flowQueue) push(key string, w *slotWaiter) {
+	f, ok := q.index[key]
+	if !ok {
+		if q.index == nil {
+			q.index = make(map[string]*flow)
+		}
+
+		f = &flow{key: key}
+		q.index[key] = f
+		q.flows = append(q.flows, f)
+	}
+
+	f.waiters = append(f.waiters, w)
+}
+
+// pop removes the first waiter of the first flow, and moves
+// flow to the end of queue, so flows take turns.
+func (q *flowQueue) pop() *slotWaiter {
+	if len(q.flows) == 0 {
+		return nil
+	}
+
+	f := q.flows[0]
+	w := f.waiters[0]
+	f.waiters = f.waiters[1:]
+
+	q.flows = q.flows[1:]
+	if len(f.waiters) == 0 {
+		delete(q.index, f.key)
+	} else {
+		q.flows = append(q.flows, f)
+	}
+
+	return w
+}
+
+// remove removes waiter from flow of key.
+// It reports whether waiter has been found.
+func (q *flowQueue) remove(key string, w *slotWaiter) bool {
+	f, ok := q.index[key]
+	if !ok {
+		return false
+	}
+
+	for i, fw := range f.waiters {
+		if fw != w {
+			continue
+		}
+
+		f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+		if len(f.waiters) == 0 {
+			delete(q.index, key)
+
+			for j, qf := range q.flows {
+				if qf == f {
+					q.flows = append(q.flows[:j], q.flows[j+1:]...)
+
+					break
+				}
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// scheduler limits number of concurrent fetches. If all slots are taken,
+// fetches wait in queues of their priorities. Freed slots are given to
+// waiters of the highest priority first. Within priority, waiters are
+// grouped in flows, which take turns, and waiters of the same flow are
+// served in order of their arrival.
+type scheduler struct {
+	mu sync.Mutex
+	// free is number of free slots. It is negative
+	// if limit is shrunk while slots are taken.
+	free   int
+	queues [priorities]flowQueue
+}
+
+// newScheduler creates scheduler of n slots.
+func newScheduler(n int) *scheduler {
+	return &scheduler{
+		free: n,
+	}
+}
+
+// acquire takes free slot for fetch of given flow, waiting for it
+// if necessary. It returns ctx's error if ctx is done before slot
+// is taken.
+func (s *scheduler) acquire(ctx context.Context, p priority, key string) error {
+	s.mu.Lock()
+	if s.free > 0 {
+		s.free--
+		s.mu.Unlock()
+
+		return nil
+	}
+
+	w := &slotWaiter{
+		ready: make(chan struct{}),
+	}
+	s.queues[p].push(key, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.queues[p].remove(key, w) {
+		// slot has been given meanwhile, so it is passed further
+		s.next()
+	}
+
+	return ctx.Err()
+}
+
+// release frees slot taken by acquire.
+func (s *scheduler) release() {
+	s.mu.Lock()
+	s.next()
+	s.mu.Unlock()
+}
+
+// resize changes number of slots by delta. Added slots are given
+// to waiters, and removed ones are dropped once they are released.
+func (s *scheduler) resize(delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.free += delta
+	for s.free > 0 && s.wake() {
+		s.free--
+	}
+}
+
+// next gives slot to the next waiter of the highest priority,
+// or makes it free if there are no waiters. If limit has been
+// shrunk, slot is dropped instead. It must be called with mutex held.
+func (s *scheduler) next() {
+	if s.free < 0 {
+		s.free++
+
+		return
+	}
+
+	if !s.wake() {
+		s.free++
+	}
+}
+
+// wake gives slot to the next waiter of the highest priority
+// and reports whether there is one. It must be called with mutex held.
+func (s *scheduler) wake() bool {
+	for p := priorities - 1; p >= 0; p-- {
+		if w := s.queues[p].pop(); w != nil {
+			close(w.ready)
+
+			return true
+		}
+	}
+
+	return false
+}
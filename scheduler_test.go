@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	s := newScheduler(1)
+
+	if err := s.acquire(context.Background(), priorityNormal, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu    sync.Mutex
+		order []priority
+		wg    sync.WaitGroup
+	)
+
+	for _, p := range []priority{priorityLow, priorityNormal, priorityHigh} {
+		wg.Add(1)
+
+		go func(p priority) {
+			defer wg.Done()
+
+			if err := s.acquire(context.Background(), p, ""); err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+
+			s.release()
+		}(p)
+
+		// let waiter be queued
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.release()
+	wg.Wait()
+
+	if len(order) != 3 || order[0] != priorityHigh || order[1] != priorityNormal || order[2] != priorityLow {
+		t.Errorf("unexpected order: %v", order)
+	}
+}
+
+func TestSchedulerCanceled(t *testing.T) {
+	s := newScheduler(1)
+	s.acquire(context.Background(), priorityNormal, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := s.acquire(ctx, priorityHigh, ""); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	s.release()
+
+	// slot is free again
+	if err := s.acquire(context.Background(), priorityLow, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	if p, err := parsePriority("HIGH"); err != nil || p != priorityHigh {
+		t.Errorf("unexpected priority: %v %v", p, err)
+	}
+	if p, err := parsePriority(""); err != nil || p != priorityNormal {
+		t.Errorf("unexpected priority: %v %v", p, err)
+	}
+	if _, err := parsePriority("urgent"); err == nil {
+		t.Error("unknown priority is accepted")
+	}
+}
+
+func TestSchedulerFlows(t *testing.T) {
+	s := newScheduler(1)
+	s.acquire(context.Background(), priorityNormal, "")
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+
+	for _, key := range []string{"a", "a", "a", "b", "b"} {
+		wg.Add(1)
+
+		go func(key string) {
+			defer wg.Done()
+
+			s.acquire(context.Background(), priorityNormal, key)
+
+			mu.Lock()
+			order = append(order, key)
+			mu.Unlock()
+
+			s.release()
+		}(key)
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.release()
+	wg.Wait()
+
+	if got := strings.Join(order, ""); got != "ababa" {
+		t.Errorf("unexpected order: %s", got)
+	}
+}
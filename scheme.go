@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Document is document fetched by SchemeFetcher.
+type Document struct {
+	// Header contains document's metadata, e.g. Content-Type.
+	// If Content-Length is set, it is used as document's length
+	// for HEAD requests.
+	Header http.Header
+	// Body is document's content. It is closed by Handler.
+	Body io.ReadCloser
+}
+
+// SchemeFetcher fetches documents identified by URLs with particular
+// scheme, e.g. file:// or s3://. Fetch is called concurrently.
+// Method is HTTP method of outgoing request; fetchers may return
+// empty body for HEAD method if Content-Length header is set.
+type SchemeFetcher interface {
+	Fetch(ctx context.Context, method string, u *url.URL) (*Document, error)
+}
+
+// SchemeFetcherFunc is an adapter to allow the use of
+// ordinary functions as SchemeFetcher.
+type SchemeFetcherFunc func(ctx context.Context, method string, u *url.URL) (*Document, error)
+
+// Fetch calls f(ctx, method, u).
+func (f SchemeFetcherFunc) Fetch(ctx context.Context, method string, u *url.URL) (*Document, error) {
+	return f(ctx, method, u)
+}
+
+// fetchScheme fetches document using fetcher and represents it as
+// HTTP response, so it is processed the same way as HTTP documents.
+func fetchScheme(f SchemeFetcher, req *http.Request) (*http.Response, error) {
+	doc, err := f.Fetch(req.Context(), req.Method, req.URL)
+	if err != nil {
+		return nil, &url.Error{
+			Op:  req.Method,
+			URL: req.URL.String(),
+			Err: err,
+		}
+	}
+
+	resp := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         req.URL.Scheme,
+		Header:        doc.Header,
+		Body:          doc.Body,
+		ContentLength: -1,
+		Request:       req,
+	}
+
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	if resp.Body == nil {
+		resp.Body = http.NoBody
+	}
+	if n, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		resp.ContentLength = n
+	}
+
+	return resp, nil
+}
+
+// FileFetcher returns SchemeFetcher serving file:// URLs from files
+// located in root directory. URLs pointing outside of root are rejected.
+func FileFetcher(root string) SchemeFetcher {
+	return SchemeFetcherFunc(func(ctx context.Context, method string, u *url.URL) (*Document, error) {
+		name := filepath.Join(root, filepath.FromSlash(filepath.Clean("/"+u.Path)))
+
+		if rel, err := filepath.Rel(root, name); err != nil || strings.HasPrefix(rel, "..") {
+			return nil, errors.New("path is outside of root directory")
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+
+			return nil, err
+		}
+		if info.IsDir() {
+			f.Close()
+
+			return nil, errors.New("path is a directory")
+		}
+
+		header := make(http.Header)
+		header.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+			header.Set("Content-Type", ct)
+		}
+
+		return &Document{
+			Header: header,
+			Body:   f,
+		}, nil
+	})
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandlerFileFetcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.html"), []byte("<html></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(NewHandler(WithSchemeFetcher("file", FileFetcher(dir))))
+	defer s.Close()
+
+	for _, mode := range []string{"body", "head"} {
+		t.Run(mode, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer("file:///a.html", "file:///../a.html", "file:///missing"))
+			req.Header.Set(fetchModeHeader, mode)
+
+			results := doFetchResults(t, req)
+			if len(results) != 3 {
+				t.Fatalf("expected 3 results, got %+v", results)
+			}
+
+			byURL := make(map[string]Result)
+			for _, r := range results {
+				byURL[r.URL] = r
+			}
+
+			for _, url := range []string{"file:///a.html", "file:///../a.html"} {
+				if r := byURL[url]; r.Length != 13 || r.ContentType != "text/html" {
+					t.Errorf("unexpected result: %+v", r)
+				}
+			}
+
+			if r := byURL["file:///missing"]; r.Error == "" {
+				t.Errorf("expected error, got %+v", r)
+			}
+		})
+	}
+}
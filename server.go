@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Default parameters of Server.
+const (
+	defaultListenAddr        = ":8000"
+	defaultReadHeaderTimeout = time.Second * 10
+	defaultIdleTimeout       = time.Minute * 2
+	defaultShutdownTimeout   = time.Second * 30
+)
+
+// ServerTimeouts configures timeouts of Server. Zero values
+// are replaced by defaults, negative ones disable timeouts.
+type ServerTimeouts struct {
+	// ReadHeaderTimeout limits time of reading request headers.
+	// By default, it is 10 seconds.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout limits time of reading whole request.
+	// By default, there is no limit, since bodies may be read
+	// while results are written, see WithChunkedInput.
+	ReadTimeout time.Duration
+	// WriteTimeout limits time of writing response. By default, there is
+	// no limit, since results are streamed while URLs are fetched.
+	WriteTimeout time.Duration
+	// IdleTimeout limits time keep-alive connections wait for
+	// the next request. By default, it is 2 minutes.
+	IdleTimeout time.Duration
+}
+
+// serverTimeout returns timeout d, or def if d is zero. Negative d disables timeout.
+func serverTimeout(d, def time.Duration) time.Duration {
+	switch {
+	case d < 0:
+		return 0
+	case d == 0:
+		return def
+	}
+
+	return d
+}
+
+// Server serves handler over TCP or Unix socket, optionally using TLS,
+// and shuts down gracefully once its context is done.
+type Server struct {
+	*http.Server
+
+	unixSocket      string
+	certFile        string
+	keyFile         string
+	timeouts        ServerTimeouts
+	shutdownTimeout time.Duration
+}
+
+// ServerOption configures Server.
+type ServerOption interface {
+	apply(s *Server)
+}
+
+// NewServer creates Server serving h with timeouts suitable for
+// batch fetching and applies provided options. By default, it
+// listens on TCP port 8000 without TLS.
+func NewServer(h http.Handler, opts ...ServerOption) *Server {
+	s := &Server{
+		Server: &http.Server{
+			Addr:    defaultListenAddr,
+			Handler: h,
+		},
+		shutdownTimeout: defaultShutdownTimeout,
+	}
+
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+
+	s.ReadHeaderTimeout = serverTimeout(s.timeouts.ReadHeaderTimeout, defaultReadHeaderTimeout)
+	s.ReadTimeout = serverTimeout(s.timeouts.ReadTimeout, 0)
+	s.WriteTimeout = serverTimeout(s.timeouts.WriteTimeout, 0)
+	s.IdleTimeout = serverTimeout(s.timeouts.IdleTimeout, defaultIdleTimeout)
+
+	return s
+}
+
+// ListenAndServe listens on Server's address or Unix socket and serves
+// requests until ctx is done, see Serve.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	l, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, l)
+}
+
+// listen creates listener of Server's address or Unix socket.
+// Stale socket file left by previous process is removed.
+func (s *Server) listen() (net.Listener, error) {
+	if s.unixSocket == "" {
+		return net.Listen("tcp", s.Addr)
+	}
+
+	if err := removeStaleSocket(s.unixSocket); err != nil {
+		return nil, err
+	}
+
+	return net.Listen("unix", s.unixSocket)
+}
+
+// removeStaleSocket removes socket file at path unless it is in use.
+// Files other than sockets, and sockets accepting connections, e.g.
+// of another running server, are left as is, so listening fails.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+
+		return fmt.Errorf("socket %s is in use", path)
+	}
+
+	return os.Remove(path)
+}
+
+// Serve serves requests accepted by l until ctx is done. Then it stops
+// accepting new requests, waits until served ones complete, up to
+// shutdown timeout, and closes handler if it implements io.Closer,
+// e.g. *Handler. Requests not completed in time are aborted.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	errc := make(chan error, 1)
+
+	go func() {
+		if s.certFile != "" || s.TLSConfig != nil {
+			errc <- s.Server.ServeTLS(l, s.certFile, s.keyFile)
+		} else {
+			errc <- s.Server.Serve(l)
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	err := s.Shutdown(shutdownCtx)
+	if err != nil {
+		s.Close()
+	}
+	<-errc
+
+	if c, ok := s.Handler.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+type listenAddrOption struct {
+	addr string
+}
+
+// WithListenAddr creates new ServerOption which sets TCP address
+// Server listens on, e.g. "127.0.0.1:8000".
+func WithListenAddr(addr string) ServerOption {
+	return &listenAddrOption{
+		addr: addr,
+	}
+}
+
+func (opt *listenAddrOption) apply(s *Server) {
+	s.Addr = opt.addr
+}
+
+type unixSocketOption struct {
+	path string
+}
+
+// WithUnixSocket creates new ServerOption which makes Server listen
+// on Unix socket at path instead of TCP address. Stale socket left at
+// path by previous process is removed, while other files and sockets
+// in use make listening fail.
+func WithUnixSocket(path string) ServerOption {
+	return &unixSocketOption{
+		path: path,
+	}
+}
+
+func (opt *unixSocketOption) apply(s *Server) {
+	s.unixSocket = opt.path
+}
+
+type serverTLSOption struct {
+	certFile string
+	keyFile  string
+}
+
+// WithServerTLS creates new ServerOption which makes Server serve
+// HTTPS using certificate and private key loaded from files.
+// For other TLS settings, set TLSConfig field of Server.
+func WithServerTLS(certFile, keyFile string) ServerOption {
+	return &serverTLSOption{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
+
+func (opt *serverTLSOption) apply(s *Server) {
+	s.certFile = opt.certFile
+	s.keyFile = opt.keyFile
+}
+
+type serverTimeoutsOption struct {
+	timeouts ServerTimeouts
+}
+
+// WithServerTimeouts creates new ServerOption which sets Server's timeouts.
+func WithServerTimeouts(timeouts ServerTimeouts) ServerOption {
+	return &serverTimeoutsOption{
+		timeouts: timeouts,
+	}
+}
+
+func (opt *serverTimeoutsOption) apply(s *Server) {
+	s.timeouts = opt.timeouts
+}
+
+type shutdownTimeoutOption struct {
+	timeout time.Duration
+}
+
+// WithShutdownTimeout creates new ServerOption which sets time Server waits
+// for served requests to complete during shutdown. By default, it is 30 seconds.
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return &shutdownTimeoutOption{
+		timeout: timeout,
+	}
+}
+
+func (opt *shutdownTimeoutOption) apply(s *Server) {
+	s.shutdownTimeout = opt.timeout
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServerGracefulShutdown(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	h := NewHandler()
+	s := NewServer(h)
+
+	if s.ReadHeaderTimeout != defaultReadHeaderTimeout || s.IdleTimeout != defaultIdleTimeout || s.WriteTimeout != 0 {
+		t.Errorf("unexpected timeouts %s %s %s", s.ReadHeaderTimeout, s.IdleTimeout, s.WriteTimeout)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(ctx, l)
+	}()
+
+	done := make(chan []Result)
+	go func() {
+		done <- fetchResults(t, "http://"+l.Addr().String(), strings.NewReader(getUrl(server.URL, 10, time.Millisecond*200)))
+	}()
+
+	time.Sleep(time.Millisecond * 50)
+	cancel()
+
+	if results := <-done; len(results) != 1 || results[0].Length != 10 {
+		t.Errorf("expected in-flight request completed, got %+v", results)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("server is not shut down")
+	}
+
+	if atomic.LoadInt32(&h.closed) == 0 {
+		t.Error("expected handler closed")
+	}
+}
+
+func TestServerUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handler.sock")
+
+	s := NewServer(NewHandler(), WithUnixSocket(path), WithServerTimeouts(ServerTimeouts{
+		ReadHeaderTimeout: -1,
+		WriteTimeout:      time.Minute,
+	}))
+
+	if s.ReadHeaderTimeout != 0 || s.WriteTimeout != time.Minute {
+		t.Errorf("unexpected timeouts %s %s", s.ReadHeaderTimeout, s.WriteTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ListenAndServe(ctx)
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for i := 0; i < 100; i++ {
+		if resp, err = client.Get("http://handler/"); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", resp.StatusCode)
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(file); err == nil {
+		t.Error("expected error for regular file")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("expected regular file kept, got %v", err)
+	}
+
+	active := filepath.Join(dir, "active.sock")
+	l, err := net.Listen("unix", active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := removeStaleSocket(active); err == nil {
+		t.Error("expected error for socket in use")
+	}
+	if _, err := os.Stat(active); err != nil {
+		t.Errorf("expected socket in use kept, got %v", err)
+	}
+
+	stale := filepath.Join(dir, "stale.sock")
+	ul, err := net.ListenUnix("unix", &net.UnixAddr{Name: stale, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ul.SetUnlinkOnClose(false)
+	ul.Close()
+
+	if err := removeStaleSocket(stale); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(stale); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected stale socket removed, got %v", err)
+	}
+
+	if err := removeStaleSocket(filepath.Join(dir, "missing.sock")); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestServerTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	s := NewServer(NewHandler())
+	s.TLSConfig = &tls.Config{
+		Certificates: ts.TLS.Certificates,
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(ctx, l)
+	}()
+
+	resp, err := ts.Client().Get("https://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.TLS == nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected response %s", resp.Status)
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
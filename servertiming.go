@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// serverTimingHeader is response header containing
+// durations of batch's phases, see https://www.w3.org/TR/server-timing/.
+const serverTimingHeader = "Server-Timing"
+
+// serverTiming collects durations of phases of single batch.
+type serverTiming struct {
+	// queue is total time batch's fetches waited for outgoing slots.
+	queue  time.Duration
+	parse  time.Duration
+	fetch  time.Duration
+	encode time.Duration
+}
+
+// waited accounts time batch's fetch waited for outgoing slot.
+func (b *batch) waited(d time.Duration) {
+	atomic.AddInt64(&b.queueWait, int64(d))
+}
+
+// queued returns total time batch's fetches waited for outgoing slots.
+func (b *batch) queued() time.Duration {
+	return time.Duration(atomic.LoadInt64(&b.queueWait))
+}
+
+// write sets Server-Timing header. Encoding phase is included only if
+// it is finished, so if header is sent before response body, encoding
+// phase is omitted. If header is declared as trailer, write must be
+// called after response body is written.
+func (t *serverTiming) write(header http.Header, encoded bool) {
+	metrics := []string{
+		timingMetric("queue", "Waiting for fetch slots", t.queue),
+		timingMetric("parse", "Parsing request", t.parse),
+		timingMetric("fetch", "Fetching documents", t.fetch),
+	}
+	if encoded {
+		metrics = append(metrics, timingMetric("encode", "Encoding results", t.encode))
+	}
+
+	header.Set(serverTimingHeader, strings.Join(metrics, ", "))
+}
+
+// timingMetric formats Server-Timing metric with duration in milliseconds.
+func timingMetric(name, desc string, d time.Duration) string {
+	ms := strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+
+	return name + ";desc=\"" + desc + "\";dur=" + ms
+}
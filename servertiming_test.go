@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerServerTiming(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	cases := []struct {
+		name    string
+		options []Option
+		trailer bool
+		metrics []string
+	}{
+		{"streamed", nil, true, []string{"queue", "parse", "fetch", "encode"}},
+		{"sorted", []Option{WithSortedResults(SortAscending)}, false, []string{"queue", "parse", "fetch"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := httptest.NewServer(NewHandler(c.options...))
+			defer s.Close()
+
+			resp, err := http.Post(s.URL, "text/plain", getRequestBodyBuffer(getUrl(server.URL, 10, time.Millisecond*50)))
+			if err != nil {
+				t.Fatalf("failed to make request: %s", err)
+			}
+			defer resp.Body.Close()
+
+			if _, err := ioutil.ReadAll(resp.Body); err != nil {
+				t.Fatalf("failed to read response: %s", err)
+			}
+
+			header := resp.Header
+			if c.trailer {
+				header = resp.Trailer
+			}
+
+			value := header.Get(serverTimingHeader)
+			metrics := strings.Split(value, ", ")
+			if len(metrics) != len(c.metrics) {
+				t.Fatalf("expected metrics %v, got %q", c.metrics, value)
+			}
+
+			for i, name := range c.metrics {
+				if !strings.HasPrefix(metrics[i], name+";") || !strings.Contains(metrics[i], ";dur=") {
+					t.Errorf("expected metric %s, got %q", name, metrics[i])
+				}
+			}
+
+			dur := metrics[2][strings.LastIndex(metrics[2], "=")+1:]
+			if ms, err := strconv.ParseFloat(dur, 64); err != nil || ms < 50 {
+				t.Errorf("fetch duration is not accounted: %q", value)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// degradedHeader is response header set if batch is
+// degraded by ShedPolicy, see ShedDegrade.
+const degradedHeader = "X-Degraded"
+
+// shedRetryInterval is interval after which ShedPolicy is consulted again
+// on queued request, unless any in-flight request is served earlier.
+const shedRetryInterval = 100 * time.Millisecond
+
+// ShedDecision is decision of ShedPolicy on incoming request.
+type ShedDecision int
+
+const (
+	// ShedAccept admits request as usual.
+	ShedAccept ShedDecision = iota
+	// ShedReject rejects request with 503 Service Unavailable.
+	ShedReject
+	// ShedQueue makes request wait until policy decides otherwise.
+	// Policy is consulted again once any in-flight request is served,
+	// or after a while. If request waits longer than timeout set by
+	// WithShedPolicy, if any, it is rejected.
+	ShedQueue
+	// ShedDegrade admits request, but its URLs are fetched by HEAD
+	// requests, so documents are not downloaded and lengths are
+	// taken from Content-Length headers. Such response has
+	// X-Degraded header set to "head". Requests which can not be
+	// served without documents, e.g. ones with checksums, archives
+	// or passthrough, or with methods other than GET, are rejected.
+	ShedDegrade
+)
+
+// ShedPolicy decides on incoming requests depending on load of Handler,
+// see WithShedPolicy. It is consulted after requests are authenticated,
+// but before they are admitted by Limiter, so stats do not include
+// request itself. Policy is called concurrently.
+type ShedPolicy interface {
+	Shed(request *http.Request, stats LoadStats) ShedDecision
+}
+
+// ShedPolicyFunc is an adapter to allow the use of ordinary
+// functions as ShedPolicy.
+type ShedPolicyFunc func(request *http.Request, stats LoadStats) ShedDecision
+
+// Shed implements ShedPolicy interface.
+func (f ShedPolicyFunc) Shed(request *http.Request, stats LoadStats) ShedDecision {
+	return f(request, stats)
+}
+
+// shedQueue notifies requests queued by ShedPolicy
+// once any in-flight request is served.
+type shedQueue struct {
+	mu sync.Mutex
+	// released is closed and replaced once in-flight request is served.
+	released chan struct{}
+}
+
+// newShedQueue creates new shedQueue.
+func newShedQueue() *shedQueue {
+	return &shedQueue{
+		released: make(chan struct{}),
+	}
+}
+
+// wait returns channel closed once any in-flight request is served.
+func (q *shedQueue) wait() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.released
+}
+
+// notify wakes up queued requests.
+func (q *shedQueue) notify() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	close(q.released)
+	q.released = make(chan struct{})
+}
+
+// shed consults ShedPolicy on request, waiting while it is queued, and
+// returns final decision, which is either ShedAccept, ShedReject or
+// ShedDegrade. Queued request is rejected once it is canceled or waits
+// longer than timeout.
+func (h *Handler) shed(request *http.Request) ShedDecision {
+	var (
+		queued   bool
+		deadline <-chan time.Time
+	)
+
+	for {
+		// channel is taken before policy is consulted,
+		// so release in between is not missed
+		released := h.shedQueue.wait()
+
+		decision := h.shedPolicy.Shed(request, h.LoadStats())
+		if decision != ShedQueue {
+			return decision
+		}
+
+		if !queued && h.shedTimeout > 0 {
+			timer := time.NewTimer(h.shedTimeout)
+			defer timer.Stop()
+
+			deadline = timer.C
+		}
+		queued = true
+
+		retry := time.NewTimer(shedRetryInterval)
+
+		select {
+		case <-released:
+		case <-retry.C:
+		case <-deadline:
+			retry.Stop()
+
+			return ShedReject
+		case <-request.Context().Done():
+			retry.Stop()
+
+			return ShedReject
+		}
+
+		retry.Stop()
+	}
+}
+
+// degradable reports whether batch can be served by HEAD requests
+// without changing its results other than lengths, see ShedDegrade.
+func (b *batch) degradable(h *Handler) bool {
+	if b.method != http.MethodGet && b.method != http.MethodHead {
+		return false
+	}
+
+	return !b.passthrough && !b.needsBody(h)
+}
+
+// ready reports whether ShedPolicy, if any, would not reject requests.
+// It is consulted with readiness probe request.
+func (h *Handler) ready(request *http.Request) bool {
+	return h.shedPolicy == nil || h.shedPolicy.Shed(request, h.LoadStats()) != ShedReject
+}
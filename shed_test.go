@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerShedPolicy(t *testing.T) {
+	release := make(chan struct{})
+	var heads int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			atomic.AddInt32(&heads, 1)
+		}
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+
+		w.Write([]byte(strings.Repeat("x", 10)))
+	}))
+	defer server.Close()
+
+	// requests of critical clients are queued while another request
+	// is served, batch clients are degraded, and the rest are rejected
+	policy := ShedPolicyFunc(func(r *http.Request, stats LoadStats) ShedDecision {
+		switch {
+		case stats.InFlightRequests == 0:
+			return ShedAccept
+		case r.Header.Get("X-Client") == "critical":
+			return ShedQueue
+		case r.Header.Get("X-Client") == "batch":
+			return ShedDegrade
+		default:
+			return ShedReject
+		}
+	})
+
+	h := NewHandler(WithShedPolicy(policy, time.Second*5))
+
+	s := httptest.NewServer(h.Mux())
+	defer s.Close()
+
+	postBody := func(client, contentType, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(body))
+		req.Header.Set("X-Client", client)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err)
+		}
+
+		return resp
+	}
+
+	post := func(client, url string) *http.Response {
+		return postBody(client, "", url)
+	}
+
+	read := func(resp *http.Response) string {
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read response: %s", err)
+		}
+
+		return string(body)
+	}
+
+	slow := make(chan *http.Response)
+	go func() {
+		slow <- post("", server.URL+"/slow")
+	}()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for h.InFlightRequests() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	resp := post("", server.URL)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected rejected request, got status %d", resp.StatusCode)
+	}
+
+	resp = post("batch", server.URL)
+	body := read(resp)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(degradedHeader) != "head" || body != "10\n" || atomic.LoadInt32(&heads) != 1 {
+		t.Errorf("expected degraded request, got status %d, %s header %q, body %q, %d HEAD requests", resp.StatusCode, degradedHeader, resp.Header.Get(degradedHeader), body, heads)
+	}
+
+	// method set by body does not override degradation
+	resp = postBody("batch", "application/json", `{"urls": ["`+server.URL+`"], "method": "GET"}`)
+	body = read(resp)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(degradedHeader) != "head" || atomic.LoadInt32(&heads) != 2 {
+		t.Errorf("expected degraded request, got status %d, %s header %q, body %q, %d HEAD requests", resp.StatusCode, degradedHeader, resp.Header.Get(degradedHeader), body, heads)
+	}
+
+	// documents are required to compute checksums
+	resp = postBody("batch", "application/json", `{"urls": ["`+server.URL+`"], "checksum": "sha256"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected rejected request, got status %d", resp.StatusCode)
+	}
+
+	ready, err := http.Get(s.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	ready.Body.Close()
+	if ready.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready, got status %d", ready.StatusCode)
+	}
+
+	queued := make(chan *http.Response)
+	go func() {
+		queued <- post("critical", server.URL)
+	}()
+
+	select {
+	case resp := <-queued:
+		resp.Body.Close()
+		t.Fatalf("expected queued request, got status %d", resp.StatusCode)
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	close(release)
+	read(<-slow)
+
+	resp = <-queued
+	if body := read(resp); resp.StatusCode != http.StatusOK || body != "10\n" {
+		t.Errorf("expected queued request served, got status %d, body %q", resp.StatusCode, body)
+	}
+}
+
+func TestHandlerShedPolicyTimeout(t *testing.T) {
+	h := NewHandler(WithShedPolicy(ShedPolicyFunc(func(r *http.Request, stats LoadStats) ShedDecision {
+		return ShedQueue
+	}), time.Millisecond*50))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://example.com")))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", w.Code)
+	}
+}
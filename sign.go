@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signer signs outgoing requests, e.g. by adding
+// Authorization header computed from request's data.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc is function implementing Signer interface.
+type SignerFunc func(req *http.Request) error
+
+// Sign implements Signer interface.
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// hostSigner binds signer to host pattern.
+type hostSigner struct {
+	pattern string
+	signer  Signer
+}
+
+// signerFor returns signer registered for host, or nil if there is no such one.
+func (h *Handler) signerFor(host string) Signer {
+	for _, hs := range h.signers {
+		if matchHost(hs.pattern, host) {
+			return hs.signer
+		}
+	}
+
+	return nil
+}
+
+// hmacSignatureDateHeader is header containing time of HMAC signature.
+const hmacSignatureDateHeader = "X-Signature-Date"
+
+// hmacSigner signs requests with HMAC-SHA256.
+type hmacSigner struct {
+	keyID  string
+	secret []byte
+	now    func() time.Time
+}
+
+// HMACSigner returns Signer which signs requests with HMAC-SHA256 of
+// secret. Signed string consists of request's method, host, path with
+// query and value of X-Signature-Date header set to current time in
+// RFC 3339 format, separated by new line. Signature is passed in header
+// Authorization: HMAC-SHA256 keyId="<keyID>",signature="<base64>".
+func HMACSigner(keyID string, secret []byte) Signer {
+	return &hmacSigner{
+		keyID:  keyID,
+		secret: secret,
+		now:    time.Now,
+	}
+}
+
+// Sign implements Signer interface.
+func (s *hmacSigner) Sign(req *http.Request) error {
+	date := s.now().UTC().Format(time.RFC3339)
+	req.Header.Set(hmacSignatureDateHeader, date)
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.Join([]string{req.Method, req.URL.Host, req.URL.RequestURI(), date}, "\n")))
+
+	req.Header.Set("Authorization", fmt.Sprintf(`HMAC-SHA256 keyId="%s",signature="%s"`, s.keyID, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+
+	return nil
+}
+
+// AWSCredentials are credentials of AWS account.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is token of temporary credentials, if any.
+	SessionToken string
+}
+
+// awsSigner signs requests with AWS Signature Version 4.
+type awsSigner struct {
+	creds   AWSCredentials
+	region  string
+	service string
+	now     func() time.Time
+}
+
+// AWSSigV4Signer returns Signer which signs requests with AWS Signature
+// Version 4, e.g. to fetch objects of private S3 buckets with "s3" service.
+func AWSSigV4Signer(creds AWSCredentials, region, service string) Signer {
+	return &awsSigner{
+		creds:   creds,
+		region:  region,
+		service: service,
+		now:     time.Now,
+	}
+}
+
+// emptyPayloadHash is SHA-256 of empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Sign implements Signer interface.
+func (s *awsSigner) Sign(req *http.Request) error {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.creds.SessionToken)
+	}
+	if s.service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	}
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for key, values := range req.Header {
+		if key = strings.ToLower(key); strings.HasPrefix(key, "x-amz-") {
+			headers[key] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path, err := url.PathUnescape(req.URL.EscapedPath())
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsEscape(path, false),
+		awsQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.region, s.service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + s.creds.SecretAccessKey)
+	for _, part := range []string{date, s.region, s.service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.creds.AccessKeyID, scope, signedHeaders, signature,
+	))
+
+	return nil
+}
+
+// hmacSHA256 returns HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// awsQuery returns canonical query string of request.
+func awsQuery(req *http.Request) string {
+	var params [][2]string
+	for key, values := range req.URL.Query() {
+		for _, value := range values {
+			params = append(params, [2]string{awsEscape(key, true), awsEscape(value, true)})
+		}
+	}
+
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+
+		return params[i][1] < params[j][1]
+	})
+
+	query := make([]string, len(params))
+	for i, param := range params {
+		query[i] = param[0] + "=" + param[1]
+	}
+
+	return strings.Join(query, "&")
+}
+
+// awsEscape escapes s according to AWS rules: all characters except
+// unreserved ones are percent-encoded, and so are slashes if escapeSlash.
+func awsEscape(s string, escapeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~',
+			c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAWSSigV4Signer(t *testing.T) {
+	// test cases of AWS Signature Version 4 test suite
+	cases := map[string]string{
+		"https://example.amazonaws.com/":                             "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		"https://example.amazonaws.com/?Param2=value2&Param1=value1": "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+	}
+
+	for u, signature := range cases {
+		s := AWSSigV4Signer(AWSCredentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		}, "us-east-1", "service").(*awsSigner)
+		s.now = func() time.Time {
+			return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		if err := s.Sign(req); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + signature
+		if auth := req.Header.Get("Authorization"); auth != expected {
+			t.Errorf("%s: unexpected authorization: %s", u, auth)
+		}
+	}
+}
+
+func TestHandlerSigner(t *testing.T) {
+	secret := []byte("secret")
+
+	var valid bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(strings.Join([]string{request.Method, request.Host, request.URL.RequestURI(), request.Header.Get(hmacSignatureDateHeader)}, "\n")))
+
+		expected := `HMAC-SHA256 keyId="key",signature="` + base64.StdEncoding.EncodeToString(mac.Sum(nil)) + `"`
+		valid = request.Header.Get("Authorization") == expected
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(
+		WithSigner("other.example.com", HMACSigner("other", []byte("other"))),
+		WithSigner("127.0.0.1", HMACSigner("key", secret)),
+	))
+	defer s.Close()
+
+	fetchResults(t, s.URL, strings.NewReader(server.URL+"/path?a=1"))
+
+	if !valid {
+		t.Error("request is not signed")
+	}
+}
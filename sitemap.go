@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// sitemapTruncatedHeader is response header set if URLs of sitemaps
+// exceed limit set by WithSitemapExpansion option.
+const sitemapTruncatedHeader = "X-Sitemap-Truncated"
+
+// Limits of sitemap expansion.
+const (
+	// maxSitemapSize is maximum size of uncompressed sitemap.
+	maxSitemapSize = 50 << 20
+	// maxSitemapDepth is maximum nesting of sitemap indexes.
+	maxSitemapDepth = 2
+)
+
+// errSitemapDisabled is returned for requests in sitemap mode
+// unless WithSitemapExpansion option is provided.
+var errSitemapDisabled = errors.New("sitemap expansion is not enabled")
+
+// sitemap is either sitemap listing URLs or sitemap index listing sitemaps.
+type sitemap struct {
+	URLs     []sitemapLocation `xml:"url"`
+	Sitemaps []sitemapLocation `xml:"sitemap"`
+}
+
+// sitemapLocation is entry of sitemap.
+type sitemapLocation struct {
+	Loc string `xml:"loc"`
+}
+
+// expandSitemaps replaces batch's targets, which point to sitemaps or
+// sitemap indexes, by URLs listed in them, up to limit set by
+// WithSitemapExpansion option. It reports whether URLs are truncated.
+func (h *Handler) expandSitemaps(b *batch) (bool, error) {
+	sitemaps := b.targets
+	b.targets = nil
+
+	seen := make(map[string]bool)
+	for _, t := range sitemaps {
+		truncated, err := h.expandSitemap(b, t.URL, 0, seen)
+		if err != nil || truncated {
+			return truncated, err
+		}
+	}
+
+	return false, nil
+}
+
+// expandSitemap appends URLs listed in sitemap at raw URL to batch's
+// targets. Sitemaps listed in sitemap index are expanded recursively.
+func (h *Handler) expandSitemap(b *batch, raw string, depth int, seen map[string]bool) (bool, error) {
+	if seen[raw] {
+		return false, nil
+	}
+	seen[raw] = true
+
+	sm, err := h.fetchSitemap(b, raw)
+	if err != nil {
+		return false, fmt.Errorf("sitemap %s: %w", h.redactor.url(raw), err)
+	}
+
+	for _, loc := range sm.URLs {
+		if len(b.targets) == h.sitemapLimit {
+			return true, nil
+		}
+
+		if u := strings.TrimSpace(loc.Loc); u != "" {
+			b.targets = append(b.targets, target{URL: u})
+		}
+	}
+
+	if len(sm.Sitemaps) != 0 && depth == maxSitemapDepth {
+		return false, fmt.Errorf("sitemap %s: sitemap indexes are nested too deep", h.redactor.url(raw))
+	}
+
+	for _, loc := range sm.Sitemaps {
+		truncated, err := h.expandSitemap(b, strings.TrimSpace(loc.Loc), depth+1, seen)
+		if err != nil || truncated {
+			return truncated, err
+		}
+	}
+
+	return false, nil
+}
+
+// fetchSitemap fetches and parses sitemap at raw URL.
+// Gzip compressed sitemaps are decompressed.
+func (h *Handler) fetchSitemap(b *batch, raw string) (*sitemap, error) {
+	req, err := http.NewRequestWithContext(b.ctx, http.MethodGet, raw, nil)
+	if err != nil {
+		return nil, h.redactor.error(err)
+	}
+
+	for key, values := range h.outboundHeaders {
+		req.Header[key] = append([]string(nil), values...)
+	}
+
+	resp, err := h.clientFor(req.URL.Hostname()).Do(req)
+	if err != nil {
+		return nil, h.redactor.error(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var r io.Reader = bufio.NewReader(resp.Body)
+	if magic, _ := r.(*bufio.Reader).Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+
+		r = gr
+	}
+
+	sm := &sitemap{}
+	if err := xml.NewDecoder(io.LimitReader(r, maxSitemapSize)).Decode(sm); err != nil {
+		return nil, err
+	}
+
+	return sm, nil
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newSitemapServer(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%[1]s/sitemap1.xml</loc></sitemap>
+  <sitemap><loc>%[1]s/sitemap2.xml.gz</loc></sitemap>
+</sitemapindex>`, server.URL)
+		case "/sitemap1.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/a</loc></url>
+  <url><loc> %[1]s/bb </loc></url>
+</urlset>`, server.URL)
+		case "/sitemap2.xml.gz":
+			var buf bytes.Buffer
+
+			gw := gzip.NewWriter(&buf)
+			fmt.Fprintf(gw, `<urlset><url><loc>%s/ccc</loc></url></urlset>`, server.URL)
+			gw.Close()
+
+			w.Write(buf.Bytes())
+		case "/a", "/bb", "/ccc":
+			w.Write([]byte(r.URL.Path[1:]))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return server
+}
+
+func fetchSitemapResults(t *testing.T, url string, body string) (*http.Response, []Result) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(inputModeHeader, "sitemap")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var results []Result
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+
+	return resp, results
+}
+
+func TestHandlerSitemapExpansion(t *testing.T) {
+	server := newSitemapServer(t)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithSitemapExpansion(10)))
+	defer s.Close()
+
+	resp, results := fetchSitemapResults(t, s.URL, server.URL+"/sitemap_index.xml")
+	if resp.Header.Get(sitemapTruncatedHeader) != "" {
+		t.Errorf("unexpected %s header", sitemapTruncatedHeader)
+	}
+
+	var urls []string
+	for _, r := range results {
+		if r.Error != "" || r.Length != len(r.URL)-len(server.URL)-1 {
+			t.Errorf("unexpected result %+v", r)
+		}
+		urls = append(urls, strings.TrimPrefix(r.URL, server.URL))
+	}
+	sort.Strings(urls)
+
+	if expected := "/a /bb /ccc"; strings.Join(urls, " ") != expected {
+		t.Errorf("expected URLs %s, got %s", expected, urls)
+	}
+}
+
+func TestHandlerSitemapExpansionLimit(t *testing.T) {
+	server := newSitemapServer(t)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithSitemapExpansion(2)))
+	defer s.Close()
+
+	resp, results := fetchSitemapResults(t, s.URL, server.URL+"/sitemap_index.xml")
+	if resp.Header.Get(sitemapTruncatedHeader) != "true" {
+		t.Errorf("expected %s header", sitemapTruncatedHeader)
+	}
+	if len(results) != 2 {
+		t.Errorf("expected 2 results, got %+v", results)
+	}
+}
+
+func TestHandlerSitemapExpansionErrors(t *testing.T) {
+	server := newSitemapServer(t)
+	defer server.Close()
+
+	cases := []struct {
+		opts   []Option
+		body   string
+		status int
+	}{
+		{nil, server.URL + "/sitemap1.xml", http.StatusBadRequest},
+		{[]Option{WithSitemapExpansion(10)}, server.URL + "/missing.xml", http.StatusBadGateway},
+		{[]Option{WithSitemapExpansion(10)}, server.URL + "/a", http.StatusBadGateway},
+	}
+
+	for _, c := range cases {
+		s := httptest.NewServer(NewHandler(c.opts...))
+
+		req, err := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(inputModeHeader, "sitemap")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: expected status %d, got %d", c.body, c.status, resp.StatusCode)
+		}
+
+		s.Close()
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// sniffLen is number of bytes used to detect content type,
+// see http.DetectContentType.
+const sniffLen = 512
+
+// prefixWriter keeps first limit bytes written to it.
+type prefixWriter struct {
+	buf   []byte
+	limit int
+}
+
+// Write implements io.Writer interface.
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if room := w.limit - len(w.buf); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+
+		w.buf = append(w.buf, p[:room]...)
+	}
+
+	return len(p), nil
+}
+
+// detectContentType records media type and charset of document in result.
+// Content-Type header is preferred; if it is missing or generic,
+// type is detected by document's prefix. Prefix may be nil if body
+// has not been read.
+func detectContentType(header http.Header, prefix []byte, result *Result) {
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+
+	if (mediaType == "" || mediaType == "application/octet-stream") && len(prefix) != 0 {
+		mediaType, params, _ = mime.ParseMediaType(http.DetectContentType(prefix))
+	}
+
+	result.ContentType = mediaType
+	result.Charset = strings.ToLower(params["charset"])
+
+	if result.Charset == "" && len(prefix) != 0 && strings.HasPrefix(mediaType, "text/") {
+		_, sniffed, _ := mime.ParseMediaType(http.DetectContentType(prefix))
+		result.Charset = sniffed["charset"]
+	}
+}
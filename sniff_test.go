@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	tests := map[string]struct {
+		header      string
+		prefix      string
+		contentType string
+		charset     string
+	}{
+		"header": {
+			header:      "text/html; charset=ISO-8859-1",
+			prefix:      "<html></html>",
+			contentType: "text/html",
+			charset:     "iso-8859-1",
+		},
+		"sniffed": {
+			prefix:      "<!DOCTYPE html><html></html>",
+			contentType: "text/html",
+			charset:     "utf-8",
+		},
+		"generic header": {
+			header:      "application/octet-stream",
+			prefix:      "%PDF-1.4",
+			contentType: "application/pdf",
+		},
+		"header without charset": {
+			header:      "text/plain",
+			prefix:      "hello",
+			contentType: "text/plain",
+			charset:     "utf-8",
+		},
+		"no body": {
+			header:      "image/png",
+			contentType: "image/png",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			header := make(http.Header)
+			if test.header != "" {
+				header.Set("Content-Type", test.header)
+			}
+
+			var prefix []byte
+			if test.prefix != "" {
+				prefix = []byte(test.prefix)
+			}
+
+			var result Result
+			detectContentType(header, prefix, &result)
+
+			if result.ContentType != test.contentType || result.Charset != test.charset {
+				t.Errorf("expected %s/%s, got %s/%s", test.contentType, test.charset, result.ContentType, result.Charset)
+			}
+		})
+	}
+}
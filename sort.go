@@ -0,0 +1,38 @@
+package handler
+
+import "sort"
+
+// SortOrder defines order results are sorted by documents' lengths in.
+type SortOrder string
+
+// Supported sort orders.
+const (
+	// SortNone leaves results unsorted.
+	SortNone SortOrder = ""
+	// SortAscending makes shortest documents written first.
+	SortAscending SortOrder = "asc"
+	// SortDescending makes longest documents written first.
+	SortDescending SortOrder = "desc"
+)
+
+// sortResults sorts results by documents' lengths. Failed results
+// are placed last, in order of their URLs in request. Results of
+// equal lengths keep order of their URLs as well.
+func sortResults(results []*Result, order SortOrder) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+
+		if (a.err == nil) != (b.err == nil) {
+			return a.err == nil
+		}
+		if a.err == nil && a.Length != b.Length {
+			if order == SortDescending {
+				return a.Length > b.Length
+			}
+
+			return a.Length < b.Length
+		}
+
+		return a.index < b.index
+	})
+}
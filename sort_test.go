@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerSortedResults(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithSortedResults(SortDescending)))
+	defer s.Close()
+
+	body := getRequestBodyBuffer(
+		getUrl(server.URL, 20, 0),
+		getUrl(server.URL, 300, 50*time.Millisecond),
+		getUrl(server.URL, 10, 0),
+		getUrl(server.URL, 100, 0),
+	)
+
+	resp, err := http.Post(s.URL, "text/plain", body)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	if got := strings.Fields(string(data)); strings.Join(got, " ") != "300 100 20 10" {
+		t.Errorf("unexpected order: %v", got)
+	}
+}
+
+func TestHandlerSortedResultsPerRequest(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	body := `{"urls": ["` + getUrl(server.URL, 30, 0) + `", "http://127.0.0.1:0", "` + getUrl(server.URL, 10, 0) + `"], "sort": "asc"}`
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	results := doFetchResults(t, req)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+
+	if results[0].Length != 10 || results[1].Length != 30 || results[2].Error == "" {
+		t.Errorf("unexpected order: %+v", results)
+	}
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+)
+
+// spoolEntry locates result spilled to spool's file.
+type spoolEntry struct {
+	offset int64
+	size   int64
+}
+
+// resultSpool holds results buffered by single incoming request, see
+// WithResultSpillover. Results are kept in memory until their total
+// estimated size exceeds limit, and the rest are written to temporary
+// file, while only their stubs are kept in memory. Stubs contain fields
+// results are sorted, filtered and grouped by, including unexported ones,
+// so they can be used in place of results until results are written.
+type resultSpool struct {
+	limit  int64
+	dir    string
+	logger *log.Logger
+
+	mu sync.Mutex
+	// size is estimated size of results kept in memory.
+	size   int64
+	file   *os.File
+	end    int64
+	closed bool
+	// sizes contain estimated sizes of results kept in memory.
+	sizes map[*Result]int64
+}
+
+// newResultSpool creates resultSpool spilling results
+// exceeding limit to temporary file in dir.
+func newResultSpool(limit int64, dir string, logger *log.Logger) *resultSpool {
+	return &resultSpool{
+		limit:  limit,
+		dir:    dir,
+		logger: logger,
+		sizes:  make(map[*Result]int64),
+	}
+}
+
+// put stores result and returns either result itself, if it is kept
+// in memory, or its stub. If spool is nil, result is returned as is.
+func (s *resultSpool) put(r *Result) *Result {
+	if s == nil {
+		return r
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		s.logger.Printf("%s: spilling result: %s", r.URL, err)
+
+		return r
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := int64(len(data))
+	if s.size+size <= s.limit || s.closed {
+		s.size += size
+		s.sizes[r] = size
+
+		return r
+	}
+
+	if s.file == nil {
+		if s.file, err = ioutil.TempFile(s.dir, "results-*.json"); err != nil {
+			s.logger.Printf("spilling results: %s", err)
+			s.closed = true
+
+			return r
+		}
+	}
+
+	if _, err := s.file.WriteAt(data, s.end); err != nil {
+		s.logger.Printf("%s: spilling result: %s", r.URL, err)
+
+		return r
+	}
+
+	stub := &Result{
+		URL:            r.URL,
+		Length:         r.Length,
+		Status:         r.Status,
+		Error:          r.Error,
+		ErrorKind:      r.ErrorKind,
+		Delta:          r.Delta,
+		DuplicateGroup: r.DuplicateGroup,
+		err:            r.err,
+		index:          r.index,
+		duration:       r.duration,
+		contentHash:    r.contentHash,
+		spilled: &spoolEntry{
+			offset: s.end,
+			size:   size,
+		},
+	}
+	s.end += size
+
+	return stub
+}
+
+// get returns result stored by put, reading it from file if it
+// has been spilled. Result is released from spool. Fields which
+// are set after result is stored, i.e. duplicate group, are taken
+// from stub. If result can not be read, e.g. spool is closed,
+// stub is returned.
+func (s *resultSpool) get(r *Result) *Result {
+	if s == nil {
+		return r
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.spilled == nil {
+		s.size -= s.sizes[r]
+		delete(s.sizes, r)
+
+		return r
+	}
+
+	if s.file == nil {
+		// spool is closed, since batch is abandoned
+		return r
+	}
+
+	data := make([]byte, r.spilled.size)
+	if _, err := s.file.ReadAt(data, r.spilled.offset); err != nil {
+		s.logger.Printf("%s: reading spilled result: %s", r.URL, err)
+
+		return r
+	}
+
+	full := &Result{}
+	if err := json.Unmarshal(data, full); err != nil {
+		s.logger.Printf("%s: reading spilled result: %s", r.URL, err)
+
+		return r
+	}
+
+	full.err = r.err
+	full.index = r.index
+	full.duration = r.duration
+	full.contentHash = r.contentHash
+	full.DuplicateGroup = r.DuplicateGroup
+
+	return full
+}
+
+// close removes spool's file, if any. Results
+// stored afterwards are kept in memory.
+func (s *resultSpool) close() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	if s.file == nil {
+		return
+	}
+
+	err := s.file.Close()
+	if rerr := os.Remove(s.file.Name()); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		s.logger.Printf("removing spilled results: %s", err)
+	}
+
+	s.file = nil
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResultSpool(t *testing.T) {
+	dir := t.TempDir()
+	s := newResultSpool(100, dir, log.New(ioutil.Discard, "", 0))
+
+	results := []*Result{
+		{URL: "https://example.com/1", Length: 10, Status: 200},
+		{URL: "https://example.com/2", Length: 20, Status: 200, Links: []string{"https://example.com/3"}, Analysis: Analyses{"title": "Example"}},
+		{URL: "https://example.com/3", Length: 0, index: 2},
+	}
+	results[2].setError(errors.New("connection refused"))
+
+	stored := make([]*Result, len(results))
+	for i, r := range results {
+		stored[i] = s.put(r)
+	}
+
+	if stored[0] != results[0] {
+		t.Error("result within limit is spilled")
+	}
+	if stored[1].spilled == nil || stored[1].Links != nil || stored[1].Length != 20 {
+		t.Errorf("expected stub of spilled result, got %+v", stored[1])
+	}
+	if stored[2].err == nil || stored[2].index != 2 {
+		t.Errorf("unexported fields are not kept in stub: %+v", stored[2])
+	}
+
+	stored[1].DuplicateGroup = 1
+
+	for i, r := range stored {
+		full := s.get(r)
+		results[i].DuplicateGroup = r.DuplicateGroup
+
+		expected, _ := json.Marshal(results[i])
+		actual, _ := json.Marshal(full)
+		if string(expected) != string(actual) {
+			t.Errorf("expected %s, got %s", expected, actual)
+		}
+		if (full.err == nil) != (results[i].err == nil) || full.index != results[i].index {
+			t.Errorf("unexported fields are not restored: %+v", full)
+		}
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected spool file, got %d files", len(files))
+	}
+
+	s.close()
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("spool file is not removed")
+	}
+}
+
+func TestHandlerResultSpillover(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		opt    Option
+		length func(i int) int
+	}{
+		{
+			opt: WithSortedResults(SortDescending),
+			length: func(i int) int {
+				return (9 - i) * 10
+			},
+		},
+		{
+			opt: WithOrderedResults(),
+			length: func(i int) int {
+				return i * 10
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s := httptest.NewServer(NewHandler(test.opt, WithResultSpillover(200, dir)))
+
+		urls := make([]string, 10)
+		for i := range urls {
+			urls[i] = getUrl(server.URL, i*10, 0)
+		}
+
+		results := fetchResults(t, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+		s.Close()
+
+		if len(results) != len(urls) {
+			t.Fatalf("expected %d results, got %+v", len(urls), results)
+		}
+
+		for i, r := range results {
+			if r.Length != test.length(i) || r.Status != 200 || r.FinalURL == "" {
+				t.Errorf("unexpected result %d: %+v", i, r)
+			}
+		}
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("spool files are not removed: %d", len(files))
+	}
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// streamConsumer passes data written to it to function
+// reading from io.Reader in separate goroutine, so documents
+// can be processed while being read without buffering.
+type streamConsumer struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+}
+
+// newStreamConsumer creates new streamConsumer and starts fn.
+// If fn returns before reading all data, the rest is discarded.
+func newStreamConsumer(fn func(r io.Reader)) *streamConsumer {
+	pr, pw := io.Pipe()
+
+	c := &streamConsumer{
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(c.done)
+		// drain the rest of data, so writer never blocks
+		defer io.Copy(ioutil.Discard, pr)
+
+		fn(pr)
+	}()
+
+	return c
+}
+
+// Write implements io.Writer interface.
+func (c *streamConsumer) Write(p []byte) (int, error) {
+	return c.pw.Write(p)
+}
+
+// finish signals end of data and waits until fn returns.
+func (c *streamConsumer) finish() {
+	c.pw.Close()
+	<-c.done
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of batch summary.
+const (
+	fetchedCountHeader  = "X-Fetched-Count"
+	failedCountHeader   = "X-Failed-Count"
+	totalBytesHeader    = "X-Total-Bytes"
+	totalDurationHeader = "X-Total-Duration"
+	timedOutCountHeader = "X-Timed-Out-Count"
+)
+
+// summaryHeaders contains names of all summary headers,
+// which are declared as trailer of streamed responses.
+var summaryHeaders = []string{fetchedCountHeader, failedCountHeader, timedOutCountHeader, totalBytesHeader, totalDurationHeader}
+
+// summary collects statistics of single batch.
+type summary struct {
+	now     func() time.Time
+	start   time.Time
+	fetched int
+	failed  int
+	// timedOut is number of failed results due to timeout.
+	timedOut int
+	bytes    int64
+}
+
+// newSummary creates summary of batch started now by clock.
+func newSummary(now func() time.Time) *summary {
+	return &summary{
+		now:   now,
+		start: now(),
+	}
+}
+
+// add accounts result in summary.
+func (s *summary) add(result *Result) {
+	if result.err != nil {
+		s.failed++
+		if result.ErrorKind == ErrorKindTimeout {
+			s.timedOut++
+		}
+
+		return
+	}
+
+	s.fetched++
+	s.bytes += int64(result.Length)
+}
+
+// statusPolicy reports whether response status
+// depends on results, see WithFailureStatus.
+func (h *Handler) statusPolicy() bool {
+	return h.partialStatus != 0 || h.failureStatus != 0
+}
+
+// status returns response status of batch summarized by s.
+func (h *Handler) status(s *summary) int {
+	switch {
+	case s.failed == 0:
+		return http.StatusOK
+	case s.fetched == 0 && h.failureStatus != 0:
+		return h.failureStatus
+	case s.fetched != 0 && h.partialStatus != 0:
+		return h.partialStatus
+	}
+
+	return http.StatusOK
+}
+
+// write sets summary headers. If headers are declared as trailer,
+// write must be called after response body is written.
+func (s *summary) write(header http.Header) {
+	header.Set(fetchedCountHeader, strconv.Itoa(s.fetched))
+	header.Set(failedCountHeader, strconv.Itoa(s.failed))
+	header.Set(timedOutCountHeader, strconv.Itoa(s.timedOut))
+	header.Set(totalBytesHeader, strconv.FormatInt(s.bytes, 10))
+	header.Set(totalDurationHeader, s.now().Sub(s.start).Round(time.Millisecond).String())
+}
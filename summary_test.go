@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerSummaryTrailer(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler())
+	defer s.Close()
+
+	body := getRequestBodyBuffer(getUrl(server.URL, 10, 0), getUrl(server.URL, 20, 0), "http://127.0.0.1:0")
+
+	resp, err := http.Post(s.URL, "text/plain", body)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatalf("failed to read response: %s", err)
+	}
+
+	checkSummary(t, resp.Trailer, "2", "1", "30")
+}
+
+func TestHandlerSummaryHeaders(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithSortedResults(SortAscending)))
+	defer s.Close()
+
+	body := getRequestBodyBuffer(getUrl(server.URL, 10, 0), "http://127.0.0.1:0")
+
+	resp, err := http.Post(s.URL, "text/plain", body)
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	resp.Body.Close()
+
+	checkSummary(t, resp.Header, "1", "1", "10")
+}
+
+func checkSummary(t *testing.T, header http.Header, fetched, failed, bytes string) {
+	t.Helper()
+
+	if got := header.Get(fetchedCountHeader); got != fetched {
+		t.Errorf("expected %s fetched, got %q", fetched, got)
+	}
+	if got := header.Get(failedCountHeader); got != failed {
+		t.Errorf("expected %s failed, got %q", failed, got)
+	}
+	if got := header.Get(totalBytesHeader); got != bytes {
+		t.Errorf("expected %s bytes, got %q", bytes, got)
+	}
+	if _, err := time.ParseDuration(header.Get(totalDurationHeader)); err != nil {
+		t.Errorf("invalid duration: %s", err)
+	}
+}
+
+func TestHandlerFailureStatus(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithFailureStatus(http.StatusMultiStatus, http.StatusBadGateway)))
+	defer s.Close()
+
+	cases := []struct {
+		urls     []string
+		encoding string
+		status   int
+	}{
+		{[]string{getUrl(server.URL, 10, 0)}, "", http.StatusOK},
+		{[]string{getUrl(server.URL, 10, 0), "http://127.0.0.1:0"}, "", http.StatusMultiStatus},
+		{[]string{getUrl(server.URL, 10, 0), "http://127.0.0.1:0"}, "gzip", http.StatusMultiStatus},
+		{[]string{"http://127.0.0.1:0"}, "", http.StatusBadGateway},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(c.urls...))
+		req.Header.Set("Accept-Encoding", c.encoding)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Errorf("%v: expected status %d, got %d", c.urls, c.status, resp.StatusCode)
+		}
+	}
+}
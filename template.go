@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"io"
+	"text/template"
+)
+
+// templateEncoder writes every result, including failed ones, as line
+// rendered by template. Template is executed with *Result, so it can
+// refer to its fields and methods, e.g.:
+//
+//	{{.URL}} {{.Length}} {{.Status}} {{.Duration}} {{.Error}}
+//
+// Record terminator, new line by default, is appended
+// to every rendered result, see TextFormat.
+type templateEncoder struct {
+	tmpl       *template.Template
+	terminator string
+}
+
+func (e *templateEncoder) contentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+func (e *templateEncoder) begin(w io.Writer) error {
+	return nil
+}
+
+func (e *templateEncoder) encode(w io.Writer, r *Result) error {
+	buf := getEncodeBuffer()
+	defer putEncodeBuffer(buf)
+
+	// result is rendered completely before it is written,
+	// so failed template does not leave partial line
+	if err := e.tmpl.Execute(buf, r); err != nil {
+		return err
+	}
+	buf.WriteString(e.terminator)
+
+	_, err := buf.WriteTo(w)
+
+	return err
+}
+
+func (e *templateEncoder) end(w io.Writer) error {
+	return nil
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestHandlerOutputTemplate(t *testing.T) {
+	target := createServer(0)
+	defer target.Close()
+
+	tmpl := template.Must(template.New("result").Parse(
+		`{{.URL}};{{.Length}};{{.Status}};{{if .Error}}FAIL{{else}}OK{{end}};{{if gt .Duration 0}}timed{{end}}`,
+	))
+
+	s := httptest.NewServer(NewHandler(WithOutputTemplate(tmpl), WithOrderedResults()))
+	defer s.Close()
+
+	ok := getUrl(target.URL, 10, 0)
+	failed := "http://127.0.0.1:1"
+
+	resp, err := http.Post(s.URL, "text/plain", strings.NewReader(ok+"\n"+failed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	expected := ok + ";10;200;OK;timed\n" + failed + ";0;0;FAIL;timed\n"
+	if string(body) != expected {
+		t.Errorf("expected %q, got %q", expected, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("expected Content-Type text/plain; charset=utf-8, got %s", ct)
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// apiKeyHeader is request header containing tenant's API key.
+const apiKeyHeader = "X-API-Key"
+
+// Tenant describes limits of requests made with single API key.
+type Tenant struct {
+	// Name identifies tenant in logs and statistics.
+	Name string
+	// MaxRequests limits number of concurrent requests.
+	// If zero, only Handler's limit is applied.
+	MaxRequests int
+	// URLQuota limits number of URLs fetched per QuotaWindow.
+	// If zero, number of URLs is not limited.
+	URLQuota    int
+	QuotaWindow time.Duration
+}
+
+// TenantStats contains tenant's usage statistics.
+type TenantStats struct {
+	// Requests is number of accepted requests.
+	Requests uint64
+	// URLs is number of URLs in accepted requests.
+	URLs uint64
+	// Rejected is number of requests rejected due to tenant's limits.
+	Rejected uint64
+}
+
+// tenant tracks usage of single API key.
+type tenant struct {
+	Tenant
+
+	sem    *semaphore
+	logger *log.Logger
+
+	mu     sync.Mutex
+	window time.Time
+	used   int
+	stats  TenantStats
+}
+
+// newTenant creates tenant whose messages are written to logger
+// prefixed with tenant's name.
+func newTenant(t Tenant, logger *log.Logger) *tenant {
+	tn := &tenant{
+		Tenant: t,
+		logger: log.New(logger.Writer(), logger.Prefix()+"["+t.Name+"] ", logger.Flags()),
+	}
+
+	if t.MaxRequests > 0 {
+		tn.sem = newSemaphore(t.MaxRequests)
+	}
+
+	return tn
+}
+
+// acquire takes one of tenant's concurrent requests slots.
+func (t *tenant) acquire() bool {
+	if t.sem == nil || t.sem.acquire() {
+		return true
+	}
+
+	t.reject()
+
+	return false
+}
+
+// release frees slot taken by acquire.
+func (t *tenant) release() {
+	if t.sem != nil {
+		t.sem.release()
+	}
+}
+
+// reject accounts request rejected due to tenant's limits.
+func (t *tenant) reject() {
+	t.mu.Lock()
+	t.stats.Rejected++
+	t.mu.Unlock()
+}
+
+// take accounts request of n URLs, if it fits tenant's quota.
+// Otherwise, it returns time left until quota is reset.
+func (t *tenant) take(n int) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.URLQuota > 0 {
+		now := time.Now()
+		if now.Sub(t.window) >= t.QuotaWindow {
+			t.window = now
+			t.used = 0
+		}
+
+		if t.used+n > t.URLQuota {
+			t.stats.Rejected++
+
+			return false, t.window.Add(t.QuotaWindow).Sub(now)
+		}
+
+		t.used += n
+	}
+
+	t.stats.Requests++
+	t.stats.URLs += uint64(n)
+
+	return true, 0
+}
+
+// TenantStats returns usage statistics of tenants registered
+// by WithTenants option, keyed by their names.
+func (h *Handler) TenantStats() map[string]TenantStats {
+	stats := make(map[string]TenantStats, len(h.tenants))
+
+	for _, t := range h.tenants {
+		t.mu.Lock()
+		stats[t.Name] = t.stats
+		t.mu.Unlock()
+	}
+
+	return stats
+}
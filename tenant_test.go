@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerTenants(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	h := NewHandler(WithTenants(map[string]Tenant{
+		"key": {Name: "team", URLQuota: 3, QuotaWindow: time.Hour},
+	}))
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	post := func(key string, urls ...string) int {
+		req, _ := http.NewRequest(http.MethodPost, s.URL, getRequestBodyBuffer(urls...))
+		if key != "" {
+			req.Header.Set(apiKeyHeader, key)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err)
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	url := getUrl(server.URL, 10, 0)
+
+	if code := post("", url); code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, code)
+	}
+	if code := post("other", url); code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, code)
+	}
+	if code := post("key", url, url); code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := post("key", url, url); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, code)
+	}
+
+	stats := h.TenantStats()["team"]
+	if stats.Requests != 1 || stats.URLs != 2 || stats.Rejected != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestTenantConcurrency(t *testing.T) {
+	tn := newTenant(Tenant{Name: "team", MaxRequests: 1}, defaultLogger)
+
+	if !tn.acquire() {
+		t.Fatal("first request is rejected")
+	}
+	if tn.acquire() {
+		t.Fatal("concurrent request is accepted")
+	}
+
+	tn.release()
+
+	if !tn.acquire() {
+		t.Fatal("request is rejected after release")
+	}
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HostLimit defines limits of outgoing requests to single host.
+type HostLimit struct {
+	// Rate is maximum number of requests per second.
+	// Zero means no rate limit.
+	Rate float64
+	// Burst is number of requests which can be made at once
+	// without waiting. It is used only if Rate is set.
+	Burst int
+	// Delay is minimum time between starts of requests,
+	// e.g. to be polite to crawled hosts.
+	Delay time.Duration
+	// Bandwidth is maximum number of bytes per second
+	// read from response bodies. Zero means no limit.
+	Bandwidth int64
+}
+
+// hostThrottle applies HostLimit to every host matching pattern separately.
+type hostThrottle struct {
+	pattern string
+	delay   time.Duration
+	limiter *rateLimiter
+	// bandwidth limits bytes read from response bodies, if set.
+	bandwidth *rateLimiter
+	now       func() time.Time
+
+	mu sync.Mutex
+	// next contains times after which the next
+	// request to host can be started.
+	next  map[string]time.Time
+	swept time.Time
+}
+
+// newHostThrottle creates new hostThrottle.
+func newHostThrottle(pattern string, limit HostLimit) *hostThrottle {
+	t := &hostThrottle{
+		pattern: pattern,
+		delay:   limit.Delay,
+		now:     time.Now,
+		next:    make(map[string]time.Time),
+	}
+
+	if limit.Rate > 0 {
+		t.limiter = newRateLimiter(limit.Rate, limit.Burst)
+	}
+	if limit.Bandwidth > 0 {
+		t.bandwidth = newBandwidthLimiter(limit.Bandwidth)
+	}
+
+	return t
+}
+
+// wait waits until request to host is allowed by limits, or ctx is done.
+func (t *hostThrottle) wait(ctx context.Context, host string) error {
+	if t.limiter != nil {
+		if err := t.limiter.wait(ctx, host); err != nil {
+			return err
+		}
+	}
+
+	if t.delay <= 0 {
+		return nil
+	}
+
+	delay := t.reserve(host)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve reserves the earliest start of request to host
+// and returns time left until it.
+func (t *hostThrottle) reserve(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.sweep(now)
+
+	start := now
+	if next, ok := t.next[host]; ok && next.After(now) {
+		start = next
+	}
+	t.next[host] = start.Add(t.delay)
+
+	return start.Sub(now)
+}
+
+// sweep drops hosts which can be requested right away,
+// so dropping them changes nothing. It must be called with mu held.
+func (t *hostThrottle) sweep(now time.Time) {
+	if now.Sub(t.swept) < bucketIdleTTL {
+		return
+	}
+	t.swept = now
+
+	for host, next := range t.next {
+		if !next.After(now) {
+			delete(t.next, host)
+		}
+	}
+}
+
+// throttleTransport delays requests exceeding outgoing rate limits.
+// Requests to hosts with their own limits wait for them first,
+// and then for global limit. Reading of response bodies is
+// delayed if it exceeds bandwidth limits.
+type throttleTransport struct {
+	// hosts contain limits of hosts matching patterns,
+	// the first matching one is applied.
+	hosts []*hostThrottle
+	// global limits aggregate rate of requests, if set.
+	global *rateLimiter
+	// bandwidth limits aggregate bandwidth, if set.
+	bandwidth *rateLimiter
+	next      http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+
+	var matched *hostThrottle
+	for _, ht := range t.hosts {
+		if matchHost(ht.pattern, host) {
+			if err := ht.wait(req.Context(), host); err != nil {
+				return nil, err
+			}
+			matched = ht
+
+			break
+		}
+	}
+
+	if t.global != nil {
+		if err := t.global.wait(req.Context(), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	t.throttleBody(req, resp, matched)
+
+	return resp, nil
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandlerOutboundRateLimit(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(WithOutboundRateLimit(20, 1)))
+	defer s.Close()
+
+	urls := make([]string, 5)
+	for i := range urls {
+		urls[i] = getUrl(server.URL, i, 0)
+	}
+
+	start := time.Now()
+
+	results := fetchResults(t, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+	if len(results) != len(urls) {
+		t.Fatalf("expected %d results, got %+v", len(urls), results)
+	}
+
+	// the first request takes the only token of burst, and the others
+	// wait 50ms each
+	if elapsed := time.Since(start); elapsed < time.Millisecond*190 {
+		t.Errorf("rate limit is not enforced, batch took %s", elapsed)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := newRateLimiter(1, 1)
+
+	if err := l.wait(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	if err := l.wait(ctx, ""); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestHandlerHostLimitDelay(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		starts []time.Time
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		starts = append(starts, time.Now())
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	s := httptest.NewServer(NewHandler(
+		WithHostLimit("example.com", HostLimit{Delay: time.Hour}),
+		WithHostLimit("127.0.0.*", HostLimit{Delay: time.Millisecond * 50}),
+	))
+	defer s.Close()
+
+	urls := make([]string, 3)
+	for i := range urls {
+		urls[i] = getUrl(server.URL, i, 0)
+	}
+
+	results := fetchResults(t, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+	if len(results) != len(urls) {
+		t.Fatalf("expected %d results, got %+v", len(urls), results)
+	}
+
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].Before(starts[j])
+	})
+	for i := 1; i < len(starts); i++ {
+		if d := starts[i].Sub(starts[i-1]); d < time.Millisecond*45 {
+			t.Errorf("requests %d and %d are started %s apart", i-1, i, d)
+		}
+	}
+}
+
+func TestHostThrottleRate(t *testing.T) {
+	ht := newHostThrottle("*", HostLimit{Rate: 1, Burst: 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		for _, host := range []string{"a", "b"} {
+			if err := ht.wait(ctx, host); err != nil {
+				t.Fatalf("request %d to %s is not allowed: %s", i, host, err)
+			}
+		}
+	}
+
+	if err := ht.wait(ctx, "a"); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
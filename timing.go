@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"crypto/tls"
+	"expvar"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// phaseMetrics contains total durations of phases of timed fetches
+// in seconds, along with their count, published at /debug/vars.
+var phaseMetrics = expvar.NewMap("fetch_phases")
+
+// Timing contains durations of phases of single fetch in milliseconds,
+// so latency of origin can be told from latency of network and handler.
+// Phases which did not happen, e.g. DNS lookup of reused connection,
+// have zero durations.
+type Timing struct {
+	DNS     float64 `json:"dns_ms" xml:"dns_ms"`
+	Connect float64 `json:"connect_ms" xml:"connect_ms"`
+	TLS     float64 `json:"tls_ms" xml:"tls_ms"`
+	TTFB    float64 `json:"ttfb_ms" xml:"ttfb_ms"`
+	Read    float64 `json:"read_ms" xml:"read_ms"`
+	Total   float64 `json:"total_ms" xml:"total_ms"`
+}
+
+// fetchTiming records timing of phases of single fetch.
+type fetchTiming struct {
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+	done         time.Time
+}
+
+// newFetchTiming creates fetchTiming of fetch started now.
+func newFetchTiming() *fetchTiming {
+	return &fetchTiming{
+		start: time.Now(),
+	}
+}
+
+// set records current time in field under mutex,
+// since trace hooks may be called concurrently.
+func (t *fetchTiming) set(field *time.Time) {
+	t.mu.Lock()
+	*field = time.Now()
+	t.mu.Unlock()
+}
+
+// trace returns client trace recording timing of fetch.
+func (t *fetchTiming) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.set(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.set(&t.dnsDone)
+		},
+		ConnectStart: func(network, addr string) {
+			t.set(&t.connectStart)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.set(&t.connectDone)
+		},
+		TLSHandshakeStart: func() {
+			t.set(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.set(&t.tlsDone)
+		},
+		GotFirstResponseByte: func() {
+			t.set(&t.firstByte)
+		},
+	}
+}
+
+// finish records end of fetch.
+func (t *fetchTiming) finish() {
+	t.set(&t.done)
+}
+
+// fetchPhases contains durations of phases of single fetch.
+// Phases which did not happen, e.g. DNS lookup of reused
+// connection, have zero durations.
+type fetchPhases struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	TTFB    time.Duration
+	Read    time.Duration
+	Total   time.Duration
+}
+
+// phases returns durations of fetch's phases.
+func (t *fetchTiming) phases() fetchPhases {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return fetchPhases{
+		DNS:     between(t.dnsStart, t.dnsDone),
+		Connect: between(t.connectStart, t.connectDone),
+		TLS:     between(t.tlsStart, t.tlsDone),
+		TTFB:    between(t.start, t.firstByte),
+		Read:    between(t.firstByte, t.done),
+		Total:   between(t.start, t.done),
+	}
+}
+
+// timing returns Timing of phases.
+func (p fetchPhases) timing() *Timing {
+	return &Timing{
+		DNS:     milliseconds(p.DNS),
+		Connect: milliseconds(p.Connect),
+		TLS:     milliseconds(p.TLS),
+		TTFB:    milliseconds(p.TTFB),
+		Read:    milliseconds(p.Read),
+		Total:   milliseconds(p.Total),
+	}
+}
+
+// record adds durations of phases to phaseMetrics.
+func (p fetchPhases) record() {
+	phaseMetrics.Add("count", 1)
+	phaseMetrics.AddFloat("dns_seconds", p.DNS.Seconds())
+	phaseMetrics.AddFloat("connect_seconds", p.Connect.Seconds())
+	phaseMetrics.AddFloat("tls_seconds", p.TLS.Seconds())
+	phaseMetrics.AddFloat("ttfb_seconds", p.TTFB.Seconds())
+	phaseMetrics.AddFloat("read_seconds", p.Read.Seconds())
+	phaseMetrics.AddFloat("total_seconds", p.Total.Seconds())
+}
+
+// milliseconds returns d in milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// between returns duration between from and to,
+// or zero if any of them is not recorded.
+func between(from, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+
+	return to.Sub(from)
+}
+
+// finishTiming records end of fetch. If phase timing is enabled, timing
+// is included into result and metrics. Then it logs warning with timing
+// details if fetch took longer than slow fetch threshold.
+func (h *Handler) finishTiming(b *batch, result *Result, timing *fetchTiming) {
+	timing.finish()
+
+	p := timing.phases()
+	if h.phaseTiming {
+		result.Timing = p.timing()
+		p.record()
+	}
+
+	if h.slowFetchThreshold <= 0 || p.Total < h.slowFetchThreshold {
+		return
+	}
+
+	b.logger.Printf(
+		"warning: slow fetch of %s: total=%s dns=%s connect=%s tls=%s ttfb=%s read=%s",
+		result.URL, p.Total, p.DNS, p.Connect, p.TLS, p.TTFB, p.Read,
+	)
+}
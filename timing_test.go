@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerSlowFetchThreshold(t *testing.T) {
+	target := createServer(time.Second)
+	defer target.Close()
+
+	var buf bytes.Buffer
+
+	h := NewHandler(
+		WithLogger(log.New(&buf, "", 0)),
+		WithSlowFetchThreshold(time.Millisecond*100),
+	)
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	fast := getUrl(target.URL, 10, 0)
+	slow := getUrl(target.URL, 20, time.Millisecond*200)
+
+	results := fetchResults(t, s.URL, getRequestBodyBuffer(fast, slow))
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+
+	logged := buf.String()
+	if !strings.Contains(logged, "warning: slow fetch of "+slow) {
+		t.Errorf("slow fetch is not logged: %s", logged)
+	}
+	if strings.Contains(logged, fast) {
+		t.Errorf("fast fetch is logged: %s", logged)
+	}
+	for _, phase := range []string{"dns=", "connect=", "tls=", "ttfb=", "read="} {
+		if !strings.Contains(logged, phase) {
+			t.Errorf("phase %q is not logged: %s", phase, logged)
+		}
+	}
+}
+
+func TestHandlerPhaseTiming(t *testing.T) {
+	target := createServer(time.Second)
+	defer target.Close()
+
+	s := httptest.NewServer(NewHandler(WithPhaseTiming()))
+	defer s.Close()
+
+	count := phaseMetrics.Get("count")
+
+	results := fetchResults(t, s.URL, getRequestBodyBuffer(getUrl(target.URL, 10, time.Millisecond*50)))
+	if len(results) != 1 || results[0].Timing == nil {
+		t.Fatalf("expected result with timing, got %+v", results)
+	}
+
+	timing := results[0].Timing
+	if timing.TTFB < 50 || timing.Total < timing.TTFB {
+		t.Errorf("unexpected timing %+v", timing)
+	}
+	if timing.Connect <= 0 {
+		t.Errorf("connection is not timed: %+v", timing)
+	}
+
+	if c := phaseMetrics.Get("count"); c == nil || count != nil && c.String() == count.String() {
+		t.Errorf("fetch is not counted in metrics")
+	}
+}
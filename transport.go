@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Settings of transport used by default client.
+const (
+	defaultMaxIdleConns        = 1024
+	defaultMaxIdleConnsPerHost = 64
+	defaultIdleConnTimeout     = time.Second * 90
+	defaultTLSHandshakeTimeout = time.Second * 10
+)
+
+// TransportSettings define connection management of outgoing transport,
+// see http.Transport. Zero fields leave transport's values intact.
+type TransportSettings struct {
+	// MaxIdleConnsPerHost limits number of idle connections kept per host.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits total number of connections per host.
+	MaxConnsPerHost int
+	// IdleConnTimeout is time after which idle connections are closed.
+	IdleConnTimeout time.Duration
+	// TLSHandshakeTimeout limits time of TLS handshake.
+	TLSHandshakeTimeout time.Duration
+}
+
+// newDefaultTransport creates transport tuned for batch fetching.
+// Unlike http.DefaultTransport, which keeps 2 idle connections per host,
+// it keeps enough of them to reuse for many URLs of the same host.
+func newDefaultTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = defaultMaxIdleConns
+	t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	t.IdleConnTimeout = defaultIdleConnTimeout
+	t.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+
+	return t
+}
+
+// DialFunc establishes network connection to addr,
+// see net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// http2Mode defines whether HTTP/2 is used for outgoing requests.
+type http2Mode int
+
+const (
+	// http2Default leaves transport's HTTP/2 behaviour intact.
+	http2Default http2Mode = iota
+	// http2Prefer makes transport attempt HTTP/2 even if
+	// custom TLS configuration or dialer is used.
+	http2Prefer
+	// http2Force makes requests fail unless HTTP/2 is negotiated.
+	http2Force
+)
+
+// hostCertificate binds client certificate to host pattern.
+type hostCertificate struct {
+	pattern string
+	cert    tls.Certificate
+}
+
+// hostRoute binds round tripper to host pattern.
+type hostRoute struct {
+	pattern string
+	rt      http.RoundTripper
+}
+
+// hostTransport routes outgoing requests to round trippers
+// selected by request's host. If no route matches, fallback is used.
+type hostTransport struct {
+	routes   []hostRoute
+	fallback http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *hostTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	host := request.URL.Hostname()
+
+	for _, route := range t.routes {
+		if matchHost(route.pattern, host) {
+			return route.rt.RoundTrip(request)
+		}
+	}
+
+	return t.fallback.RoundTrip(request)
+}
+
+// customTransport reports whether any of options
+// affecting outgoing transport has been provided.
+func (h *Handler) customTransport() bool {
+	return h.dial != nil || h.dnsCache != nil || h.http2 != http2Default || h.tlsConfig != nil || h.clientCert != nil || h.rootCAs != nil || len(h.hostCerts) != 0 || h.transportSettings != nil || h.maxFetchDepth > 0
+}
+
+// configureClient returns copy of client adjusted
+// according to Handler's options.
+func (h *Handler) configureClient(client *http.Client) *http.Client {
+	c := *client
+	c.Transport = h.configureTransport(client.Transport)
+
+	if h.checkRedirect != nil {
+		c.CheckRedirect = h.checkRedirect
+	}
+
+	return &c
+}
+
+// configureTransport returns round tripper adjusted according to Handler's
+// options. If no transport options are provided, or rt is not *http.Transport,
+// rt is returned as is.
+func (h *Handler) configureTransport(rt http.RoundTripper) http.RoundTripper {
+	if h.roundTripper != nil {
+		return h.roundTripper
+	}
+
+	if !h.customTransport() {
+		return rt
+	}
+
+	var transport *http.Transport
+
+	switch t := rt.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		h.logger.Printf("transport options are ignored for custom round tripper %T", t)
+
+		return rt
+	}
+
+	h.configureTLS(transport)
+	h.configureDialer(transport)
+	h.configureConnections(transport)
+
+	if h.http2 != http2Default {
+		transport.ForceAttemptHTTP2 = true
+	}
+	if h.http2 == http2Force {
+		transport.TLSClientConfig.NextProtos = []string{"h2"}
+	}
+
+	if len(h.hostCerts) == 0 {
+		return transport
+	}
+
+	ht := &hostTransport{
+		fallback: transport,
+	}
+
+	for _, hc := range h.hostCerts {
+		t := transport.Clone()
+		t.TLSClientConfig.Certificates = []tls.Certificate{hc.cert}
+
+		ht.routes = append(ht.routes, hostRoute{
+			pattern: hc.pattern,
+			rt:      t,
+		})
+	}
+
+	return ht
+}
+
+// wrapClients replaces outgoing clients, including ones set
+// by WithClientFor option, by their copies whose transports
+// are wrapped by wrap. Wrappers applied later are outer ones.
+func (h *Handler) wrapClients(wrap func(next http.RoundTripper) http.RoundTripper) {
+	h.client = wrapClient(h.client, wrap)
+
+	for i := range h.hostClients {
+		h.hostClients[i].client = wrapClient(h.hostClients[i].client, wrap)
+	}
+}
+
+// wrapClient returns copy of client whose transport is wrapped by wrap.
+func wrapClient(client *http.Client, wrap func(next http.RoundTripper) http.RoundTripper) *http.Client {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	c := *client
+	c.Transport = wrap(next)
+
+	return &c
+}
+
+// configureDialer applies dialing related options to transport.
+func (h *Handler) configureDialer(transport *http.Transport) {
+	dial := transport.DialContext
+	if h.dial != nil {
+		dial = h.dial
+	}
+	if dial == nil {
+		dial = (&net.Dialer{
+			Timeout:   time.Second * 30,
+			KeepAlive: time.Second * 30,
+		}).DialContext
+	}
+
+	if h.dnsCache != nil {
+		dial = h.dnsCache.dialContext(dial)
+	}
+	if h.maxFetchDepth > 0 {
+		dial = selfDial(dial)
+	}
+
+	transport.DialContext = dial
+}
+
+// configureConnections applies TransportSettings to transport.
+func (h *Handler) configureConnections(transport *http.Transport) {
+	s := h.transportSettings
+	if s == nil {
+		return
+	}
+
+	if s.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = s.MaxIdleConnsPerHost
+	}
+	if s.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = s.MaxConnsPerHost
+	}
+	if s.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = s.IdleConnTimeout
+	}
+	if s.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = s.TLSHandshakeTimeout
+	}
+}
+
+// configureTLS applies TLS related options to transport.
+func (h *Handler) configureTLS(transport *http.Transport) {
+	if h.tlsConfig != nil {
+		transport.TLSClientConfig = h.tlsConfig.Clone()
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	if h.clientCert != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*h.clientCert}
+	}
+	if h.rootCAs != nil {
+		transport.TLSClientConfig.RootCAs = h.rootCAs
+	}
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerClientCertificate(t *testing.T) {
+	cert, leaf := createCertificate(t)
+	untrusted, _ := createCertificate(t)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(leaf)
+
+	server := httptest.NewUnstartedServer(createServer(0).Config.Handler)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	for name, opts := range map[string][]Option{
+		"default":  {WithClientCertificate(cert, rootCAs)},
+		"per host": {WithClientCertificate(untrusted, rootCAs), WithClientCertificateFor("127.0.0.*", cert)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := httptest.NewServer(NewHandler(opts...))
+			defer s.Close()
+
+			resp, err := s.Client().Post(s.URL, "text/plain", getRequestBodyBuffer(getUrl(server.URL, 100, 0)))
+			if err != nil {
+				t.Fatalf("failed to make request: %s", err)
+			}
+			defer resp.Body.Close()
+
+			if err := checkResponse(resp, []int{100}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestHandlerTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(createServer(0).Config.Handler)
+	defer server.Close()
+
+	tests := map[string]struct {
+		opts      []Option
+		length    int
+		errorKind ErrorKind
+	}{
+		"untrusted": {
+			errorKind: ErrorKindTLS,
+		},
+		"insecure": {
+			opts:   []Option{WithTLSConfig(&tls.Config{InsecureSkipVerify: true})},
+			length: 100,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := httptest.NewServer(NewHandler(test.opts...))
+			defer s.Close()
+
+			results := fetchResults(t, s.URL, getRequestBodyBuffer(getUrl(server.URL, 100, 0)))
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(results))
+			}
+
+			if results[0].Length != test.length || results[0].ErrorKind != test.errorKind {
+				t.Errorf("unexpected result: %+v", results[0])
+			}
+		})
+	}
+}
+
+func TestHandlerHTTP2(t *testing.T) {
+	h2 := httptest.NewUnstartedServer(createServer(0).Config.Handler)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+
+	h1 := httptest.NewTLSServer(createServer(0).Config.Handler)
+	defer h1.Close()
+
+	insecure := WithTLSConfig(&tls.Config{InsecureSkipVerify: true})
+
+	tests := map[string]struct {
+		opts     []Option
+		url      string
+		protocol string
+		failed   bool
+	}{
+		"prefer": {
+			opts:     []Option{insecure, PreferHTTP2()},
+			url:      h2.URL,
+			protocol: "HTTP/2.0",
+		},
+		"prefer fallback": {
+			opts:     []Option{insecure, PreferHTTP2()},
+			url:      h1.URL,
+			protocol: "HTTP/1.1",
+		},
+		"force": {
+			opts:     []Option{insecure, ForceHTTP2()},
+			url:      h2.URL,
+			protocol: "HTTP/2.0",
+		},
+		"force unsupported": {
+			opts:   []Option{insecure, ForceHTTP2()},
+			url:    h1.URL,
+			failed: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := httptest.NewServer(NewHandler(test.opts...))
+			defer s.Close()
+
+			results := fetchResults(t, s.URL, getRequestBodyBuffer(getUrl(test.url, 100, 0)))
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(results))
+			}
+
+			if test.failed {
+				if results[0].Error == "" {
+					t.Errorf("expected error, got %+v", results[0])
+				}
+
+				return
+			}
+
+			if results[0].Protocol != test.protocol {
+				t.Errorf("expected protocol %s, got %+v", test.protocol, results[0])
+			}
+		})
+	}
+}
+
+func TestHandlerDialer(t *testing.T) {
+	server := createServer(0)
+
+	var dialed []string
+
+	s := httptest.NewServer(NewHandler(WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+
+		return nil, errors.New("dial is not allowed")
+	})))
+	defer s.Close()
+
+	results := fetchResults(t, s.URL, getRequestBodyBuffer(getUrl(server.URL, 100, 0)))
+	if len(results) != 1 || !strings.Contains(results[0].Error, "dial is not allowed") {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	if len(dialed) != 1 || dialed[0] != server.Listener.Addr().String() {
+		t.Errorf("unexpected dialed addresses: %v", dialed)
+	}
+}
+
+// createCertificate creates self-signed client certificate.
+func createCertificate(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, leaf
+}
+
+func TestHandlerTransportSettings(t *testing.T) {
+	transport := func(h *Handler) *http.Transport {
+		t.Helper()
+
+		tr, ok := h.client.Transport.(*http.Transport)
+		if !ok {
+			t.Fatalf("unexpected transport %T", h.client.Transport)
+		}
+
+		return tr
+	}
+
+	if tr := transport(NewHandler()); tr.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost {
+		t.Errorf("default transport is not tuned: %d idle connections per host", tr.MaxIdleConnsPerHost)
+	}
+
+	tr := transport(NewHandler(WithTransportSettings(TransportSettings{
+		MaxConnsPerHost: 8,
+		IdleConnTimeout: time.Minute,
+	})))
+	if tr.MaxConnsPerHost != 8 || tr.IdleConnTimeout != time.Minute {
+		t.Errorf("settings are not applied: %d, %s", tr.MaxConnsPerHost, tr.IdleConnTimeout)
+	}
+	if tr.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost || tr.TLSHandshakeTimeout != defaultTLSHandshakeTimeout {
+		t.Errorf("unset fields are changed: %d, %s", tr.MaxIdleConnsPerHost, tr.TLSHandshakeTimeout)
+	}
+	if defaultClient.Transport.(*http.Transport).MaxConnsPerHost != 0 {
+		t.Error("default transport is modified")
+	}
+}
+
+func TestHandlerRoundTripper(t *testing.T) {
+	rt := &http.Transport{}
+
+	if h := NewHandler(WithRoundTripper(rt)); h.client.Transport != rt {
+		t.Errorf("round tripper is not used: %T", h.client.Transport)
+	}
+
+	h := NewHandler(WithRoundTripper(rt), WithLoopProtection(3), WithLogger(log.New(ioutil.Discard, "", 0)))
+	if h.client.Transport == rt {
+		t.Error("round tripper is used along with loop protection")
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// workerPool runs tasks on fixed number of long-lived goroutines,
+// so fetching does not start goroutine per URL.
+type workerPool struct {
+	tasks chan func()
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// newWorkerPool creates new workerPool and starts its workers.
+func newWorkerPool(size int) *workerPool {
+	p := &workerPool{
+		tasks: make(chan func()),
+	}
+
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// work runs tasks until pool is closed.
+func (p *workerPool) work() {
+	defer p.wg.Done()
+
+	for task := range p.tasks {
+		task()
+	}
+}
+
+// submit waits for idle worker and runs task on it.
+// It must not be called after pool is closed.
+func (p *workerPool) submit(task func()) {
+	p.tasks <- task
+}
+
+// close stops workers and waits until running tasks complete.
+func (p *workerPool) close() {
+	p.once.Do(func() {
+		close(p.tasks)
+	})
+
+	p.wg.Wait()
+}
+
+// Close stops scheduled batches and workers started by WithWorkerPool
+// option, waiting until running fetches complete, and closes cassette
+// file. Handler must not serve requests after it is closed. Once Close
+// is called, /readyz endpoint served by Mux reports Handler is not ready.
+func (h *Handler) Close() error {
+	atomic.StoreInt32(&h.closed, 1)
+	// scheduled batches must be stopped before
+	// workers, since they submit fetches to them
+	h.schedules.close()
+
+	if h.workers != nil {
+		h.workers.close()
+	}
+	if h.cassette != nil {
+		return h.cassette.close()
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerWorkerPool(t *testing.T) {
+	var running, max int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for m := atomic.LoadInt32(&max); n > m && !atomic.CompareAndSwapInt32(&max, m, n); m = atomic.LoadInt32(&max) {
+		}
+
+		time.Sleep(time.Millisecond * 10)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	h := NewHandler(WithWorkerPool(3))
+	defer h.Close()
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	urls := make([]string, 10)
+	for i := range urls {
+		urls[i] = getUrl(server.URL, i, 0)
+	}
+
+	// batches share workers
+	done := make(chan []Result)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- fetchResults(t, s.URL, strings.NewReader(strings.Join(urls, "\n")))
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		results := <-done
+		if len(results) != len(urls) {
+			t.Fatalf("expected %d results, got %+v", len(urls), results)
+		}
+		for _, r := range results {
+			if r.Error != "" || r.Length != 5 {
+				t.Errorf("unexpected result: %+v", r)
+			}
+		}
+	}
+
+	if max != 3 {
+		t.Errorf("expected at most 3 simultaneous fetches, got %d", max)
+	}
+}
+
+func TestWorkerPoolClose(t *testing.T) {
+	p := newWorkerPool(2)
+
+	var done int32
+	for i := 0; i < 4; i++ {
+		p.submit(func() {
+			time.Sleep(time.Millisecond * 10)
+			atomic.AddInt32(&done, 1)
+		})
+	}
+
+	p.close()
+
+	if done != 4 {
+		t.Errorf("close does not wait for running tasks, %d are done", done)
+	}
+}
+
+func TestHandlerAbandonedBatch(t *testing.T) {
+	server := createServer(time.Second)
+	defer server.Close()
+
+	h := NewHandler(WithWorkerPool(1))
+	defer h.Close()
+
+	b, err := h.newBatch(httptest.NewRequest(http.MethodPost, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.targets = []target{{URL: getUrl(server.URL, 1, 0)}, {URL: getUrl(server.URL, 2, 0)}}
+
+	// results are never received, so the only worker
+	// is freed once batch is abandoned
+	results := h.fetch(b)
+	b.abandon()
+
+	b, _ = h.newBatch(httptest.NewRequest(http.MethodPost, "/", nil))
+	b.targets = []target{{URL: getUrl(server.URL, 3, 0)}}
+
+	select {
+	case r := <-h.fetch(b):
+		if r.Length != 3 {
+			t.Errorf("unexpected result: %+v", r)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("worker is held by abandoned batch")
+	}
+
+	for range results {
+	}
+}
+
+func TestWorkerPoolSlowConsumer(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	h := NewHandler(WithWorkerPool(1))
+	defer h.Close()
+
+	slow, err := h.internalBatch(context.Background(), "slow", []string{getUrl(server.URL, 10, 0), getUrl(server.URL, 10, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := h.internalBatch(context.Background(), "fast", []string{getUrl(server.URL, 10, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// results of slow batch are not received yet,
+	// but they do not hold the only worker
+	pending := h.fetch(slow)
+	time.Sleep(time.Millisecond * 100)
+	results := h.fetch(fast)
+
+	select {
+	case result := <-results:
+		if result.err != nil || result.Length != 10 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("fetch waits for worker held by slow consumer")
+	}
+
+	for range pending {
+	}
+	for range results {
+	}
+}
+
+func TestWorkerPoolQueuedResults(t *testing.T) {
+	server := createServer(0)
+	defer server.Close()
+
+	h := NewHandler(WithWorkerPool(2))
+	defer h.Close()
+
+	urls := make([]string, 50)
+	for i := range urls {
+		urls[i] = getUrl(server.URL, i, 0)
+	}
+
+	b, err := h.internalBatch(context.Background(), "slow", urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := runtime.NumGoroutine()
+
+	// results are not received until all URLs are fetched
+	results := h.fetch(b)
+
+	deadline := time.Now().Add(time.Second * 5)
+	for atomic.LoadInt64(&b.done) != int64(len(urls)) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if n := runtime.NumGoroutine() - before; n > 10 {
+		t.Errorf("expected results queued, got %d new goroutines", n)
+	}
+
+	var n int
+	for range results {
+		n++
+	}
+	if n != len(urls) {
+		t.Errorf("expected %d results, got %d", len(urls), n)
+	}
+}